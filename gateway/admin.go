@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// localDayStats 统计本地某一天的下发记录，用于与 ISMG 的统计对账
+// 按创建时间范围遍历，只访问当天的记录
+func localDayStats(day time.Time) map[string]int {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 1)
+	stats := map[string]int{"total": 0, "success": 0, "failed": 0, "waiting": 0}
+
+	filters := map[string]string{"from": start.Format(time.RFC3339), "to": end.Format(time.RFC3339)}
+	err := SCache.ForEachMessage("list_message", filters, func(mes *SmsMes) error {
+		stats["total"]++
+		switch mes.SubmitResult {
+		case 0:
+			stats["success"]++
+		case 65535:
+			stats["waiting"]++
+		default:
+			stats["failed"]++
+		}
+		return nil
+	})
+	if err != nil {
+		Warnf("[HTTP] 统计本地下发记录失败: %v", err)
+	}
+	return stats
+}
+
+// adminQuery 通过 CMPP_QUERY 查询 ISMG 的统计并与本地记录对账
+//
+// 参数: date（YYYYMMDD，默认当天）、type（0 总数 / 1 按业务）、code（业务代码，默认配置的 service_id）
+func adminQuery(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"result": -1, "error": "请求格式错误"})
+		return
+	}
+
+	date := r.Form.Get("date")
+	if date == "" {
+		date = time.Now().Format("20060102")
+	}
+	day, err := time.ParseInLocation("20060102", date, time.Local)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"result": -1, "error": "无效的日期（格式应为 YYYYMMDD）"})
+		return
+	}
+
+	queryType := QueryTypeTotal
+	code := ""
+	if r.Form.Get("type") == "1" {
+		queryType = QueryTypeService
+		code = r.Form.Get("code")
+		if code == "" {
+			code = config.ServiceId
+		}
+	}
+
+	cm := GetClientManager()
+	if cm == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]interface{}{"result": -4, "error": "当前上游通道不支持该操作"})
+		return
+	}
+	if !cm.IsReady() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"result": -2, "error": "CMPP 未连接，服务暂不可用"})
+		return
+	}
+
+	rsp, err := cm.Query(date, queryType, code)
+	if err != nil {
+		Errorf("[HTTP] CMPP 查询失败: %v", err)
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{"result": -3, "error": fmt.Sprintf("查询失败: %v", err)})
+		return
+	}
+
+	local := localDayStats(day)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"result": 0,
+		"error":  "",
+		"date":   date,
+		"type":   queryType,
+		"code":   code,
+		"ismg": map[string]uint32{
+			"mt_total_msg":  rsp.MtTlMsg,
+			"mt_total_user": rsp.MtTlUsr,
+			"mt_success":    rsp.MtScs,
+			"mt_waiting":    rsp.MtWt,
+			"mt_failed":     rsp.MtFl,
+			"mo_success":    rsp.MoScs,
+			"mo_waiting":    rsp.MoWt,
+			"mo_failed":     rsp.MoFl,
+		},
+		"local":       local,
+		"local_total": SCache.GetStats(),
+		// 正数表示 ISMG 记录的比本地多
+		"diff": map[string]int{
+			"total":   int(rsp.MtTlMsg) - local["total"],
+			"success": int(rsp.MtScs) - local["success"],
+			"failed":  int(rsp.MtFl) - local["failed"],
+		},
+	})
+}
+
+// adminCancel 通过 CMPP_CANCEL 删除 ISMG 中尚未下发的消息
+//
+// 参数: msgid（十进制或十六进制）
+func adminCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{"result": -1, "error": "仅支持 POST"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"result": -1, "error": "请求格式错误"})
+		return
+	}
+
+	msgId, err := ParseMsgId(r.Form.Get("msgid"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"result": -1, "error": "无效的消息ID"})
+		return
+	}
+
+	cm := GetClientManager()
+	if cm == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]interface{}{"result": -4, "error": "当前上游通道不支持该操作"})
+		return
+	}
+	if !cm.IsReady() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"result": -2, "error": "CMPP 未连接，服务暂不可用"})
+		return
+	}
+
+	ok, err := cm.Cancel(msgId)
+	if err != nil {
+		Errorf("[HTTP] CMPP 删除失败: %v", err)
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{"result": -3, "error": fmt.Sprintf("删除失败: %v", err)})
+		return
+	}
+	if !ok {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"result": 1, "error": "网关拒绝删除（消息可能已下发）"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"result": 0, "error": ""})
+}
@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestAdminCancelMarksCanceld 删除成功的消息应记为 CANCELD 并通知处理器，且可以按状态搜索
+func TestAdminCancelMarksCanceld(t *testing.T) {
+	cache := newTestBoltCache(t)
+	cache.AddSubmits(&SmsMes{Id: "c1", Dest: "13800000000", MsgId: "42", Created: time.Now()})
+
+	addr := startFakeISMG(t)
+	host, port, _ := net.SplitHostPort(addr)
+	cm := NewClientManager(&Config{CMPPHost: host, CMPPPort: port, User: "104221", Password: "secret"})
+	h := &recordingHandler{}
+	cm.SetHandler(h)
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	cm.StartReceiver()
+	defer cm.Shutdown()
+	oldManager := clientManager
+	clientManager = cm
+	defer func() { clientManager = oldManager }()
+
+	header := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	if rec, out := apiRequest(t, adminCancel, "POST", "/api/admin/cancel", "msgid=42", header); rec.Code != http.StatusOK {
+		t.Fatalf("Cancel failed: %d %v", rec.Code, out)
+	}
+	h.mu.Lock()
+	if len(h.receipts) != 1 || h.receipts[0].Id != "c1" || h.receipts[0].DeliveryStat != deliveryStatCanceled {
+		t.Errorf("Expected the cancellation to be reported as a receipt, got %+v", h.receipts)
+	}
+	h.mu.Unlock()
+
+	rec, out := apiRequest(t, apiMessages, "GET", "/api/v1/messages?delivery_stat=canceld", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Search failed: %d %v", rec.Code, out)
+	}
+	data := out["data"].([]interface{})
+	if len(data) != 1 || data[0].(map[string]interface{})["id"] != "c1" {
+		t.Errorf("Expected c1 to be found by delivery_stat=CANCELD, got %v", data)
+	}
+}
+
+func TestLocalDayStats(t *testing.T) {
+	cache := newTestBoltCache(t)
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	fixtures := []SmsMes{
+		{Id: "before", Created: day.Add(-time.Minute)},
+		{Id: "ok", Created: day.Add(time.Hour)},
+		{Id: "failed", Created: day.Add(2 * time.Hour), SubmitResult: 8},
+		{Id: "waiting", Created: day.Add(3 * time.Hour), SubmitResult: 65535},
+		{Id: "after", Created: day.AddDate(0, 0, 1)},
+	}
+	for i := range fixtures {
+		fixtures[i].Dest = "13800000000"
+		cache.AddSubmits(&fixtures[i])
+	}
+
+	stats := localDayStats(day.Add(12 * time.Hour))
+	want := map[string]int{"total": 3, "success": 1, "failed": 1, "waiting": 1}
+	for k, v := range want {
+		if stats[k] != v {
+			t.Errorf("stats[%s] = %d, want %d", k, stats[k], v)
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 消息列表接口的默认与最大每页条数
+	apiDefaultPageSize = 20
+	apiMaxPageSize     = 100
+	// 请求体大小上限
+	apiMaxBodySize = 64 << 10
+	// Idempotency-Key 的保留时间
+	apiIdempotencyTTL = 24 * time.Hour
+	// client_ref 的最大长度
+	apiMaxClientRefLen = 64
+)
+
+// apiError 是 JSON 接口的结构化错误
+type apiError struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// writeAPIError 输出 {"error": {...}} 形式的错误响应
+func writeAPIError(w http.ResponseWriter, status int, code, field, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": apiError{Code: code, Field: field, Message: message},
+	})
+}
+
+// writeValidationError 将参数验证错误转换为 400 响应，字段名取自 ValidationError.Field
+func writeValidationError(w http.ResponseWriter, err error) {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_param", ve.Field, ve.Message)
+		return
+	}
+	writeAPIError(w, http.StatusBadRequest, "invalid_param", "", err.Error())
+}
+
+// apiSubmitRequest 是 POST /api/v1/messages 的请求体
+type apiSubmitRequest struct {
+	Src       string `json:"src"`
+	Dest      string `json:"dest"`
+	Content   string `json:"content"`
+	ClientRef string `json:"client_ref"`
+}
+
+// apiMessage 是消息的 JSON 表示
+type apiMessage struct {
+	Id             string    `json:"id,omitempty"`
+	Src            string    `json:"src"`
+	Dest           string    `json:"dest"`
+	Content        string    `json:"content"`
+	MsgId          string    `json:"msg_id,omitempty"`
+	Channel        string    `json:"channel"`
+	Status         string    `json:"status"`
+	SubmitResult   uint32    `json:"submit_result"`
+	DeliveryResult uint32    `json:"delivery_result"`
+	DeliveryStat   string    `json:"delivery_stat,omitempty"`
+	ClientRef      string    `json:"client_ref,omitempty"`
+	Created        time.Time `json:"created"`
+	// 收到提交响应与状态报告的时间，尚未收到时省略
+	SubmittedAt *time.Time   `json:"submitted_at,omitempty"`
+	DeliveredAt *time.Time   `json:"delivered_at,omitempty"`
+	Segments    *segmentInfo `json:"segments,omitempty"`
+}
+
+// segmentInfo 描述短信内容的编码与按运营商规则拆分的条数
+type segmentInfo struct {
+	Encoding string `json:"encoding"` // ascii 或 ucs2
+	Length   int    `json:"length"`   // 按编码计算的字符数（UCS2 以 16 位为单位）
+	Count    int    `json:"count"`    // 拆分条数：ASCII 单条 160、长短信每条 153；UCS2 单条 70、长短信每条 67
+}
+
+// messageSegments 计算短信内容的拆分信息
+func messageSegments(content string) *segmentInfo {
+	format, b := encodeMsgContent(content)
+	info := &segmentInfo{Encoding: "ascii", Length: len(b), Count: 1}
+	single, multi := 160, 153
+	if format == msgFormatUCS2 {
+		info.Encoding = "ucs2"
+		info.Length = len(b) / 2
+		single, multi = 70, 67
+	}
+	if info.Length > single {
+		info.Count = (info.Length + multi - 1) / multi
+	}
+	return info
+}
+
+// optionalTime 将零值时间转换为 nil，使 JSON 中省略该字段
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// messageStatus 将提交结果与投递结果归纳为消息状态
+func messageStatus(mes *SmsMes) string {
+	switch {
+	case mes.SubmitResult == 65535:
+		return "pending"
+	case mes.SubmitResult != 0:
+		return "failed"
+	case mes.DelivleryResult == 65535:
+		return "submitted"
+	case mes.DelivleryResult == 0:
+		return "delivered"
+	default:
+		return "undelivered"
+	}
+}
+
+func newAPIMessage(mes *SmsMes, listName string) apiMessage {
+	m := apiMessage{
+		Id:             mes.Id,
+		Src:            mes.Src,
+		Dest:           mes.Dest,
+		Content:        mes.Content,
+		MsgId:          mes.MsgId,
+		Channel:        channelOf(mes),
+		SubmitResult:   mes.SubmitResult,
+		DeliveryResult: mes.DelivleryResult,
+		DeliveryStat:   mes.DeliveryStat,
+		ClientRef:      mes.ClientRef,
+		Created:        mes.Created,
+		SubmittedAt:    optionalTime(mes.SubmitTime),
+		DeliveredAt:    optionalTime(mes.ReceiptTime),
+		Segments:       messageSegments(mes.Content),
+		Status:         messageStatus(mes),
+	}
+	if listName == "list_mo" {
+		m.Status = "received"
+	}
+	return m
+}
+
+// idempotencyCache 记录 Idempotency-Key 对应的消息标识，重复提交返回 409
+type idempotencyCache struct {
+	mu    sync.Mutex
+	keys  map[string]idempotencyEntry
+	ttl   time.Duration
+	swept time.Time
+}
+
+type idempotencyEntry struct {
+	id      string
+	created time.Time
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{keys: make(map[string]idempotencyEntry), ttl: ttl}
+}
+
+// Reserve 登记 key，已存在且未过期时返回之前的消息标识和 false
+func (c *idempotencyCache) Reserve(key, id string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Sub(c.swept) >= time.Minute {
+		for k, e := range c.keys {
+			if now.Sub(e.created) >= c.ttl {
+				delete(c.keys, k)
+			}
+		}
+		c.swept = now
+	}
+	if e, ok := c.keys[key]; ok && now.Sub(e.created) < c.ttl {
+		return e.id, false
+	}
+	c.keys[key] = idempotencyEntry{id: id, created: now}
+	return id, true
+}
+
+// Release 撤销未能入队的登记
+func (c *idempotencyCache) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.keys, key)
+}
+
+var idempotencyKeys = newIdempotencyCache(apiIdempotencyTTL)
+
+// queuedMessages 记录已进入发送队列、尚未交给上游通道的消息，
+// 使提交响应中的 Location 在消息出队前也能查询到
+type queuedMessages struct {
+	mu   sync.Mutex
+	byId map[string]SmsMes
+}
+
+var sendQueue = &queuedMessages{byId: make(map[string]SmsMes)}
+
+// Add 登记入队的消息
+func (q *queuedMessages) Add(mes SmsMes) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.byId[mes.Id] = mes
+}
+
+// Remove 撤销登记：消息未能入队，或已交给上游通道处理
+func (q *queuedMessages) Remove(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.byId, id)
+}
+
+// Find 按网关标识或客户端的 client_ref 查找队列中的消息
+func (q *queuedMessages) Find(id, client string) (SmsMes, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if mes, ok := q.byId[id]; ok {
+		return mes, true
+	}
+	for _, mes := range q.byId {
+		if mes.ClientRef != "" && mes.ClientRef == id && mes.Client == client {
+			return mes, true
+		}
+	}
+	return SmsMes{}, false
+}
+
+// apiMessages 处理 /api/v1/messages：POST 提交短信，GET 查询列表
+func apiMessages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		apiSubmit(w, r)
+	case http.MethodGet:
+		apiListMessages(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "", "仅支持 GET 和 POST")
+	}
+}
+
+// apiSubmit 接受 JSON 请求体并放入发送队列
+//
+// 成功返回 201；参数错误 400；Idempotency-Key 重复 409；队列已满 429；上游未就绪 503
+func apiSubmit(w http.ResponseWriter, r *http.Request) {
+	var req apiSubmitRequest
+	dec := json.NewDecoder(io.LimitReader(r.Body, apiMaxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_json", "", "请求体不是有效的 JSON: "+err.Error())
+		return
+	}
+
+	content, err := ValidateSubmitParams(req.Src, req.Dest, req.Content)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	if !IsCmppReady() {
+		writeAPIError(w, http.StatusServiceUnavailable, "service_unavailable", "", "上游通道未连接，服务暂不可用")
+		return
+	}
+
+	client := clientFromRequest(r)
+	src, err := ValidateClientExtCode(client, req.Src)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	if len(req.ClientRef) > apiMaxClientRefLen {
+		writeAPIError(w, http.StatusBadRequest, "invalid_param", "client_ref", "client_ref 最长 "+strconv.Itoa(apiMaxClientRefLen)+" 个字符")
+		return
+	}
+
+	mes := SmsMes{
+		Id:              newMessageId(),
+		Src:             src,
+		Dest:            req.Dest,
+		Content:         content,
+		ClientRef:       req.ClientRef,
+		Created:         time.Now(),
+		SubmitResult:    65535,
+		DelivleryResult: 65535,
+	}
+	key := r.Header.Get("Idempotency-Key")
+	if client != nil {
+		mes.Client = client.Name
+		if key != "" {
+			// 不同客户端的 Idempotency-Key 互不影响
+			key = client.Name + ":" + key
+		}
+	}
+	if key != "" {
+		if id, ok := idempotencyKeys.Reserve(key, mes.Id); !ok {
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"id":    id,
+				"error": apiError{Code: "duplicate_request", Message: "Idempotency-Key 已被使用"},
+			})
+			return
+		}
+	}
+
+	// 入队前登记，发送协程取出后可能立即处理完并撤销登记
+	sendQueue.Add(mes)
+	select {
+	case Messages <- mes:
+	default:
+		sendQueue.Remove(mes.Id)
+		if key != "" {
+			idempotencyKeys.Release(key)
+		}
+		w.Header().Set("Retry-After", "1")
+		writeAPIError(w, http.StatusTooManyRequests, "queue_full", "", "发送队列已满，请稍后重试")
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/messages/"+mes.Id)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"id": mes.Id, "status": "queued"})
+}
+
+// apiListMessages 分页查询消息列表
+//
+// 参数: type（mt 下发 / mo 上行，默认 mt）、page、page_size，以及与列表页相同的搜索条件
+func apiListMessages(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_param", "", "请求格式错误")
+		return
+	}
+
+	listName := "list_message"
+	switch r.Form.Get("type") {
+	case "", "mt":
+	case "mo":
+		listName = "list_mo"
+	default:
+		writeAPIError(w, http.StatusBadRequest, "invalid_param", "type", "type 仅支持 mt 或 mo")
+		return
+	}
+
+	page, err := ValidatePageParam(r.Form.Get("page"))
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	size, err := ValidatePageSize(r.Form.Get("page_size"), apiDefaultPageSize)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	filters, err := listFilters(r, listName)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	if r.Form.Has("cursor") {
+		if r.Form.Get("page") != "" {
+			writeAPIError(w, http.StatusBadRequest, "invalid_param", "cursor", "cursor 与 page 不能同时使用")
+			return
+		}
+		apiListByCursor(w, r.Form.Get("cursor"), listName, filters, size)
+		return
+	}
+
+	count, list := queryList(listName, filters, page, size)
+	data := make([]apiMessage, 0, len(*list))
+	for i := range *list {
+		data = append(data, newAPIMessage(&(*list)[i], listName))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":      data,
+		"page":      page,
+		"page_size": size,
+		"total":     count,
+	})
+}
+
+// errInvalidCursor 表示游标无法解析或不属于当前列表
+var errInvalidCursor = &ValidationError{Field: "cursor", Message: "无效的游标"}
+
+// encodeCursor 将列表名与记录在存储中的位置编码为不透明的游标
+func encodeCursor(listName string, pos []byte) string {
+	return base64.RawURLEncoding.EncodeToString(append([]byte(listName+":"), pos...))
+}
+
+// decodeCursor 解析游标，空字符串表示从最新的记录开始
+func decodeCursor(listName, cursor string) ([]byte, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	prefix := listName + ":"
+	if err != nil || len(raw) <= len(prefix) || string(raw[:len(prefix)]) != prefix {
+		return nil, errInvalidCursor
+	}
+	return raw[len(prefix):], nil
+}
+
+// apiListByCursor 按游标分页返回消息，不计算总数，翻页速度与深度无关
+//
+// 响应中的 next_cursor 为空表示没有更多记录；翻页期间新写入的消息不会导致重复或遗漏，
+// 也不会出现在后续页中（从头重新请求即可看到）。等待提交响应的消息不在结果中
+func apiListByCursor(w http.ResponseWriter, cursor, listName string, filters map[string]string, size int) {
+	after, err := decodeCursor(listName, cursor)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	list, next, err := SCache.PageMessages(listName, filters, after, size)
+	if err != nil {
+		var ve *ValidationError
+		if errors.As(err, &ve) {
+			writeValidationError(w, err)
+			return
+		}
+		Errorf("[HTTP] 分页查询 %s 失败: %v", listName, err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "", "查询失败")
+		return
+	}
+	data := make([]apiMessage, 0, len(list))
+	for i := range list {
+		data = append(data, newAPIMessage(&list[i], listName))
+	}
+	nextCursor := ""
+	if next != nil {
+		nextCursor = encodeCursor(listName, next)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":        data,
+		"page_size":   size,
+		"next_cursor": nextCursor,
+		"has_more":    next != nil,
+	})
+}
+
+// apiGetMessage 处理 GET /api/v1/messages/{id}
+//
+// id 依次按网关消息标识、ISMG MsgId、提交时的 client_ref 查找；
+// 管理客户端按 client_ref 查找其他客户端的消息时需传 client 参数
+func apiGetMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "", "仅支持 GET")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_param", "", "请求格式错误")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/messages/")
+	if id == "" || strings.Contains(id, "/") {
+		writeAPIError(w, http.StatusNotFound, "not_found", "", "消息不存在")
+		return
+	}
+
+	mes, ok := findMessage(id, scopeClient(r))
+	if c := clientFromRequest(r); ok && c != nil && !c.Admin && mes.Client != c.Name {
+		ok = false
+	}
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "not_found", "", "消息不存在")
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIMessage(&mes, "list_message"))
+}
+
+// findMessage 查找下发记录：按消息流转的顺序依次查发送队列、等待响应的消息，
+// 最后通过存储的索引按网关标识、MsgId、client_ref 定位，消息在两步之间转移时也不会漏查
+func findMessage(id, client string) (SmsMes, bool) {
+	if mes, ok := sendQueue.Find(id, client); ok {
+		return mes, true
+	}
+
+	for _, key := range []string{indexById + id, clientRefKey(client, id)} {
+		if mes, ok := SCache.LookupWait(key); ok {
+			return mes, true
+		}
+	}
+
+	for _, key := range []string{indexById + id, indexByMsgId + id, clientRefKey(client, id)} {
+		if mes, ok := SCache.LookupMessage(key); ok {
+			return mes, true
+		}
+	}
+	return SmsMes{}, false
+}
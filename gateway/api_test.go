@@ -0,0 +1,439 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func apiRequest(t *testing.T, h http.HandlerFunc, method, target, body string, header map[string]string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	var out map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("Invalid JSON response %q: %v", rec.Body.String(), err)
+	}
+	return rec, out
+}
+
+// drainMessages 清空测试期间写入发送队列的消息
+func drainMessages(t *testing.T) {
+	t.Cleanup(func() {
+		for {
+			select {
+			case mes := <-Messages:
+				sendQueue.Remove(mes.Id)
+			default:
+				return
+			}
+		}
+	})
+}
+
+func TestAPISubmitStatusCodes(t *testing.T) {
+	oldUpstream := upstream
+	upstream = nil
+	t.Cleanup(func() { upstream = oldUpstream })
+	newTestBoltCache(t)
+	drainMessages(t)
+
+	valid := `{"dest":"13800000000","content":"hello"}`
+	if rec, _ := apiRequest(t, apiMessages, "POST", "/api/v1/messages", valid, nil); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when upstream is not ready, got %d", rec.Code)
+	}
+
+	upstream = &stubChannel{pipeline: newMessagePipeline(ChannelCMPP)}
+	rec, out := apiRequest(t, apiMessages, "POST", "/api/v1/messages", `{"dest":"123","content":"hello"}`, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for invalid dest, got %d", rec.Code)
+	}
+	if e := out["error"].(map[string]interface{}); e["field"] != "dest" || e["code"] != "invalid_param" {
+		t.Errorf("Unexpected error body: %v", out)
+	}
+	if rec, _ := apiRequest(t, apiMessages, "POST", "/api/v1/messages", `{"dest":`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for malformed JSON, got %d", rec.Code)
+	}
+
+	key := map[string]string{"Idempotency-Key": "order-1"}
+	rec, out = apiRequest(t, apiMessages, "POST", "/api/v1/messages", valid, key)
+	if rec.Code != http.StatusCreated || out["id"] == "" || rec.Header().Get("Location") != "/api/v1/messages/"+out["id"].(string) {
+		t.Fatalf("Expected 201 with id and Location, got %d %v", rec.Code, out)
+	}
+	// 出队前 Location 即可查询
+	if rec, got := apiRequest(t, apiGetMessage, "GET", rec.Header().Get("Location"), "", nil); rec.Code != http.StatusOK || got["status"] != "pending" {
+		t.Errorf("Expected queued message at Location, got %d %v", rec.Code, got)
+	}
+	mes := <-Messages
+	if mes.Id != out["id"] || mes.Dest != "13800000000" {
+		t.Errorf("Unexpected queued message: %+v", mes)
+	}
+	rec, dup := apiRequest(t, apiMessages, "POST", "/api/v1/messages", valid, key)
+	if rec.Code != http.StatusConflict || dup["id"] != out["id"] {
+		t.Errorf("Expected 409 with original id, got %d %v", rec.Code, dup)
+	}
+
+	for i := 0; i < cap(Messages); i++ {
+		Messages <- SmsMes{}
+	}
+	rec, out = apiRequest(t, apiMessages, "POST", "/api/v1/messages", `{"dest":"13800000000","content":"hello","client_ref":"full-1"}`, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 when queue is full, got %d", rec.Code)
+	}
+	if _, ok := findMessage("full-1", ""); ok {
+		t.Errorf("Rejected message should not stay registered as queued")
+	}
+}
+
+func TestAPIListAndGetMessage(t *testing.T) {
+	newTestBoltCache(t)
+	SCache.AddSubmits(&SmsMes{Id: "a1", Src: "01", Dest: "13800000000", Content: "hi", MsgId: "100", DelivleryResult: 0, DeliveryStat: "DELIVRD"})
+	SCache.AddSubmits(&SmsMes{Id: "a2", Dest: "13900000000", Content: "yo", MsgId: "SEND_ERROR", SubmitResult: 254, DelivleryResult: 65535})
+	SCache.AddMoList(&SmsMes{Src: "13800000000", Dest: "10659", Content: "reply"})
+
+	rec, out := apiRequest(t, apiMessages, "GET", "/api/v1/messages?page_size=1", "", nil)
+	if rec.Code != http.StatusOK || out["total"].(float64) != 2 || len(out["data"].([]interface{})) != 1 {
+		t.Fatalf("Unexpected list response: %d %v", rec.Code, out)
+	}
+	_, out = apiRequest(t, apiMessages, "GET", "/api/v1/messages?dest=13900000000", "", nil)
+	data := out["data"].([]interface{})
+	if len(data) != 1 || data[0].(map[string]interface{})["status"] != "failed" {
+		t.Errorf("Unexpected filtered list: %v", out)
+	}
+	_, out = apiRequest(t, apiMessages, "GET", "/api/v1/messages?type=mo", "", nil)
+	if data := out["data"].([]interface{}); len(data) != 1 || data[0].(map[string]interface{})["status"] != "received" {
+		t.Errorf("Unexpected MO list: %v", out)
+	}
+	if rec, _ := apiRequest(t, apiMessages, "GET", "/api/v1/messages?page_size=1000", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for oversized page, got %d", rec.Code)
+	}
+
+	rec, out = apiRequest(t, apiGetMessage, "GET", "/api/v1/messages/a1", "", nil)
+	if rec.Code != http.StatusOK || out["msg_id"] != "100" || out["status"] != "delivered" {
+		t.Errorf("Unexpected message: %d %v", rec.Code, out)
+	}
+	if rec, _ := apiRequest(t, apiGetMessage, "GET", "/api/v1/messages/missing", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown id, got %d", rec.Code)
+	}
+}
+
+func TestAPIGetMessageLookup(t *testing.T) {
+	newTestBoltCache(t)
+	p := newMessagePipeline(ChannelCMPP)
+	long := strings.Repeat("长", 80)
+	mes := SmsMes{Id: "g1", Dest: "13800000000", Content: long, ClientRef: "order-1", Created: time.Now(), SubmitResult: 65535, DelivleryResult: 65535}
+	p.addPending(1, 1, &mes)
+
+	// 等待响应期间可按 client_ref 查到
+	rec, out := apiRequest(t, apiGetMessage, "GET", "/api/v1/messages/order-1", "", nil)
+	if rec.Code != http.StatusOK || out["status"] != "pending" || out["submitted_at"] != nil {
+		t.Fatalf("Unexpected pending message: %d %v", rec.Code, out)
+	}
+
+	p.submitResponded(1, 1, "12345", 0)
+	p.receiptReceived(SmsMes{MsgId: "12345", DelivleryResult: 0, DeliveryStat: "DELIVRD"})
+
+	for _, id := range []string{"g1", "12345", "order-1"} {
+		rec, out := apiRequest(t, apiGetMessage, "GET", "/api/v1/messages/"+id, "", nil)
+		if rec.Code != http.StatusOK || out["id"] != "g1" || out["status"] != "delivered" || out["client_ref"] != "order-1" {
+			t.Errorf("Lookup %s: %d %v", id, rec.Code, out)
+			continue
+		}
+		if out["submitted_at"] == nil || out["delivered_at"] == nil {
+			t.Errorf("Lookup %s: expected timestamps, got %v", id, out)
+		}
+		seg := out["segments"].(map[string]interface{})
+		if seg["encoding"] != "ucs2" || seg["length"].(float64) != 80 || seg["count"].(float64) != 2 {
+			t.Errorf("Lookup %s: unexpected segments %v", id, seg)
+		}
+	}
+
+	// client_ref 只在所属客户端内有效
+	if rec, _ := apiRequest(t, apiGetMessage, "GET", "/api/v1/messages/order-1?client=other", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for client_ref of another client, got %d", rec.Code)
+	}
+}
+
+// TestFindMessageAcrossStages 消息从发送队列、等待响应到入库的每个阶段都能查到
+func TestFindMessageAcrossStages(t *testing.T) {
+	newTestBoltCache(t)
+	p := newMessagePipeline(ChannelCMPP)
+	mes := SmsMes{Id: "s1", Dest: "13800000000", ClientRef: "ref-1", Client: "acme", Created: time.Now(), SubmitResult: 65535}
+
+	sendQueue.Add(mes)
+	if got, ok := findMessage("ref-1", "acme"); !ok || got.Id != "s1" {
+		t.Fatalf("Expected queued message, got %+v %v", got, ok)
+	}
+
+	p.addPending(1, 1, &mes)
+	sendQueue.Remove(mes.Id)
+	if got, ok := findMessage("s1", ""); !ok || got.SubmitResult != 65535 {
+		t.Fatalf("Expected pending message, got %+v %v", got, ok)
+	}
+
+	// 写入记录与删除等待条目在同一事务中完成
+	p.submitResponded(1, 1, "600", 0)
+	if n := len(SCache.GetWaitList()); n != 0 {
+		t.Errorf("Expected wait cache to be empty, got %d", n)
+	}
+	if _, ok := SCache.LookupWait(indexById + "s1"); ok {
+		t.Error("Expected wait index to be cleared with the wait entry")
+	}
+	for _, id := range []string{"s1", "600"} {
+		if got, ok := findMessage(id, "acme"); !ok || got.Id != "s1" || got.SubmitResult != 0 {
+			t.Errorf("Lookup %s: got %+v %v", id, got, ok)
+		}
+	}
+	if _, err := SCache.CompleteWaitCache(1, 1, func(*SmsMes) {}); err == nil {
+		t.Error("Expected completing a finished wait entry to fail")
+	}
+}
+
+func TestAPIListByCursor(t *testing.T) {
+	newTestBoltCache(t)
+	for i := 0; i < 7; i++ {
+		SCache.AddSubmits(&SmsMes{Id: fmt.Sprintf("old%d", i), Dest: "13800000000", Content: "x", SubmitResult: uint32(i % 2)})
+	}
+
+	// 翻页期间写入的新消息不影响后续页
+	seen := make(map[string]bool)
+	cursor := ""
+	for pages := 0; ; pages++ {
+		rec, out := apiRequest(t, apiMessages, "GET", "/api/v1/messages?page_size=3&cursor="+cursor, "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Unexpected response: %d %v", rec.Code, out)
+		}
+		if _, ok := out["total"]; ok {
+			t.Error("Cursor pages should not compute total")
+		}
+		for _, m := range out["data"].([]interface{}) {
+			id := m.(map[string]interface{})["id"].(string)
+			if seen[id] || strings.HasPrefix(id, "new") {
+				t.Errorf("Unexpected message %s on page %d", id, pages)
+			}
+			seen[id] = true
+		}
+		SCache.AddSubmits(&SmsMes{Id: fmt.Sprintf("new%d", pages), Dest: "13800000000", Content: "x"})
+		cursor = out["next_cursor"].(string)
+		if cursor == "" {
+			if out["has_more"] != false || pages != 2 {
+				t.Errorf("Expected 3 pages, last page %d: %v", pages, out)
+			}
+			break
+		}
+	}
+	if len(seen) != 7 {
+		t.Errorf("Expected 7 messages, got %d", len(seen))
+	}
+
+	// 最后一页刚好满页时没有下一页
+	_, out := apiRequest(t, apiMessages, "GET", "/api/v1/messages?status=1&page_size=3&cursor=", "", nil)
+	if len(out["data"].([]interface{})) != 3 || out["next_cursor"] != "" {
+		t.Errorf("Expected exactly 3 failed messages and no next cursor: %v", out)
+	}
+	_, out = apiRequest(t, apiMessages, "GET", "/api/v1/messages?status=1&page_size=2&cursor=", "", nil)
+	_, out = apiRequest(t, apiMessages, "GET", "/api/v1/messages?status=1&page_size=2&cursor="+out["next_cursor"].(string), "", nil)
+	if data := out["data"].([]interface{}); len(data) != 1 || data[0].(map[string]interface{})["id"] != "old1" {
+		t.Errorf("Unexpected filtered second page: %v", out)
+	}
+
+	_, out = apiRequest(t, apiMessages, "GET", "/api/v1/messages?page_size=1&cursor=", "", nil)
+	mtCursor := out["next_cursor"].(string)
+	for _, query := range []string{"cursor=bad!", "cursor=" + encodeCursor("list_message", nil), "type=mo&cursor=" + mtCursor, "page=2&cursor=" + mtCursor} {
+		if rec, _ := apiRequest(t, apiMessages, "GET", "/api/v1/messages?"+query, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestAPIListTimeRangeAndStatus(t *testing.T) {
+	cache := newTestBoltCache(t)
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	fixtures := []SmsMes{
+		{Id: "m1", Created: day.Add(-time.Hour), DeliveryStat: "DELIVRD"},
+		{Id: "m2", Created: day, DeliveryStat: "DELIVRD"},
+		{Id: "m3", Created: day.Add(30 * time.Minute), SubmitResult: 8},
+		{Id: "m4", Created: day.Add(time.Hour), DeliveryStat: "UNDELIV"},
+	}
+	for i := range fixtures {
+		fixtures[i].Dest = "13800000000"
+		cache.AddSubmits(&fixtures[i])
+	}
+	// 建立创建时间索引之前写入的记录，启动时补建索引
+	cache.db.Update(func(tx *bolt.Tx) error {
+		tx.Bucket(indexBucket).Delete(createdBackfilled)
+		b := tx.Bucket(messageBucket)
+		v, _ := json.Marshal(SmsMes{Id: "legacy", Dest: "13800000000", Created: day.Add(59 * time.Minute)})
+		if err := b.Put(timeKey(tx, b), v); err != nil {
+			return err
+		}
+		return backfillCreatedIndex(tx)
+	})
+
+	ids := func(query string) string {
+		t.Helper()
+		rec, out := apiRequest(t, apiMessages, "GET", "/api/v1/messages?"+query, "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected response %d %v", query, rec.Code, out)
+		}
+		var got []string
+		for _, m := range out["data"].([]interface{}) {
+			got = append(got, m.(map[string]interface{})["id"].(string))
+		}
+		return strings.Join(got, ",")
+	}
+	tests := map[string]string{
+		"from=2026-03-01T10:00&to=2026-03-01T11:00":                      "legacy,m3,m2",
+		"from=2026-03-01T10:00&to=2026-03-01T11:00&cursor=":              "legacy,m3,m2",
+		"from=2026-03-01+10:00:00":                                       "m4,legacy,m3,m2",
+		"from=2026-03-01+10:00:00&cursor=":                               "legacy,m4,m3,m2",
+		"to=2026-03-01T10:00":                                            "m1",
+		"submit_result=8":                                                "m3",
+		"delivery_stat=delivrd&from=2026-03-01T09:30":                    "m2",
+		"delivery_stat=UNDELIV&to=2026-03-01":                            "m4",
+		"from=2026-03-01T10:00&to=2026-03-01T11:00&status=0&page_size=1": "legacy",
+	}
+	for query, want := range tests {
+		if got := ids(query); got != want {
+			t.Errorf("%s: got %s, want %s", query, got, want)
+		}
+	}
+	if rec, out := apiRequest(t, apiMessages, "GET", "/api/v1/messages?from=2026-03-01T10:00&page_size=1", "", nil); rec.Code != http.StatusOK || out["total"] != float64(4) {
+		t.Errorf("Expected total 4, got %v", out)
+	}
+
+	for _, query := range []string{"from=yesterday", "from=2026-03-02&to=2026-03-01", "submit_result=-1", "delivery_stat=TOOLONGSTAT", "delivery_stat=A%20B"} {
+		if rec, _ := apiRequest(t, apiMessages, "GET", "/api/v1/messages?"+query, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestBoltCacheTimeRangeSeek(t *testing.T) {
+	cache := newTestBoltCache(t)
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 10; i++ {
+		cache.AddMoList(&SmsMes{Id: fmt.Sprintf("mo%d", i), Src: "13900000000", Created: day.Add(time.Duration(i) * time.Hour)})
+	}
+	// 索引时间早于范围、记录的创建时间却在范围内的索引项不应被访问，说明遍历在范围起点之前停止
+	cache.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(moBucket)
+		v, _ := json.Marshal(SmsMes{Id: "stray", Src: "13900000000", Created: day.Add(3 * time.Hour)})
+		key := timeKey(tx, b)
+		if err := b.Put(key, v); err != nil {
+			return err
+		}
+		return tx.Bucket(moCreatedBucket).Put(createdKey(day.Add(-time.Hour), key), nil)
+	})
+
+	filters := map[string]string{"from": "2026-03-01 12:00:00", "to": "2026-03-01 15:00:00"}
+	var got []string
+	cache.ForEachMessage("list_mo", filters, func(mes *SmsMes) error {
+		got = append(got, mes.Id)
+		return nil
+	})
+	if strings.Join(got, ",") != "mo4,mo3,mo2" {
+		t.Errorf("ForEachMessage got %v", got)
+	}
+	if n := cache.GetSearchCount("list_mo", filters); n != 3 {
+		t.Errorf("GetSearchCount = %d, want 3", n)
+	}
+	if list := cache.SearchList("list_mo", filters, 1, 1); len(*list) != 1 || (*list)[0].Id != "mo3" {
+		t.Errorf("SearchList second row = %v", *list)
+	}
+	// 翻页按入库顺序遍历记录本身，不经过索引
+	page, next, _ := cache.PageMessages("list_mo", filters, nil, 2)
+	if len(page) != 2 || page[0].Id != "stray" || next == nil {
+		t.Fatalf("Unexpected first page %v", page)
+	}
+	if page, next, _ = cache.PageMessages("list_mo", filters, next, 2); len(page) != 2 || page[1].Id != "mo2" || next != nil {
+		t.Errorf("Unexpected second page %v", page)
+	}
+}
+
+// TestPageMessagesLateInsert 收到提交响应才入库的记录创建时间较早，翻页过程中写入也不会打乱已返回的位置
+func TestPageMessagesLateInsert(t *testing.T) {
+	cache := newTestBoltCache(t)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		cache.AddSubmits(&SmsMes{Id: fmt.Sprintf("s%d", i), Created: now.Add(time.Duration(i) * time.Second)})
+	}
+
+	page, next, _ := cache.PageMessages("list_message", nil, nil, 2)
+	if len(page) != 2 || page[0].Id != "s2" || page[1].Id != "s1" {
+		t.Fatalf("Unexpected first page %v", page)
+	}
+	cache.AddSubmits(&SmsMes{Id: "late", Created: now.Add(-time.Minute)})
+
+	if page, next, _ = cache.PageMessages("list_message", nil, next, 2); len(page) != 1 || page[0].Id != "s0" || next != nil {
+		t.Errorf("Unexpected second page %v", page)
+	}
+	if page, _, _ = cache.PageMessages("list_message", nil, nil, 1); len(page) != 1 || page[0].Id != "late" {
+		t.Errorf("Expected the late record at the head of the list, got %v", page)
+	}
+	// 按创建时间的范围查询仍能找到
+	filters := map[string]string{"to": now.Format("2006-01-02 15:04:05")}
+	if list := cache.SearchList("list_message", filters, 0, 10); len(*list) != 1 || (*list)[0].Id != "late" {
+		t.Errorf("Expected time range search to find the late record, got %v", *list)
+	}
+}
+
+func TestSearchFilterParsedOnce(t *testing.T) {
+	f := newSearchFilter(map[string]string{"from": "2026-03-01 12:00:00", "to": "2026-03-01 15:00:00", "submit_result": "0"})
+	if f.from.IsZero() || f.to.IsZero() || f.submitResult == nil || f.msgId != nil {
+		t.Fatalf("Unexpected parsed filter: %+v", f)
+	}
+	at := time.Date(2026, 3, 1, 13, 0, 0, 0, time.Local)
+	if !f.matchExact(&SmsMes{Created: at}) || f.matchExact(&SmsMes{Created: at.Add(2 * time.Hour)}) || f.matchExact(&SmsMes{Created: at, SubmitResult: 1}) {
+		t.Error("Unexpected time range or submit result match")
+	}
+	if newSearchFilter(map[string]string{"msgid": "not-a-msgid~"}).matchExact(&SmsMes{Created: at}) {
+		t.Error("Unparsable msgid filter should match nothing")
+	}
+}
+
+func TestSearchFilterPastRange(t *testing.T) {
+	from := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	f := newSearchFilter(map[string]string{"from": from.Format("2006-01-02 15:04:05")})
+	// 创建早于 from、写入晚于 from 的记录之后可能还有匹配的记录
+	if f.pastSearchRange(&SmsMes{Created: from.Add(-time.Hour), SubmitTime: from.Add(time.Second)}) {
+		t.Error("Record written after from should not stop the scan")
+	}
+	if !f.pastSearchRange(&SmsMes{Created: from.Add(-time.Hour), SubmitTime: from.Add(-time.Hour)}) {
+		t.Error("Record written well before from should stop the scan")
+	}
+	if !f.pastSearchRange(&SmsMes{Created: from.Add(-time.Hour)}) {
+		t.Error("Record without submit time should fall back to its creation time")
+	}
+	if newSearchFilter(nil).pastSearchRange(&SmsMes{Created: from.Add(-time.Hour)}) {
+		t.Error("Filter without from should never stop the scan")
+	}
+}
+
+func TestMessageSegments(t *testing.T) {
+	tests := []struct {
+		content  string
+		encoding string
+		count    int
+	}{
+		{strings.Repeat("a", 160), "ascii", 1},
+		{strings.Repeat("a", 161), "ascii", 2},
+		{strings.Repeat("中", 70), "ucs2", 1},
+		{strings.Repeat("中", 135), "ucs2", 3},
+	}
+	for _, tt := range tests {
+		if got := messageSegments(tt.content); got.Encoding != tt.encoding || got.Count != tt.count {
+			t.Errorf("messageSegments(len=%d) = %+v, want %s/%d", len(tt.content), got, tt.encoding, tt.count)
+		}
+	}
+}
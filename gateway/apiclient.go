@@ -0,0 +1,256 @@
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type apiClientKey struct{}
+
+// apiClients 返回配置的 API 客户端，为空表示不启用 API Key 认证
+func apiClients() []APIClient {
+	if config == nil {
+		return nil
+	}
+	return config.APIClients
+}
+
+// clientNames 返回所有客户端名称，供页面的筛选下拉框使用
+func clientNames() []string {
+	clients := apiClients()
+	names := make([]string, 0, len(clients))
+	for _, c := range clients {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// requestAPIKey 从 X-API-Key 或 Authorization: Bearer 请求头中取出密钥
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// findAPIClient 按密钥查找客户端，逐个做常量时间比较
+func findAPIClient(key string) *APIClient {
+	clients := apiClients()
+	var found *APIClient
+	for i := range clients {
+		if subtle.ConstantTimeCompare([]byte(clients[i].Key), []byte(key)) == 1 {
+			found = &clients[i]
+		}
+	}
+	return found
+}
+
+// allowIP 检查来源地址是否在客户端的 IP 白名单内
+func (c *APIClient) allowIP(remoteAddr string) bool {
+	if len(c.AllowIPs) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, allowed := range c.AllowIPs {
+		if strings.Contains(allowed, "/") {
+			if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowCert 检查客户端证书，未配置 cert_cn 时不要求证书
+func (c *APIClient) allowCert(state *tls.ConnectionState) bool {
+	if c.CertCN == "" {
+		return true
+	}
+	for _, name := range peerCertNames(state) {
+		if name == c.CertCN {
+			return true
+		}
+	}
+	return false
+}
+
+// validateExtCodeRange 检查扩展码范围的配置：须为数字串，两端都配置时位数相同且起始值不大于结束值
+func (c *APIClient) validateExtCodeRange() error {
+	for _, v := range []string{c.ExtCodeMin, c.ExtCodeMax} {
+		if v != "" && !isNumeric(v) {
+			return fmt.Errorf("api client %s: ext code %q is not numeric", c.Name, v)
+		}
+	}
+	if c.ExtCodeMin != "" && c.ExtCodeMax != "" {
+		if len(c.ExtCodeMin) != len(c.ExtCodeMax) {
+			return fmt.Errorf("api client %s: ext_code_min and ext_code_max must have the same length", c.Name)
+		}
+		if c.ExtCodeMin > c.ExtCodeMax {
+			return fmt.Errorf("api client %s: ext_code_min is greater than ext_code_max", c.Name)
+		}
+	}
+	return nil
+}
+
+// extCodeLen 返回客户端扩展码的位数，未限制范围时为 0
+func (c *APIClient) extCodeLen() int {
+	if c.ExtCodeMin != "" {
+		return len(c.ExtCodeMin)
+	}
+	return len(c.ExtCodeMax)
+}
+
+// inExtCodeRange 检查扩展码是否在客户端允许的范围内（位数相同的数字串按字典序比较）
+// 只配置了一端时另一端不限制
+func (c *APIClient) inExtCodeRange(ext string) bool {
+	n := c.extCodeLen()
+	if n == 0 {
+		return true
+	}
+	if len(ext) != n {
+		return false
+	}
+	return (c.ExtCodeMin == "" || ext >= c.ExtCodeMin) && (c.ExtCodeMax == "" || ext <= c.ExtCodeMax)
+}
+
+// ValidateClientExtCode 检查客户端提交的扩展码，未提交时使用范围的起始值
+func ValidateClientExtCode(c *APIClient, src string) (string, error) {
+	if c == nil {
+		return src, nil
+	}
+	if src == "" {
+		if c.ExtCodeMin == "" && c.ExtCodeMax != "" {
+			return strings.Repeat("0", len(c.ExtCodeMax)), nil
+		}
+		return c.ExtCodeMin, nil
+	}
+	if !c.inExtCodeRange(src) {
+		return "", &ValidationError{
+			Field:   "src",
+			Message: fmt.Sprintf("扩展码 %s 不在客户端 %s 允许的范围 %s-%s 内", src, c.Name, c.ExtCodeMin, c.ExtCodeMax),
+		}
+	}
+	return src, nil
+}
+
+// clientForDest 按上行短信目的号码中的扩展码确定所属客户端
+func clientForDest(dest string) string {
+	if config == nil {
+		return ""
+	}
+	ext, ok := strings.CutPrefix(dest, config.SmsAccessNo)
+	if !ok {
+		return ""
+	}
+	for _, c := range config.APIClients {
+		n := c.extCodeLen()
+		if n == 0 || len(ext) < n {
+			continue
+		}
+		if c.inExtCodeRange(ext[:n]) {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// clientFromRequest 返回通过认证的客户端，未启用认证时为 nil
+func clientFromRequest(r *http.Request) *APIClient {
+	c, _ := r.Context().Value(apiClientKey{}).(*APIClient)
+	return c
+}
+
+// scopeClient 返回请求可查看的客户端：普通客户端只能查看自己的消息，
+// 管理客户端或未启用认证时使用 client 参数（为空表示全部）
+func scopeClient(r *http.Request) string {
+	if c := clientFromRequest(r); c != nil && !c.Admin {
+		return c.Name
+	}
+	return r.Form.Get("client")
+}
+
+// requireAPIClient 校验 API Key 与来源 IP，未配置客户端时直接放行（启动时会给出警告）
+func requireAPIClient(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(apiClients()) == 0 {
+			next(w, r)
+			return
+		}
+		key := requestAPIKey(r)
+		if key == "" {
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", "", "缺少 API Key")
+			return
+		}
+		client := findAPIClient(key)
+		if client == nil {
+			Warnf("[HTTP] Invalid API key from %s", r.RemoteAddr)
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", "", "无效的 API Key")
+			return
+		}
+		if !client.allowIP(r.RemoteAddr) {
+			Warnf("[HTTP] Client %s rejected from %s: not in IP allowlist", client.Name, r.RemoteAddr)
+			writeAPIError(w, http.StatusForbidden, "forbidden", "", "来源 IP 不在白名单内")
+			return
+		}
+		if !client.allowCert(r.TLS) {
+			Warnf("[HTTP] Client %s rejected from %s: missing or mismatched client certificate", client.Name, r.RemoteAddr)
+			writeAPIError(w, http.StatusForbidden, "forbidden", "", "需要有效的客户端证书")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiClientKey{}, client)))
+	}
+}
+
+// requireAdminKey 要求携带管理客户端的 API Key，用于可删除消息、查询运营商数据的 /api/admin/*
+// 与 requireAdminClient 不同，未配置任何客户端时同样拒绝
+func requireAdminKey(next http.HandlerFunc) http.HandlerFunc {
+	return requireAdminClient(func(w http.ResponseWriter, r *http.Request) {
+		if clientFromRequest(r) == nil {
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", "", "未配置管理客户端，接口未开放")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// requireAdminClient 在 API Key 认证的基础上要求管理客户端
+func requireAdminClient(next http.HandlerFunc) http.HandlerFunc {
+	return requireAPIClient(func(w http.ResponseWriter, r *http.Request) {
+		if c := clientFromRequest(r); c != nil && !c.Admin {
+			writeAPIError(w, http.StatusForbidden, "forbidden", "", "该客户端无权调用管理接口")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// clientStats 返回某个客户端累计的下发与上行数量
+func clientStats(name string) map[string]int {
+	counts, err := SCache.GetClientStats(name)
+	if err != nil {
+		Warnf("[HTTP] Failed to load statistics of client %s: %v", name, err)
+	}
+	return map[string]int{
+		"total":    int(counts.Submitted),
+		"success":  int(counts.Succeeded),
+		"failed":   int(counts.Failed),
+		"received": int(counts.MO),
+	}
+}
@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func withAPIClients(t *testing.T, clients ...APIClient) {
+	t.Helper()
+	oldConfig := config
+	config = &Config{SmsAccessNo: "10659", APIClients: clients}
+	t.Cleanup(func() { config = oldConfig })
+}
+
+func TestRequireAPIClient(t *testing.T) {
+	withAPIClients(t,
+		APIClient{Name: "acme", Key: "acme-key", AllowIPs: []string{"10.0.0.0/8"}},
+		APIClient{Name: "ops", Key: "ops-key", AllowIPs: []string{"192.168.1.5"}, Admin: true},
+	)
+	var seen *APIClient
+	h := requireAPIClient(func(w http.ResponseWriter, r *http.Request) {
+		seen = clientFromRequest(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		remote string
+		header map[string]string
+		want   int
+		client string
+	}{
+		{"missing key", "10.1.2.3:1000", nil, http.StatusUnauthorized, ""},
+		{"wrong key", "10.1.2.3:1000", map[string]string{"X-API-Key": "nope"}, http.StatusUnauthorized, ""},
+		{"header key", "10.1.2.3:1000", map[string]string{"X-API-Key": "acme-key"}, http.StatusOK, "acme"},
+		{"bearer key", "192.168.1.5:1000", map[string]string{"Authorization": "Bearer ops-key"}, http.StatusOK, "ops"},
+		{"ip not allowed", "192.168.1.6:1000", map[string]string{"X-API-Key": "ops-key"}, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		seen = nil
+		req := httptest.NewRequest("GET", "/api/stats", nil)
+		req.RemoteAddr = tt.remote
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if tt.client != "" && (seen == nil || seen.Name != tt.client) {
+			t.Errorf("%s: client = %+v, want %s", tt.name, seen, tt.client)
+		}
+	}
+
+	admin := requireAdminClient(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	req := httptest.NewRequest("POST", "/api/admin/cancel", nil)
+	req.RemoteAddr = "10.1.2.3:1000"
+	req.Header.Set("X-API-Key", "acme-key")
+	rec := httptest.NewRecorder()
+	admin(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected non-admin client to be rejected, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/admin/cancel", nil)
+	req.RemoteAddr = "192.168.1.5:1000"
+	req.Header.Set("X-API-Key", "ops-key")
+	rec = httptest.NewRecorder()
+	requireAdminKey(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected admin client to be accepted, got %d", rec.Code)
+	}
+}
+
+func TestRequireAPIClientWithoutClients(t *testing.T) {
+	withAPIClients(t)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	// 未配置客户端时与旧版本一样允许匿名访问，只有 /api/admin/* 不开放
+	for name, tt := range map[string]struct {
+		h    http.HandlerFunc
+		want int
+	}{
+		"/submit":           {requireAPIClient(ok), http.StatusOK},
+		"/api/v1/messages":  {requireAPIClient(ok), http.StatusOK},
+		"/api/admin/cancel": {requireAdminKey(ok), http.StatusUnauthorized},
+		"/metrics":          {requireAdminClient(ok), http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		tt.h(rec, httptest.NewRequest("GET", name, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", name, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestClientExtCodeRange(t *testing.T) {
+	withAPIClients(t,
+		APIClient{Name: "acme", ExtCodeMin: "100", ExtCodeMax: "199"},
+		APIClient{Name: "beta", ExtCodeMin: "20", ExtCodeMax: "29"},
+	)
+	acme := &config.APIClients[0]
+
+	if src, err := ValidateClientExtCode(acme, ""); err != nil || src != "100" {
+		t.Errorf("Expected default ext code 100, got %q %v", src, err)
+	}
+	if _, err := ValidateClientExtCode(acme, "150"); err != nil {
+		t.Errorf("Expected 150 to be allowed: %v", err)
+	}
+	for _, src := range []string{"200", "15", "1500"} {
+		if _, err := ValidateClientExtCode(acme, src); err == nil {
+			t.Errorf("Expected %s to be rejected", src)
+		}
+	}
+
+	for dest, want := range map[string]string{
+		"10659123":  "acme",
+		"106591234": "acme", // 用户在扩展码后追加的号码
+		"1065925":   "beta",
+		"1065930":   "",
+		"10086123":  "",
+	} {
+		if got := clientForDest(dest); got != want {
+			t.Errorf("clientForDest(%s) = %q, want %q", dest, got, want)
+		}
+	}
+}
+
+func TestClientExtCodeSingleBound(t *testing.T) {
+	withAPIClients(t,
+		APIClient{Name: "low", ExtCodeMin: "500"},
+		APIClient{Name: "high", ExtCodeMax: "39"},
+	)
+	low, high := &config.APIClients[0], &config.APIClients[1]
+
+	// 只配置一端时另一端不限制
+	if _, err := ValidateClientExtCode(low, "999"); err != nil {
+		t.Errorf("Expected 999 to be allowed: %v", err)
+	}
+	if _, err := ValidateClientExtCode(low, "499"); err == nil {
+		t.Error("Expected 499 to be rejected")
+	}
+	if src, err := ValidateClientExtCode(high, ""); err != nil || src != "00" {
+		t.Errorf("Expected default ext code 00, got %q %v", src, err)
+	}
+	if _, err := ValidateClientExtCode(high, "40"); err == nil {
+		t.Error("Expected 40 to be rejected")
+	}
+	if got := clientForDest("10659600"); got != "low" {
+		t.Errorf("Expected MO routed to low, got %q", got)
+	}
+	if got := clientForDest("106593912"); got != "high" {
+		t.Errorf("Expected MO routed to high, got %q", got)
+	}
+
+	for _, c := range []APIClient{
+		{Name: "a", ExtCodeMin: "10", ExtCodeMax: "199"},
+		{Name: "b", ExtCodeMin: "20", ExtCodeMax: "10"},
+		{Name: "c", ExtCodeMax: "1x"},
+	} {
+		if err := c.validateExtCodeRange(); err == nil {
+			t.Errorf("Expected invalid range for %+v", c)
+		}
+	}
+	if err := low.validateExtCodeRange(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestAPIClientScoping(t *testing.T) {
+	newTestBoltCache(t)
+	withAPIClients(t,
+		APIClient{Name: "acme", Key: "acme-key"},
+		APIClient{Name: "ops", Key: "ops-key", Admin: true},
+	)
+	SCache.AddSubmits(&SmsMes{Id: "a1", Client: "acme", Dest: "13800000000"})
+	SCache.AddSubmits(&SmsMes{Id: "b1", Client: "beta", Dest: "13900000000"})
+
+	acme := map[string]string{"X-API-Key": "acme-key"}
+	_, out := apiRequest(t, requireAPIClient(apiMessages), "GET", "/api/v1/messages?client=beta", "", acme)
+	if out["total"].(float64) != 1 || out["data"].([]interface{})[0].(map[string]interface{})["id"] != "a1" {
+		t.Errorf("Expected client to see only its own messages, got %v", out)
+	}
+	if rec, _ := apiRequest(t, requireAPIClient(apiGetMessage), "GET", "/api/v1/messages/b1", "", acme); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another client's message, got %d", rec.Code)
+	}
+
+	ops := map[string]string{"X-API-Key": "ops-key"}
+	_, out = apiRequest(t, requireAPIClient(apiMessages), "GET", "/api/v1/messages?client=beta", "", ops)
+	if out["total"].(float64) != 1 || out["data"].([]interface{})[0].(map[string]interface{})["id"] != "b1" {
+		t.Errorf("Expected admin to filter by client, got %v", out)
+	}
+	_, out = apiRequest(t, requireAPIClient(getStats), "GET", "/api/stats", "", acme)
+	if out["total"].(float64) != 1 {
+		t.Errorf("Expected per-client stats, got %v", out)
+	}
+}
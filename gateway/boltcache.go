@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -15,13 +16,32 @@ import (
 // BoltCache 使用 BoltDB 作为存储后端
 type BoltCache struct {
 	db *bolt.DB
+	// 上次清理过期随机数的时间，仅在写事务内访问
+	nonceSwept time.Time
+	// 上次清理过期统计的时间，仅在写事务内访问
+	statsSwept time.Time
 }
 
 var (
 	// Bucket 名称
 	waitBucket    = []byte("wait")     // 等待队列
+	waitIdxBucket = []byte("waitidx")  // 等待响应消息的索引：索引键 -> wait 中的 key
 	messageBucket = []byte("messages") // 消息列表
 	moBucket      = []byte("mo")       // MO消息列表
+	orphanBucket  = []byte("orphan")   // 未能匹配到消息的状态报告
+	nonceBucket   = []byte("nonces")   // 签名请求的随机数，用于防重放
+	indexBucket   = []byte("msgindex") // 下发记录索引：索引键 -> messages 中的 key
+	webhookBucket = []byte("webhooks") // 待投递的 Webhook 记录
+	// 超过最多投递次数、等待人工重新投递的 Webhook 记录
+	webhookFailedBucket = []byte("webhooks_failed")
+	// 待投递记录的索引：8 字节下次投递时间 + 记录标识 -> 记录标识
+	webhookDueBucket = []byte("webhook_due")
+	userBucket       = []byte("users") // 管理界面用户
+	statsBucket      = []byte("stats") // 时间序列统计：粒度前缀+时间段 -> 各项数量
+	// 列表记录的创建时间索引：8 字节倒序创建时间 + 记录的 key -> 空，用于按时间范围定位
+	messageCreatedBucket = []byte("messages_created")
+	moCreatedBucket      = []byte("mo_created")
+	orphanCreatedBucket  = []byte("orphan_created")
 )
 
 // StartBoltCache 初始化 BoltDB
@@ -36,7 +56,7 @@ func StartBoltCache(dbPath string) (*BoltCache, error) {
 
 	// 创建必要的 Buckets
 	err = db.Update(func(tx *bolt.Tx) error {
-		for _, bucketName := range [][]byte{waitBucket, messageBucket, moBucket} {
+		for _, bucketName := range [][]byte{waitBucket, waitIdxBucket, messageBucket, moBucket, orphanBucket, nonceBucket, indexBucket, webhookBucket, webhookFailedBucket, webhookDueBucket, userBucket, statsBucket, messageCreatedBucket, moCreatedBucket, orphanCreatedBucket} {
 			_, err := tx.CreateBucketIfNotExists(bucketName)
 			if err != nil {
 				return fmt.Errorf("创建bucket失败: %w", err)
@@ -49,153 +69,900 @@ func StartBoltCache(dbPath string) (*BoltCache, error) {
 		return nil, err
 	}
 
+	if err := db.Update(backfillMessageIndex); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("补建消息索引失败: %w", err)
+	}
+	if err := db.Update(initStatsTotal); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化累计统计失败: %w", err)
+	}
+	if err := db.Update(backfillCreatedIndex); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("补建创建时间索引失败: %w", err)
+	}
+
 	Infof("[CACHE] BoltDB 初始化成功: %s", dbPath)
 	return &BoltCache{db: db}, nil
 }
 
+// indexBackfilled 消息索引已补建的标记，保存在 msgindex bucket 中
+var indexBackfilled = []byte("meta:backfilled")
+
+// backfillMessageIndex 为建立索引之前写入的下发记录补建索引，只执行一次
+//
+// 从最新的记录开始，已有的索引键不覆盖，重复的 MsgId 指向最新的记录
+func backfillMessageIndex(tx *bolt.Tx) error {
+	idx, b := tx.Bucket(indexBucket), tx.Bucket(messageBucket)
+	if idx.Get(indexBackfilled) != nil {
+		return nil
+	}
+	added := 0
+	cursor := b.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		mes := SmsMes{}
+		if json.Unmarshal(v, &mes) != nil {
+			continue
+		}
+		for _, indexKey := range messageIndexKeys(&mes) {
+			if idx.Get([]byte(indexKey)) != nil {
+				continue
+			}
+			if err := idx.Put([]byte(indexKey), append([]byte(nil), k...)); err != nil {
+				return err
+			}
+			added++
+		}
+	}
+	if added > 0 {
+		Infof("[CACHE] 已为旧的下发记录补建 %d 条索引", added)
+	}
+	return idx.Put(indexBackfilled, []byte(time.Now().Format(time.RFC3339)))
+}
+
+// createdBackfilled 创建时间索引已补建的标记，保存在 msgindex bucket 中
+var createdBackfilled = []byte("meta:created_backfilled")
+
+// backfillCreatedIndex 为建立创建时间索引之前写入的列表记录补建索引，只执行一次
+func backfillCreatedIndex(tx *bolt.Tx) error {
+	idx := tx.Bucket(indexBucket)
+	if idx.Get(createdBackfilled) != nil {
+		return nil
+	}
+	added := 0
+	for _, bucket := range [][]byte{messageBucket, moBucket, orphanBucket} {
+		b, created := tx.Bucket(bucket), tx.Bucket(createdIndexBucket(bucket))
+		cursor := b.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			mes := SmsMes{}
+			if json.Unmarshal(v, &mes) != nil {
+				continue
+			}
+			if err := created.Put(createdKey(mes.Created, k), nil); err != nil {
+				return err
+			}
+			added++
+		}
+	}
+	if added > 0 {
+		Infof("[CACHE] 已为旧的列表记录补建 %d 条创建时间索引", added)
+	}
+	return idx.Put(createdBackfilled, []byte(time.Now().Format(time.RFC3339)))
+}
+
 // StopBoltCache 关闭数据库
 func (c *BoltCache) StopBoltCache() error {
 	if c.db != nil {
 		Debugf("[CACHE] 关闭 BoltDB")
 		return c.db.Close()
 	}
-	return nil
+	return nil
+}
+
+// SetWaitCache 将发送的记录放到等待缓存中
+func (c *BoltCache) SetWaitCache(gen uint64, seq uint32, message SmsMes) error {
+	if c.db == nil {
+		Warnf("[CACHE] BoltDB 未初始化，跳过 SetWaitCache")
+		return errors.New("database not initialized")
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(waitBucket)
+		if b == nil {
+			return errors.New("wait bucket not found")
+		}
+
+		// 序列化消息
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+
+		// 使用 连接代次+SeqId 作为 key
+		key := waitKey(gen, seq)
+		if err := b.Put(key, data); err != nil {
+			return err
+		}
+		idx := tx.Bucket(waitIdxBucket)
+		if idx == nil {
+			return errors.New("waitidx bucket not found")
+		}
+		for _, indexKey := range messageIndexKeys(&message) {
+			if err := idx.Put([]byte(indexKey), key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteWaitIndex 删除等待消息的索引，索引已指向其他等待消息时保留
+func deleteWaitIndex(tx *bolt.Tx, key []byte, mes *SmsMes) error {
+	idx := tx.Bucket(waitIdxBucket)
+	if idx == nil {
+		return errors.New("waitidx bucket not found")
+	}
+	for _, indexKey := range messageIndexKeys(mes) {
+		if bytes.Equal(idx.Get([]byte(indexKey)), key) {
+			if err := idx.Delete([]byte(indexKey)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetWaitCache 获取并删除等待缓存
+func (c *BoltCache) GetWaitCache(gen uint64, seq uint32) (SmsMes, error) {
+	if c.db == nil {
+		return SmsMes{}, errors.New("database not initialized")
+	}
+
+	var mes SmsMes
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(waitBucket)
+		if b == nil {
+			return errors.New("wait bucket not found")
+		}
+
+		keyBytes := waitKey(gen, seq)
+		data := b.Get(keyBytes)
+		if data == nil {
+			return errors.New("no key in cache")
+		}
+
+		// 反序列化
+		if err := json.Unmarshal(data, &mes); err != nil {
+			return err
+		}
+
+		// 删除该键及其索引
+		if err := deleteWaitIndex(tx, keyBytes, &mes); err != nil {
+			return err
+		}
+		return b.Delete(keyBytes)
+	})
+
+	return mes, err
+}
+
+// CompleteWaitCache 取出等待缓存中的消息，由 fill 填入提交结果后写入下发记录
+// 写入记录、建立索引与删除等待条目在同一事务中完成，查询不会在两者之间落空
+func (c *BoltCache) CompleteWaitCache(gen uint64, seq uint32, fill func(mes *SmsMes)) (SmsMes, error) {
+	if c.db == nil {
+		return SmsMes{}, errors.New("database not initialized")
+	}
+
+	var mes SmsMes
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(waitBucket)
+		if b == nil {
+			return errors.New("wait bucket not found")
+		}
+
+		keyBytes := waitKey(gen, seq)
+		data := b.Get(keyBytes)
+		if data == nil {
+			return errors.New("no key in cache")
+		}
+		if err := json.Unmarshal(data, &mes); err != nil {
+			return err
+		}
+		if err := deleteWaitIndex(tx, keyBytes, &mes); err != nil {
+			return err
+		}
+
+		fill(&mes)
+		if err := c.putSubmit(tx, &mes); err != nil {
+			return err
+		}
+		return b.Delete(keyBytes)
+	})
+
+	return mes, err
+}
+
+// GetWaitList 获取所有等待响应的消息
+func (c *BoltCache) GetWaitList() []SmsMes {
+	if c.db == nil {
+		return []SmsMes{}
+	}
+
+	result := make([]SmsMes, 0)
+
+	c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(waitBucket)
+		if b == nil {
+			return nil
+		}
+
+		// 遍历所有等待的消息
+		cursor := b.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			mes := SmsMes{}
+			if err := json.Unmarshal(v, &mes); err == nil {
+				result = append(result, mes)
+			}
+		}
+
+		return nil
+	})
+
+	return result
+}
+
+// LookupWait 按索引键查找等待响应的消息
+func (c *BoltCache) LookupWait(indexKey string) (SmsMes, bool) {
+	mes := SmsMes{}
+	if c.db == nil {
+		return mes, false
+	}
+
+	found := false
+	c.db.View(func(tx *bolt.Tx) error {
+		idx, b := tx.Bucket(waitIdxBucket), tx.Bucket(waitBucket)
+		if idx == nil || b == nil {
+			return nil
+		}
+		key := idx.Get([]byte(indexKey))
+		if key == nil {
+			return nil
+		}
+		if data := b.Get(key); data != nil && json.Unmarshal(data, &mes) == nil {
+			found = true
+		}
+		return nil
+	})
+	return mes, found
+}
+
+// DrainStaleWait 取出并删除指定通道上所有不属于当前连接代次的等待消息
+func (c *BoltCache) DrainStaleWait(channel string, currentGen uint64) ([]SmsMes, error) {
+	if c.db == nil {
+		return nil, errors.New("database not initialized")
+	}
+
+	result := make([]SmsMes, 0)
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(waitBucket)
+		if b == nil {
+			return errors.New("wait bucket not found")
+		}
+
+		var stale [][]byte
+		cursor := b.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			// 旧版本使用 4 字节 SeqId 作为 key，同样视为过期
+			if len(k) == 12 && binary.BigEndian.Uint64(k[:8]) == currentGen {
+				continue
+			}
+			mes := SmsMes{}
+			if err := json.Unmarshal(v, &mes); err == nil {
+				if channelOf(&mes) != channel {
+					continue
+				}
+				result = append(result, mes)
+				if err := deleteWaitIndex(tx, k, &mes); err != nil {
+					return err
+				}
+			}
+			stale = append(stale, append([]byte(nil), k...))
+		}
+
+		// 遍历结束后再删除，避免游标失效
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// AddSubmits 添加提交消息到列表
+func (c *BoltCache) AddSubmits(mes *SmsMes) error {
+	if c.db == nil {
+		Warnf("[CACHE] BoltDB 未初始化，跳过 AddSubmits")
+		return errors.New("database not initialized")
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return c.putSubmit(tx, mes)
+	})
+}
+
+// putSubmit 在事务中写入下发记录、索引和统计
+func (c *BoltCache) putSubmit(tx *bolt.Tx, mes *SmsMes) error {
+	key, err := putListRecord(tx, messageBucket, mes)
+	if err != nil {
+		return err
+	}
+	idx := tx.Bucket(indexBucket)
+	if idx == nil {
+		return errors.New("msgindex bucket not found")
+	}
+	for _, indexKey := range messageIndexKeys(mes) {
+		if err := idx.Put([]byte(indexKey), key); err != nil {
+			return err
+		}
+	}
+	if err := addClientStats(tx, mes.Client, submitCounts(mes)); err != nil {
+		return err
+	}
+	return c.addStats(tx, statsTime(mes.SubmitTime), submitCounts(mes))
+}
+
+// putListRecord 按入库顺序写入列表记录并建立创建时间索引，返回记录的 key
+func putListRecord(tx *bolt.Tx, bucket []byte, mes *SmsMes) ([]byte, error) {
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return nil, fmt.Errorf("%s bucket not found", bucket)
+	}
+
+	// 使用入库时间+序列号作为key，保证倒序，翻页的位置不受之后写入的记录影响
+	key := timeKey(tx, b)
+
+	// 序列化消息
+	data, err := json.Marshal(mes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.Put(key, data); err != nil {
+		return nil, err
+	}
+	return key, tx.Bucket(createdIndexBucket(bucket)).Put(createdKey(mes.Created, key), nil)
+}
+
+// LookupMessage 按索引键查找下发记录
+func (c *BoltCache) LookupMessage(indexKey string) (SmsMes, bool) {
+	mes := SmsMes{}
+	if c.db == nil {
+		return mes, false
+	}
+
+	found := false
+	c.db.View(func(tx *bolt.Tx) error {
+		idx, b := tx.Bucket(indexBucket), tx.Bucket(messageBucket)
+		if idx == nil || b == nil {
+			return nil
+		}
+		key := idx.Get([]byte(indexKey))
+		if key == nil {
+			return nil
+		}
+		if v := b.Get(key); v != nil && json.Unmarshal(v, &mes) == nil {
+			found = true
+		}
+		return nil
+	})
+	return mes, found
+}
+
+// AddMoList 添加MO消息到列表
+func (c *BoltCache) AddMoList(mes *SmsMes) error {
+	if c.db == nil {
+		Warnf("[CACHE] BoltDB 未初始化，跳过 AddMoList")
+		return errors.New("database not initialized")
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if _, err := putListRecord(tx, moBucket, mes); err != nil {
+			return err
+		}
+		if err := addClientStats(tx, mes.Client, StatCounts{MO: 1}); err != nil {
+			return err
+		}
+		return c.addStats(tx, statsTime(mes.Created), StatCounts{MO: 1})
+	})
+}
+
+// ApplyReceipt 将状态报告写入 MsgId 对应的下发记录，返回更新后的记录
+// 返回 false 表示尚未找到对应的记录
+func (c *BoltCache) ApplyReceipt(msgId string, result uint32, stat string) (SmsMes, bool, error) {
+	updated := SmsMes{}
+	if c.db == nil {
+		return updated, false, errors.New("database not initialized")
+	}
+
+	matched := false
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(messageBucket)
+		if b == nil {
+			return errors.New("messages bucket not found")
+		}
+
+		// 仅通过 MsgId 索引定位，未命中时由状态报告缓冲稍后重试
+		idx := tx.Bucket(indexBucket)
+		if idx == nil {
+			return errors.New("msgindex bucket not found")
+		}
+		k := idx.Get([]byte(indexByMsgId + msgId))
+		if k == nil {
+			return nil
+		}
+		v := b.Get(k)
+		if v == nil {
+			return nil
+		}
+		mes := SmsMes{}
+		if err := json.Unmarshal(v, &mes); err != nil || mes.MsgId != msgId {
+			return nil
+		}
+		// 重复的状态报告不重复计入投递成功数量
+		delivered := stat == "DELIVRD" && mes.DeliveryStat != stat
+		mes.DelivleryResult = result
+		mes.DeliveryStat = stat
+		mes.ReceiptTime = time.Now()
+		data, err := json.Marshal(&mes)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(append([]byte(nil), k...), data); err != nil {
+			return err
+		}
+		matched, updated = true, mes
+		if delivered {
+			return c.addStats(tx, mes.ReceiptTime, StatCounts{Delivered: 1})
+		}
+		return nil
+	})
+
+	return updated, matched, err
+}
+
+// AddOrphanReceipt 记录超时仍未匹配到消息的状态报告
+func (c *BoltCache) AddOrphanReceipt(mes *SmsMes) error {
+	if c.db == nil {
+		Warnf("[CACHE] BoltDB 未初始化，跳过 AddOrphanReceipt")
+		return errors.New("database not initialized")
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		_, err := putListRecord(tx, orphanBucket, mes)
+		return err
+	})
+}
+
+// addStats 将数量累加到各粒度的统计中，在调用方的写事务内执行
+func (c *BoltCache) addStats(tx *bolt.Tx, t time.Time, d StatCounts) error {
+	b := tx.Bucket(statsBucket)
+	if b == nil {
+		return errors.New("stats bucket not found")
+	}
+
+	now := time.Now()
+	// 每小时最多清理一次超过保留时长的时间段
+	if now.Sub(c.statsSwept) >= time.Hour {
+		for _, res := range statsResolutions {
+			prefix, expired := []byte(res.prefix), []byte(res.key(now.Add(-res.retention)))
+			var keys [][]byte
+			cursor := b.Cursor()
+			for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) && bytes.Compare(k, expired) < 0; k, _ = cursor.Next() {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		c.statsSwept = now
+	}
+
+	for _, res := range statsResolutions {
+		if err := addCounts(b, []byte(res.key(t)), d); err != nil {
+			return err
+		}
+	}
+	return addCounts(b, statsTotalKey, d)
+}
+
+// addCounts 将数量累加到 stats bucket 中的一项统计
+func addCounts(b *bolt.Bucket, key []byte, d StatCounts) error {
+	counts := StatCounts{}
+	if v := b.Get(key); v != nil {
+		json.Unmarshal(v, &counts)
+	}
+	counts.add(d)
+	data, err := json.Marshal(&counts)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// statsTotalKey 全部记录的累计统计在 stats bucket 中的 key，不参与过期清理
+var statsTotalKey = []byte("total")
+
+// initStatsTotal 按已有记录初始化累计统计，只在累计统计不存在时执行
+//
+// 升级前的版本没有累计统计；在同一个写事务中遍历记录，计数与记录保持一致
+func initStatsTotal(tx *bolt.Tx) error {
+	stats := tx.Bucket(statsBucket)
+	if stats.Get(statsTotalKey) != nil {
+		return nil
+	}
+	total := StatCounts{}
+	tx.Bucket(messageBucket).ForEach(func(_, v []byte) error {
+		mes := SmsMes{}
+		if json.Unmarshal(v, &mes) == nil {
+			total.add(submitCounts(&mes))
+		}
+		return nil
+	})
+	total.MO = int64(tx.Bucket(moBucket).Stats().KeyN)
+	return addCounts(stats, statsTotalKey, total)
+}
+
+// clientStatsPrefix 客户端累计统计在 stats bucket 中的 key 前缀，不参与过期清理
+const clientStatsPrefix = "c:"
+
+// addClientStats 将数量累加到客户端的累计统计，不计状态报告
+func addClientStats(tx *bolt.Tx, client string, d StatCounts) error {
+	if client == "" {
+		return nil
+	}
+	b := tx.Bucket(statsBucket)
+	if b == nil {
+		return errors.New("stats bucket not found")
+	}
+	d.Delivered = 0
+	return addCounts(b, []byte(clientStatsPrefix+client), d)
+}
+
+// GetClientStats 读取客户端的累计统计
+func (c *BoltCache) GetClientStats(client string) (StatCounts, error) {
+	counts := StatCounts{}
+	if c.db == nil {
+		return counts, errors.New("database not initialized")
+	}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(statsBucket); b != nil {
+			if v := b.Get([]byte(clientStatsPrefix + client)); v != nil {
+				return json.Unmarshal(v, &counts)
+			}
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// GetTimeSeries 读取 [from, to) 范围内各时间段的统计
+func (c *BoltCache) GetTimeSeries(resolution string, from, to time.Time) ([]StatsPoint, error) {
+	res, ok := findStatsResolution(resolution)
+	if !ok {
+		return nil, fmt.Errorf("unknown resolution %s", resolution)
+	}
+	if c.db == nil {
+		return nil, errors.New("database not initialized")
+	}
+
+	periods := res.periods(from, to)
+	result := make([]StatsPoint, len(periods))
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(statsBucket)
+		for i, t := range periods {
+			result[i].Time = t
+			if b == nil {
+				continue
+			}
+			if v := b.Get([]byte(res.key(t))); v != nil {
+				json.Unmarshal(v, &result[i].StatCounts)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// ReserveNonce 登记随机数及其过期时间，未过期的随机数重复登记返回 false
+func (c *BoltCache) ReserveNonce(key string, ttl time.Duration) (bool, error) {
+	if c.db == nil {
+		return false, errors.New("database not initialized")
+	}
+
+	reserved := false
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(nonceBucket)
+		if b == nil {
+			return errors.New("nonces bucket not found")
+		}
+
+		now := time.Now()
+		// 每分钟最多清理一次过期的随机数
+		if now.Sub(c.nonceSwept) >= time.Minute {
+			var expired [][]byte
+			b.ForEach(func(k, v []byte) error {
+				if len(v) != 8 || int64(binary.BigEndian.Uint64(v)) <= now.UnixNano() {
+					expired = append(expired, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			for _, k := range expired {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			c.nonceSwept = now
+		}
+
+		if v := b.Get([]byte(key)); len(v) == 8 && int64(binary.BigEndian.Uint64(v)) > now.UnixNano() {
+			return nil
+		}
+		expires := make([]byte, 8)
+		binary.BigEndian.PutUint64(expires, uint64(now.Add(ttl).UnixNano()))
+		reserved = true
+		return b.Put([]byte(key), expires)
+	})
+	return reserved, err
+}
+
+// webhookDueKey 返回待投递索引的 key，按下次投递时间排序
+func webhookDueKey(d *WebhookDelivery) []byte {
+	key := make([]byte, 8, 8+len(d.Id))
+	if t := d.NextAttempt.UnixNano(); t > 0 {
+		binary.BigEndian.PutUint64(key, uint64(t))
+	}
+	return append(key, d.Id...)
+}
+
+// loadWebhook 从待投递或失败的记录中读取
+func loadWebhook(tx *bolt.Tx, id string) (WebhookDelivery, bool) {
+	d := WebhookDelivery{}
+	for _, name := range [][]byte{webhookBucket, webhookFailedBucket} {
+		if v := tx.Bucket(name).Get([]byte(id)); v != nil {
+			return d, json.Unmarshal(v, &d) == nil
+		}
+	}
+	return d, false
+}
+
+// removeWebhook 删除记录及其待投递索引
+func removeWebhook(tx *bolt.Tx, id string) error {
+	if old, ok := loadWebhook(tx, id); ok {
+		if err := tx.Bucket(webhookDueBucket).Delete(webhookDueKey(&old)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(webhookBucket).Delete([]byte(id)); err != nil {
+		return err
+	}
+	return tx.Bucket(webhookFailedBucket).Delete([]byte(id))
+}
+
+// putWebhook 写入记录并递增 Revision：待投递的记录建立索引，失败的记录单独存放
+func putWebhook(tx *bolt.Tx, d *WebhookDelivery) error {
+	if err := removeWebhook(tx, d.Id); err != nil {
+		return err
+	}
+	d.Revision++
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if d.Status == webhookFailed {
+		return tx.Bucket(webhookFailedBucket).Put([]byte(d.Id), data)
+	}
+	if err := tx.Bucket(webhookBucket).Put([]byte(d.Id), data); err != nil {
+		return err
+	}
+	return tx.Bucket(webhookDueBucket).Put(webhookDueKey(d), []byte(d.Id))
 }
 
-// SetWaitCache 将发送的记录放到等待缓存中
-func (c *BoltCache) SetWaitCache(key uint32, message SmsMes) error {
+// SaveWebhook 新增或覆盖 Webhook 投递记录
+func (c *BoltCache) SaveWebhook(d *WebhookDelivery) error {
 	if c.db == nil {
-		Warnf("[CACHE] BoltDB 未初始化，跳过 SetWaitCache")
 		return errors.New("database not initialized")
 	}
 
 	return c.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(waitBucket)
-		if b == nil {
-			return errors.New("wait bucket not found")
-		}
-
-		// 序列化消息
-		data, err := json.Marshal(message)
-		if err != nil {
-			return err
-		}
-
-		// 使用 SeqId 作为 key
-		keyBytes := uint32ToBytes(key)
-		return b.Put(keyBytes, data)
+		return putWebhook(tx, d)
 	})
 }
 
-// GetWaitCache 获取并删除等待缓存
-func (c *BoltCache) GetWaitCache(key uint32) (SmsMes, error) {
+// UpdateWebhook 在存储中的记录未被修改时保存
+func (c *BoltCache) UpdateWebhook(d *WebhookDelivery) (bool, error) {
 	if c.db == nil {
-		return SmsMes{}, errors.New("database not initialized")
+		return false, errors.New("database not initialized")
 	}
 
-	var mes SmsMes
+	updated := false
 	err := c.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(waitBucket)
-		if b == nil {
-			return errors.New("wait bucket not found")
-		}
-
-		keyBytes := uint32ToBytes(key)
-		data := b.Get(keyBytes)
-		if data == nil {
-			return errors.New("no key in cache")
+		current, ok := loadWebhook(tx, d.Id)
+		if !ok || current.Revision != d.Revision {
+			return nil
 		}
+		updated = true
+		return putWebhook(tx, d)
+	})
+	return updated, err
+}
 
-		// 反序列化
-		if err := json.Unmarshal(data, &mes); err != nil {
-			return err
-		}
+// GetWebhook 获取投递记录
+func (c *BoltCache) GetWebhook(id string) (WebhookDelivery, bool) {
+	d := WebhookDelivery{}
+	if c.db == nil {
+		return d, false
+	}
 
-		// 删除该键
-		return b.Delete(keyBytes)
+	found := false
+	c.db.View(func(tx *bolt.Tx) error {
+		d, found = loadWebhook(tx, id)
+		return nil
 	})
-
-	return mes, err
+	return d, found
 }
 
-// GetWaitList 获取所有等待响应的消息
-func (c *BoltCache) GetWaitList() []SmsMes {
+// DeleteWebhook 删除已投递成功的记录
+func (c *BoltCache) DeleteWebhook(id string) error {
 	if c.db == nil {
-		return []SmsMes{}
+		return errors.New("database not initialized")
 	}
 
-	result := make([]SmsMes, 0)
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return removeWebhook(tx, id)
+	})
+}
 
-	c.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(waitBucket)
-		if b == nil {
-			return nil
-		}
+// DueWebhooks 按待投递索引取出到期的记录，不读取其他记录
+func (c *BoltCache) DueWebhooks(now time.Time, limit int) []WebhookDelivery {
+	var list []WebhookDelivery
+	if c.db == nil {
+		return list
+	}
 
-		// 遍历所有等待的消息
-		cursor := b.Cursor()
-		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
-			mes := SmsMes{}
-			if err := json.Unmarshal(v, &mes); err == nil {
-				result = append(result, mes)
+	c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(webhookBucket)
+		end := uint64(now.UnixNano())
+		cursor := tx.Bucket(webhookDueBucket).Cursor()
+		for k, v := cursor.First(); k != nil && len(list) < limit; k, v = cursor.Next() {
+			if len(k) < 8 || binary.BigEndian.Uint64(k) > end {
+				break
+			}
+			d := WebhookDelivery{}
+			if data := b.Get(v); data != nil && json.Unmarshal(data, &d) == nil {
+				list = append(list, d)
 			}
 		}
-
 		return nil
 	})
+	return list
+}
 
-	return result
+// ListWebhooks 获取所有投递记录
+func (c *BoltCache) ListWebhooks() []WebhookDelivery {
+	var list []WebhookDelivery
+	if c.db == nil {
+		return list
+	}
+
+	c.db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{webhookBucket, webhookFailedBucket} {
+			tx.Bucket(name).ForEach(func(k, v []byte) error {
+				d := WebhookDelivery{}
+				if json.Unmarshal(v, &d) == nil {
+					list = append(list, d)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	sortWebhooks(list)
+	return list
 }
 
-// AddSubmits 添加提交消息到列表
-func (c *BoltCache) AddSubmits(mes *SmsMes) error {
+// SaveUser 新增或更新管理界面用户
+func (c *BoltCache) SaveUser(u *ConsoleUser) error {
 	if c.db == nil {
-		Warnf("[CACHE] BoltDB 未初始化，跳过 AddSubmits")
 		return errors.New("database not initialized")
 	}
 
 	return c.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(messageBucket)
+		b := tx.Bucket(userBucket)
 		if b == nil {
-			return errors.New("messages bucket not found")
+			return errors.New("users bucket not found")
 		}
-
-		// 使用时间戳+序列号作为key，保证倒序
-		key := generateTimeKey(tx, b)
-
-		// 序列化消息
-		data, err := json.Marshal(mes)
+		data, err := json.Marshal(u)
 		if err != nil {
 			return err
 		}
+		return b.Put([]byte(u.Name), data)
+	})
+}
 
-		return b.Put(key, data)
+// GetUser 获取管理界面用户
+func (c *BoltCache) GetUser(name string) (ConsoleUser, bool) {
+	u := ConsoleUser{}
+	if c.db == nil {
+		return u, false
+	}
+
+	found := false
+	c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(userBucket)
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(name)); v != nil && json.Unmarshal(v, &u) == nil {
+			found = true
+		}
+		return nil
 	})
+	return u, found
 }
 
-// AddMoList 添加MO消息到列表
-func (c *BoltCache) AddMoList(mes *SmsMes) error {
+// DeleteUser 删除管理界面用户
+func (c *BoltCache) DeleteUser(name string) error {
 	if c.db == nil {
-		Warnf("[CACHE] BoltDB 未初始化，跳过 AddMoList")
 		return errors.New("database not initialized")
 	}
 
 	return c.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(moBucket)
+		b := tx.Bucket(userBucket)
 		if b == nil {
-			return errors.New("mo bucket not found")
+			return errors.New("users bucket not found")
 		}
+		return b.Delete([]byte(name))
+	})
+}
 
-		// 使用时间戳+序列号作为key
-		key := generateTimeKey(tx, b)
+// ListUsers 获取所有管理界面用户（按用户名排序）
+func (c *BoltCache) ListUsers() []ConsoleUser {
+	var list []ConsoleUser
+	if c.db == nil {
+		return list
+	}
 
-		// 序列化消息
-		data, err := json.Marshal(mes)
-		if err != nil {
-			return err
+	c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(userBucket)
+		if b == nil {
+			return nil
 		}
+		return b.ForEach(func(k, v []byte) error {
+			u := ConsoleUser{}
+			if json.Unmarshal(v, &u) == nil {
+				list = append(list, u)
+			}
+			return nil
+		})
+	})
+	return list
+}
 
-		return b.Put(key, data)
+// Ping 检查数据库是否打开且可读
+func (c *BoltCache) Ping() error {
+	if c.db == nil {
+		return errors.New("database not initialized")
+	}
+	return c.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(messageBucket) == nil {
+			return errors.New("messages bucket not found")
+		}
+		return nil
 	})
 }
 
@@ -213,6 +980,8 @@ func (c *BoltCache) Length(listName string) int {
 			b = tx.Bucket(messageBucket)
 		case "list_mo":
 			b = tx.Bucket(moBucket)
+		case "list_orphan":
+			b = tx.Bucket(orphanBucket)
 		default:
 			return nil
 		}
@@ -232,70 +1001,20 @@ func (c *BoltCache) Length(listName string) int {
 	return count
 }
 
-// GetStats 获取短信统计信息
+// GetStats 读取全部下发记录的累计统计
 func (c *BoltCache) GetStats() map[string]int {
-	stats := map[string]int{
-		"total":   0,
-		"success": 0,
-		"failed":  0,
-	}
-
-	if c.db == nil {
-		return stats
-	}
-
-	c.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(messageBucket)
-		if b == nil {
-			return nil
-		}
-
-		successCount := 0
-		failedCount := 0
-		totalCount := 0
-		sampleSize := 0
-		maxSample := 1000
-
-		// 倒序遍历（从最新到最旧）
-		cursor := b.Cursor()
-		for k, v := cursor.Last(); k != nil && sampleSize < maxSample; k, v = cursor.Prev() {
-			totalCount++
-			sampleSize++
-
-			mes := SmsMes{}
-			if err := json.Unmarshal(v, &mes); err == nil {
-				if mes.SubmitResult == 0 {
-					successCount++
-				} else if mes.SubmitResult != 65535 {
-					// 65535 是等待状态，不算失败
-					failedCount++
+	total := StatCounts{}
+	if c.db != nil {
+		c.db.View(func(tx *bolt.Tx) error {
+			if b := tx.Bucket(statsBucket); b != nil {
+				if v := b.Get(statsTotalKey); v != nil {
+					json.Unmarshal(v, &total)
 				}
 			}
-		}
-
-		// 继续计数总数（不解析JSON）
-		if sampleSize >= maxSample {
-			for k, _ := cursor.Prev(); k != nil; k, _ = cursor.Prev() {
-				totalCount++
-			}
-		}
-
-		stats["total"] = totalCount
-
-		// 基于样本估算
-		if totalCount > sampleSize && sampleSize > 0 {
-			ratio := float64(totalCount) / float64(sampleSize)
-			stats["success"] = int(float64(successCount) * ratio)
-			stats["failed"] = int(float64(failedCount) * ratio)
-		} else {
-			stats["success"] = successCount
-			stats["failed"] = failedCount
-		}
-
-		return nil
-	})
-
-	return stats
+			return nil
+		})
+	}
+	return totalStats(total)
 }
 
 // GetList 获取消息列表
@@ -313,6 +1032,8 @@ func (c *BoltCache) GetList(listName string, start, end int) *[]SmsMes {
 			b = tx.Bucket(messageBucket)
 		case "list_mo":
 			b = tx.Bucket(moBucket)
+		case "list_orphan":
+			b = tx.Bucket(orphanBucket)
 		default:
 			return nil
 		}
@@ -352,6 +1073,7 @@ func (c *BoltCache) GetList(listName string, start, end int) *[]SmsMes {
 
 // SearchList 在BoltDB中搜索消息列表
 func (c *BoltCache) SearchList(listName string, filters map[string]string, start, end int) *[]SmsMes {
+	f := newSearchFilter(filters)
 	result := make([]SmsMes, 0)
 
 	if c.db == nil {
@@ -362,29 +1084,20 @@ func (c *BoltCache) SearchList(listName string, filters map[string]string, start
 	var allMatches []SmsMes
 
 	c.db.View(func(tx *bolt.Tx) error {
-		var b *bolt.Bucket
-		switch listName {
-		case "list_message":
-			b = tx.Bucket(messageBucket)
-		case "list_mo":
-			b = tx.Bucket(moBucket)
-		default:
-			return nil
-		}
-
-		if b == nil {
+		bucket := listBucket(listName)
+		if bucket == nil || tx.Bucket(bucket) == nil {
 			return nil
 		}
 
-		// 遍历所有记录
-		cursor := b.Cursor()
-		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		// 遍历时间范围内的记录
+		lc := newListCursor(tx, bucket, f, true)
+		for k, v := lc.seek(nil); k != nil; k, v = lc.next() {
 			mes := SmsMes{}
 			if err := json.Unmarshal(v, &mes); err != nil {
 				continue
 			}
 
-			if c.matchFilters(&mes, filters, listName) {
+			if c.matchFilters(&mes, f, listName) {
 				allMatches = append(allMatches, mes)
 			}
 		}
@@ -406,6 +1119,7 @@ func (c *BoltCache) SearchList(listName string, filters map[string]string, start
 
 // GetSearchCount 获取搜索结果的数量
 func (c *BoltCache) GetSearchCount(listName string, filters map[string]string) int {
+	f := newSearchFilter(filters)
 	if c.db == nil {
 		return 0
 	}
@@ -413,29 +1127,20 @@ func (c *BoltCache) GetSearchCount(listName string, filters map[string]string) i
 	count := 0
 
 	c.db.View(func(tx *bolt.Tx) error {
-		var b *bolt.Bucket
-		switch listName {
-		case "list_message":
-			b = tx.Bucket(messageBucket)
-		case "list_mo":
-			b = tx.Bucket(moBucket)
-		default:
-			return nil
-		}
-
-		if b == nil {
+		bucket := listBucket(listName)
+		if bucket == nil || tx.Bucket(bucket) == nil {
 			return nil
 		}
 
-		// 遍历所有记录并统计匹配的数量
-		cursor := b.Cursor()
-		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		// 遍历时间范围内的记录并统计匹配的数量
+		lc := newListCursor(tx, bucket, f, true)
+		for k, v := lc.seek(nil); k != nil; k, v = lc.next() {
 			mes := SmsMes{}
 			if err := json.Unmarshal(v, &mes); err != nil {
 				continue
 			}
 
-			if c.matchFilters(&mes, filters, listName) {
+			if c.matchFilters(&mes, f, listName) {
 				count++
 			}
 		}
@@ -446,29 +1151,151 @@ func (c *BoltCache) GetSearchCount(listName string, filters map[string]string) i
 	return count
 }
 
+// ForEachMessage 按从新到旧的顺序逐条遍历匹配的记录，fn 返回错误时停止并返回该错误
+//
+// 每批记录在单独的只读事务中读取，回调在事务外执行，长时间的导出不会阻塞写入
+func (c *BoltCache) ForEachMessage(listName string, filters map[string]string, fn func(mes *SmsMes) error) error {
+	f := newSearchFilter(filters)
+	if c.db == nil {
+		return nil
+	}
+	var bucket []byte
+	switch listName {
+	case "list_message":
+		bucket = messageBucket
+	case "list_mo":
+		bucket = moBucket
+	case "list_orphan":
+		bucket = orphanBucket
+	default:
+		return nil
+	}
+
+	var last []byte
+	for {
+		batch := make([]SmsMes, 0, exportBatchSize)
+		err := c.db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket(bucket)
+			if b == nil {
+				return nil
+			}
+			// 从上一批的最后一个位置之后继续
+			lc := newListCursor(tx, bucket, f, true)
+			k, v := lc.seek(last)
+			scanned := 0
+			for ; k != nil && scanned < exportBatchSize; k, v = lc.next() {
+				scanned++
+				last = append(last[:0], k...)
+				mes := SmsMes{}
+				if err := json.Unmarshal(v, &mes); err != nil {
+					continue
+				}
+				if c.matchFilters(&mes, f, listName) {
+					batch = append(batch, mes)
+				}
+			}
+			if k == nil {
+				last = nil
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if last == nil {
+			return nil
+		}
+	}
+}
+
+// PageMessages 按游标分页读取记录
+//
+// 位置为记录的 key（反转的入库时间），新记录的 key 更小，不影响之后的翻页；
+// 指定时间范围时同样按入库顺序遍历并逐条过滤，创建时间较早但之后才入库的记录不会被跳过
+func (c *BoltCache) PageMessages(listName string, filters map[string]string, after []byte, limit int) ([]SmsMes, []byte, error) {
+	f := newSearchFilter(filters)
+	if c.db == nil {
+		return nil, nil, errors.New("database not initialized")
+	}
+	var bucket []byte
+	switch listName {
+	case "list_message":
+		bucket = messageBucket
+	case "list_mo":
+		bucket = moBucket
+	case "list_orphan":
+		bucket = orphanBucket
+	default:
+		return nil, nil, fmt.Errorf("unknown list %s", listName)
+	}
+
+	result := make([]SmsMes, 0, limit)
+	var next []byte
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		lc := newListCursor(tx, bucket, f, false)
+		var last []byte
+		for k, v := lc.seek(after); k != nil; k, v = lc.next() {
+			mes := SmsMes{}
+			if err := json.Unmarshal(v, &mes); err != nil || !c.matchFilters(&mes, f, listName) {
+				continue
+			}
+			if len(result) == limit {
+				// 多找到一条说明还有下一页
+				next = append([]byte(nil), last...)
+				return nil
+			}
+			result = append(result, mes)
+			last = k
+		}
+		return nil
+	})
+	return result, next, err
+}
+
 // matchFilters 检查消息是否匹配过滤条件
-func (c *BoltCache) matchFilters(mes *SmsMes, filters map[string]string, listName string) bool {
+func (c *BoltCache) matchFilters(mes *SmsMes, f *searchFilter, listName string) bool {
 	// 如果没有过滤条件，都匹配
-	if len(filters) == 0 {
+	if len(f.fields) == 0 {
 		return true
 	}
 
 	// 通用过滤条件
-	if content, ok := filters["content"]; ok && content != "" {
+	if content, ok := f.fields["content"]; ok && content != "" {
 		if !strings.Contains(strings.ToLower(mes.Content), strings.ToLower(content)) {
 			return false
 		}
 	}
 
+	if f.msgId != nil && !f.msgId.match(mes.MsgId) {
+		return false
+	}
+
+	if client, ok := f.fields["client"]; ok && client != "" && mes.Client != client {
+		return false
+	}
+
+	if !f.matchExact(mes) {
+		return false
+	}
+
 	if listName == "list_message" {
 		// 下发消息特定过滤
-		if dest, ok := filters["dest"]; ok && dest != "" {
+		if dest, ok := f.fields["dest"]; ok && dest != "" {
 			if !strings.Contains(strings.ToLower(mes.Dest), strings.ToLower(dest)) {
 				return false
 			}
 		}
 
-		if status, ok := filters["status"]; ok && status != "" {
+		if status, ok := f.fields["status"]; ok && status != "" {
 			statusInt, err := strconv.Atoi(status)
 			if err != nil {
 				return false
@@ -482,13 +1309,20 @@ func (c *BoltCache) matchFilters(mes *SmsMes, filters map[string]string, listNam
 		}
 	} else if listName == "list_mo" {
 		// 上行消息特定过滤
-		if src, ok := filters["src"]; ok && src != "" {
+		if src, ok := f.fields["src"]; ok && src != "" {
 			if !strings.Contains(strings.ToLower(mes.Src), strings.ToLower(src)) {
 				return false
 			}
 		}
 
-		if dest, ok := filters["dest"]; ok && dest != "" {
+		if dest, ok := f.fields["dest"]; ok && dest != "" {
+			if !strings.Contains(strings.ToLower(mes.Dest), strings.ToLower(dest)) {
+				return false
+			}
+		}
+	} else if listName == "list_orphan" {
+		// 孤立状态报告过滤
+		if dest, ok := f.fields["dest"]; ok && dest != "" {
 			if !strings.Contains(strings.ToLower(mes.Dest), strings.ToLower(dest)) {
 				return false
 			}
@@ -498,29 +1332,127 @@ func (c *BoltCache) matchFilters(mes *SmsMes, filters map[string]string, listNam
 	return true
 }
 
-// 工具函数：uint32 转 []byte
-func uint32ToBytes(n uint32) []byte {
-	b := make([]byte, 4)
-	binary.BigEndian.PutUint32(b, n)
+// 工具函数：生成等待队列的 key（8字节连接代次 + 4字节SeqId）
+func waitKey(gen uint64, seq uint32) []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint64(b[:8], gen)
+	binary.BigEndian.PutUint32(b[8:], seq)
+	return b
+}
+
+// invertedTime 返回时间对应的 key 前缀（8字节倒序时间戳）
+func invertedTime(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(1<<63-1-t.UnixNano()))
 	return b
 }
 
-// 生成基于时间的key（倒序）
-// 使用 (MaxUint64 - timestamp) 确保最新的记录排在前面
-func generateTimeKey(tx *bolt.Tx, b *bolt.Bucket) []byte {
-	// 获取当前时间的纳秒时间戳
-	now := time.Now().UnixNano()
+// listBucket 返回列表名称对应的 bucket，未知的列表返回 nil
+func listBucket(listName string) []byte {
+	switch listName {
+	case "list_message":
+		return messageBucket
+	case "list_mo":
+		return moBucket
+	case "list_orphan":
+		return orphanBucket
+	}
+	return nil
+}
+
+// createdIndexBucket 返回列表对应的创建时间索引 bucket
+func createdIndexBucket(bucket []byte) []byte {
+	switch {
+	case bytes.Equal(bucket, messageBucket):
+		return messageCreatedBucket
+	case bytes.Equal(bucket, moBucket):
+		return moCreatedBucket
+	default:
+		return orphanCreatedBucket
+	}
+}
+
+// createdKey 生成创建时间索引的 key，创建时间为零值时使用入库时间
+func createdKey(created time.Time, key []byte) []byte {
+	k := make([]byte, 0, 8+len(key))
+	if created.IsZero() {
+		k = append(k, key[:8]...)
+	} else {
+		k = append(k, invertedTime(created)...)
+	}
+	return append(k, key...)
+}
+
+// listCursor 按从新到旧的顺序遍历列表中时间范围内的记录
+//
+// byCreated 时遍历创建时间索引，位置为索引的 key，可按时间范围两端精确定位；
+// 否则按入库顺序遍历记录本身，位置为记录的 key。入库时间不早于创建时间，
+// 两种方式都可在位置的时间早于 from 时停止，其余条件由 matchFilters 逐条检查
+type listCursor struct {
+	records     *bolt.Bucket
+	cursor      *bolt.Cursor
+	byCreated   bool
+	start, stop []byte // 未指定的一端为 nil
+}
+
+// newListCursor 创建遍历 bucket 中记录的游标，byCreated 为 true 且指定了时间范围时使用创建时间索引
+func newListCursor(tx *bolt.Tx, bucket []byte, f *searchFilter, byCreated bool) *listCursor {
+	lc := &listCursor{records: tx.Bucket(bucket)}
+	if !f.from.IsZero() {
+		lc.stop = invertedTime(f.from)
+	}
+	if byCreated && (!f.from.IsZero() || !f.to.IsZero()) {
+		lc.byCreated = true
+		lc.cursor = tx.Bucket(createdIndexBucket(bucket)).Cursor()
+		if !f.to.IsZero() {
+			lc.start = invertedTime(f.to)
+		}
+	} else {
+		lc.cursor = lc.records.Cursor()
+	}
+	return lc
+}
+
+// seek 定位到 after 之后的第一条记录，after 为空或早于起点时定位到起点
+func (lc *listCursor) seek(after []byte) ([]byte, []byte) {
+	if after != nil && bytes.Compare(after, lc.start) >= 0 {
+		k, v := lc.cursor.Seek(after)
+		if k != nil && bytes.Equal(k, after) {
+			k, v = lc.cursor.Next()
+		}
+		return lc.record(k, v)
+	}
+	if lc.start != nil {
+		return lc.record(lc.cursor.Seek(lc.start))
+	}
+	return lc.record(lc.cursor.First())
+}
+
+// next 移动到下一条记录
+func (lc *listCursor) next() ([]byte, []byte) {
+	return lc.record(lc.cursor.Next())
+}
 
-	// 使用反转的时间戳（最大值减去当前时间）来实现倒序
-	// 这样最新的记录会有最小的key值，在BoltDB中排在最前面
-	invertedTime := uint64(1<<63 - 1 - now) // 使用63位最大值
+// record 返回位置与对应的记录，位置的时间早于时间范围的起始时间时返回 nil
+func (lc *listCursor) record(k, v []byte) ([]byte, []byte) {
+	if k == nil || lc.stop != nil && bytes.Compare(k[:8], lc.stop) > 0 {
+		return nil, nil
+	}
+	if lc.byCreated {
+		v = lc.records.Get(k[8:])
+	}
+	return k, v
+}
 
+// timeKey 生成以当前时间（入库时间）为前缀的key
+func timeKey(tx *bolt.Tx, b *bolt.Bucket) []byte {
 	// 获取序列号（BoltDB的NextSequence）
 	seq, _ := b.NextSequence()
 
 	// 组合成16字节的key: 8字节倒序时间戳 + 8字节序列号
+	// 最新的记录有最小的key值，在BoltDB中排在最前面
 	key := make([]byte, 16)
-	binary.BigEndian.PutUint64(key[:8], invertedTime)
+	copy(key[:8], invertedTime(time.Now()))
 	binary.BigEndian.PutUint64(key[8:], seq)
 
 	return key
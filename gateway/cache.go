@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,20 +16,50 @@ import (
 
 // CacheInterface 定义缓存接口，支持多种实现
 type CacheInterface interface {
-	SetWaitCache(key uint32, message SmsMes) error
-	GetWaitCache(key uint32) (SmsMes, error)
-	GetWaitList() []SmsMes // 获取所有等待响应的消息
+	SetWaitCache(gen uint64, seq uint32, message SmsMes) error
+	GetWaitCache(gen uint64, seq uint32) (SmsMes, error)
+	GetWaitList() []SmsMes                                              // 获取所有等待响应的消息
+	LookupWait(indexKey string) (SmsMes, bool)                          // 按索引键（见 messageIndexKeys）查找等待响应的消息
+	DrainStaleWait(channel string, currentGen uint64) ([]SmsMes, error) // 取出并删除该通道非当前连接代次的等待消息
 	AddSubmits(mes *SmsMes) error
+	CompleteWaitCache(gen uint64, seq uint32, fill func(mes *SmsMes)) (SmsMes, error)
 	AddMoList(mes *SmsMes) error
+	ApplyReceipt(msgId string, result uint32, stat string) (SmsMes, bool, error) // 将状态报告写入对应的下发记录，返回更新后的记录
+	AddOrphanReceipt(mes *SmsMes) error                                          // 记录无法匹配的状态报告
 	Length(listName string) int
 	GetStats() map[string]int
 	GetList(listName string, start, end int) *[]SmsMes
 	SearchList(listName string, filters map[string]string, start, end int) *[]SmsMes
 	GetSearchCount(listName string, filters map[string]string) int
+	// 按从新到旧的顺序逐条遍历匹配的记录，用于导出
+	ForEachMessage(listName string, filters map[string]string, fn func(mes *SmsMes) error) error
+	// 从 after（上一页最后一条的位置，nil 表示从最新开始）之后按从新到旧取最多 limit 条匹配的记录，
+	// 还有更多记录时返回本页最后一条的位置；位置不受新写入记录的影响
+	PageMessages(listName string, filters map[string]string, after []byte, limit int) ([]SmsMes, []byte, error)
+	ReserveNonce(key string, ttl time.Duration) (bool, error) // 登记请求随机数，ttl 内重复返回 false
+	LookupMessage(indexKey string) (SmsMes, bool)             // 按索引键（见 messageIndexKeys）查找下发记录
+	SaveWebhook(d *WebhookDelivery) error                     // 新增或覆盖 Webhook 投递记录，并递增 d.Revision
+	// 仅当存储中记录的 Revision 与 d.Revision 相同时保存并递增 d.Revision，
+	// 返回 false 表示记录已被其他请求修改或已删除
+	UpdateWebhook(d *WebhookDelivery) (bool, error)
+	GetWebhook(id string) (WebhookDelivery, bool)
+	DeleteWebhook(id string) error
+	DueWebhooks(now time.Time, limit int) []WebhookDelivery // 到期的待投递记录，按下次投递时间排序，最多 limit 条
+	ListWebhooks() []WebhookDelivery                        // 所有未成功的投递记录，按创建时间排序
+	Ping() error                                            // 检查存储是否可用
+	SaveUser(u *ConsoleUser) error                          // 新增或更新管理界面用户
+	GetUser(name string) (ConsoleUser, bool)
+	DeleteUser(name string) error
+	ListUsers() []ConsoleUser // 按用户名排序
+	// 返回 [from, to) 范围内按 resolution（minute、hour 或 day）汇总的数量，没有记录的时间段数量为零
+	GetTimeSeries(resolution string, from, to time.Time) ([]StatsPoint, error)
+	// 返回某个客户端累计的下发与上行数量（Delivered 不统计）
+	GetClientStats(client string) (StatCounts, error)
 }
 
 type Cache struct {
-	pool *redis.Pool
+	pool        *redis.Pool
+	maxMessages int // list_message 最多保留的记录数，0 表示不限制
 }
 
 var SCache CacheInterface
@@ -105,7 +136,16 @@ func StartCache(config *Config) {
 		log.Fatalf("连接Redis出错[%v]", err)
 	}
 
-	cache := &Cache{pool: pool}
+	cache := &Cache{pool: pool, maxMessages: config.RedisMaxMessages}
+	if added, err := redis.Int(backfillMessageIndexScript.Do(conn, "list_message", "message_data", "message_index", "meta:message_index",
+		newMessageId()[:12], time.Now().Format(time.RFC3339), indexById, indexByMsgId, indexByClientRef)); err != nil {
+		Warnf("[CACHE] 补建消息索引失败: %v", err)
+	} else if added > 0 {
+		Infof("[CACHE] 已为 %d 条旧的下发记录补建索引", added)
+	}
+	if _, err := initStatsTotalScript.Do(conn, "list_message", "list_mo", "stats:total", "meta:stats_total", time.Now().Format(time.RFC3339)); err != nil {
+		Warnf("[CACHE] 初始化累计统计失败: %v", err)
+	}
 	SCache = cache
 	Infof("[CACHE] 连接 Redis 成功: %s", config.RedisHost+":"+config.RedisPort)
 }
@@ -121,8 +161,14 @@ func StopCache() {
 	}
 }
 
+// waitField 生成等待队列的 hash field：连接代次:序列号
+// gocmpp 每次重连都会从 0 开始分配 SeqId，单独使用 SeqId 会与上一个连接的记录冲突
+func waitField(gen uint64, seq uint32) string {
+	return strconv.FormatUint(gen, 10) + ":" + strconv.FormatUint(uint64(seq), 10)
+}
+
 // 将发送的记录转为json放到redis中保存下来,为异步返回的submit reponse做准备
-func (c *Cache) SetWaitCache(key uint32, message SmsMes) error {
+func (c *Cache) SetWaitCache(gen uint64, seq uint32, message SmsMes) error {
 	if c.pool == nil {
 		Warnf("[CACHE] Redis 连接池未初始化，跳过 SetWaitCache")
 		return errors.New("cache pool not initialized")
@@ -131,24 +177,49 @@ func (c *Cache) SetWaitCache(key uint32, message SmsMes) error {
 	defer conn.Close()
 
 	data, _ := json.Marshal(message)
-	_, err := conn.Do("HSET", "waitseqcache", strconv.FormatUint(uint64(key), 10), data)
+	field := waitField(gen, seq)
+	conn.Send("MULTI")
+	conn.Send("HSET", "waitseqcache", field, data)
+	for _, key := range messageIndexKeys(&message) {
+		conn.Send("HSET", "wait_index", key, field)
+	}
+	_, err := conn.Do("EXEC")
 	return err
 }
 
-func (c *Cache) GetWaitCache(key uint32) (SmsMes, error) {
+// sendDelWaitIndex 在 MULTI 中追加删除等待消息索引的命令
+// 索引可能已指向同一标识的新等待消息，只有仍指向 field 时才删除
+func sendDelWaitIndex(conn redis.Conn, field string, mes *SmsMes) {
+	for _, key := range messageIndexKeys(mes) {
+		delWaitIndexScript.Send(conn, "wait_index", key, field)
+	}
+}
+
+// delWaitIndexScript 仅当索引键仍指向给定的等待条目时删除
+var delWaitIndexScript = redis.NewScript(1, `
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+func (c *Cache) GetWaitCache(gen uint64, seq uint32) (SmsMes, error) {
 	if c.pool == nil {
 		return SmsMes{}, errors.New("cache pool not initialized")
 	}
 	conn := c.pool.Get()
 	defer conn.Close()
 
-	seq_id := strconv.FormatUint(uint64(key), 10)
+	seq_id := waitField(gen, seq)
 	ret, _ := redis.String(conn.Do("HGET", "waitseqcache", seq_id))
 	mes := SmsMes{}
 	if ret != "" {
 		//从json还原为对象
 		json.Unmarshal([]byte(ret), &mes)
-		conn.Do("HDEL", "waitseqcache", seq_id)
+		conn.Send("MULTI")
+		conn.Send("HDEL", "waitseqcache", seq_id)
+		sendDelWaitIndex(conn, seq_id, &mes)
+		conn.Do("EXEC")
 		return mes, nil
 	} else {
 		return mes, errors.New("no key in cache")
@@ -156,6 +227,38 @@ func (c *Cache) GetWaitCache(key uint32) (SmsMes, error) {
 
 }
 
+// CompleteWaitCache 取出等待缓存中的消息，由 fill 填入提交结果后写入下发记录
+// 写入记录、建立索引与删除等待条目在同一个 MULTI 中执行，查询不会在两者之间落空
+func (c *Cache) CompleteWaitCache(gen uint64, seq uint32, fill func(mes *SmsMes)) (SmsMes, error) {
+	mes := SmsMes{}
+	if c.pool == nil {
+		return mes, errors.New("cache pool not initialized")
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	field := waitField(gen, seq)
+	data, err := redis.Bytes(conn.Do("HGET", "waitseqcache", field))
+	if err != nil {
+		return mes, errors.New("no key in cache")
+	}
+	if err := json.Unmarshal(data, &mes); err != nil {
+		return mes, err
+	}
+
+	indexed := mes
+	fill(&mes)
+	conn.Send("MULTI")
+	sendSubmit(conn, &mes)
+	conn.Send("HDEL", "waitseqcache", field)
+	sendDelWaitIndex(conn, field, &indexed)
+	if _, err = conn.Do("EXEC"); err != nil {
+		return mes, err
+	}
+	c.trimMessages(conn)
+	return mes, nil
+}
+
 // GetWaitList 获取所有等待响应的消息
 func (c *Cache) GetWaitList() []SmsMes {
 	if c.pool == nil {
@@ -181,6 +284,67 @@ func (c *Cache) GetWaitList() []SmsMes {
 	return result
 }
 
+// LookupWait 按索引键查找等待响应的消息
+func (c *Cache) LookupWait(indexKey string) (SmsMes, bool) {
+	mes := SmsMes{}
+	if c.pool == nil {
+		return mes, false
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	field, err := redis.String(conn.Do("HGET", "wait_index", indexKey))
+	if err != nil {
+		return mes, false
+	}
+	data, err := redis.Bytes(conn.Do("HGET", "waitseqcache", field))
+	if err != nil || json.Unmarshal(data, &mes) != nil {
+		return mes, false
+	}
+	return mes, true
+}
+
+// DrainStaleWait 取出并删除指定通道上所有不属于当前连接代次的等待消息
+// 旧连接上的响应不会再到达，调用者需要显式地为这些消息给出最终结果；其他通道的等待消息不受影响
+func (c *Cache) DrainStaleWait(channel string, currentGen uint64) ([]SmsMes, error) {
+	if c.pool == nil {
+		return nil, errors.New("cache pool not initialized")
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	entries, err := redis.StringMap(conn.Do("HGETALL", "waitseqcache"))
+	if err != nil {
+		return nil, err
+	}
+
+	current := strconv.FormatUint(currentGen, 10) + ":"
+	result := make([]SmsMes, 0)
+	for field, value := range entries {
+		if strings.HasPrefix(field, current) {
+			continue
+		}
+		mes := SmsMes{}
+		parsed := json.Unmarshal([]byte(value), &mes) == nil
+		if parsed && channelOf(&mes) != channel {
+			continue
+		}
+		// HDEL 返回 0 说明已被其他协程取走（例如迟到的响应），不再重复处理
+		removed, err := redis.Int(conn.Do("HDEL", "waitseqcache", field))
+		if err != nil || removed == 0 {
+			continue
+		}
+		if parsed {
+			result = append(result, mes)
+			conn.Send("MULTI")
+			sendDelWaitIndex(conn, field, &mes)
+			conn.Do("EXEC")
+		}
+	}
+
+	return result, nil
+}
+
 func (c *Cache) AddSubmits(mes *SmsMes) error {
 	if c.pool == nil {
 		Warnf("[CACHE] Redis 连接池未初始化，跳过 AddSubmits")
@@ -189,13 +353,129 @@ func (c *Cache) AddSubmits(mes *SmsMes) error {
 	conn := c.pool.Get()
 	defer conn.Close()
 
+	conn.Send("MULTI")
+	sendSubmit(conn, mes)
+	if _, err := conn.Do("EXEC"); err != nil {
+		return err
+	}
+	c.trimMessages(conn)
+	return nil
+}
+
+// sendSubmit 在 MULTI 中追加写入下发记录、索引和统计的命令
+func sendSubmit(conn redis.Conn, mes *SmsMes) {
 	//将submit结果提交到redis的队列存放
 	data, _ := json.Marshal(mes)
 	//新的记录加在头部,自然就倒序排列了
-	_, err := conn.Do("LPUSH", "list_message", data)
-	//只保留最近五十条
-	//conn.Do("LTRIM", "submitlist", "0", "49")
-	return err
+	conn.Send("LPUSH", "list_message", data)
+	// 按网关标识另存一份并建立索引，用于单条查询；超过 redis_max_messages 的记录由 trimMessages 删除
+	if mes.Id != "" {
+		conn.Send("HSET", "message_data", mes.Id, data)
+		for _, key := range messageIndexKeys(mes) {
+			conn.Send("HSET", "message_index", key, mes.Id)
+		}
+	}
+	sendStats(conn, statsTime(mes.SubmitTime), submitCounts(mes))
+	sendClientStats(conn, mes.Client, submitCounts(mes))
+}
+
+// trimMessagesScript 删除 list_message 中超出数量上限的最旧记录，以及它们在 message_data 中的记录和指向它们的索引
+//
+// 索引键按 message_data 中的当前记录计算（列表中的记录不含之后写入的字段），已指向其他记录的索引保留
+// 删除的记录数累加到 KEYS[4]，分页与遍历据此修正位置（见 listState）
+var trimMessagesScript = redis.NewScript(4, `
+local removed = 0
+local n = redis.call('LLEN', KEYS[1]) - tonumber(ARGV[1])
+while n > 0 do
+	local v = redis.call('RPOP', KEYS[1])
+	n = n - 1
+	removed = removed + 1
+	local ok, mes = pcall(cjson.decode, v)
+	if ok and type(mes) == 'table' and type(mes['Id']) == 'string' and mes['Id'] ~= '' then
+		local id = mes['Id']
+		local cur = redis.call('HGET', KEYS[2], id)
+		if cur then
+			local ok2, m = pcall(cjson.decode, cur)
+			if ok2 and type(m) == 'table' then
+				mes = m
+			end
+		end
+		local keys = {ARGV[2] .. id}
+		if type(mes['MsgId']) == 'string' and mes['MsgId'] ~= '' and mes['SubmitResult'] == 0 then
+			table.insert(keys, ARGV[3] .. mes['MsgId'])
+		end
+		if type(mes['ClientRef']) == 'string' and mes['ClientRef'] ~= '' then
+			table.insert(keys, ARGV[4] .. tostring(mes['Client'] or '') .. ':' .. mes['ClientRef'])
+		end
+		for _, key in ipairs(keys) do
+			if redis.call('HGET', KEYS[3], key) == id then
+				redis.call('HDEL', KEYS[3], key)
+			end
+		end
+		redis.call('HDEL', KEYS[2], id)
+	end
+end
+if removed > 0 then
+	redis.call('INCRBY', KEYS[4], removed)
+end
+return removed
+`)
+
+// trimMessages 在配置了 redis_max_messages 时删除超出上限的最旧下发记录
+func (c *Cache) trimMessages(conn redis.Conn) {
+	if c.maxMessages <= 0 {
+		return
+	}
+	if _, err := trimMessagesScript.Do(conn, "list_message", "message_data", "message_index", trimmedKey("list_message"),
+		c.maxMessages, indexById, indexByMsgId, indexByClientRef); err != nil {
+		Warnf("[CACHE] Failed to trim message list: %v", err)
+	}
+}
+
+// trimmedKey 返回记录列表已从表尾删除的记录数的键
+func trimmedKey(listName string) string {
+	return "meta:trimmed:" + listName
+}
+
+// listState 原子地读取列表长度与已从表尾删除的记录数
+//
+// 新记录从表头插入、旧记录从表尾删除，两次读取之间表头插入的记录数为长度增量加删除数的增量
+func listState(conn redis.Conn, listName string) (length, trimmed int, err error) {
+	conn.Send("MULTI")
+	conn.Send("LLEN", listName)
+	conn.Send("GET", trimmedKey(listName))
+	reply, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err = redis.Int(reply[0], nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if reply[1] != nil {
+		trimmed, err = redis.Int(reply[1], nil)
+	}
+	return length, trimmed, err
+}
+
+// LookupMessage 按索引键查找下发记录
+func (c *Cache) LookupMessage(indexKey string) (SmsMes, bool) {
+	mes := SmsMes{}
+	if c.pool == nil {
+		return mes, false
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	id, err := redis.String(conn.Do("HGET", "message_index", indexKey))
+	if err != nil {
+		return mes, false
+	}
+	data, err := redis.Bytes(conn.Do("HGET", "message_data", id))
+	if err != nil || json.Unmarshal(data, &mes) != nil {
+		return mes, false
+	}
+	return mes, true
 }
 
 func (c *Cache) AddMoList(mes *SmsMes) error {
@@ -209,87 +489,522 @@ func (c *Cache) AddMoList(mes *SmsMes) error {
 	//将submit结果提交到redis的队列存放
 	data, _ := json.Marshal(mes)
 	//新的记录加在头部,自然就倒序排列了
-	_, err := conn.Do("LPUSH", "list_mo", data)
+	conn.Send("MULTI")
+	conn.Send("LPUSH", "list_mo", data)
 	//只保留最近五十条
 	//conn.Do("LTRIM", "molist", "0", "49")
+	sendStats(conn, statsTime(mes.Created), StatCounts{MO: 1})
+	sendClientStats(conn, mes.Client, StatCounts{MO: 1})
+	_, err := conn.Do("EXEC")
 	return err
 }
 
-func (c *Cache) Length(listName string) int {
-	if listName == "" || c.pool == nil {
-		return 0
+// applyReceiptScript 在 Redis 端原子地通过 message_index 找到 MsgId 对应的记录，并更新 message_data 中的记录
+//
+// message_data 是下发记录状态的来源，list_message 只保存提交时的记录用于排序，
+// 读取列表时以 message_data 中的记录为准（见 decodeMessages）
+// 返回 {状态, 更新后的记录}，状态 0 表示未找到，1 表示已更新，2 表示记录中已是相同的状态（重复的状态报告）
+var applyReceiptScript = redis.NewScript(2, `
+local id = redis.call('HGET', KEYS[1], ARGV[1])
+if not id then
+	return {0}
+end
+local item = redis.call('HGET', KEYS[2], id)
+if not item then
+	return {0}
+end
+local ok, mes = pcall(cjson.decode, item)
+if not ok then
+	return {0}
+end
+local prev = mes['DeliveryStat']
+mes['DelivleryResult'] = tonumber(ARGV[2])
+mes['DeliveryStat'] = ARGV[3]
+mes['ReceiptTime'] = ARGV[4]
+local data = cjson.encode(mes)
+redis.call('HSET', KEYS[2], id, data)
+if prev == ARGV[3] then
+	return {2, data}
+end
+return {1, data}
+`)
+
+// ApplyReceipt 将状态报告写入 MsgId 对应的下发记录
+func (c *Cache) ApplyReceipt(msgId string, result uint32, stat string) (SmsMes, bool, error) {
+	mes := SmsMes{}
+	if c.pool == nil {
+		return mes, false, errors.New("cache pool not initialized")
 	}
 	conn := c.pool.Get()
 	defer conn.Close()
 
-	size, _ := redis.Int(conn.Do("LLEN", listName))
-	return size
+	now := time.Now()
+	reply, err := redis.Values(applyReceiptScript.Do(conn, "message_index", "message_data", indexByMsgId+msgId, result, stat, now.Format(time.RFC3339Nano)))
+	if err != nil {
+		return mes, false, err
+	}
+	matched, _ := redis.Int(reply[0], nil)
+	if matched == 0 {
+		return mes, false, nil
+	}
+	if data, err := redis.Bytes(reply[1], nil); err == nil {
+		json.Unmarshal(data, &mes)
+	}
+	if matched == 1 && stat == "DELIVRD" {
+		conn.Send("MULTI")
+		sendStats(conn, now, StatCounts{Delivered: 1})
+		if _, err := conn.Do("EXEC"); err != nil {
+			Warnf("[CACHE] Failed to update statistics for MsgId=%s: %v", msgId, err)
+		}
+	}
+	return mes, true, nil
 }
 
-// GetStats 获取短信统计信息
-func (c *Cache) GetStats() map[string]int {
+// sendStats 在事务中将数量累加到各粒度的统计哈希表（stats:<粒度前缀><时间段>），并设置过期时间
+func sendStats(conn redis.Conn, t time.Time, d StatCounts) {
+	for _, res := range statsResolutions {
+		key := "stats:" + res.key(t)
+		for field, v := range d.fields() {
+			if *v != 0 {
+				conn.Send("HINCRBY", key, field, *v)
+			}
+		}
+		conn.Send("EXPIRE", key, int(res.retention/time.Second))
+	}
+	for field, v := range d.fields() {
+		if *v != 0 {
+			conn.Send("HINCRBY", "stats:total", field, *v)
+		}
+	}
+}
+
+// backfillMessageIndexScript 为建立索引之前写入的下发记录补建 message_data 与 message_index，只执行一次
+//
+// 升级前的记录没有网关标识，按 ARGV[1] 前缀加序号生成并写回列表，之后与新记录一样以 message_data 为准。
+// 从最新的记录开始，已有的键不覆盖，重复的 MsgId 指向最新的记录。返回补建的记录数
+var backfillMessageIndexScript = redis.NewScript(4, `
+if redis.call('EXISTS', KEYS[4]) == 1 then
+	return 0
+end
+local added = 0
+local n = redis.call('LLEN', KEYS[1])
+for i = 0, n - 1, 1000 do
+	for j, v in ipairs(redis.call('LRANGE', KEYS[1], i, i + 999)) do
+		local ok, mes = pcall(cjson.decode, v)
+		if ok and type(mes) == 'table' then
+			local id, data = mes['Id'], v
+			if type(id) ~= 'string' or id == '' then
+				id = string.format('%s%012x', ARGV[1], i + j)
+				mes['Id'] = id
+				data = cjson.encode(mes)
+				redis.call('LSET', KEYS[1], i + j - 1, data)
+			end
+			if redis.call('HSETNX', KEYS[2], id, data) == 1 then
+				added = added + 1
+			end
+			redis.call('HSETNX', KEYS[3], ARGV[3] .. id, id)
+			if type(mes['MsgId']) == 'string' and mes['MsgId'] ~= '' and mes['SubmitResult'] == 0 then
+				redis.call('HSETNX', KEYS[3], ARGV[4] .. mes['MsgId'], id)
+			end
+			if type(mes['ClientRef']) == 'string' and mes['ClientRef'] ~= '' then
+				redis.call('HSETNX', KEYS[3], ARGV[5] .. tostring(mes['Client'] or '') .. ':' .. mes['ClientRef'], id)
+			end
+		end
+	end
+end
+redis.call('SET', KEYS[4], ARGV[2])
+return added
+`)
+
+// initStatsTotalScript 按已有记录初始化累计统计（stats:total），只执行一次
+//
+// 升级前的版本没有累计统计；脚本在 Redis 中原子执行，计数与列表中的记录保持一致，
+// 之后写入记录与累加统计在同一个 MULTI 中完成。列表中的记录不含状态报告，投递成功数不重建
+var initStatsTotalScript = redis.NewScript(4, `
+if redis.call('EXISTS', KEYS[4]) == 1 then
+	return 0
+end
+local submitted, succeeded = 0, 0
+local n = redis.call('LLEN', KEYS[1])
+for i = 0, n - 1, 1000 do
+	for _, v in ipairs(redis.call('LRANGE', KEYS[1], i, i + 999)) do
+		local ok, mes = pcall(cjson.decode, v)
+		if ok then
+			submitted = submitted + 1
+			if mes['SubmitResult'] == 0 then
+				succeeded = succeeded + 1
+			end
+		end
+	end
+end
+redis.call('HMSET', KEYS[3], 'submitted', submitted, 'succeeded', succeeded, 'failed', submitted - succeeded, 'mo', redis.call('LLEN', KEYS[2]))
+redis.call('SET', KEYS[4], ARGV[1])
+return 1
+`)
+
+// sendClientStats 在事务中将数量累加到客户端的累计统计（client_stats:<客户端>），不计状态报告
+func sendClientStats(conn redis.Conn, client string, d StatCounts) {
+	if client == "" {
+		return
+	}
+	d.Delivered = 0
+	for field, v := range d.fields() {
+		if *v != 0 {
+			conn.Send("HINCRBY", "client_stats:"+client, field, *v)
+		}
+	}
+}
+
+// GetClientStats 读取客户端的累计统计
+func (c *Cache) GetClientStats(client string) (StatCounts, error) {
+	counts := StatCounts{}
 	if c.pool == nil {
-		return map[string]int{
-			"total":   0,
-			"success": 0,
-			"failed":  0,
+		return counts, errors.New("cache pool not initialized")
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.Int64Map(conn.Do("HGETALL", "client_stats:"+client))
+	if err != nil {
+		return counts, err
+	}
+	for field, v := range counts.fields() {
+		*v = values[field]
+	}
+	return counts, nil
+}
+
+// GetTimeSeries 通过管道批量读取 [from, to) 范围内各时间段的统计
+func (c *Cache) GetTimeSeries(resolution string, from, to time.Time) ([]StatsPoint, error) {
+	res, ok := findStatsResolution(resolution)
+	if !ok {
+		return nil, fmt.Errorf("unknown resolution %s", resolution)
+	}
+	if c.pool == nil {
+		return nil, errors.New("cache pool not initialized")
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	periods := res.periods(from, to)
+	for _, t := range periods {
+		conn.Send("HGETALL", "stats:"+res.key(t))
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	result := make([]StatsPoint, len(periods))
+	for i, t := range periods {
+		values, err := redis.Int64Map(conn.Receive())
+		if err != nil {
+			return nil, err
+		}
+		result[i].Time = t
+		for field, v := range result[i].fields() {
+			*v = values[field]
 		}
 	}
+	return result, nil
+}
+
+// AddOrphanReceipt 记录超时仍未匹配到消息的状态报告
+func (c *Cache) AddOrphanReceipt(mes *SmsMes) error {
+	if c.pool == nil {
+		Warnf("[CACHE] Redis 连接池未初始化，跳过 AddOrphanReceipt")
+		return errors.New("cache pool not initialized")
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	data, _ := json.Marshal(mes)
+	_, err := conn.Do("LPUSH", "list_orphan", data)
+	return err
+}
 
+// ReserveNonce 以 SET NX EX 登记随机数，键已存在时返回 false
+func (c *Cache) ReserveNonce(key string, ttl time.Duration) (bool, error) {
+	if c.pool == nil {
+		return false, errors.New("cache pool not initialized")
+	}
 	conn := c.pool.Get()
 	defer conn.Close()
 
-	stats := map[string]int{
-		"total":   0,
-		"success": 0,
-		"failed":  0,
+	secs := int(ttl / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	_, err := redis.String(conn.Do("SET", "nonce:"+key, 1, "EX", secs, "NX"))
+	if err == redis.ErrNil {
+		return false, nil
 	}
+	return err == nil, err
+}
 
-	// 获取总记录数
-	total, _ := redis.Int(conn.Do("LLEN", "list_message"))
-	stats["total"] = total
+// saveWebhookScript 原子地写入 Webhook 投递记录
+//
+// 待投递的记录保存在 webhook_outbox 哈希表，并按下次投递时间（毫秒）加入 webhook_due 有序集合；
+// 失败的记录保存在 webhook_failed 哈希表。ARGV[2] 非空时仅当存储中记录的 Revision 与之相同时写入，
+// 返回 0 表示记录已被修改或删除
+var saveWebhookScript = redis.NewScript(3, `
+local cur = redis.call('HGET', KEYS[1], ARGV[1]) or redis.call('HGET', KEYS[2], ARGV[1])
+if ARGV[2] ~= '' then
+	if not cur then
+		return 0
+	end
+	local ok, d = pcall(cjson.decode, cur)
+	if not ok or tostring(d['Revision'] or 0) ~= ARGV[2] then
+		return 0
+	end
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+if ARGV[4] == 'failed' then
+	redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+else
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+	redis.call('ZADD', KEYS[3], ARGV[5], ARGV[1])
+end
+return 1
+`)
 
-	// 如果记录数太多，只统计最近1000条以避免性能问题
-	sampleSize := total
-	if sampleSize > 1000 {
-		sampleSize = 1000
+// writeWebhook 写入记录并递增 Revision，checkRevision 为 true 时要求存储中的记录未被修改
+func (c *Cache) writeWebhook(d *WebhookDelivery, checkRevision bool) (bool, error) {
+	if c.pool == nil {
+		return false, errors.New("cache pool not initialized")
 	}
+	conn := c.pool.Get()
+	defer conn.Close()
 
-	// 获取样本数据
-	values, err := redis.Strings(conn.Do("LRANGE", "list_message", 0, sampleSize-1))
+	expect := ""
+	if checkRevision {
+		expect = strconv.FormatInt(d.Revision, 10)
+	}
+	next := *d
+	next.Revision++
+	data, err := json.Marshal(&next)
 	if err != nil {
-		return stats
+		return false, err
+	}
+	saved, err := redis.Int(saveWebhookScript.Do(conn, "webhook_outbox", "webhook_failed", "webhook_due",
+		d.Id, expect, data, d.Status, d.NextAttempt.UnixMilli()))
+	if err != nil || saved == 0 {
+		return false, err
 	}
+	d.Revision = next.Revision
+	return true, nil
+}
 
-	// 统计成功和失败数量
-	successCount := 0
-	failedCount := 0
-	waitingCount := 0
+// SaveWebhook 新增或覆盖投递记录
+func (c *Cache) SaveWebhook(d *WebhookDelivery) error {
+	_, err := c.writeWebhook(d, false)
+	return err
+}
 
-	for _, value := range values {
-		mes := SmsMes{}
-		if err := json.Unmarshal([]byte(value), &mes); err == nil {
-			if mes.SubmitResult == 0 {
-				successCount++
-			} else if mes.SubmitResult == 65535 {
-				waitingCount++ // 等待响应，不算失败
-			} else {
-				failedCount++ // 其他状态都算失败
+// UpdateWebhook 在存储中的记录未被修改时保存
+func (c *Cache) UpdateWebhook(d *WebhookDelivery) (bool, error) {
+	return c.writeWebhook(d, true)
+}
+
+// GetWebhook 获取投递记录
+func (c *Cache) GetWebhook(id string) (WebhookDelivery, bool) {
+	d := WebhookDelivery{}
+	if c.pool == nil {
+		return d, false
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	for _, key := range []string{"webhook_outbox", "webhook_failed"} {
+		data, err := redis.Bytes(conn.Do("HGET", key, id))
+		if err == nil {
+			return d, json.Unmarshal(data, &d) == nil
+		}
+	}
+	return d, false
+}
+
+// DeleteWebhook 删除已投递成功的记录
+func (c *Cache) DeleteWebhook(id string) error {
+	if c.pool == nil {
+		return errors.New("cache pool not initialized")
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	conn.Send("MULTI")
+	conn.Send("HDEL", "webhook_outbox", id)
+	conn.Send("HDEL", "webhook_failed", id)
+	conn.Send("ZREM", "webhook_due", id)
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+// DueWebhooks 按 webhook_due 取出到期的记录，不读取其他记录
+func (c *Cache) DueWebhooks(now time.Time, limit int) []WebhookDelivery {
+	if c.pool == nil {
+		return nil
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	ids, err := redis.Strings(conn.Do("ZRANGEBYSCORE", "webhook_due", "-inf", now.UnixMilli(), "LIMIT", 0, limit))
+	if err != nil {
+		Errorf("[CACHE] Failed to list due webhooks: %v", err)
+		return nil
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	values, err := redis.ByteSlices(conn.Do("HMGET", redis.Args{"webhook_outbox"}.AddFlat(ids)...))
+	if err != nil {
+		Errorf("[CACHE] Failed to load due webhooks: %v", err)
+		return nil
+	}
+	list := make([]WebhookDelivery, 0, len(values))
+	for _, v := range values {
+		d := WebhookDelivery{}
+		if v != nil && json.Unmarshal(v, &d) == nil {
+			list = append(list, d)
+		}
+	}
+	return list
+}
+
+// ListWebhooks 获取所有投递记录
+func (c *Cache) ListWebhooks() []WebhookDelivery {
+	if c.pool == nil {
+		return nil
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	var list []WebhookDelivery
+	for _, key := range []string{"webhook_outbox", "webhook_failed"} {
+		values, err := redis.ByteSlices(conn.Do("HVALS", key))
+		if err != nil {
+			Errorf("[CACHE] Failed to list %s: %v", key, err)
+			return nil
+		}
+		for _, v := range values {
+			d := WebhookDelivery{}
+			if json.Unmarshal(v, &d) == nil {
+				list = append(list, d)
 			}
 		}
 	}
+	sortWebhooks(list)
+	return list
+}
 
-	// 基于样本估算总体统计
-	if total > sampleSize {
-		ratio := float64(total) / float64(sampleSize)
-		stats["success"] = int(float64(successCount) * ratio)
-		stats["failed"] = int(float64(failedCount) * ratio)
-	} else {
-		stats["success"] = successCount
-		stats["failed"] = failedCount
+// SaveUser 新增或更新管理界面用户
+func (c *Cache) SaveUser(u *ConsoleUser) error {
+	if c.pool == nil {
+		return errors.New("cache pool not initialized")
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Do("HSET", "console_users", u.Name, data)
+	return err
+}
+
+// GetUser 获取管理界面用户
+func (c *Cache) GetUser(name string) (ConsoleUser, bool) {
+	u := ConsoleUser{}
+	if c.pool == nil {
+		return u, false
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("HGET", "console_users", name))
+	if err != nil || json.Unmarshal(data, &u) != nil {
+		return u, false
+	}
+	return u, true
+}
+
+// DeleteUser 删除管理界面用户
+func (c *Cache) DeleteUser(name string) error {
+	if c.pool == nil {
+		return errors.New("cache pool not initialized")
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HDEL", "console_users", name)
+	return err
+}
+
+// ListUsers 获取所有管理界面用户（按用户名排序）
+func (c *Cache) ListUsers() []ConsoleUser {
+	if c.pool == nil {
+		return nil
 	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.ByteSlices(conn.Do("HVALS", "console_users"))
+	if err != nil {
+		Errorf("[CACHE] Failed to list console users: %v", err)
+		return nil
+	}
+	list := make([]ConsoleUser, 0, len(values))
+	for _, v := range values {
+		u := ConsoleUser{}
+		if json.Unmarshal(v, &u) == nil {
+			list = append(list, u)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Ping 检查 Redis 连接
+func (c *Cache) Ping() error {
+	if c.pool == nil {
+		return errors.New("cache pool not initialized")
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
 
-	return stats
+	_, err := conn.Do("PING")
+	return err
+}
+
+func (c *Cache) Length(listName string) int {
+	if listName == "" || c.pool == nil {
+		return 0
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	size, _ := redis.Int(conn.Do("LLEN", listName))
+	return size
+}
+
+// GetStats 读取全部下发记录的累计统计
+func (c *Cache) GetStats() map[string]int {
+	total := StatCounts{}
+	if c.pool == nil {
+		return totalStats(total)
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.Int64Map(conn.Do("HGETALL", "stats:total"))
+	if err != nil {
+		Warnf("[CACHE] 读取累计统计失败: %v", err)
+	}
+	for field, v := range total.fields() {
+		*v = values[field]
+	}
+	return totalStats(total)
 }
 
 func (c *Cache) GetList(listName string, start, end int) *[]SmsMes {
@@ -306,16 +1021,61 @@ func (c *Cache) GetList(listName string, start, end int) *[]SmsMes {
 		return &[]SmsMes{}
 	}
 	v := make([]SmsMes, 0, len(values))
-	for _, s := range values {
-		mes := SmsMes{}
-		json.Unmarshal([]byte(s), &mes)
-		v = append(v, mes)
+	for _, mes := range decodeMessages(conn, listName, values) {
+		if mes == nil {
+			mes = &SmsMes{}
+		}
+		v = append(v, *mes)
 	}
 	return &v
 }
 
+// decodeMessages 解码列表中的记录，返回与 values 一一对应的结果，无法解码的为 nil
+//
+// list_message 中是提交时的记录，状态报告只更新 message_data，
+// 这里按网关标识批量读取 message_data，以其中的记录为准
+func decodeMessages(conn redis.Conn, listName string, values []string) []*SmsMes {
+	result := make([]*SmsMes, len(values))
+	var pos []int
+	for i, s := range values {
+		mes := &SmsMes{}
+		if json.Unmarshal([]byte(s), mes) != nil {
+			continue
+		}
+		result[i] = mes
+		if listName == "list_message" && mes.Id != "" {
+			pos = append(pos, i)
+		}
+	}
+	for len(pos) > 0 {
+		batch := pos
+		if len(batch) > exportBatchSize {
+			batch = batch[:exportBatchSize]
+		}
+		pos = pos[len(batch):]
+		args := redis.Args{"message_data"}
+		for _, i := range batch {
+			args = append(args, result[i].Id)
+		}
+		current, err := redis.ByteSlices(conn.Do("HMGET", args...))
+		if err != nil {
+			// 读取失败时退回提交时的记录
+			Warnf("[CACHE] Failed to load message data: %v", err)
+			return result
+		}
+		for j, data := range current {
+			mes := &SmsMes{}
+			if data != nil && json.Unmarshal(data, mes) == nil {
+				result[batch[j]] = mes
+			}
+		}
+	}
+	return result
+}
+
 // SearchList 在Redis中搜索消息列表
 func (c *Cache) SearchList(listName string, filters map[string]string, start, end int) *[]SmsMes {
+	f := newSearchFilter(filters)
 	if c.pool == nil {
 		return &[]SmsMes{}
 	}
@@ -336,14 +1096,9 @@ func (c *Cache) SearchList(listName string, filters map[string]string, start, en
 
 	// 过滤消息
 	var filteredMessages []SmsMes
-	for _, s := range values {
-		mes := SmsMes{}
-		if json.Unmarshal([]byte(s), &mes) != nil {
-			continue
-		}
-
-		if c.matchFilters(&mes, filters, listName) {
-			filteredMessages = append(filteredMessages, mes)
+	for _, mes := range decodeMessages(conn, listName, values) {
+		if mes != nil && c.matchFilters(mes, f, listName) {
+			filteredMessages = append(filteredMessages, *mes)
 		}
 	}
 
@@ -362,6 +1117,7 @@ func (c *Cache) SearchList(listName string, filters map[string]string, start, en
 
 // GetSearchCount 获取搜索结果的数量
 func (c *Cache) GetSearchCount(listName string, filters map[string]string) int {
+	f := newSearchFilter(filters)
 	if c.pool == nil {
 		return 0
 	}
@@ -382,13 +1138,8 @@ func (c *Cache) GetSearchCount(listName string, filters map[string]string) int {
 
 	// 统计匹配的消息数量
 	count := 0
-	for _, s := range values {
-		mes := SmsMes{}
-		if json.Unmarshal([]byte(s), &mes) != nil {
-			continue
-		}
-
-		if c.matchFilters(&mes, filters, listName) {
+	for _, mes := range decodeMessages(conn, listName, values) {
+		if mes != nil && c.matchFilters(mes, f, listName) {
 			count++
 		}
 	}
@@ -396,29 +1147,151 @@ func (c *Cache) GetSearchCount(listName string, filters map[string]string) int {
 	return count
 }
 
+// ForEachMessage 按从新到旧的顺序逐条遍历匹配的记录，fn 返回错误时停止并返回该错误
+//
+// 分批 LRANGE 读取；遍历期间新记录从表头插入，按表头插入的记录数修正偏移，避免重复输出。
+// 指定了 from 时，读到写入时间早于 from 的记录即停止（见 pastSearchRange）
+func (c *Cache) ForEachMessage(listName string, filters map[string]string, fn func(mes *SmsMes) error) error {
+	f := newSearchFilter(filters)
+	if c.pool == nil {
+		return nil
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	length, trimmed, err := listState(conn, listName)
+	if err != nil {
+		return err
+	}
+	for offset := 0; offset < length; {
+		values, err := redis.Strings(conn.Do("LRANGE", listName, offset, offset+exportBatchSize-1))
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		for _, mes := range decodeMessages(conn, listName, values) {
+			if mes == nil {
+				continue
+			}
+			if f.pastSearchRange(mes) {
+				return nil
+			}
+			if c.matchFilters(mes, f, listName) {
+				if err := fn(mes); err != nil {
+					return err
+				}
+			}
+		}
+		offset += len(values)
+
+		current, currentTrimmed, err := listState(conn, listName)
+		if err != nil {
+			return err
+		}
+		offset += current - length + currentTrimmed - trimmed
+		length, trimmed = current, currentTrimmed
+	}
+	return nil
+}
+
+// PageMessages 按游标分页读取记录
+//
+// 位置为记录距表尾（最旧一条）的下标加上已从表尾删除的记录数，新记录插入或旧记录删除时不变
+func (c *Cache) PageMessages(listName string, filters map[string]string, after []byte, limit int) ([]SmsMes, []byte, error) {
+	f := newSearchFilter(filters)
+	if c.pool == nil {
+		return nil, nil, errors.New("cache pool not initialized")
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	length, trimmed, err := listState(conn, listName)
+	if err != nil {
+		return nil, nil, err
+	}
+	offset := 0
+	if after != nil {
+		pos, err := strconv.Atoi(string(after))
+		if err != nil || pos < 0 {
+			return nil, nil, errInvalidCursor
+		}
+		offset = length + trimmed - pos
+	}
+
+	batch := limit + 1
+	if len(filters) > 0 {
+		batch = exportBatchSize
+	}
+	result := make([]SmsMes, 0, limit)
+	var last int
+	for offset >= 0 && offset < length {
+		values, err := redis.Strings(conn.Do("LRANGE", listName, offset, offset+batch-1))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(values) == 0 {
+			break
+		}
+		for i, mes := range decodeMessages(conn, listName, values) {
+			if mes == nil || !c.matchFilters(mes, f, listName) {
+				continue
+			}
+			if len(result) == limit {
+				// 多取到一条说明还有下一页
+				return result, []byte(strconv.Itoa(last)), nil
+			}
+			result = append(result, *mes)
+			last = trimmed + length - 1 - (offset + i)
+		}
+		offset += len(values)
+
+		current, currentTrimmed, err := listState(conn, listName)
+		if err != nil {
+			return nil, nil, err
+		}
+		offset += current - length + currentTrimmed - trimmed
+		length, trimmed = current, currentTrimmed
+	}
+	return result, nil, nil
+}
+
 // matchFilters 检查消息是否匹配过滤条件
-func (c *Cache) matchFilters(mes *SmsMes, filters map[string]string, listName string) bool {
+func (c *Cache) matchFilters(mes *SmsMes, f *searchFilter, listName string) bool {
 	// 如果没有过滤条件，都匹配
-	if len(filters) == 0 {
+	if len(f.fields) == 0 {
 		return true
 	}
 
 	// 通用过滤条件
-	if content, ok := filters["content"]; ok && content != "" {
+	if content, ok := f.fields["content"]; ok && content != "" {
 		if !contains(mes.Content, content) {
 			return false
 		}
 	}
 
+	if f.msgId != nil && !f.msgId.match(mes.MsgId) {
+		return false
+	}
+
+	if client, ok := f.fields["client"]; ok && client != "" && mes.Client != client {
+		return false
+	}
+
+	if !f.matchExact(mes) {
+		return false
+	}
+
 	if listName == "list_message" {
 		// 下发消息特定过滤
-		if dest, ok := filters["dest"]; ok && dest != "" {
+		if dest, ok := f.fields["dest"]; ok && dest != "" {
 			if !contains(mes.Dest, dest) {
 				return false
 			}
 		}
 
-		if status, ok := filters["status"]; ok && status != "" {
+		if status, ok := f.fields["status"]; ok && status != "" {
 			statusInt, err := strconv.Atoi(status)
 			if err != nil {
 				return false
@@ -432,13 +1305,20 @@ func (c *Cache) matchFilters(mes *SmsMes, filters map[string]string, listName st
 		}
 	} else if listName == "list_mo" {
 		// 上行消息特定过滤
-		if src, ok := filters["src"]; ok && src != "" {
+		if src, ok := f.fields["src"]; ok && src != "" {
 			if !contains(mes.Src, src) {
 				return false
 			}
 		}
 
-		if dest, ok := filters["dest"]; ok && dest != "" {
+		if dest, ok := f.fields["dest"]; ok && dest != "" {
+			if !contains(mes.Dest, dest) {
+				return false
+			}
+		}
+	} else if listName == "list_orphan" {
+		// 孤立状态报告过滤
+		if dest, ok := f.fields["dest"]; ok && dest != "" {
 			if !contains(mes.Dest, dest) {
 				return false
 			}
@@ -459,3 +1339,75 @@ func contains(s, substr string) bool {
 	substr = strings.ToLower(substr)
 	return strings.Contains(s, substr)
 }
+
+// searchFilter 是一次查询的过滤条件
+// 时间范围、提交结果码和 MsgId 条件在创建时解析一次，逐条匹配时不再重复解析
+type searchFilter struct {
+	fields       map[string]string
+	from, to     time.Time    // 未指定的一端为零值
+	submitResult *uint32      // 为 nil 时不限制
+	msgId        *msgIdFilter // 为 nil 时不限制
+	invalid      bool         // 条件无法解析，不匹配任何记录
+}
+
+// newSearchFilter 解析搜索条件，无法解析的时间范围视为未指定
+func newSearchFilter(filters map[string]string) *searchFilter {
+	f := &searchFilter{fields: filters}
+	if filters["from"] != "" || filters["to"] != "" {
+		if from, to, err := ValidateTimeRange(filters["from"], filters["to"]); err == nil {
+			f.from, f.to = from, to
+		}
+	}
+	if result := filters["submit_result"]; result != "" {
+		if code, err := strconv.ParseUint(result, 10, 32); err != nil {
+			f.invalid = true
+		} else {
+			v := uint32(code)
+			f.submitResult = &v
+		}
+	}
+	if msgId := filters["msgid"]; msgId != "" {
+		if parsed, err := parseMsgIdFilter(msgId); err != nil {
+			f.invalid = true
+		} else {
+			f.msgId = &parsed
+		}
+	}
+	return f
+}
+
+// listOrderSlack 是列表中记录写入顺序与所用时间可能不一致的最大偏差：
+// 孤立状态报告在关联缓冲区中保留 defaultReceiptHoldTime 后才写入，另留出并发写入的余量
+const listOrderSlack = defaultReceiptHoldTime + time.Minute
+
+// pastSearchRange 判断从新到旧遍历 Redis 列表时是否已越过 from，之后的记录都不会匹配
+//
+// 列表按写入顺序排列，下发记录在收到提交响应时写入（SubmitTime），创建时间早于写入时间，
+// 写入时间早于 from 时更旧的记录的创建时间也早于 from；旧记录没有 SubmitTime 时使用创建时间
+func (f *searchFilter) pastSearchRange(mes *SmsMes) bool {
+	if f.from.IsZero() {
+		return false
+	}
+	written := mes.SubmitTime
+	if written.IsZero() {
+		written = mes.Created
+	}
+	return written.Before(f.from.Add(-listOrderSlack))
+}
+
+// matchExact 检查时间范围、提交结果码与状态报告状态等精确条件
+func (f *searchFilter) matchExact(mes *SmsMes) bool {
+	if f.invalid {
+		return false
+	}
+	if !f.from.IsZero() && mes.Created.Before(f.from) || !f.to.IsZero() && !mes.Created.Before(f.to) {
+		return false
+	}
+	if f.submitResult != nil && mes.SubmitResult != *f.submitResult {
+		return false
+	}
+	if stat := f.fields["delivery_stat"]; stat != "" && !strings.EqualFold(mes.DeliveryStat, stat) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,427 @@
+package gateway
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cmpputils "github.com/bigwhite/gocmpp/utils"
+)
+
+// 通道类型
+const (
+	ChannelCMPP = "cmpp"
+	ChannelSMPP = "smpp"
+	ChannelSMGP = "smgp"
+	ChannelSGIP = "sgip"
+)
+
+// Channel 是上游短信通道的协议无关接口
+//
+// 发送协程与 HTTP 层只依赖该接口；提交响应、上行短信和状态报告
+// 由各实现交给 messagePipeline，写入统一的存储后通过 ChannelHandler 上报
+type Channel interface {
+	// Name 返回通道类型，如 cmpp、smpp、smgp、sgip
+	Name() string
+	// Start 建立连接并启动接收、心跳等后台协程
+	// 初始连接失败不返回错误，由心跳协程负责重连
+	Start()
+	// Stop 断开连接并等待后台协程退出（可重复调用）
+	Stop()
+	// IsReady 返回连接是否可用于发送
+	IsReady() bool
+	// Submit 异步提交一条消息，并以 连接代次+序列号 登记为等待响应
+	// 返回错误时消息未登记，由调用者通过 SubmitFailed 记录失败结果；
+	// 返回 errSubmitPaused 时消息留在发送协程中稍后重试
+	Submit(mes *SmsMes) error
+	// SubmitFailed 记录未能提交的消息，与提交响应一样写入通道的存储并通知回调
+	SubmitFailed(mes *SmsMes)
+	// SetHandler 设置接收处理结果与连接状态的回调，需在 Start 之前调用
+	// 未设置时通知网关内的消息观察者与事件总线
+	SetHandler(h ChannelHandler)
+}
+
+// ChannelHandler 接收通道上报的结果，与具体协议无关
+// 回调在通道的接收协程中同步调用，实现不应阻塞
+type ChannelHandler interface {
+	// SubmitDone 在下发记录入库（含连接中断）后调用
+	SubmitDone(mes SmsMes)
+	// MOReceived 在上行短信入库后调用
+	MOReceived(mes SmsMes)
+	// ReceiptReceived 在状态报告与下发记录匹配后调用，mes 为写入状态报告后的下发记录
+	ReceiptReceived(receipt, mes SmsMes)
+	// ConnectionChanged 在通道可用状态变化时调用
+	ConnectionChanged(channel string, ready bool)
+}
+
+// errSrcIdTooLong 表示拼接扩展码后的源号码超过协议允许的长度
+var errSrcIdTooLong = errors.New("source address too long")
+
+// errSubmitPaused 表示通道暂停接收新的提交（如切回主地址前等待响应），消息未登记，稍后重试即可
+var errSubmitPaused = errors.New("submit paused")
+
+// submitRetryInterval 通道暂停提交时发送协程的重试间隔
+const submitRetryInterval = 50 * time.Millisecond
+
+// buildSrcId 构建实际的发送号码
+// 如果用户提供了扩展码（src），将其附加到接入码后面
+func buildSrcId(accessNo, src string) string {
+	if src != "" && src != accessNo {
+		// 只有当 src 不是完整号码时才追加
+		Debugf("[SEND] Using extension code: %s -> %s", src, accessNo+src)
+		return accessNo + src
+	}
+	return accessNo
+}
+
+// 短消息编码
+const (
+	msgFormatASCII uint8 = 0
+	msgFormatUCS2  uint8 = 8
+	msgFormatGB    uint8 = 15
+)
+
+// encodeMsgContent 选择短消息编码：纯 ASCII 使用 0，其余使用 UCS2
+// CMPP、SMGP、SGIP 的编码取值相同（0 ASCII、8 UCS2、15 GB）
+func encodeMsgContent(s string) (uint8, []byte) {
+	if isASCII(s) {
+		return msgFormatASCII, []byte(s)
+	}
+	return msgFormatUCS2, encodeUCS2(s)
+}
+
+// decodeMsgContent 按短消息编码解码为 UTF-8
+func decodeMsgContent(format uint8, b []byte) string {
+	switch format {
+	case msgFormatUCS2:
+		return decodeUCS2(b)
+	case msgFormatGB:
+		s, err := cmpputils.GB18030ToUtf8(string(b))
+		if err != nil {
+			return string(b)
+		}
+		return s
+	default:
+		return string(b)
+	}
+}
+
+// channelOf 返回消息所属的通道，升级前保存的记录没有该字段，视为 CMPP
+func channelOf(mes *SmsMes) string {
+	if mes.Channel == "" {
+		return ChannelCMPP
+	}
+	return mes.Channel
+}
+
+// messageObserver 接收消息处理结果的通知，如 CMPP 代理将结果转发给下游连接
+// 回调在通道的接收协程中同步调用，实现不应阻塞
+type messageObserver interface {
+	// submitDone 在下发记录入库（含本地失败与连接中断）后调用
+	submitDone(mes SmsMes)
+	// moDone 在上行短信入库后调用
+	moDone(mes SmsMes)
+	// receiptDone 在状态报告与下发记录匹配后调用，mes 为写入状态报告后的下发记录
+	receiptDone(receipt, mes SmsMes)
+}
+
+var (
+	observersMu sync.RWMutex
+	observers   []messageObserver
+)
+
+// addObserver 注册消息观察者
+func addObserver(o messageObserver) {
+	observersMu.Lock()
+	defer observersMu.Unlock()
+	observers = append(observers, o)
+}
+
+// removeObserver 注销消息观察者
+func removeObserver(o messageObserver) {
+	observersMu.Lock()
+	defer observersMu.Unlock()
+	for i, cur := range observers {
+		if cur == o {
+			observers = append(observers[:i:i], observers[i+1:]...)
+			return
+		}
+	}
+}
+
+func eachObserver(fn func(o messageObserver)) {
+	observersMu.RLock()
+	list := observers
+	observersMu.RUnlock()
+	for _, o := range list {
+		fn(o)
+	}
+}
+
+// observerHandler 是通道的默认回调，将结果转给消息观察者，连接状态变化发布到事件总线
+type observerHandler struct{}
+
+func (observerHandler) SubmitDone(mes SmsMes) {
+	eachObserver(func(o messageObserver) { o.submitDone(mes) })
+}
+
+func (observerHandler) MOReceived(mes SmsMes) {
+	eachObserver(func(o messageObserver) { o.moDone(mes) })
+}
+
+func (observerHandler) ReceiptReceived(receipt, mes SmsMes) {
+	eachObserver(func(o messageObserver) { o.receiptDone(receipt, mes) })
+}
+
+func (observerHandler) ConnectionChanged(channel string, ready bool) {
+	Debugf("[EVENT] Upstream %s ready=%v", channel, ready)
+	events.Publish(Event{Type: eventConnection, Data: connectionState{Channel: channel, Ready: ready}})
+}
+
+// recordSubmit 保存下发记录并通知处理器
+func recordSubmit(cache CacheInterface, h ChannelHandler, mes *SmsMes) {
+	if mes.SubmitTime.IsZero() {
+		mes.SubmitTime = time.Now()
+	}
+	cache.AddSubmits(mes)
+	h.SubmitDone(*mes)
+}
+
+// messagePipeline 将通道上报的提交响应、上行短信和状态报告写入存储
+//
+// 与具体协议无关，每个通道持有一个实例；状态报告关联缓冲区按通道隔离，
+// 因为不同通道的 MsgId 各自编号
+//
+// 存储在创建时确定，后台协程不读取全局的 SCache
+type messagePipeline struct {
+	channel  string
+	tag      string // 日志前缀，如 [CMPP]
+	cache    CacheInterface
+	handler  ChannelHandler
+	receipts *receiptBuffer
+
+	// 各连接代次上等待提交响应的消息数，只统计本进程登记的消息
+	inflightMu sync.Mutex
+	inflight   map[uint64]int
+}
+
+func newMessagePipeline(channel string) *messagePipeline {
+	return &messagePipeline{
+		channel:  channel,
+		tag:      "[" + strings.ToUpper(channel) + "]",
+		cache:    SCache,
+		handler:  observerHandler{},
+		receipts: newReceiptBuffer(defaultReceiptHoldTime),
+		inflight: make(map[uint64]int),
+	}
+}
+
+// setHandler 替换回调，nil 表示恢复默认
+func (p *messagePipeline) setHandler(h ChannelHandler) {
+	if h == nil {
+		h = observerHandler{}
+	}
+	p.handler = h
+}
+
+// setReady 更新通道的可用状态，状态变化时通知处理器
+func (p *messagePipeline) setReady(flag *atomic.Bool, ready bool) {
+	if flag.Swap(ready) != ready {
+		p.handler.ConnectionChanged(p.channel, ready)
+	}
+}
+
+// addPending 登记等待提交响应的消息，并记录发送时间
+func (p *messagePipeline) addPending(gen uint64, seq uint32, mes *SmsMes) error {
+	mes.Channel = p.channel
+	mes.SentTime = time.Now()
+	if err := p.cache.SetWaitCache(gen, seq, *mes); err != nil {
+		return err
+	}
+	p.inflightMu.Lock()
+	p.inflight[gen]++
+	p.inflightMu.Unlock()
+	metrics.inflight.Add(1)
+	return nil
+}
+
+// inflightDone 在消息收到响应或撤销登记后减少计数
+func (p *messagePipeline) inflightDone(gen uint64) {
+	p.inflightMu.Lock()
+	defer p.inflightMu.Unlock()
+	n := p.inflight[gen]
+	if n == 0 {
+		// 本进程未登记或已按连接中断处理的消息
+		return
+	}
+	if n > 1 {
+		p.inflight[gen] = n - 1
+	} else {
+		delete(p.inflight, gen)
+	}
+	metrics.inflight.Add(-1)
+}
+
+// inflightCount 返回指定连接代次上等待提交响应的消息数
+func (p *messagePipeline) inflightCount(gen uint64) int {
+	p.inflightMu.Lock()
+	defer p.inflightMu.Unlock()
+	return p.inflight[gen]
+}
+
+// removePending 撤销未能发出的消息的登记
+func (p *messagePipeline) removePending(gen uint64, seq uint32) {
+	if _, err := p.cache.GetWaitCache(gen, seq); err == nil {
+		p.inflightDone(gen)
+	}
+}
+
+// submitResponded 处理提交响应：按 连接代次+序列号 取出等待中的消息并入库
+func (p *messagePipeline) submitResponded(gen uint64, seq uint32, msgId string, result uint32) {
+	var receipt SmsMes
+	var hasReceipt bool
+	mes, err := p.cache.CompleteWaitCache(gen, seq, func(mes *SmsMes) {
+		Debugf("%s[SUBMIT-RSP] Matched pending message: %+v, Result=%d", p.tag, *mes, result)
+		mes.MsgId = msgId
+		mes.SubmitResult = result
+		mes.SubmitTime = time.Now()
+		// 状态报告可能先于响应到达，此时直接合并；事务失败时放回缓冲区
+		if receipt, hasReceipt = p.receipts.Take(msgId); hasReceipt {
+			Debugf("%s[SUBMIT-RSP] Applying buffered receipt for MsgId=%s: %s", p.tag, msgId, receipt.DeliveryStat)
+			mes.DelivleryResult = receipt.DelivleryResult
+			mes.DeliveryStat = receipt.DeliveryStat
+			mes.ReceiptTime = mes.SubmitTime
+		}
+	})
+	if err != nil {
+		if hasReceipt {
+			p.receipts.Restore(receipt)
+		}
+		Warnf("%s[SUBMIT-RSP] No pending message found for Gen=%d SeqId=%d: %v", p.tag, gen, seq, err)
+		return
+	}
+	p.inflightDone(gen)
+
+	p.handler.SubmitDone(mes)
+	if hasReceipt {
+		p.handler.ReceiptReceived(receipt, mes)
+	}
+}
+
+// submitFailed 记录未能提交的消息，结果码由调用者填好
+func (p *messagePipeline) submitFailed(mes *SmsMes) {
+	mes.Channel = p.channel
+	recordSubmit(p.cache, p.handler, mes)
+}
+
+// moReceived 保存上行短信
+func (p *messagePipeline) moReceived(mes SmsMes) {
+	mes.Channel = p.channel
+	if mes.Created.IsZero() {
+		mes.Created = time.Now()
+	}
+	if mes.Client == "" {
+		mes.Client = clientForDest(mes.Dest)
+	}
+	p.cache.AddMoList(&mes)
+	p.handler.MOReceived(mes)
+}
+
+// receiptReceived 处理状态报告，无法匹配的报告暂存到关联缓冲区
+func (p *messagePipeline) receiptReceived(receipt SmsMes) {
+	receipt.Channel = p.channel
+	mes, matched, err := p.cache.ApplyReceipt(receipt.MsgId, receipt.DelivleryResult, receipt.DeliveryStat)
+	if err != nil {
+		Warnf("%s[RECEIPT] Failed to apply receipt MsgId=%s: %v", p.tag, receipt.MsgId, err)
+	}
+	if !matched {
+		Debugf("%s[RECEIPT] No stored message for MsgId=%s yet, buffering receipt", p.tag, receipt.MsgId)
+		p.receipts.Put(receipt)
+		return
+	}
+	p.handler.ReceiptReceived(receipt, mes)
+}
+
+// messageCanceled 将已从网关删除的消息记为 CANCELD，并像状态报告一样通知处理器
+// 删除的消息不会再有状态报告；找不到下发记录时不暂存
+func (p *messagePipeline) messageCanceled(msgId string) {
+	receipt := SmsMes{
+		MsgId:           msgId,
+		Channel:         p.channel,
+		Created:         time.Now(),
+		SubmitResult:    65535,
+		DelivleryResult: deliveryResultFailed,
+		DeliveryStat:    deliveryStatCanceled,
+	}
+	mes, matched, err := p.cache.ApplyReceipt(msgId, receipt.DelivleryResult, receipt.DeliveryStat)
+	if err != nil {
+		Warnf("%s[CANCEL] Failed to record cancellation of MsgId=%s: %v", p.tag, msgId, err)
+		return
+	}
+	if !matched {
+		Warnf("%s[CANCEL] No stored message for cancelled MsgId=%s", p.tag, msgId)
+		return
+	}
+	p.handler.ReceiptReceived(receipt, mes)
+}
+
+// expireReceipts 将超时仍未匹配的状态报告转入孤立状态报告列表
+func (p *messagePipeline) expireReceipts(now time.Time) {
+	for _, receipt := range p.receipts.Expire(now) {
+		// 过期前最后再尝试一次，覆盖响应入库与报告到达交错的情况
+		if mes, matched, _ := p.cache.ApplyReceipt(receipt.MsgId, receipt.DelivleryResult, receipt.DeliveryStat); matched {
+			p.handler.ReceiptReceived(receipt, mes)
+			continue
+		}
+		Warnf("%s[RECEIPT] Receipt for MsgId=%s expired without matching message", p.tag, receipt.MsgId)
+		p.cache.AddOrphanReceipt(&receipt)
+	}
+}
+
+// runReceiptSweeper 定期清理关联缓冲区，直到 stop 关闭
+func (p *messagePipeline) runReceiptSweeper(stop <-chan struct{}) {
+	ticker := time.NewTicker(defaultReceiptSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			p.expireReceipts(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// resolveStalePending 将本通道旧连接上未收到响应的消息记录为失败
+// 响应只会在发送请求的那条连接上返回，重连后这些消息不可能再被匹配
+func (p *messagePipeline) resolveStalePending(gen uint64) {
+	p.inflightMu.Lock()
+	for g, n := range p.inflight {
+		if g != gen {
+			delete(p.inflight, g)
+			metrics.inflight.Add(-int64(n))
+		}
+	}
+	p.inflightMu.Unlock()
+
+	if p.cache == nil {
+		return
+	}
+	stale, err := p.cache.DrainStaleWait(p.channel, gen)
+	if err != nil {
+		Warnf("%s Failed to drain pending submits of previous connections: %v", p.tag, err)
+		return
+	}
+	for i := range stale {
+		mes := stale[i]
+		mes.SubmitResult = 253 // 253表示连接中断，未收到响应
+		mes.MsgId = "CONN_LOST"
+		recordSubmit(p.cache, p.handler, &mes)
+	}
+	if len(stale) > 0 {
+		Warnf("%s Resolved %d pending submits from previous connections as lost", p.tag, len(stale))
+	}
+}
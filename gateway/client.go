@@ -1,9 +1,9 @@
 package gateway
 
 import (
+	"errors"
+	"strings"
 	"time"
-
-	cmpp "github.com/bigwhite/gocmpp"
 )
 
 // 发送消息队列
@@ -15,98 +15,87 @@ var Abort = make(chan struct{})
 // 配置文件
 var config *Config
 
-// 全局的 ClientManager（替代原来的 c *cmpp.Client）
+// 全局的 ClientManager（替代原来的 c *cmpp.Client），上游通道为 CMPP 时有效
 var clientManager *ClientManager
 
-// IsCmppReady 检查 CMPP 连接是否就绪（向后兼容）
+// 当前使用的上游通道
+var upstream Channel
+
+// IsCmppReady 检查上游通道是否就绪（向后兼容，其他协议的通道同样适用）
 func IsCmppReady() bool {
-	if clientManager == nil {
+	if upstream == nil {
 		return false
 	}
-	return clientManager.IsReady()
+	return upstream.IsReady()
+}
+
+// channelName 返回当前上游通道类型，未启动时按配置推断
+func channelName() string {
+	if upstream != nil {
+		return upstream.Name()
+	}
+	if config != nil && config.Channel != "" {
+		return strings.ToLower(config.Channel)
+	}
+	return ChannelCMPP
 }
 
 // GetClientManager 获取全局 ClientManager（用于测试和内部使用）
+// 上游通道不是 CMPP 时返回 nil
 func GetClientManager() *ClientManager {
 	return clientManager
 }
 
 // startSender 启动发送协程
-func startSender() {
+func startSender(ch Channel) {
 OuterLoop:
 	for {
 		select {
 		case message := <-Messages:
-			Infof("[SEND] Preparing to send: Src=%s Dest=%s Content=%s", message.Src, message.Dest, message.Content)
-
-			// 构建实际的发送号码
-			// 如果用户提供了扩展码（src），将其附加到SrcId后面
-			srcId := config.SmsAccessNo
-			if message.Src != "" && message.Src != config.SmsAccessNo {
-				// 只有当 src 不是完整号码时才追加
-				srcId = config.SmsAccessNo + message.Src
-				Debugf("[SEND] Using extension code: %s -> %s", message.Src, srcId)
-			}
-
-			// 检查 SrcId 长度（CMPP协议要求最大21字节）
-			if len(srcId) > 21 {
-				Errorf("[SEND] SrcId exceeds 21 bytes: %s (len=%d)", srcId, len(srcId))
-				// 记录失败消息
-				message.Created = time.Now()
-				message.SubmitResult = 255 // 255表示本地错误
-				message.DelivleryResult = 65535
-				message.MsgId = "ERROR"
-				SCache.AddSubmits(&message)
-				continue
-			}
-
-			// 构建 CMPP 提交请求包
-			p := &cmpp.Cmpp3SubmitReqPkt{
-				PkTotal:            1,
-				PkNumber:           1,
-				RegisteredDelivery: 0,
-				MsgLevel:           1,
-				ServiceId:          config.ServiceId,
-				FeeUserType:        0,
-				FeeTerminalId:      "",
-				FeeTerminalType:    0,
-				MsgFmt:             0,
-				MsgSrc:             config.User, // MsgSrc应该是企业代码，即登录用户名（6字节）
-				FeeType:            "01",
-				FeeCode:            "000000",
-				ValidTime:          "",
-				AtTime:             "",
-				SrcId:              srcId,
-				DestUsrTl:          1,
-				DestTerminalId:     []string{message.Dest},
-				DestTerminalType:   0,
-				MsgLength:          uint8(len(message.Content)),
-				MsgContent:         message.Content,
-			}
-
-			// 使用 ClientManager 发送（线程安全）
-			seq_id, err := clientManager.SendReqPkt(p)
-			message.Created = time.Now()
-			message.DelivleryResult = 65535
-
-			if err != nil {
-				Errorf("[SEND] CMPP request send failed: %v", err)
-				// 发送失败，直接记录到列表，标记为失败
-				message.SubmitResult = 254 // 254表示发送失败
-				message.MsgId = "SEND_ERROR"
-				SCache.AddSubmits(&message)
-			} else {
-				Infof("[SEND] Sent successfully, waiting for response SeqId=%d", seq_id)
-				// 发送成功，等待响应
-				message.SubmitResult = 65535 // 等待响应
-				SCache.SetWaitCache(seq_id, message)
-			}
+			sendMessage(ch, message)
 		case <-Abort:
 			break OuterLoop
 		}
 	}
 }
 
+// sendMessage 通过上游通道提交一条消息，本地失败经由通道记录，保证回调一致
+func sendMessage(ch Channel, message SmsMes) {
+	Infof("[SEND] Preparing to send via %s: Src=%s Dest=%s Content=%s", ch.Name(), message.Src, message.Dest, message.Content)
+
+	if message.Id == "" {
+		message.Id = newMessageId()
+	}
+	message.Created = time.Now()
+	message.DelivleryResult = 65535
+	message.SubmitResult = 65535 // 等待响应
+	err := ch.Submit(&message)
+	// 通道暂停提交期间消息保留在发送协程中，其余消息继续在队列中等待
+	for errors.Is(err, errSubmitPaused) && isRunning() {
+		time.Sleep(submitRetryInterval)
+		err = ch.Submit(&message)
+	}
+
+	switch {
+	case err == nil:
+		events.publishMessage(eventSent, &message, "list_message")
+	case errors.Is(err, errSrcIdTooLong):
+		Errorf("[SEND] %v", err)
+		// 记录失败消息
+		message.SubmitResult = 255 // 255表示本地错误
+		message.MsgId = "ERROR"
+		ch.SubmitFailed(&message)
+	default:
+		Errorf("[SEND] %s request send failed: %v", strings.ToUpper(ch.Name()), err)
+		// 发送失败，直接记录到列表，标记为失败
+		message.SubmitResult = 254 // 254表示发送失败
+		message.MsgId = "SEND_ERROR"
+		ch.SubmitFailed(&message)
+	}
+	// 已登记为等待响应或已入库，不再需要队列中的登记
+	sendQueue.Remove(message.Id)
+}
+
 // isRunning 检查服务是否在运行
 func isRunning() bool {
 	select {
@@ -117,33 +106,70 @@ func isRunning() bool {
 	}
 }
 
-// StartClient 启动 CMPP 客户端（新版本使用 ClientManager）
+// newChannel 根据配置创建上游通道
+func newChannel(cfg *Config) Channel {
+	switch strings.ToLower(cfg.Channel) {
+	case ChannelSMPP:
+		return NewSMPPClient(cfg)
+	case ChannelSMGP:
+		return NewSMGPClient(cfg)
+	case ChannelSGIP:
+		return NewSGIPClient(cfg)
+	case "", ChannelCMPP:
+		clientManager = NewClientManager(cfg)
+		return clientManager
+	default:
+		Warnf("[SEND] Unknown channel type %q, falling back to cmpp", cfg.Channel)
+		clientManager = NewClientManager(cfg)
+		return clientManager
+	}
+}
+
+// StartClient 启动上游通道客户端
 func StartClient(gconfig *Config) {
 	config = gconfig
 
-	// 创建 ClientManager
-	clientManager = NewClientManager(config)
+	upstream = newChannel(config)
+	Infof("[SEND] Upstream channel: %s", upstream.Name())
 
-	// 初始连接
-	if err := clientManager.Connect(); err != nil {
-		Errorf("[CMPP] Initial connection failed: %v", err)
-		// 不要 Fatal，让心跳协程尝试重连
-	}
+	// 事件总线与运行指标接收提交结果、上行短信与状态报告，连接状态变化由通道回调发布
+	addObserver(events)
+	addObserver(metrics)
 
-	// 启动发送协程
-	go startSender()
+	// 建立连接并启动后台协程（连接失败时由心跳协程重连）
+	upstream.Start()
 
-	// 如果初始连接成功，启动接收协程
-	if clientManager.IsReady() {
-		clientManager.StartReceiver()
+	// 启动发送协程
+	go startSender(upstream)
+
+	// 启动 CMPP 代理服务（可选）
+	var proxy *CMPPServer
+	if config.CMPPServerAddr != "" {
+		proxy = NewCMPPServer(config)
+		if err := proxy.Start(); err != nil {
+			Errorf("[CMPP-SERVER] Failed to listen on %s: %v", config.CMPPServerAddr, err)
+			proxy = nil
+		}
 	}
 
-	// 启动心跳协程（会自动处理重连）
-	clientManager.StartHeartbeat()
+	// 启动 Webhook 推送（可选）
+	var webhooks *WebhookDispatcher
+	if hasWebhooks(config) {
+		webhooks = NewWebhookDispatcher(config)
+		webhooks.Start()
+	}
 
 	// 等待退出信号
 	<-Abort
 
 	// 清理资源
-	clientManager.Shutdown()
+	if webhooks != nil {
+		webhooks.Stop()
+	}
+	if proxy != nil {
+		proxy.Stop()
+	}
+	removeObserver(events)
+	removeObserver(metrics)
+	upstream.Stop()
 }
@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -19,54 +20,99 @@ const (
 	defaultHeartbeatInterval = 10 * time.Second
 	// 接收超时时间，避免阻塞无法退出
 	defaultReceiveTimeout = 2 * time.Second
+	// 同步请求（查询、删除）等待响应的超时时间
+	defaultRequestTimeout = 10 * time.Second
+	// 切回主地址前等待当前连接上提交响应的最长时间
+	defaultFailbackDrainTimeout = 3 * time.Second
 )
 
+// errRequestTimeout 表示同步请求在超时时间内未收到响应
+var errRequestTimeout = errors.New("CMPP request timed out")
+
+// callKey 同步请求的关联键
+type callKey struct {
+	gen uint64
+	seq uint32
+}
+
 // cmppClient 抽象接口，便于单元测试注入 mock 实现
 type cmppClient interface {
 	Connect(addr, user, password string, timeout time.Duration) error
 	Disconnect()
 	SendReqPkt(p cmpp.Packer) (uint32, error)
+	// NextSeq 分配请求序列号，配合 SendRspPkt 用于需要先登记再发送的请求
+	NextSeq() uint32
 	SendRspPkt(p cmpp.Packer, seqId uint32) error
 	RecvAndUnpackPkt(timeout time.Duration) (interface{}, error)
 }
 
-// realCMPPClient 是对实际 gocmpp.Client 的封装
+// realCMPPClient 是对实际 CMPP 3.0 连接的封装
+// 帧层由 cmppConn 实现，以支持 gocmpp 未内置的 CMPP_QUERY/CMPP_CANCEL
 type realCMPPClient struct {
-	inner *cmpp.Client
+	config *Config
+	conn   *cmppConn
+}
+
+// dial 建立到 ISMG 的底层连接，配置了 cmpp_tls 时使用 TLS
+func (c *realCMPPClient) dial(addr string, timeout time.Duration) (net.Conn, error) {
+	if c.config == nil || !c.config.CMPPTLS {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+
+	tlsConfig, err := newCMPPTLSConfig(c.config)
+	if err != nil {
+		return nil, err
+	}
+	// Dialer 的超时同时覆盖 TCP 建连与 TLS 握手
+	return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, tlsConfig)
 }
 
 func (c *realCMPPClient) Connect(addr, user, password string, timeout time.Duration) error {
-	if c.inner == nil {
-		return fmt.Errorf("cmpp client not initialised")
+	netConn, err := c.dial(addr, timeout)
+	if err != nil {
+		return err
+	}
+	conn := newCMPPConn(netConn)
+	if err := conn.login(user, password, timeout); err != nil {
+		conn.Close()
+		return err
 	}
-	return c.inner.Connect(addr, user, password, timeout)
+	c.conn = conn
+	return nil
 }
 
 func (c *realCMPPClient) Disconnect() {
-	if c.inner != nil {
-		c.inner.Disconnect()
+	if c.conn != nil {
+		c.conn.Close()
 	}
 }
 
 func (c *realCMPPClient) SendReqPkt(p cmpp.Packer) (uint32, error) {
-	if c.inner == nil {
-		return 0, fmt.Errorf("cmpp client not initialised")
+	if c.conn == nil {
+		return 0, fmt.Errorf("cmpp client not connected")
 	}
-	return c.inner.SendReqPkt(p)
+	return c.conn.SendReqPkt(p)
+}
+
+func (c *realCMPPClient) NextSeq() uint32 {
+	if c.conn == nil {
+		return 0
+	}
+	return c.conn.nextSeq()
 }
 
 func (c *realCMPPClient) SendRspPkt(p cmpp.Packer, seqId uint32) error {
-	if c.inner == nil {
-		return fmt.Errorf("cmpp client not initialised")
+	if c.conn == nil {
+		return fmt.Errorf("cmpp client not connected")
 	}
-	return c.inner.SendRspPkt(p, seqId)
+	return c.conn.SendRspPkt(p, seqId)
 }
 
 func (c *realCMPPClient) RecvAndUnpackPkt(timeout time.Duration) (interface{}, error) {
-	if c.inner == nil {
-		return nil, fmt.Errorf("cmpp client not initialised")
+	if c.conn == nil {
+		return nil, fmt.Errorf("cmpp client not connected")
 	}
-	return c.inner.RecvAndUnpackPkt(timeout)
+	return c.conn.RecvAndUnpackPkt(timeout)
 }
 
 // ClientManager 管理 CMPP 客户端连接的线程安全封装
@@ -82,12 +128,33 @@ type ClientManager struct {
 	// 连接状态（使用 atomic 保证并发安全）
 	ready atomic.Bool
 
+	// ISMG 地址列表及健康状态，probe 用于探测主地址是否恢复
+	endpoints *endpointPool
+	probe     func(addr string) error
+
+	// 切回主地址前将当前连接标记为 draining，新的提交返回 errSubmitPaused，
+	// 等待当前连接上的消息收到响应；submitMu 保证标记之后不再有提交登记到旧连接
+	submitMu     sync.RWMutex
+	draining     atomic.Bool
+	drainTimeout time.Duration
+
+	// 连接代次：每次成功建立连接后递增，与 SeqId 共同作为提交响应的关联键
+	// 初始值取自启动时间，避免与上一次进程运行时持久化的等待记录冲突
+	generation atomic.Uint64
+
 	// 接收协程控制
 	receiverRunning atomic.Bool
 	receiverStop    chan struct{}
 	receiverDone    chan struct{}
 	receiverMu      sync.Mutex // 保护 receiverStop 的创建和关闭
 
+	// 提交响应、上行短信和状态报告的入库处理
+	pipeline *messagePipeline
+
+	// 等待同步响应的请求（CMPP_QUERY / CMPP_CANCEL）
+	callMu sync.Mutex
+	calls  map[callKey]chan interface{}
+
 	// 退出信号
 	shutdown     chan struct{}
 	shutdownOnce sync.Once // 确保只关闭一次
@@ -96,18 +163,122 @@ type ClientManager struct {
 
 // NewClientManager 创建一个新的客户端管理器
 func NewClientManager(cfg *Config) *ClientManager {
-	return &ClientManager{
+	cm := &ClientManager{
 		config:       cfg,
 		shutdown:     make(chan struct{}),
 		receiverStop: make(chan struct{}),
+		pipeline:     newMessagePipeline(ChannelCMPP),
+		calls:        make(map[callKey]chan interface{}),
+		endpoints:    newEndpointPool(cfg),
+		drainTimeout: defaultFailbackDrainTimeout,
 		newClient: func() cmppClient {
-			return &realCMPPClient{inner: cmpp.NewClient(cmpp.V30)}
+			return &realCMPPClient{config: cfg}
+		},
+		probe: func(addr string) error {
+			return probeEndpoint(cfg, addr, defaultConnectTimeout)
 		},
 	}
+	cm.generation.Store(uint64(time.Now().UnixNano()))
+	return cm
+}
+
+// Name 返回通道类型
+func (cm *ClientManager) Name() string {
+	return ChannelCMPP
+}
+
+// Start 建立初始连接并启动接收、心跳和状态报告清理协程
+func (cm *ClientManager) Start() {
+	if err := cm.Connect(); err != nil {
+		Errorf("[CMPP] Initial connection failed: %v", err)
+		// 不要 Fatal，让心跳协程尝试重连
+	}
+
+	// 如果初始连接成功，启动接收协程
+	if cm.IsReady() {
+		cm.StartReceiver()
+	}
+
+	// 启动心跳协程（会自动处理重连）
+	cm.StartHeartbeat()
+
+	// 启动状态报告关联缓冲区的过期清理
+	cm.StartReceiptSweeper()
+}
+
+// Stop 关闭客户端管理器
+func (cm *ClientManager) Stop() {
+	cm.Shutdown()
+}
+
+// Submit 构建 CMPP 提交请求包并发送
+func (cm *ClientManager) Submit(mes *SmsMes) error {
+	srcId := buildSrcId(cm.config.SmsAccessNo, mes.Src)
+
+	// 检查 SrcId 长度（CMPP协议要求最大21字节）
+	if len(srcId) > 21 {
+		return fmt.Errorf("%w: %s (len=%d, max 21)", errSrcIdTooLong, srcId, len(srcId))
+	}
+
+	p := &cmpp.Cmpp3SubmitReqPkt{
+		PkTotal:            1,
+		PkNumber:           1,
+		RegisteredDelivery: cm.config.CMPPRegisteredDelivery,
+		MsgLevel:           1,
+		ServiceId:          cm.config.ServiceId,
+		FeeUserType:        0,
+		FeeTerminalId:      "",
+		FeeTerminalType:    0,
+		MsgFmt:             0,
+		MsgSrc:             cm.config.User, // MsgSrc应该是企业代码，即登录用户名（6字节）
+		FeeType:            "01",
+		FeeCode:            "000000",
+		ValidTime:          "",
+		AtTime:             "",
+		SrcId:              srcId,
+		DestUsrTl:          1,
+		DestTerminalId:     []string{mes.Dest},
+		DestTerminalType:   0,
+		MsgLength:          uint8(len(mes.Content)),
+		MsgContent:         mes.Content,
+	}
+
+	cm.submitMu.RLock()
+	defer cm.submitMu.RUnlock()
+	if cm.draining.Load() {
+		return errSubmitPaused
+	}
+	client, gen, err := cm.readyClient()
+	if err != nil {
+		return err
+	}
+	// 先登记再发送，避免提交响应先于登记到达
+	seqId := client.NextSeq()
+	if err := cm.pipeline.addPending(gen, seqId, mes); err != nil {
+		return err
+	}
+	if err := client.SendRspPkt(p, seqId); err != nil {
+		// 未发出的消息撤销登记，由调用者记录为发送失败
+		cm.pipeline.removePending(gen, seqId)
+		return err
+	}
+	Infof("[SEND] Sent successfully, waiting for response Gen=%d SeqId=%d", gen, seqId)
+	return nil
 }
 
 // Connect 连接到 CMPP 服务器（线程安全）
+// 连接成功后，上一代连接上仍在等待响应的消息会被显式地标记为失败
 func (cm *ClientManager) Connect() error {
+	gen, err := cm.connect()
+	if err != nil {
+		return err
+	}
+	cm.pipeline.resolveStalePending(gen)
+	return nil
+}
+
+// connect 建立新连接并返回新的连接代次
+func (cm *ClientManager) connect() (uint64, error) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
@@ -117,21 +288,48 @@ func (cm *ClientManager) Connect() error {
 		cm.client = nil
 	}
 
-	// 创建新连接
-	client := cm.newClient()
-	addr := cm.config.CMPPHost + ":" + cm.config.CMPPPort
-	err := client.Connect(addr, cm.config.User, cm.config.Password, defaultConnectTimeout)
+	// 按健康状态依次尝试各个地址
+	var lastErr error
+	for _, i := range cm.endpoints.candidates(time.Now()) {
+		label := cm.endpoints.label(i)
+		client := cm.newClient()
+		err := client.Connect(cm.endpoints.addr(i), cm.config.User, cm.config.Password, defaultConnectTimeout)
+		if err != nil {
+			Errorf("[CMPP] Connection to %s failed: %v", label, err)
+			cm.endpoints.markFailure(i, err)
+			lastErr = err
+			continue
+		}
 
-	if err != nil {
-		Errorf("[CMPP] Connection failed: %v", err)
-		cm.ready.Store(false)
-		return fmt.Errorf("failed to connect to CMPP server: %w", err)
+		cm.client = client
+		cm.endpoints.markSuccess(i)
+		gen := cm.generation.Add(1)
+		cm.pipeline.setReady(&cm.ready, true)
+		Infof("[CMPP] Connection and authentication successful, endpoint=%s tls=%v generation=%d", label, cm.config.CMPPTLS, gen)
+		return gen, nil
 	}
 
-	cm.client = client
-	cm.ready.Store(true)
-	Infof("[CMPP] Connection and authentication successful")
-	return nil
+	cm.pipeline.setReady(&cm.ready, false)
+	return 0, fmt.Errorf("failed to connect to CMPP server: %w", lastErr)
+}
+
+// Generation 返回当前连接代次
+func (cm *ClientManager) Generation() uint64 {
+	return cm.generation.Load()
+}
+
+// Endpoints 返回各 ISMG 地址的健康状态
+func (cm *ClientManager) Endpoints() []EndpointStatus {
+	return cm.endpoints.snapshot(cm.IsReady())
+}
+
+// ActiveEndpoint 返回当前使用的 ISMG 地址，未连接时返回空字符串
+func (cm *ClientManager) ActiveEndpoint() string {
+	i := cm.endpoints.activeIndex()
+	if i < 0 || !cm.IsReady() {
+		return ""
+	}
+	return cm.endpoints.addr(i)
 }
 
 // Disconnect 断开连接（线程安全）
@@ -142,7 +340,7 @@ func (cm *ClientManager) Disconnect() {
 	if cm.client != nil {
 		cm.client.Disconnect()
 		cm.client = nil
-		cm.ready.Store(false)
+		cm.pipeline.setReady(&cm.ready, false)
 	}
 }
 
@@ -154,6 +352,16 @@ func (cm *ClientManager) GetClient() cmppClient {
 	return cm.client
 }
 
+// SetHandler 设置接收处理结果与连接状态的回调，需在 Start 之前调用
+func (cm *ClientManager) SetHandler(h ChannelHandler) {
+	cm.pipeline.setHandler(h)
+}
+
+// SubmitFailed 记录未能提交的消息
+func (cm *ClientManager) SubmitFailed(mes *SmsMes) {
+	cm.pipeline.submitFailed(mes)
+}
+
 // IsReady 检查连接是否就绪
 func (cm *ClientManager) IsReady() bool {
 	return cm.ready.Load()
@@ -162,16 +370,26 @@ func (cm *ClientManager) IsReady() bool {
 // SendReqPkt 发送请求包（线程安全）
 // p 必须实现 cmpp.Packer 接口
 func (cm *ClientManager) SendReqPkt(p cmpp.Packer) (uint32, error) {
+	client, _, err := cm.readyClient()
+	if err != nil {
+		return 0, err
+	}
+	return client.SendReqPkt(p)
+}
+
+// readyClient 返回当前就绪的连接及其代次
+// 需要关联异步响应的请求（如 Submit）通过它分配序列号，登记后再发送
+func (cm *ClientManager) readyClient() (cmppClient, uint64, error) {
 	cm.mu.RLock()
 	client := cm.client
+	gen := cm.generation.Load()
 	ready := cm.ready.Load()
 	cm.mu.RUnlock()
 
 	if !ready || client == nil {
-		return 0, fmt.Errorf("CMPP client not ready")
+		return nil, 0, fmt.Errorf("CMPP client not ready")
 	}
-
-	return client.SendReqPkt(p)
+	return client, gen, nil
 }
 
 // SendRspPkt 发送响应包（线程安全）
@@ -191,15 +409,23 @@ func (cm *ClientManager) SendRspPkt(p cmpp.Packer, seqId uint32) error {
 
 // RecvAndUnpackPkt 接收并解包消息（线程安全）
 func (cm *ClientManager) RecvAndUnpackPkt(timeout time.Duration) (interface{}, error) {
+	pkt, _, err := cm.recvWithGen(timeout)
+	return pkt, err
+}
+
+// recvWithGen 接收消息，同时返回接收所用连接的代次
+func (cm *ClientManager) recvWithGen(timeout time.Duration) (interface{}, uint64, error) {
 	cm.mu.RLock()
 	client := cm.client
+	gen := cm.generation.Load()
 	cm.mu.RUnlock()
 
 	if client == nil {
-		return nil, fmt.Errorf("CMPP client not available")
+		return nil, 0, fmt.Errorf("CMPP client not available")
 	}
 
-	return client.RecvAndUnpackPkt(timeout)
+	pkt, err := client.RecvAndUnpackPkt(timeout)
+	return pkt, gen, err
 }
 
 // StartReceiver 启动接收协程（防止重复启动）
@@ -289,7 +515,7 @@ func (cm *ClientManager) receiveLoop(stopChan chan struct{}) {
 		}
 
 		// 接收并处理消息
-		pkt, err := cm.RecvAndUnpackPkt(defaultReceiveTimeout)
+		pkt, gen, err := cm.recvWithGen(defaultReceiveTimeout)
 		if err != nil {
 			if errors.Is(err, cmpp.ErrReadCmdIDTimeout) || errors.Is(err, cmpp.ErrReadPktBodyTimeout) {
 				continue
@@ -297,26 +523,31 @@ func (cm *ClientManager) receiveLoop(stopChan chan struct{}) {
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				continue
 			}
+			if errors.Is(err, errUnknownCommand) {
+				// 包已完整读出，流未错位，忽略即可
+				Warnf("[CMPP][RECV] Ignoring packet: %v", err)
+				continue
+			}
 			if errors.Is(err, cmpp.ErrConnIsClosed) || errors.Is(err, io.EOF) {
 				Warnf("[CMPP][RECV] Connection closed: %v", err)
-				cm.ready.Store(false)
+				cm.pipeline.setReady(&cm.ready, false)
 				continue
 			}
 			Warnf("[CMPP][RECV] Receive/unpack failed: %v, marking not ready", err)
-			cm.ready.Store(false)
+			cm.pipeline.setReady(&cm.ready, false)
 			continue
 		}
 
 		// 处理消息
-		cm.handlePacket(pkt)
+		cm.handlePacket(pkt, gen)
 	}
 }
 
-// handlePacket 处理接收到的消息包
-func (cm *ClientManager) handlePacket(pkt interface{}) {
+// handlePacket 处理接收到的消息包，gen 为接收该包的连接代次
+func (cm *ClientManager) handlePacket(pkt interface{}, gen uint64) {
 	switch p := pkt.(type) {
 	case *cmpp.Cmpp3SubmitRspPkt:
-		cm.handleSubmitRsp(p)
+		cm.handleSubmitRsp(p, gen)
 	case *cmpp.CmppActiveTestReqPkt:
 		cm.handleActiveTestReq(p)
 	case *cmpp.CmppActiveTestRspPkt:
@@ -327,26 +558,20 @@ func (cm *ClientManager) handlePacket(pkt interface{}) {
 		cm.handleTerminateRsp(p)
 	case *cmpp.Cmpp3DeliverReqPkt:
 		cm.handleDeliverReq(p)
+	case *CmppQueryRspPkt:
+		cm.handleCallRsp(gen, p.SeqId, p)
+	case *Cmpp3CancelRspPkt:
+		cm.handleCallRsp(gen, p.SeqId, p)
 	default:
 		Debugf("[CMPP][RECV] Unknown packet type: %T", pkt)
 	}
 }
 
 // handleSubmitRsp 处理提交响应
-func (cm *ClientManager) handleSubmitRsp(p *cmpp.Cmpp3SubmitRspPkt) {
-	Infof("[CMPP][SUBMIT-RSP] Received submit response: MsgId=%d SeqId=%d Result=%d", p.MsgId, p.SeqId, p.Result)
-
-	// 从缓存中获取等待响应的消息
-	mes, err := SCache.GetWaitCache(p.SeqId)
-	if err == nil {
-		Debugf("[CMPP][SUBMIT-RSP] Matched pending message: %+v, Result=%d", mes, p.Result)
-		// 更新消息状态
-		mes.MsgId = fmt.Sprintf("%d", p.MsgId)
-		mes.SubmitResult = p.Result
-		SCache.AddSubmits(&mes)
-	} else {
-		Warnf("[CMPP][SUBMIT-RSP] No pending message found for SeqId=%d: %v", p.SeqId, err)
-	}
+func (cm *ClientManager) handleSubmitRsp(p *cmpp.Cmpp3SubmitRspPkt, gen uint64) {
+	Infof("[CMPP][SUBMIT-RSP] Received submit response: MsgId=%d SeqId=%d Gen=%d Result=%d", p.MsgId, p.SeqId, gen, p.Result)
+	// 按 连接代次+SeqId 匹配等待响应的消息
+	cm.pipeline.submitResponded(gen, p.SeqId, fmt.Sprintf("%d", p.MsgId), p.Result)
 }
 
 // handleActiveTestReq 处理心跳请求
@@ -356,14 +581,14 @@ func (cm *ClientManager) handleActiveTestReq(p *cmpp.CmppActiveTestReqPkt) {
 	err := cm.SendRspPkt(rsp, p.SeqId)
 	if err != nil {
 		Errorf("[CMPP][HEARTBEAT] Failed to send active test response: %v", err)
-		cm.ready.Store(false)
+		cm.pipeline.setReady(&cm.ready, false)
 	}
 }
 
 // handleActiveTestRsp 处理心跳响应
 func (cm *ClientManager) handleActiveTestRsp(p *cmpp.CmppActiveTestRspPkt) {
 	Debugf("[CMPP][HEARTBEAT] Received active test response: %+v", p)
-	cm.ready.Store(true)
+	cm.pipeline.setReady(&cm.ready, true)
 }
 
 // handleTerminateReq 处理终止请求
@@ -395,15 +620,129 @@ func (cm *ClientManager) handleDeliverReq(p *cmpp.Cmpp3DeliverReqPkt) {
 		Errorf("[CMPP][DELIVER] Failed to send response: %v", err)
 	}
 
+	// 状态报告
+	if p.RegisterDelivery == 1 {
+		cm.handleReceipt(p)
+		return
+	}
+
 	// 保存上行消息
-	mes := SmsMes{
+	cm.pipeline.moReceived(SmsMes{
 		MsgId:   fmt.Sprintf("%d", p.MsgId),
 		Src:     p.SrcTerminalId,
 		Dest:    p.DestId,
 		Content: p.MsgContent,
-		Created: time.Now(),
+	})
+}
+
+// handleReceipt 处理状态报告，无法匹配的报告暂存到关联缓冲区
+func (cm *ClientManager) handleReceipt(p *cmpp.Cmpp3DeliverReqPkt) {
+	var r cmpp.CmppReceiptPkt
+	if err := r.Unpack([]byte(p.MsgContent)); err != nil {
+		Warnf("[CMPP][RECEIPT] Failed to unpack receipt: %v", err)
+		return
 	}
-	SCache.AddMoList(&mes)
+
+	receipt := SmsMes{
+		MsgId:           fmt.Sprintf("%d", r.MsgId),
+		Dest:            r.DestTerminalId,
+		Created:         time.Now(),
+		SubmitResult:    65535,
+		DelivleryResult: deliveryResultFromStat(r.Stat),
+		DeliveryStat:    r.Stat,
+	}
+	Infof("[CMPP][RECEIPT] Received receipt: MsgId=%s Stat=%s Dest=%s", receipt.MsgId, r.Stat, r.DestTerminalId)
+	cm.pipeline.receiptReceived(receipt)
+}
+
+// handleCallRsp 将响应交给等待中的同步请求
+func (cm *ClientManager) handleCallRsp(gen uint64, seqId uint32, rsp interface{}) {
+	cm.callMu.Lock()
+	ch, ok := cm.calls[callKey{gen: gen, seq: seqId}]
+	cm.callMu.Unlock()
+
+	if !ok {
+		Warnf("[CMPP] No pending request for %T Gen=%d SeqId=%d", rsp, gen, seqId)
+		return
+	}
+	// 通道容量为 1，重复的响应直接丢弃，不阻塞接收协程
+	select {
+	case ch <- rsp:
+	default:
+		Warnf("[CMPP] Dropped duplicate %T Gen=%d SeqId=%d", rsp, gen, seqId)
+	}
+}
+
+// call 发送请求并等待对应的响应
+func (cm *ClientManager) call(p cmpp.Packer, timeout time.Duration) (interface{}, error) {
+	ch := make(chan interface{}, 1)
+
+	client, gen, err := cm.readyClient()
+	if err != nil {
+		return nil, err
+	}
+	// 先登记再发送，避免响应先于登记到达
+	key := callKey{gen: gen, seq: client.NextSeq()}
+	cm.callMu.Lock()
+	cm.calls[key] = ch
+	cm.callMu.Unlock()
+
+	defer func() {
+		cm.callMu.Lock()
+		delete(cm.calls, key)
+		cm.callMu.Unlock()
+	}()
+	if err := client.SendRspPkt(p, key.seq); err != nil {
+		return nil, err
+	}
+
+	select {
+	case rsp := <-ch:
+		return rsp, nil
+	case <-time.After(timeout):
+		return nil, errRequestTimeout
+	case <-cm.shutdown:
+		return nil, fmt.Errorf("CMPP client shutting down")
+	}
+}
+
+// Query 通过 CMPP_QUERY 查询 ISMG 的统计信息
+// date 格式为 YYYYMMDD；queryType 为 QueryTypeService 时按 serviceId 查询
+func (cm *ClientManager) Query(date string, queryType uint8, serviceId string) (*CmppQueryRspPkt, error) {
+	req := &CmppQueryReqPkt{
+		Time:      date,
+		QueryType: queryType,
+		QueryCode: serviceId,
+	}
+	Infof("[CMPP][QUERY] Querying ISMG statistics: Time=%s Type=%d Code=%s", date, queryType, serviceId)
+	rsp, err := cm.call(req, defaultRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.(*CmppQueryRspPkt), nil
+}
+
+// Cancel 通过 CMPP_CANCEL 删除 ISMG 中尚未下发的消息，删除成功后将下发记录记为 CANCELD
+func (cm *ClientManager) Cancel(msgId uint64) (bool, error) {
+	Infof("[CMPP][CANCEL] Cancelling MsgId=%d", msgId)
+	rsp, err := cm.call(&CmppCancelReqPkt{MsgId: msgId}, defaultRequestTimeout)
+	if err != nil {
+		return false, err
+	}
+	if rsp.(*Cmpp3CancelRspPkt).SuccessId != 0 {
+		return false, nil
+	}
+	cm.pipeline.messageCanceled(fmt.Sprintf("%d", msgId))
+	return true, nil
+}
+
+// StartReceiptSweeper 启动状态报告关联缓冲区的过期清理协程
+func (cm *ClientManager) StartReceiptSweeper() {
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		cm.pipeline.runReceiptSweeper(cm.shutdown)
+	}()
 }
 
 // StartHeartbeat 启动心跳协程
@@ -438,7 +777,10 @@ func (cm *ClientManager) performHeartbeat() {
 	// 检查是否需要重连
 	if !cm.IsReady() || cm.GetClient() == nil {
 		Warnf("[CMPP][HEARTBEAT] Client not ready, attempting reconnection")
-		cm.ready.Store(false)
+		if cm.GetClient() != nil {
+			cm.endpoints.markLost(errors.New("connection lost"))
+		}
+		cm.pipeline.setReady(&cm.ready, false)
 		cm.StopReceiver() // 停止旧的接收协程
 
 		if err := cm.Connect(); err != nil {
@@ -447,6 +789,7 @@ func (cm *ClientManager) performHeartbeat() {
 		}
 
 		// 重连成功，启动接收协程
+		metrics.reconnects.Inc(ChannelCMPP)
 		cm.StartReceiver()
 		return
 	}
@@ -457,7 +800,9 @@ func (cm *ClientManager) performHeartbeat() {
 	_, err := cm.SendReqPkt(req)
 	if err != nil {
 		Errorf("[CMPP][HEARTBEAT] Heartbeat send failed: %v, will reconnect", err)
-		cm.ready.Store(false)
+		metrics.heartbeatFailures.Inc(ChannelCMPP)
+		cm.endpoints.markLost(err)
+		cm.pipeline.setReady(&cm.ready, false)
 		cm.StopReceiver() // 停止接收协程
 
 		// 尝试重连
@@ -467,7 +812,65 @@ func (cm *ClientManager) performHeartbeat() {
 		}
 
 		// 重连成功，启动接收协程
+		metrics.reconnects.Inc(ChannelCMPP)
 		cm.StartReceiver()
+		return
+	}
+
+	cm.tryFailback()
+}
+
+// tryFailback 当前使用备用地址时探测主地址，恢复后切回主地址
+//
+// 切换会断开当前连接，尚未收到响应的消息将被记为连接中断，
+// 因此先暂停提交，等待当前连接上的消息收到响应后再切换；等待期间不持有锁，提交直接返回 errSubmitPaused
+func (cm *ClientManager) tryFailback() {
+	if !cm.endpoints.shouldProbePrimary(time.Now()) {
+		return
+	}
+
+	primary := cm.endpoints.label(0)
+	if err := cm.probe(cm.endpoints.addr(0)); err != nil {
+		Debugf("[CMPP][FAILOVER] Primary endpoint %s still unavailable: %v", primary, err)
+		cm.endpoints.markFailure(0, err)
+		return
+	}
+
+	// 已进入 Submit 的提交登记完成后再开始等待
+	cm.submitMu.Lock()
+	cm.draining.Store(true)
+	cm.submitMu.Unlock()
+	defer cm.draining.Store(false)
+	if n := cm.drainInflight(cm.drainTimeout); n > 0 {
+		Infof("[CMPP][FAILOVER] Primary endpoint %s is healthy, but %d submits are still pending; switching back later", primary, n)
+		return
+	}
+
+	Infof("[CMPP][FAILOVER] Primary endpoint %s is healthy again, switching back from %s",
+		primary, cm.endpoints.label(cm.endpoints.activeIndex()))
+	cm.pipeline.setReady(&cm.ready, false)
+	cm.StopReceiver()
+	if err := cm.Connect(); err != nil {
+		Errorf("[CMPP][FAILOVER] Switching back failed: %v", err)
+		return
+	}
+	cm.StartReceiver()
+}
+
+// drainInflight 等待当前连接上的消息收到提交响应，返回超时后仍在等待的数量
+// 调用者需先将连接标记为 draining，保证等待期间没有新的提交
+func (cm *ClientManager) drainInflight(timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		n := cm.pipeline.inflightCount(cm.generation.Load())
+		if n == 0 || !time.Now().Before(deadline) {
+			return n
+		}
+		select {
+		case <-cm.shutdown:
+			return n
+		case <-time.After(50 * time.Millisecond):
+		}
 	}
 }
 
@@ -18,6 +18,7 @@ type mockClient struct {
 	sendReqFunc    func(p cmpp.Packer) (uint32, error)
 	sendRspFunc    func(p cmpp.Packer, seqId uint32) error
 	recvFunc       func(timeout time.Duration) (interface{}, error)
+	seq            atomic.Uint32
 }
 
 func (m *mockClient) Connect(addr, user, password string, timeout time.Duration) error {
@@ -40,6 +41,10 @@ func (m *mockClient) SendReqPkt(p cmpp.Packer) (uint32, error) {
 	return 0, fmt.Errorf("sendReq not implemented")
 }
 
+func (m *mockClient) NextSeq() uint32 {
+	return m.seq.Add(1)
+}
+
 func (m *mockClient) SendRspPkt(p cmpp.Packer, seqId uint32) error {
 	if m.sendRspFunc != nil {
 		return m.sendRspFunc(p, seqId)
@@ -604,7 +609,7 @@ func TestClientManagerReceiveLoopWithMock(t *testing.T) {
 		Content: "test message",
 		Created: time.Now(),
 	}
-	if err := SCache.SetWaitCache(100, testMes); err != nil {
+	if err := SCache.SetWaitCache(cm.Generation(), 100, testMes); err != nil {
 		t.Fatalf("Failed to set wait cache: %v", err)
 	}
 
@@ -747,3 +752,133 @@ func TestClientManagerHandleActiveTestRsp(t *testing.T) {
 	// 注意：这个测试依赖于 handleActiveTestRsp 的实现
 	cm.Shutdown()
 }
+
+// TestClientManagerReconnectResolvesStalePending 测试重连后旧连接上的等待消息被显式处理
+func TestClientManagerReconnectResolvesStalePending(t *testing.T) {
+	newTestBoltCache(t)
+
+	config := &Config{
+		CMPPHost: "127.0.0.1",
+		CMPPPort: "7891",
+		User:     "testuser",
+		Password: "testpass",
+	}
+	cm := NewClientManager(config)
+	cm.newClient = func() cmppClient {
+		return &mockClient{}
+	}
+
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	oldGen := cm.Generation()
+	if err := SCache.SetWaitCache(oldGen, 0, SmsMes{Dest: "13800138000", Content: "old"}); err != nil {
+		t.Fatalf("SetWaitCache failed: %v", err)
+	}
+
+	// 重连后 gocmpp 会从相同的 SeqId 重新开始分配
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("Reconnect failed: %v", err)
+	}
+	newGen := cm.Generation()
+	if newGen == oldGen {
+		t.Fatal("Expected generation to change after reconnect")
+	}
+	if err := SCache.SetWaitCache(newGen, 0, SmsMes{Dest: "13800138001", Content: "new"}); err != nil {
+		t.Fatalf("SetWaitCache failed: %v", err)
+	}
+
+	// 旧连接上的消息应已被记录为连接中断
+	list := *SCache.GetList("list_message", 0, 10)
+	if len(list) != 1 || list[0].Content != "old" || list[0].SubmitResult != 253 {
+		t.Fatalf("Expected stale message resolved with result 253, got %+v", list)
+	}
+
+	// 新连接的响应只能匹配新连接上的消息
+	cm.handleSubmitRsp(&cmpp.Cmpp3SubmitRspPkt{MsgId: 1, SeqId: 0, Result: 0}, oldGen)
+	if len(SCache.GetWaitList()) != 1 {
+		t.Fatal("Response from previous generation must not match new pending message")
+	}
+	cm.handleSubmitRsp(&cmpp.Cmpp3SubmitRspPkt{MsgId: 2, SeqId: 0, Result: 0}, newGen)
+	if len(SCache.GetWaitList()) != 0 {
+		t.Fatal("Expected pending message to be matched by current generation")
+	}
+
+	cm.Shutdown()
+}
+
+// TestClientManagerSubmitRegistersBeforeSend 测试提交先登记再发送，发送失败时撤销登记
+func TestClientManagerSubmitRegistersBeforeSend(t *testing.T) {
+	cache := newTestBoltCache(t)
+	cm := NewClientManager(&Config{User: "testuser"})
+
+	var registered atomic.Bool
+	fail := false
+	cm.newClient = func() cmppClient {
+		return &mockClient{
+			sendRspFunc: func(p cmpp.Packer, seqId uint32) error {
+				// 响应可能在写出后立即到达，此时消息必须已经登记
+				for _, mes := range cache.GetWaitList() {
+					if mes.Dest == "13800138000" {
+						registered.Store(true)
+					}
+				}
+				if fail {
+					return errors.New("write failed")
+				}
+				return nil
+			},
+		}
+	}
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer cm.Shutdown()
+
+	if err := cm.Submit(&SmsMes{Src: "01", Dest: "13800138000", Content: "hello"}); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if !registered.Load() {
+		t.Error("Message should be registered before it is sent")
+	}
+	if n := len(cache.GetWaitList()); n != 1 {
+		t.Fatalf("Expected 1 pending message, got %d", n)
+	}
+
+	fail = true
+	if err := cm.Submit(&SmsMes{Src: "01", Dest: "13800138001", Content: "hello"}); err == nil {
+		t.Fatal("Expected Submit to fail")
+	}
+	if n := len(cache.GetWaitList()); n != 1 {
+		t.Errorf("Failed submit should be unregistered, got %d pending messages", n)
+	}
+}
+
+// TestClientManagerSubmitRegisteredDelivery 测试 Registered_Delivery 默认为 0，按配置请求状态报告
+func TestClientManagerSubmitRegisteredDelivery(t *testing.T) {
+	newTestBoltCache(t)
+	for _, want := range []uint8{0, 1} {
+		cm := NewClientManager(&Config{User: "testuser", CMPPRegisteredDelivery: want})
+		var got uint8 = 0xff
+		cm.newClient = func() cmppClient {
+			return &mockClient{
+				sendRspFunc: func(p cmpp.Packer, seqId uint32) error {
+					if pkt, ok := p.(*cmpp.Cmpp3SubmitReqPkt); ok {
+						got = pkt.RegisteredDelivery
+					}
+					return nil
+				},
+			}
+		}
+		if err := cm.Connect(); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := cm.Submit(&SmsMes{Src: "01", Dest: "13800138000", Content: "hello"}); err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		cm.Shutdown()
+		if got != want {
+			t.Errorf("Expected RegisteredDelivery %d, got %d", want, got)
+		}
+	}
+}
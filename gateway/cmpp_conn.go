@@ -0,0 +1,201 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cmpp "github.com/bigwhite/gocmpp"
+)
+
+// 读取包体的超时时间：包头一旦开始到达，剩余部分应很快收齐
+const defaultPacketBodyTimeout = 5 * time.Second
+
+// cmppConn 是 CMPP 3.0 连接的帧层实现
+//
+// gocmpp 的 Conn 只能解码它内置的包类型（不支持 CMPP_QUERY/CMPP_CANCEL 的响应，
+// 遇到时会返回 ErrCommandIdNotSupported），因此这里自行处理分帧，
+// 包体的编解码仍复用 gocmpp 的包类型
+//
+// SMGP 3.0 的消息头与 CMPP 布局相同（长度+命令+序列号），
+// 通过替换 newPacket 和包长度上限复用同一套分帧逻辑
+type cmppConn struct {
+	conn   net.Conn
+	seq    atomic.Uint32
+	closed atomic.Bool
+	wmu    sync.Mutex // 保证一个包的字节连续写出
+
+	newPacket func(id uint32) (cmpp.Packer, error)
+	maxLen    uint32
+}
+
+func newCMPPConn(conn net.Conn) *cmppConn {
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetKeepAlive(true)
+	}
+	return &cmppConn{
+		conn: conn,
+		newPacket: func(id uint32) (cmpp.Packer, error) {
+			return newCMPPPacket(cmpp.CommandId(id))
+		},
+		maxLen: cmpp.CMPP3_PACKET_MAX,
+	}
+}
+
+// login 发送 CMPP_CONNECT 并校验响应
+func (c *cmppConn) login(user, password string, timeout time.Duration) error {
+	req := &cmpp.CmppConnReqPkt{
+		SrcAddr: user,
+		Secret:  password,
+		Version: cmpp.V30,
+	}
+	if _, err := c.SendReqPkt(req); err != nil {
+		return err
+	}
+
+	pkt, err := c.RecvAndUnpackPkt(timeout)
+	if err != nil {
+		return err
+	}
+	rsp, ok := pkt.(*cmpp.Cmpp3ConnRspPkt)
+	if !ok {
+		return cmpp.ErrRespNotMatch
+	}
+	if rsp.Status != 0 {
+		status := uint8(rsp.Status)
+		if status > cmpp.ErrnoConnOthers {
+			status = cmpp.ErrnoConnOthers
+		}
+		return cmpp.ConnRspStatusErrMap[status]
+	}
+	return nil
+}
+
+// Close 关闭连接（可重复调用）
+func (c *cmppConn) Close() {
+	if c.closed.CompareAndSwap(false, true) {
+		c.conn.Close()
+	}
+}
+
+// nextSeq 分配请求序列号
+func (c *cmppConn) nextSeq() uint32 {
+	return c.seq.Add(1)
+}
+
+// SendReqPkt 分配序列号并发送请求包
+func (c *cmppConn) SendReqPkt(p cmpp.Packer) (uint32, error) {
+	seqId := c.nextSeq()
+	return seqId, c.SendRspPkt(p, seqId)
+}
+
+// SendRspPkt 使用指定序列号发送包
+func (c *cmppConn) SendRspPkt(p cmpp.Packer, seqId uint32) error {
+	if c.closed.Load() {
+		return cmpp.ErrConnIsClosed
+	}
+	data, err := p.Pack(seqId)
+	if err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.conn.Write(data)
+	return err
+}
+
+// RecvAndUnpackPkt 读取一个完整的包并解码
+// 超时返回 cmpp.ErrReadCmdIDTimeout，与 gocmpp 的行为保持一致
+func (c *cmppConn) RecvAndUnpackPkt(timeout time.Duration) (interface{}, error) {
+	if c.closed.Load() {
+		return nil, cmpp.ErrConnIsClosed
+	}
+
+	var header [8]byte
+	if timeout != 0 {
+		c.conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	// 先读第一个字节：此时超时说明没有数据，可以安全地重试
+	if _, err := io.ReadFull(c.conn, header[:1]); err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, cmpp.ErrReadCmdIDTimeout
+		}
+		return nil, err
+	}
+
+	// 包已开始到达，剩余部分使用较长的超时，避免读取半个包后流错位
+	c.conn.SetReadDeadline(time.Now().Add(defaultPacketBodyTimeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	if _, err := io.ReadFull(c.conn, header[1:]); err != nil {
+		return nil, err
+	}
+
+	totalLen := binary.BigEndian.Uint32(header[:4])
+	commandId := binary.BigEndian.Uint32(header[4:])
+	if totalLen < cmpp.CMPP3_PACKET_MIN || totalLen > c.maxLen {
+		return nil, cmpp.ErrTotalLengthInvalid
+	}
+
+	// 剩余数据从 Sequence_Id 开始，与 gocmpp 各包 Unpack 的约定一致
+	body := make([]byte, totalLen-8)
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, cmpp.ErrReadPktBodyTimeout
+		}
+		return nil, err
+	}
+
+	p, err := c.newPacket(commandId)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Unpack(body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// errUnknownCommand 表示收到了无法解码的命令
+var errUnknownCommand = errors.New("unsupported cmpp command")
+
+// newCMPPPacket 根据 Command_Id 创建对应的 CMPP 3.0 包
+func newCMPPPacket(id cmpp.CommandId) (cmpp.Packer, error) {
+	switch id {
+	case cmpp.CMPP_CONNECT:
+		return &cmpp.CmppConnReqPkt{}, nil
+	case cmpp.CMPP_CONNECT_RESP:
+		return &cmpp.Cmpp3ConnRspPkt{}, nil
+	case cmpp.CMPP_TERMINATE:
+		return &cmpp.CmppTerminateReqPkt{}, nil
+	case cmpp.CMPP_TERMINATE_RESP:
+		return &cmpp.CmppTerminateRspPkt{}, nil
+	case cmpp.CMPP_SUBMIT:
+		return &cmpp.Cmpp3SubmitReqPkt{}, nil
+	case cmpp.CMPP_SUBMIT_RESP:
+		return &cmpp.Cmpp3SubmitRspPkt{}, nil
+	case cmpp.CMPP_DELIVER:
+		return &cmpp.Cmpp3DeliverReqPkt{}, nil
+	case cmpp.CMPP_DELIVER_RESP:
+		return &cmpp.Cmpp3DeliverRspPkt{}, nil
+	case cmpp.CMPP_QUERY:
+		return &CmppQueryReqPkt{}, nil
+	case cmpp.CMPP_QUERY_RESP:
+		return &CmppQueryRspPkt{}, nil
+	case cmpp.CMPP_CANCEL:
+		return &CmppCancelReqPkt{}, nil
+	case cmpp.CMPP_CANCEL_RESP:
+		return &Cmpp3CancelRspPkt{}, nil
+	case cmpp.CMPP_ACTIVE_TEST:
+		return &cmpp.CmppActiveTestReqPkt{}, nil
+	case cmpp.CMPP_ACTIVE_TEST_RESP:
+		return &cmpp.CmppActiveTestRspPkt{}, nil
+	default:
+		return nil, fmt.Errorf("%w: 0x%08x", errUnknownCommand, uint32(id))
+	}
+}
@@ -0,0 +1,156 @@
+package gateway
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	cmpp "github.com/bigwhite/gocmpp"
+)
+
+// startFakeISMG 启动一个最小的 ISMG，处理登录、查询和删除请求
+func startFakeISMG(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			netConn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeISMG(newCMPPConn(netConn))
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFakeISMG(conn *cmppConn) {
+	defer conn.Close()
+	for {
+		pkt, err := conn.RecvAndUnpackPkt(0)
+		if err != nil {
+			return
+		}
+		switch p := pkt.(type) {
+		case *cmpp.CmppConnReqPkt:
+			conn.SendRspPkt(&cmpp.Cmpp3ConnRspPkt{Status: 0, Version: cmpp.V30}, p.SeqId)
+		case *CmppQueryReqPkt:
+			conn.SendRspPkt(&CmppQueryRspPkt{
+				Time:      p.Time,
+				QueryType: p.QueryType,
+				QueryCode: p.QueryCode,
+				MtTlMsg:   10,
+				MtScs:     8,
+				MtFl:      2,
+			}, p.SeqId)
+		case *CmppCancelReqPkt:
+			var result uint32
+			if p.MsgId != 42 {
+				result = 1
+			}
+			conn.SendRspPkt(&Cmpp3CancelRspPkt{SuccessId: result}, p.SeqId)
+		}
+	}
+}
+
+func TestCmppQueryCancelPacketRoundTrip(t *testing.T) {
+	query := &CmppQueryRspPkt{Time: "20240102", QueryType: 1, QueryCode: "SVC", MtTlMsg: 1, MoFl: 8}
+	data, err := query.Pack(77)
+	if err != nil || uint32(len(data)) != CmppQueryRspPktLen {
+		t.Fatalf("Pack() len=%d err=%v", len(data), err)
+	}
+	var got CmppQueryRspPkt
+	if err := got.Unpack(data[8:]); err != nil {
+		t.Fatalf("Unpack() error: %v", err)
+	}
+	if got != *query {
+		t.Errorf("Unpack() = %+v, want %+v", got, *query)
+	}
+
+	cancel := &CmppCancelReqPkt{MsgId: 1<<63 + 5}
+	data, _ = cancel.Pack(9)
+	var gotCancel CmppCancelReqPkt
+	if err := gotCancel.Unpack(data[8:]); err != nil || gotCancel != *cancel {
+		t.Errorf("Cancel round trip = %+v, %v", gotCancel, err)
+	}
+
+	if err := got.Unpack(data[8:]); err == nil {
+		t.Error("Expected error when unpacking short data")
+	}
+}
+
+// TestClientManagerQueryAndCancel 通过真实连接测试 CMPP_QUERY / CMPP_CANCEL
+func TestClientManagerQueryAndCancel(t *testing.T) {
+	addr := startFakeISMG(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	cm := NewClientManager(&Config{CMPPHost: host, CMPPPort: port, User: "104221", Password: "secret"})
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	cm.StartReceiver()
+	defer cm.Shutdown()
+
+	rsp, err := cm.Query("20240102", QueryTypeService, "SVC")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if rsp.Time != "20240102" || rsp.QueryCode != "SVC" || rsp.MtTlMsg != 10 || rsp.MtFl != 2 {
+		t.Errorf("Unexpected query response: %+v", rsp)
+	}
+
+	ok, err := cm.Cancel(42)
+	if err != nil || !ok {
+		t.Errorf("Cancel(42) = %v, %v", ok, err)
+	}
+	ok, err = cm.Cancel(43)
+	if err != nil || ok {
+		t.Errorf("Cancel(43) = %v, %v", ok, err)
+	}
+}
+
+func TestClientManagerCallTimeout(t *testing.T) {
+	cm := NewClientManager(&Config{})
+	cm.newClient = func() cmppClient {
+		return &mockClient{
+			sendRspFunc: func(p cmpp.Packer, seqId uint32) error { return nil },
+		}
+	}
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer cm.Shutdown()
+
+	if _, err := cm.call(&CmppCancelReqPkt{MsgId: 1}, 50*time.Millisecond); err != errRequestTimeout {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if len(cm.calls) != 0 {
+		t.Error("Expected pending call to be removed after timeout")
+	}
+}
+
+func TestClientManagerDuplicateCallRsp(t *testing.T) {
+	cm := NewClientManager(&Config{})
+	ch := make(chan interface{}, 1)
+	cm.calls[callKey{gen: 1, seq: 7}] = ch
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cm.handleCallRsp(1, 7, &Cmpp3CancelRspPkt{SuccessId: 1})
+		cm.handleCallRsp(1, 7, &Cmpp3CancelRspPkt{SuccessId: 0})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Duplicate response should not block the receiver")
+	}
+	if rsp := (<-ch).(*Cmpp3CancelRspPkt); rsp.SuccessId != 1 {
+		t.Errorf("Expected the first response to be kept, got %+v", rsp)
+	}
+}
@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	cmpp "github.com/bigwhite/gocmpp"
+)
+
+// CMPP_QUERY / CMPP_CANCEL 的包长度（gocmpp 未实现这两类包）
+const (
+	CmppQueryReqPktLen   uint32 = 12 + 8 + 1 + 10 + 8   // 39
+	CmppQueryRspPktLen   uint32 = 12 + 8 + 1 + 10 + 8*4 // 63
+	CmppCancelReqPktLen  uint32 = 12 + 8                // 20
+	Cmpp3CancelRspPktLen uint32 = 12 + 4                // 16
+)
+
+// 查询类型
+const (
+	QueryTypeTotal   uint8 = 0 // 总数查询
+	QueryTypeService uint8 = 1 // 按业务类型查询
+)
+
+var errPacketTooShort = errors.New("packet data too short")
+
+// CmppQueryReqPkt 查询 ISMG 的统计信息
+type CmppQueryReqPkt struct {
+	Time      string // YYYYMMDD，精确到日
+	QueryType uint8
+	QueryCode string // 业务类型，QueryType 为 0 时忽略
+	Reserve   string
+
+	// session info
+	SeqId uint32
+}
+
+// CmppQueryRspPkt 是 ISMG 返回的统计信息
+type CmppQueryRspPkt struct {
+	Time      string
+	QueryType uint8
+	QueryCode string
+	MtTlMsg   uint32 // 从 SP 接收的消息总数
+	MtTlUsr   uint32 // 从 SP 接收的用户总数
+	MtScs     uint32 // 成功转发数量
+	MtWt      uint32 // 待转发数量
+	MtFl      uint32 // 转发失败数量
+	MoScs     uint32 // 向 SP 成功送达数量
+	MoWt      uint32 // 向 SP 待送达数量
+	MoFl      uint32 // 向 SP 送达失败数量
+
+	// session info
+	SeqId uint32
+}
+
+// CmppCancelReqPkt 删除 ISMG 中尚未下发的消息（如定时消息）
+type CmppCancelReqPkt struct {
+	MsgId uint64
+
+	// session info
+	SeqId uint32
+}
+
+// Cmpp3CancelRspPkt 删除结果，SuccessId 为 0 表示成功
+type Cmpp3CancelRspPkt struct {
+	SuccessId uint32
+
+	// session info
+	SeqId uint32
+}
+
+// writeHeader 写入消息头
+func writeHeader(buf *bytes.Buffer, totalLen uint32, id cmpp.CommandId, seqId uint32) {
+	binary.Write(buf, binary.BigEndian, totalLen)
+	binary.Write(buf, binary.BigEndian, id)
+	binary.Write(buf, binary.BigEndian, seqId)
+}
+
+// writeFixedString 写入定长字符串，不足部分补 0，超长部分截断
+func writeFixedString(buf *bytes.Buffer, s string, size int) {
+	b := make([]byte, size)
+	copy(b, s)
+	buf.Write(b)
+}
+
+// readFixedString 读取定长字符串，去掉第一个 0 字节及其后的内容
+func readFixedString(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return string(data[:i])
+	}
+	return string(data)
+}
+
+// Pack 打包查询请求
+func (p *CmppQueryReqPkt) Pack(seqId uint32) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, CmppQueryReqPktLen))
+	writeHeader(buf, CmppQueryReqPktLen, cmpp.CMPP_QUERY, seqId)
+	writeFixedString(buf, p.Time, 8)
+	buf.WriteByte(p.QueryType)
+	writeFixedString(buf, p.QueryCode, 10)
+	writeFixedString(buf, p.Reserve, 8)
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包查询请求，data 从 Sequence_Id 开始
+func (p *CmppQueryReqPkt) Unpack(data []byte) error {
+	if uint32(len(data)) < CmppQueryReqPktLen-8 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	p.Time = readFixedString(data[4:12])
+	p.QueryType = data[12]
+	p.QueryCode = readFixedString(data[13:23])
+	p.Reserve = readFixedString(data[23:31])
+	return nil
+}
+
+// Pack 打包查询响应
+func (p *CmppQueryRspPkt) Pack(seqId uint32) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, CmppQueryRspPktLen))
+	writeHeader(buf, CmppQueryRspPktLen, cmpp.CMPP_QUERY_RESP, seqId)
+	writeFixedString(buf, p.Time, 8)
+	buf.WriteByte(p.QueryType)
+	writeFixedString(buf, p.QueryCode, 10)
+	for _, v := range []uint32{p.MtTlMsg, p.MtTlUsr, p.MtScs, p.MtWt, p.MtFl, p.MoScs, p.MoWt, p.MoFl} {
+		binary.Write(buf, binary.BigEndian, v)
+	}
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包查询响应，data 从 Sequence_Id 开始
+func (p *CmppQueryRspPkt) Unpack(data []byte) error {
+	if uint32(len(data)) < CmppQueryRspPktLen-8 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	p.Time = readFixedString(data[4:12])
+	p.QueryType = data[12]
+	p.QueryCode = readFixedString(data[13:23])
+	counters := []*uint32{&p.MtTlMsg, &p.MtTlUsr, &p.MtScs, &p.MtWt, &p.MtFl, &p.MoScs, &p.MoWt, &p.MoFl}
+	for i, v := range counters {
+		*v = binary.BigEndian.Uint32(data[23+i*4:])
+	}
+	return nil
+}
+
+// Pack 打包删除请求
+func (p *CmppCancelReqPkt) Pack(seqId uint32) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, CmppCancelReqPktLen))
+	writeHeader(buf, CmppCancelReqPktLen, cmpp.CMPP_CANCEL, seqId)
+	binary.Write(buf, binary.BigEndian, p.MsgId)
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包删除请求，data 从 Sequence_Id 开始
+func (p *CmppCancelReqPkt) Unpack(data []byte) error {
+	if uint32(len(data)) < CmppCancelReqPktLen-8 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	p.MsgId = binary.BigEndian.Uint64(data[4:12])
+	return nil
+}
+
+// Pack 打包删除响应
+func (p *Cmpp3CancelRspPkt) Pack(seqId uint32) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, Cmpp3CancelRspPktLen))
+	writeHeader(buf, Cmpp3CancelRspPktLen, cmpp.CMPP_CANCEL_RESP, seqId)
+	binary.Write(buf, binary.BigEndian, p.SuccessId)
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包删除响应，data 从 Sequence_Id 开始
+func (p *Cmpp3CancelRspPkt) Unpack(data []byte) error {
+	if uint32(len(data)) < Cmpp3CancelRspPktLen-8 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	p.SuccessId = binary.BigEndian.Uint32(data[4:8])
+	return nil
+}
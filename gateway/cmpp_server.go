@@ -0,0 +1,652 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cmpp "github.com/bigwhite/gocmpp"
+	cmpputils "github.com/bigwhite/gocmpp/utils"
+)
+
+const (
+	// 下游连接的心跳间隔与最大无响应次数
+	cmppServerActiveTestInterval = 30 * time.Second
+	cmppServerActiveTestMax      = 3
+	// 提交进入发送队列的最长等待时间，超时返回流量控制错
+	cmppServerEnqueueTimeout = 5 * time.Second
+	// 下游账号离线时每个账号暂存的上行短信与状态报告数量上限
+	cmppServerMaxPending = 1000
+	// 向下游连接写出 Deliver 的超时
+	cmppServerWriteTimeout = 2 * time.Second
+	// 长短信等待其余分段的最长时间，超时未收齐则丢弃已收到的分段
+	cmppServerSegmentTimeout = 5 * time.Minute
+)
+
+// CMPP_CONNECT_RESP 的 Status
+const (
+	cmppConnOK           uint32 = 0
+	cmppConnInvalidSrc   uint32 = 2 // 非法源地址
+	cmppConnAuthFailed   uint32 = 3 // 认证错
+	cmppConnVersionError uint32 = 4 // 版本太高
+)
+
+// CMPP_SUBMIT_RESP 的 Result
+const (
+	cmppSubmitOK          uint32 = 0
+	cmppSubmitMalformed   uint32 = 1  // 消息结构错
+	cmppSubmitTooLong     uint32 = 6  // 超过最大信息长
+	cmppSubmitFlowControl uint32 = 8  // 流量控制错
+	cmppSubmitBadSrcId    uint32 = 10 // Src_Id 错误
+	cmppSubmitBadDest     uint32 = 13 // Dest_terminal_Id 错误
+)
+
+// proxyRoute 描述一条下发消息的状态报告应回送给哪个下游账号，由下发记录中的账号与 MsgId 得出
+type proxyRoute struct {
+	account   string
+	msgId     uint64 // 返回给下游的 MsgId
+	srcId     string // 下游提交时的 SrcId
+	dest      string
+	submitted time.Time
+}
+
+// downstreamSession 是已登录的下游连接，Deliver 经发送队列由该连接的写协程写出，
+// 观察者回调只入队，不等待网络写
+type downstreamSession struct {
+	account string
+	out     chan *cmpp.Cmpp3DeliverReqPkt
+}
+
+// segmentKey 标识下游提交的一条长短信
+type segmentKey struct {
+	account string
+	srcId   string
+	dests   string
+	ref     uint16 // UDH 中的长短信参考号
+}
+
+// partialSubmit 是尚未收齐分段的长短信
+type partialSubmit struct {
+	msgId   uint64 // 各分段共用的下游 MsgId
+	format  uint8
+	total   uint8
+	parts   map[uint8][]byte // 分段序号 -> 去掉 UDH 的内容
+	started time.Time
+}
+
+// CMPPServer 以 CMPP 3.0 服务端身份接入内部 SP（代理模式）
+//
+// 下游提交的消息进入发送队列，经上游通道转发，并立即以本网关生成的 MsgId 响应；
+// 上游的状态报告按下发记录中保存的账号与下游 MsgId、上行短信按接入号+扩展码路由，回送到对应账号的连接
+type CMPPServer struct {
+	cfg      *Config
+	accounts map[string]CMPPAccount
+	seq      uint32 // 生成下游 MsgId 的序列号
+
+	mu       sync.Mutex
+	ln       net.Listener
+	sessions map[*cmpp.Conn]*downstreamSession     // 已登录的连接
+	pending  map[string][]*cmpp.Cmpp3DeliverReqPkt // 账号离线时暂存的 Deliver
+	partials map[segmentKey]*partialSubmit         // 收齐前的长短信分段
+
+	shutdown chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewCMPPServer 创建 CMPP 代理服务
+func NewCMPPServer(cfg *Config) *CMPPServer {
+	accounts := make(map[string]CMPPAccount, len(cfg.CMPPServerAccounts))
+	for _, a := range cfg.CMPPServerAccounts {
+		accounts[a.User] = a
+	}
+	return &CMPPServer{
+		cfg:      cfg,
+		accounts: accounts,
+		sessions: make(map[*cmpp.Conn]*downstreamSession),
+		pending:  make(map[string][]*cmpp.Cmpp3DeliverReqPkt),
+		partials: make(map[segmentKey]*partialSubmit),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Start 开始监听下游连接，并注册为消息观察者
+func (s *CMPPServer) Start() error {
+	ln, err := net.Listen("tcp", s.cfg.CMPPServerAddr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+	addObserver(s)
+	Infof("[CMPP-SERVER] Accepting downstream connections on %s (%d accounts)", ln.Addr(), len(s.accounts))
+
+	srv := &cmpp.Server{
+		Handler:  s,
+		Typ:      cmpp.V30,
+		T:        cmppServerActiveTestInterval,
+		N:        cmppServerActiveTestMax,
+		ErrorLog: log.New(debugLogWriter{}, "", 0),
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := srv.Serve(ln); err != nil {
+			select {
+			case <-s.shutdown:
+			default:
+				Errorf("[CMPP-SERVER] Serve failed: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Addr 返回实际监听地址
+func (s *CMPPServer) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return ""
+	}
+	return s.ln.Addr().String()
+}
+
+// Stop 关闭监听与所有下游连接，并等待各连接的服务协程退出（可重复调用）
+//
+// cmpp.Conn 只能由 gocmpp 的服务协程关闭，这里只关闭底层 socket，
+// 服务协程读取失败后自行关闭连接
+func (s *CMPPServer) Stop() {
+	s.once.Do(func() {
+		close(s.shutdown)
+		removeObserver(s)
+		s.mu.Lock()
+		if s.ln != nil {
+			s.ln.Close()
+		}
+		conns := make([]*cmpp.Conn, 0, len(s.sessions))
+		for conn := range s.sessions {
+			conn.Conn.Close()
+			conns = append(conns, conn)
+			s.removeSessionLocked(conn)
+		}
+		s.mu.Unlock()
+		for _, conn := range conns {
+			waitConnClosed(conn)
+		}
+		s.wg.Wait()
+	})
+}
+
+// waitConnClosed 等待服务协程关闭连接：cmpp.Conn 关闭时会结束 SeqId 通道
+func waitConnClosed(conn *cmpp.Conn) {
+	for range conn.SeqId {
+	}
+}
+
+// ServeCmpp 实现 cmpp.Handler，处理下游连接上的请求
+func (s *CMPPServer) ServeCmpp(r *cmpp.Response, p *cmpp.Packet, l *log.Logger) (bool, error) {
+	switch req := p.Packer.(type) {
+	case *cmpp.CmppConnReqPkt:
+		return false, s.handleConnect(r, p.Conn, req)
+	case *cmpp.Cmpp3SubmitReqPkt:
+		return false, s.handleSubmit(r.Packer.(*cmpp.Cmpp3SubmitRspPkt), p.Conn, req)
+	case *cmpp.CmppTerminateReqPkt:
+		var account string
+		s.mu.Lock()
+		if sess, ok := s.sessions[p.Conn]; ok {
+			account = sess.account
+		}
+		s.removeSessionLocked(p.Conn)
+		s.mu.Unlock()
+		Infof("[CMPP-SERVER] Account %s terminated connection from %s", account, p.Conn.RemoteAddr())
+	}
+	return false, nil
+}
+
+// cmppAuthSrc 按协议计算 AuthenticatorSource：MD5(Source_Addr + 9 字节 0 + shared secret + timestamp)
+func cmppAuthSrc(srcAddr, secret string, timestamp uint32) string {
+	sum := md5.Sum(bytes.Join([][]byte{
+		[]byte(cmpputils.OctetString(srcAddr, 6)),
+		make([]byte, 9),
+		[]byte(secret),
+		[]byte(cmpputils.TimeStamp2Str(timestamp)),
+	}, nil))
+	return string(sum[:])
+}
+
+// handleConnect 校验下游账号，成功后登记连接并补发离线期间暂存的 Deliver
+func (s *CMPPServer) handleConnect(r *cmpp.Response, conn *cmpp.Conn, req *cmpp.CmppConnReqPkt) error {
+	rsp := r.Packer.(*cmpp.Cmpp3ConnRspPkt)
+	user := strings.TrimRight(req.SrcAddr, "\x00")
+	account, ok := s.accounts[user]
+
+	rsp.Version = cmpp.V30
+	rsp.AuthSrc = req.AuthSrc
+	switch {
+	case req.Version != cmpp.V30:
+		rsp.Status = cmppConnVersionError // 仅支持 CMPP 3.0
+	case !ok:
+		rsp.Status = cmppConnInvalidSrc
+	case cmppAuthSrc(req.SrcAddr, account.Password, req.Timestamp) != req.AuthSrc:
+		rsp.Status = cmppConnAuthFailed
+	default:
+		rsp.Status = cmppConnOK
+		rsp.Secret = account.Password
+	}
+	if rsp.Status != cmppConnOK {
+		Warnf("[CMPP-SERVER] Rejected connect from %s: user=%s version=0x%x status=%d", conn.RemoteAddr(), user, req.Version, rsp.Status)
+		return fmt.Errorf("cmpp server: connect rejected with status %d", rsp.Status)
+	}
+
+	// 先写出响应再补发暂存的 Deliver，保证下游先收到 Connect_Resp
+	if err := conn.SendPkt(rsp, r.SeqId); err != nil {
+		return err
+	}
+	r.Packer = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := &downstreamSession{account: user, out: make(chan *cmpp.Cmpp3DeliverReqPkt, cmppServerMaxPending)}
+	s.sessions[conn] = sess
+	queued := s.pending[user]
+	delete(s.pending, user)
+	Infof("[CMPP-SERVER] Account %s connected from %s, flushing %d queued delivers", user, conn.RemoteAddr(), len(queued))
+	for _, p := range queued {
+		sess.out <- p
+	}
+	s.wg.Add(1)
+	go s.writeLoop(conn, sess)
+	return nil
+}
+
+// handleSubmit 将下游提交的消息放入发送队列，并以本网关生成的 MsgId 响应
+//
+// 长短信（TP_udhi=1）的分段先暂存，收齐后拼接为一条完整的消息转发，各分段以同一个 MsgId 响应
+func (s *CMPPServer) handleSubmit(rsp *cmpp.Cmpp3SubmitRspPkt, conn *cmpp.Conn, req *cmpp.Cmpp3SubmitReqPkt) error {
+	s.mu.Lock()
+	sess, ok := s.sessions[conn]
+	s.mu.Unlock()
+	if !ok {
+		rsp.Result = cmppSubmitMalformed
+		return errors.New("cmpp server: submit before connect")
+	}
+	user := sess.account
+	account := s.accounts[user]
+
+	content := []byte(req.MsgContent)
+	format := req.MsgFmt
+	var msgId uint64
+	var key *segmentKey
+	if req.TpUdhi == 1 {
+		ref, total, number, body, ok := parseConcatUDH(content)
+		if !ok {
+			rsp.Result = cmppSubmitMalformed
+			Warnf("[CMPP-SERVER] Account %s submitted segment with unsupported UDH", user)
+			return nil
+		}
+		key = &segmentKey{account: user, srcId: req.SrcId, dests: strings.Join(req.DestTerminalId, ","), ref: ref}
+		var complete bool
+		msgId, format, content, complete = s.addSegment(*key, req.MsgFmt, total, number, body)
+		if !complete {
+			rsp.MsgId = msgId
+			rsp.Result = cmppSubmitOK
+			Debugf("[CMPP-SERVER] Account %s submitted segment %d/%d of MsgId=%d", user, number, total, msgId)
+			return nil
+		}
+	}
+	text := decodeMsgContent(format, content)
+	src := s.extCode(account, req.SrcId)
+
+	dests := make([]string, 0, len(req.DestTerminalId))
+	for _, d := range req.DestTerminalId {
+		if len(d) == 13 && strings.HasPrefix(d, "86") {
+			d = d[2:]
+		}
+		if _, err := ValidateSubmitParams(src, d, text); err != nil {
+			rsp.Result = submitResultForValidation(err)
+			Warnf("[CMPP-SERVER] Account %s submit rejected: %v", user, err)
+			s.dropSegments(key)
+			return nil
+		}
+		dests = append(dests, d)
+	}
+	if !IsCmppReady() {
+		rsp.Result = cmppSubmitFlowControl
+		Warnf("[CMPP-SERVER] Upstream not ready, rejecting submit from account %s", user)
+		return nil
+	}
+
+	if msgId == 0 {
+		msgId = s.nextMsgId()
+	}
+	timeout := time.NewTimer(cmppServerEnqueueTimeout)
+	defer timeout.Stop()
+	for _, d := range dests {
+		mes := SmsMes{
+			Src:        src,
+			Dest:       d,
+			Content:    text,
+			Account:    user,
+			ProxyMsgId: strconv.FormatUint(msgId, 10),
+		}
+		select {
+		case Messages <- mes:
+		case <-s.shutdown:
+			rsp.Result = cmppSubmitFlowControl
+			return nil
+		case <-timeout.C:
+			rsp.Result = cmppSubmitFlowControl
+			Warnf("[CMPP-SERVER] Send queue full, rejecting submit from account %s", user)
+			return nil
+		}
+	}
+	// 入队失败时保留分段，下游重发最后一段即可再次拼接
+	s.dropSegments(key)
+	rsp.MsgId = msgId
+	rsp.Result = cmppSubmitOK
+	Infof("[CMPP-SERVER] Account %s submitted MsgId=%d Src=%s Dest=%v", user, msgId, src, dests)
+	return nil
+}
+
+// parseConcatUDH 解析长短信的 UDH（IEI 0x00 为 8 位参考号，0x08 为 16 位参考号），返回去掉 UDH 的内容
+func parseConcatUDH(content []byte) (ref uint16, total, number uint8, body []byte, ok bool) {
+	if len(content) == 0 || int(content[0])+1 > len(content) {
+		return 0, 0, 0, nil, false
+	}
+	udh, body := content[1:content[0]+1], content[content[0]+1:]
+	for len(udh) >= 2 {
+		iei, n := udh[0], int(udh[1])
+		if len(udh) < 2+n {
+			break
+		}
+		ie := udh[2 : 2+n]
+		switch {
+		case iei == 0x00 && n == 3:
+			ref, total, number = uint16(ie[0]), ie[1], ie[2]
+			ok = true
+		case iei == 0x08 && n == 4:
+			ref, total, number = uint16(ie[0])<<8|uint16(ie[1]), ie[2], ie[3]
+			ok = true
+		}
+		udh = udh[2+n:]
+	}
+	if !ok || total == 0 || number == 0 || number > total {
+		return 0, 0, 0, nil, false
+	}
+	return ref, total, number, body, true
+}
+
+// addSegment 暂存长短信的一个分段，收齐后按序拼接内容
+//
+// 返回各分段共用的下游 MsgId；拼接后的分段在转发成功后由 dropSegments 删除
+func (s *CMPPServer) addSegment(key segmentKey, format, total, number uint8, body []byte) (msgId uint64, msgFmt uint8, content []byte, complete bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, p := range s.partials {
+		if now.Sub(p.started) >= cmppServerSegmentTimeout {
+			Warnf("[CMPP-SERVER] Account %s dropped incomplete long message MsgId=%d (%d/%d segments)", k.account, p.msgId, len(p.parts), p.total)
+			delete(s.partials, k)
+		}
+	}
+	p := s.partials[key]
+	if p == nil || p.total != total {
+		p = &partialSubmit{msgId: s.nextMsgId(), format: format, total: total, parts: make(map[uint8][]byte), started: now}
+		s.partials[key] = p
+	}
+	p.parts[number] = body
+	if len(p.parts) < int(p.total) {
+		return p.msgId, p.format, nil, false
+	}
+	for i := uint8(1); i <= p.total; i++ {
+		content = append(content, p.parts[i]...)
+	}
+	return p.msgId, p.format, content, true
+}
+
+// dropSegments 删除已转发或被拒绝的长短信分段，key 为 nil 表示普通短信
+func (s *CMPPServer) dropSegments(key *segmentKey) {
+	if key == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.partials, *key)
+	s.mu.Unlock()
+}
+
+// submitResultForValidation 将参数验证错误转换为 Submit_Resp 的 Result
+func submitResultForValidation(err error) uint32 {
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		return cmppSubmitMalformed
+	}
+	switch ve.Field {
+	case "dest":
+		return cmppSubmitBadDest
+	case "src":
+		return cmppSubmitBadSrcId
+	default:
+		return cmppSubmitTooLong
+	}
+}
+
+// extCode 从下游的 SrcId 中取出扩展码：去掉接入号前缀，并补齐账号的扩展码
+func (s *CMPPServer) extCode(account CMPPAccount, srcId string) string {
+	ext := strings.TrimPrefix(srcId, s.cfg.SmsAccessNo)
+	if !strings.HasPrefix(ext, account.ExtCode) {
+		ext = account.ExtCode + ext
+	}
+	return ext
+}
+
+// nextMsgId 生成返回给下游的 MsgId
+func (s *CMPPServer) nextMsgId() uint64 {
+	now := time.Now()
+	return EncodeMsgId(MsgIdParts{
+		Month:    int(now.Month()),
+		Day:      now.Day(),
+		Hour:     now.Hour(),
+		Minute:   now.Minute(),
+		Second:   now.Second(),
+		IsmgCode: s.cfg.CMPPServerIsmgCode,
+		Sequence: uint16(atomic.AddUint32(&s.seq, 1)),
+	})
+}
+
+// routeOf 由下发记录得出状态报告的回送路由，HTTP 提交的记录返回 false
+func (s *CMPPServer) routeOf(mes SmsMes) (proxyRoute, bool) {
+	if mes.Account == "" {
+		return proxyRoute{}, false
+	}
+	proxyMsgId, err := strconv.ParseUint(mes.ProxyMsgId, 10, 64)
+	if err != nil {
+		Warnf("[CMPP-SERVER] Invalid downstream MsgId %q for account %s", mes.ProxyMsgId, mes.Account)
+		return proxyRoute{}, false
+	}
+	return proxyRoute{
+		account:   mes.Account,
+		msgId:     proxyMsgId,
+		srcId:     s.cfg.SmsAccessNo + mes.Src,
+		dest:      mes.Dest,
+		submitted: mes.Created,
+	}, true
+}
+
+// submitDone 在上游拒绝提交时直接回送失败的状态报告
+func (s *CMPPServer) submitDone(mes SmsMes) {
+	if mes.SubmitResult == 0 {
+		return
+	}
+	route, ok := s.routeOf(mes)
+	if !ok {
+		return
+	}
+	Warnf("[CMPP-SERVER] Upstream submit for account %s failed: MsgId=%s Result=%d", mes.Account, mes.ProxyMsgId, mes.SubmitResult)
+	s.deliver(route.account, s.receiptPkt(route, "UNDELIV"))
+}
+
+// receiptDone 将上游状态报告转换为下游 MsgId 后回送
+//
+// 路由取自匹配到的下发记录，进程重启后收到的状态报告同样能回送
+func (s *CMPPServer) receiptDone(receipt, mes SmsMes) {
+	route, ok := s.routeOf(mes)
+	if !ok {
+		return
+	}
+	Debugf("[CMPP-SERVER] Forwarding receipt MsgId=%s -> %d to account %s: %s", receipt.MsgId, route.msgId, route.account, receipt.DeliveryStat)
+	s.deliver(route.account, s.receiptPkt(route, receipt.DeliveryStat))
+}
+
+// moDone 按接入号+扩展码的最长前缀将上行短信路由到下游账号
+func (s *CMPPServer) moDone(mes SmsMes) {
+	account, ok := s.routeMO(mes.Dest)
+	if !ok {
+		return
+	}
+	format, content := encodeMsgContent(mes.Content)
+	if len(content) > 255 {
+		content = content[:255]
+	}
+	Debugf("[CMPP-SERVER] Forwarding MO Src=%s Dest=%s to account %s", mes.Src, mes.Dest, account)
+	s.deliver(account, &cmpp.Cmpp3DeliverReqPkt{
+		MsgId:         s.nextMsgId(),
+		DestId:        mes.Dest,
+		ServiceId:     s.cfg.ServiceId,
+		MsgFmt:        format,
+		SrcTerminalId: mes.Src,
+		MsgLength:     uint8(len(content)),
+		MsgContent:    string(content),
+	})
+}
+
+// routeMO 返回上行短信目的号码所属的下游账号
+func (s *CMPPServer) routeMO(dest string) (string, bool) {
+	account, best := "", -1
+	for user, a := range s.accounts {
+		prefix := s.cfg.SmsAccessNo + a.ExtCode
+		if strings.HasPrefix(dest, prefix) && len(prefix) > best {
+			account, best = user, len(prefix)
+		}
+	}
+	return account, best >= 0
+}
+
+// receiptPkt 构造回送给下游的状态报告
+func (s *CMPPServer) receiptPkt(route proxyRoute, stat string) *cmpp.Cmpp3DeliverReqPkt {
+	r := &cmpp.CmppReceiptPkt{
+		MsgId:          route.msgId,
+		Stat:           stat,
+		SubmitTime:     route.submitted.Format("0601021504"),
+		DoneTime:       time.Now().Format("0601021504"),
+		DestTerminalId: route.dest,
+	}
+	data, _ := r.Pack()
+	return &cmpp.Cmpp3DeliverReqPkt{
+		MsgId:            s.nextMsgId(),
+		DestId:           route.srcId,
+		ServiceId:        s.cfg.ServiceId,
+		SrcTerminalId:    route.dest,
+		RegisterDelivery: 1,
+		MsgLength:        uint8(len(data)),
+		MsgContent:       string(data),
+	}
+}
+
+// deliver 放入账号在线连接中队列最短的一个，账号离线时暂存到登录后补发
+//
+// 只入队不写网络，可在观察者回调中调用；队列已满时丢弃最早的 Deliver
+func (s *CMPPServer) deliver(account string, p *cmpp.Cmpp3DeliverReqPkt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var target *downstreamSession
+	for _, sess := range s.sessions {
+		if sess.account == account && (target == nil || len(sess.out) < len(target.out)) {
+			target = sess
+		}
+	}
+	if target != nil {
+		select {
+		case target.out <- p:
+		default:
+			Warnf("[CMPP-SERVER] Deliver queue of account %s full, dropping oldest deliver", account)
+			select {
+			case <-target.out:
+			default:
+			}
+			// 只在持锁时入队，取出一个后必有空位
+			target.out <- p
+		}
+		return
+	}
+
+	queue := append(s.pending[account], p)
+	if len(queue) > cmppServerMaxPending {
+		Warnf("[CMPP-SERVER] Account %s offline, dropping %d oldest queued delivers", account, len(queue)-cmppServerMaxPending)
+		queue = queue[len(queue)-cmppServerMaxPending:]
+	}
+	s.pending[account] = queue
+}
+
+// removeSessionLocked 注销连接并关闭其发送队列，写协程写完剩余的 Deliver 后退出
+func (s *CMPPServer) removeSessionLocked(conn *cmpp.Conn) {
+	if sess, ok := s.sessions[conn]; ok {
+		delete(s.sessions, conn)
+		close(sess.out)
+	}
+}
+
+// writeLoop 依次写出连接发送队列中的 Deliver
+//
+// 写失败时关闭底层 socket（由服务协程结束该连接）并注销连接，
+// 剩余的 Deliver 改投账号的其他连接或暂存
+func (s *CMPPServer) writeLoop(conn *cmpp.Conn, sess *downstreamSession) {
+	defer s.wg.Done()
+	failed := false
+	for p := range sess.out {
+		if !failed {
+			err := sendDeliver(conn, p)
+			if err == nil {
+				continue
+			}
+			Warnf("[CMPP-SERVER] Deliver to account %s at %s failed: %v", sess.account, conn.RemoteAddr(), err)
+			conn.Conn.Close()
+			s.mu.Lock()
+			s.removeSessionLocked(conn)
+			s.mu.Unlock()
+			failed = true
+		}
+		s.deliver(sess.account, p)
+	}
+}
+
+// sendDeliver 向下游连接写出 Deliver
+//
+// 直接写底层 socket（net.Conn 可并发写），不经过 cmpp.Conn.SendPkt：
+// 后者读取的连接状态由服务协程修改，在观察者协程中访问会产生数据竞争
+func sendDeliver(conn *cmpp.Conn, p *cmpp.Cmpp3DeliverReqPkt) error {
+	data, err := p.Pack(<-conn.SeqId)
+	if err != nil {
+		return err
+	}
+	conn.Conn.SetWriteDeadline(time.Now().Add(cmppServerWriteTimeout))
+	_, err = conn.Conn.Write(data)
+	return err
+}
+
+// debugLogWriter 将 gocmpp 服务端的日志转到 Debug 级别
+type debugLogWriter struct{}
+
+func (debugLogWriter) Write(p []byte) (int, error) {
+	Debugf("[CMPP-SERVER] %s", strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,279 @@
+package gateway
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	cmpp "github.com/bigwhite/gocmpp"
+)
+
+// stubChannel 是始终就绪的上游通道，测试直接驱动其 pipeline 模拟上游响应
+type stubChannel struct {
+	pipeline  *messagePipeline
+	submitErr error
+}
+
+func (c *stubChannel) Name() string                { return ChannelCMPP }
+func (c *stubChannel) Start()                      {}
+func (c *stubChannel) Stop()                       {}
+func (c *stubChannel) IsReady() bool               { return true }
+func (c *stubChannel) Submit(mes *SmsMes) error    { return c.submitErr }
+func (c *stubChannel) SetHandler(h ChannelHandler) { c.pipeline.setHandler(h) }
+func (c *stubChannel) SubmitFailed(mes *SmsMes)    { c.pipeline.submitFailed(mes) }
+
+func startTestCMPPServer(t *testing.T) (*CMPPServer, *stubChannel) {
+	t.Helper()
+	ch := &stubChannel{pipeline: newMessagePipeline(ChannelCMPP)}
+	oldUpstream := upstream
+	upstream = ch
+	s := NewCMPPServer(&Config{
+		SmsAccessNo:    "10659",
+		ServiceId:      "TEST",
+		CMPPServerAddr: "127.0.0.1:0",
+		CMPPServerAccounts: []CMPPAccount{
+			{User: "900001", Password: "secret1", ExtCode: "88"},
+			{User: "900002", Password: "secret2", ExtCode: "881"},
+		},
+		CMPPServerIsmgCode: 1234,
+	})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() {
+		s.Stop()
+		upstream = oldUpstream
+	})
+	return s, ch
+}
+
+func dialCMPPServer(t *testing.T, s *CMPPServer, user, password string) (*cmpp.Client, error) {
+	t.Helper()
+	c := cmpp.NewClient(cmpp.V30)
+	if err := c.Connect(s.Addr(), user, password, time.Second); err != nil {
+		return nil, err
+	}
+	t.Cleanup(c.Disconnect)
+	return c, nil
+}
+
+// recvDeliver 读取下一个 Deliver 并回复响应
+func recvDeliver(t *testing.T, c *cmpp.Client) *cmpp.Cmpp3DeliverReqPkt {
+	t.Helper()
+	for {
+		pkt, err := c.RecvAndUnpackPkt(2 * time.Second)
+		if err != nil {
+			t.Fatalf("Receive deliver failed: %v", err)
+		}
+		if p, ok := pkt.(*cmpp.Cmpp3DeliverReqPkt); ok {
+			c.SendRspPkt(&cmpp.Cmpp3DeliverRspPkt{MsgId: p.MsgId}, p.SeqId)
+			return p
+		}
+	}
+}
+
+func TestCMPPServerAuth(t *testing.T) {
+	s, _ := startTestCMPPServer(t)
+
+	if _, err := dialCMPPServer(t, s, "900001", "wrong"); err == nil {
+		t.Error("Expected connect with wrong password to be rejected")
+	}
+	if _, err := dialCMPPServer(t, s, "999999", "secret1"); err == nil {
+		t.Error("Expected connect with unknown account to be rejected")
+	}
+	if _, err := dialCMPPServer(t, s, "900001", "secret1"); err != nil {
+		t.Errorf("Connect failed: %v", err)
+	}
+}
+
+func TestCMPPServerRelaysSubmitAndReceipt(t *testing.T) {
+	newTestBoltCache(t)
+	s, ch := startTestCMPPServer(t)
+	c, err := dialCMPPServer(t, s, "900001", "secret1")
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	format, content := encodeMsgContent("验证码 123456")
+	if _, err := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{
+		PkTotal: 1, PkNumber: 1, RegisteredDelivery: 1, MsgFmt: format,
+		SrcId: "1065901", DestUsrTl: 2, DestTerminalId: []string{"13800000000", "8613900000000"},
+		MsgLength: uint8(len(content)), MsgContent: string(content),
+	}); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	pkt, err := c.RecvAndUnpackPkt(2 * time.Second)
+	if err != nil {
+		t.Fatalf("Receive submit response failed: %v", err)
+	}
+	rsp := pkt.(*cmpp.Cmpp3SubmitRspPkt)
+	if rsp.Result != 0 || DecodeMsgId(rsp.MsgId).IsmgCode != 1234 {
+		t.Fatalf("Unexpected submit response: %+v", rsp)
+	}
+
+	// 模拟发送协程与上游：第一条成功，第二条被上游拒绝
+	for i, result := range []uint32{0, 8} {
+		mes := <-Messages
+		if mes.Account != "900001" || mes.Src != "8801" || mes.Content != "验证码 123456" {
+			t.Fatalf("Unexpected queued message: %+v", mes)
+		}
+		mes.Created = time.Now()
+		ch.pipeline.addPending(1, uint32(i), &mes)
+		ch.pipeline.submitResponded(1, uint32(i), strconv.Itoa(5000+i), result)
+	}
+	if d := recvDeliver(t, c); d.RegisterDelivery != 1 || d.SrcTerminalId != "13900000000" {
+		t.Fatalf("Expected failure receipt for rejected submit, got %+v", d)
+	}
+
+	ch.pipeline.receiptReceived(SmsMes{MsgId: "5000", DelivleryResult: 0, DeliveryStat: "DELIVRD"})
+	d := recvDeliver(t, c)
+	var r cmpp.CmppReceiptPkt
+	if err := r.Unpack([]byte(d.MsgContent)); err != nil {
+		t.Fatalf("Unpack receipt failed: %v", err)
+	}
+	if d.RegisterDelivery != 1 || d.DestId != "106598801" || r.MsgId != rsp.MsgId || r.Stat != "DELIVRD" || r.DestTerminalId != "13800000000" {
+		t.Errorf("Unexpected receipt: %+v %+v", d, r)
+	}
+}
+
+// TestCMPPServerReassemblesLongMessage 测试长短信的分段收齐后拼接为一条消息转发
+func TestCMPPServerReassemblesLongMessage(t *testing.T) {
+	newTestBoltCache(t)
+	s, _ := startTestCMPPServer(t)
+	c, err := dialCMPPServer(t, s, "900001", "secret1")
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	format, content := encodeMsgContent("第一段内容，第二段内容")
+	half := len(content) / 2
+	var msgIds []uint64
+	// 先提交第二段，分段可以乱序到达
+	for _, seg := range []struct {
+		number byte
+		body   []byte
+	}{{2, content[half:]}, {1, content[:half]}} {
+		data := append([]byte{0x05, 0x00, 0x03, 0x2a, 0x02, seg.number}, seg.body...)
+		if _, err := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{
+			PkTotal: 2, PkNumber: seg.number, TpUdhi: 1, MsgFmt: format,
+			SrcId: "10659", DestUsrTl: 1, DestTerminalId: []string{"13800000000"},
+			MsgLength: uint8(len(data)), MsgContent: string(data),
+		}); err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		pkt, err := c.RecvAndUnpackPkt(2 * time.Second)
+		if err != nil {
+			t.Fatalf("Receive submit response failed: %v", err)
+		}
+		rsp := pkt.(*cmpp.Cmpp3SubmitRspPkt)
+		if rsp.Result != 0 {
+			t.Fatalf("Unexpected submit response: %+v", rsp)
+		}
+		msgIds = append(msgIds, rsp.MsgId)
+	}
+	if msgIds[0] != msgIds[1] {
+		t.Errorf("Expected segments to share MsgId, got %v", msgIds)
+	}
+
+	select {
+	case mes := <-Messages:
+		if mes.Content != "第一段内容，第二段内容" || mes.ProxyMsgId != strconv.FormatUint(msgIds[0], 10) {
+			t.Errorf("Unexpected queued message: %+v", mes)
+		}
+	default:
+		t.Fatal("Expected reassembled message in send queue")
+	}
+	select {
+	case mes := <-Messages:
+		t.Errorf("Expected a single queued message, got extra %+v", mes)
+	default:
+	}
+}
+
+// TestCMPPServerReceiptFromStoredRoute 测试状态报告按下发记录中的账号回送，不依赖本进程见过该提交
+func TestCMPPServerReceiptFromStoredRoute(t *testing.T) {
+	cache := newTestBoltCache(t)
+	s, ch := startTestCMPPServer(t)
+	c, err := dialCMPPServer(t, s, "900002", "secret2")
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// 模拟重启前提交、已入库的下发记录
+	proxyMsgId := s.nextMsgId()
+	cache.AddSubmits(&SmsMes{
+		Src: "8815", Dest: "13800000000", Content: "hello", Created: time.Now().Add(-100 * time.Hour),
+		MsgId: "7000", Channel: ChannelCMPP, Account: "900002", ProxyMsgId: strconv.FormatUint(proxyMsgId, 10),
+	})
+	ch.pipeline.receiptReceived(SmsMes{MsgId: "7000", DelivleryResult: 0, DeliveryStat: "DELIVRD"})
+
+	d := recvDeliver(t, c)
+	var r cmpp.CmppReceiptPkt
+	if err := r.Unpack([]byte(d.MsgContent)); err != nil {
+		t.Fatalf("Unpack receipt failed: %v", err)
+	}
+	if d.DestId != "106598815" || r.MsgId != proxyMsgId || r.Stat != "DELIVRD" {
+		t.Errorf("Unexpected receipt: %+v %+v", d, r)
+	}
+}
+
+// TestCMPPServerDeliverDoesNotBlock 测试下游连接写阻塞时回送不阻塞观察者回调
+func TestCMPPServerDeliverDoesNotBlock(t *testing.T) {
+	s, _ := startTestCMPPServer(t)
+
+	// net.Pipe 的写在对端读取前一直阻塞，模拟不再读取的下游
+	local, remote := net.Pipe()
+	defer remote.Close()
+	// Stop 等待 SeqId 通道关闭，这里预先关闭
+	seq := make(chan uint32, 1)
+	seq <- 1
+	close(seq)
+	conn := &cmpp.Conn{Conn: local, SeqId: seq}
+	s.mu.Lock()
+	sess := &downstreamSession{account: "900001", out: make(chan *cmpp.Cmpp3DeliverReqPkt, 2)}
+	s.sessions[conn] = sess
+	s.wg.Add(1)
+	go s.writeLoop(conn, sess)
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			s.deliver("900001", &cmpp.Cmpp3DeliverReqPkt{MsgContent: "hi"})
+		}
+		s.Addr() // 回送期间服务端的锁不被写操作占用
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("deliver blocked on a stalled downstream connection")
+	}
+}
+
+func TestCMPPServerForwardsMO(t *testing.T) {
+	newTestBoltCache(t)
+	s, ch := startTestCMPPServer(t)
+
+	// 账号离线时暂存，登录后补发；按扩展码最长前缀路由
+	ch.pipeline.moReceived(SmsMes{MsgId: "1", Src: "13800000000", Dest: "106598812", Content: "回复"})
+	ch.pipeline.moReceived(SmsMes{MsgId: "2", Src: "13800000000", Dest: "10659885", Content: "TD"})
+
+	c2, err := dialCMPPServer(t, s, "900002", "secret2")
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	d := recvDeliver(t, c2)
+	if d.RegisterDelivery != 0 || d.DestId != "106598812" || d.SrcTerminalId != "13800000000" || decodeMsgContent(d.MsgFmt, []byte(d.MsgContent)) != "回复" {
+		t.Errorf("Unexpected MO for account 900002: %+v", d)
+	}
+
+	c1, err := dialCMPPServer(t, s, "900001", "secret1")
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if d := recvDeliver(t, c1); d.DestId != "10659885" || d.MsgContent != "TD" {
+		t.Errorf("Unexpected MO for account 900001: %+v", d)
+	}
+}
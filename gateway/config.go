@@ -19,14 +19,112 @@ type Config struct {
 	HttpHost string `json:"http_host"`
 	HttpPort string `json:"http_port"`
 
+	// HTTPS 配置（可选），配置证书与私钥后 http_port 改为提供 HTTPS；文件更新后自动重新加载
+	HTTPSCertFile string `json:"https_cert_file"`
+	HTTPSKeyFile  string `json:"https_key_file"`
+	// 校验客户端证书的 CA 文件，配置后启用双向认证（见 api_clients 的 cert_cn）
+	HTTPSClientCAFile string `json:"https_client_ca_file"`
+	// 所有连接都必须提供有效的客户端证书，否则只校验客户端主动提供的证书
+	HTTPSRequireClientCert bool `json:"https_require_client_cert"`
+	// 明文 HTTP 监听地址，如 :80，请求重定向到 HTTPS，为空时不监听
+	HTTPRedirectAddr string `json:"http_redirect_addr"`
+
 	CMPPHost string `json:"cmpp_host"`
 	CMPPPort string `json:"cmpp_port"`
 	Debug    bool   `json:"debug"`
 
+	// 上游通道类型：cmpp（默认）、smpp、smgp 或 sgip
+	Channel string `json:"channel"`
+
+	// ISMG 地址列表（host:port），第一个为主地址，其余为备用地址
+	// 配置后忽略 cmpp_host / cmpp_port；连接失败时依次切换，主地址恢复后自动切回
+	CMPPEndpoints []string `json:"cmpp_endpoints"`
+
+	// CMPP 提交时的 Registered_Delivery：0 不要求状态报告（默认，与旧版本一致），1 要求状态报告
+	// 状态查询、Webhook 等依赖状态报告的功能需要设为 1
+	CMPPRegisteredDelivery uint8 `json:"cmpp_registered_delivery"`
+
+	// CMPP TLS 配置（可选，默认使用明文 TCP）
+	CMPPTLS bool `json:"cmpp_tls"`
+	// 校验服务端证书的 CA 文件，为空时使用系统根证书
+	CMPPTLSCAFile string `json:"cmpp_tls_ca_file"`
+	// 客户端证书与私钥，服务端要求双向认证时配置
+	CMPPTLSCertFile string `json:"cmpp_tls_cert_file"`
+	CMPPTLSKeyFile  string `json:"cmpp_tls_key_file"`
+	// 校验证书时使用的服务器名，为空时使用 cmpp_host
+	CMPPTLSServerName string `json:"cmpp_tls_server_name"`
+	// 跳过服务端证书校验（仅用于测试）
+	CMPPTLSInsecureSkipVerify bool `json:"cmpp_tls_insecure_skip_verify"`
+
+	// SMPP 3.4 配置（channel 为 smpp 时使用）
+	SMPPHost       string `json:"smpp_host"`
+	SMPPPort       string `json:"smpp_port"`
+	SMPPSystemId   string `json:"smpp_system_id"`
+	SMPPPassword   string `json:"smpp_password"`
+	SMPPSystemType string `json:"smpp_system_type"`
+	// 发送方地址，为空时使用 sms_accessno（同样会追加扩展码）
+	SMPPSourceAddr string `json:"smpp_source_addr"`
+
+	// SMGP 3.0 配置（channel 为 smgp 时使用，中国电信）
+	SMGPHost     string `json:"smgp_host"`
+	SMGPPort     string `json:"smgp_port"`
+	SMGPClientId string `json:"smgp_client_id"`
+	SMGPPassword string `json:"smgp_password"`
+	// 业务代码，为空时使用 service_id
+	SMGPServiceId string `json:"smgp_service_id"`
+	// 发送方号码，为空时使用 sms_accessno（同样会追加扩展码）
+	SMGPSrcTermId string `json:"smgp_src_term_id"`
+
+	// SGIP 1.2 配置（channel 为 sgip 时使用，中国联通）
+	SGIPHost     string `json:"sgip_host"`
+	SGIPPort     string `json:"sgip_port"`
+	SGIPUser     string `json:"sgip_user"`
+	SGIPPassword string `json:"sgip_password"`
+	// SP 节点编号，用于生成序列号（3 + 区号 + 企业代码）
+	SGIPNodeId uint32 `json:"sgip_node_id"`
+	// 企业代码
+	SGIPCorpId string `json:"sgip_corp_id"`
+	// 业务代码，为空时使用 service_id
+	SGIPServiceType string `json:"sgip_service_type"`
+	// SP 接入号，为空时使用 sms_accessno（同样会追加扩展码）
+	SGIPSPNumber string `json:"sgip_sp_number"`
+	// 接收 SMG 连接（上行短信与状态报告）的监听地址，如 :8801，为空时不监听
+	SGIPListenAddr string `json:"sgip_listen_addr"`
+	// SMG 登录本网关时使用的用户名和密码，为空时不校验
+	SGIPListenUser     string `json:"sgip_listen_user"`
+	SGIPListenPassword string `json:"sgip_listen_password"`
+
+	// CMPP 代理服务配置（可选），内部 SP 以 CMPP 3.0 接入本网关，消息经上游通道转发
+	// 监听地址，如 :7890，为空时不启用
+	CMPPServerAddr string `json:"cmpp_server_addr"`
+	// 允许接入的下游账号
+	CMPPServerAccounts []CMPPAccount `json:"cmpp_server_accounts"`
+	// 生成下游 MsgId 使用的网关代码（22 位）
+	CMPPServerIsmgCode uint32 `json:"cmpp_server_ismg_code"`
+
+	// HTTP API 客户端，配置后 /submit、/send 与 /api 接口需携带 API Key
+	APIClients []APIClient `json:"api_clients"`
+	// 签名请求允许的时间偏差（秒），默认 300
+	SignatureMaxSkew int `json:"signature_max_skew"`
+
+	// Webhook 配置（可选），上行短信与状态报告以 JSON POST 到该地址；客户端可单独配置 webhook_url
+	WebhookURL string `json:"webhook_url"`
+	// 签名密钥，为空时不签名；消息所属客户端配置了 secret 时使用客户端的密钥
+	WebhookSecret string `json:"webhook_secret"`
+	// 最多投递次数，超过后标记为失败，默认 10
+	WebhookMaxAttempts int `json:"webhook_max_attempts"`
+
+	// 管理界面登录会话的空闲超时（分钟），默认 30
+	ConsoleSessionTimeout int `json:"console_session_timeout"`
+	// 尚无任何用户时创建的初始管理员 admin 的密码，为空时随机生成并输出到日志
+	ConsoleAdminPassword string `json:"console_admin_password"`
+
 	// Redis 配置（可选，如果不配置则使用 BoltDB）
 	RedisHost     string `json:"redis_host"`
 	RedisPort     string `json:"redis_port"`
 	RedisPassword string `json:"redis_password"`
+	// 最多保留的下发记录数，超过时删除最旧的记录及其索引，0 表示不限制
+	RedisMaxMessages int `json:"redis_max_messages"`
 
 	// BoltDB 配置
 	// 数据库文件路径，默认为 "./data/cmpp.db"
@@ -35,6 +133,35 @@ type Config struct {
 	CacheType string `json:"cache_type"`
 }
 
+// CMPPAccount 是 CMPP 代理服务的下游账号
+type CMPPAccount struct {
+	// 登录名（Source_Addr，6 位企业代码）
+	User     string `json:"user"`
+	Password string `json:"password"`
+	// 分配给该账号的扩展码，提交时自动补齐，上行短信按接入号+扩展码路由
+	ExtCode string `json:"ext_code"`
+}
+
+// APIClient 是调用 HTTP API 的客户端（租户）
+type APIClient struct {
+	Name string `json:"name"`
+	// 请求头 X-API-Key 或 Authorization: Bearer 中携带的密钥
+	Key string `json:"key"`
+	// 允许使用的扩展码范围（含两端，位数须相同），为空时不限制；提交未带扩展码时使用 ext_code_min
+	ExtCodeMin string `json:"ext_code_min"`
+	ExtCodeMax string `json:"ext_code_max"`
+	// 允许的来源 IP 或网段（CIDR），为空时不限制
+	AllowIPs []string `json:"allow_ips"`
+	// 是否允许调用 /api/admin 接口，以及查看所有客户端的消息
+	Admin bool `json:"admin"`
+	// HMAC-SHA256 签名密钥，配置后该客户端的提交与查询请求必须签名
+	Secret string `json:"secret"`
+	// 该客户端的上行短信与状态报告推送地址，为空时使用全局 webhook_url
+	WebhookURL string `json:"webhook_url"`
+	// 配置后该客户端必须通过 HTTPS 提供由 https_client_ca_file 签发的证书，且证书 CN 或 DNS 名称与此相同
+	CertCN string `json:"cert_cn"`
+}
+
 func (c *Config) LoadFile(path string) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -47,6 +174,11 @@ func (c *Config) LoadFile(path string) {
 			if err := json.Unmarshal(fileData, c); err != nil {
 				log.Fatal("读取失败 => ", err)
 			} else {
+				for i := range c.APIClients {
+					if err := c.APIClients[i].validateExtCodeRange(); err != nil {
+						log.Fatalf("配置文件[%s]有误[%v]", path, err)
+					}
+				}
 				log.Println("读取成功 => ", c)
 			}
 		}
@@ -0,0 +1,533 @@
+package gateway
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 会话 Cookie 名称
+	sessionCookieName = "cmpp_session"
+	// 默认会话空闲超时
+	defaultSessionTimeout = 30 * time.Minute
+	// 清理过期会话的最短间隔
+	sessionSweepInterval = time.Minute
+	// 初始管理员用户名
+	defaultAdminUser = "admin"
+	// 密码最短长度
+	minPasswordLength = 8
+)
+
+// 密码哈希的迭代次数，测试中调低以加快速度
+var passwordHashIterations = 600000
+
+// ConsoleUser 是管理界面的登录用户，保存在存储中
+type ConsoleUser struct {
+	Name         string
+	PasswordHash string // 见 hashPassword
+	Role         string // 见 RoleViewer 等
+	Created      time.Time
+	Updated      time.Time
+}
+
+// pbkdf2SHA256 按 RFC 8018 计算 PBKDF2-HMAC-SHA256
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+	dk := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	var counter [4]byte
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
+
+// hashPassword 生成带随机盐的密码哈希
+//
+// 格式与 Django 的 pbkdf2_sha256 相同：pbkdf2_sha256$迭代次数$盐$Base64(哈希)，
+// 可用 Python hashlib.pbkdf2_hmac 或 Go crypto/pbkdf2 生成与校验
+func hashPassword(password string) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	salt := base64.RawURLEncoding.EncodeToString(raw)
+	key := pbkdf2SHA256([]byte(password), []byte(salt), passwordHashIterations, sha256.Size)
+	return "pbkdf2_sha256$" + strconv.Itoa(passwordHashIterations) + "$" + salt + "$" + base64.StdEncoding.EncodeToString(key), nil
+}
+
+// checkPassword 校验密码，哈希格式无效时返回 false
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2_sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	expected, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	key := pbkdf2SHA256([]byte(password), []byte(parts[2]), iterations, len(expected))
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash 用于用户不存在时仍做一次同样耗时的校验，避免通过响应时间探测用户名
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = hashPassword("dummy-password")
+	})
+	return dummyHash
+}
+
+// ValidatePassword 检查新密码是否符合要求
+func ValidatePassword(password, confirm string) error {
+	if len([]rune(password)) < minPasswordLength {
+		return &ValidationError{Field: "password", Message: "密码至少 " + strconv.Itoa(minPasswordLength) + " 个字符"}
+	}
+	if password != confirm {
+		return &ValidationError{Field: "confirm", Message: "两次输入的密码不一致"}
+	}
+	return nil
+}
+
+// SetUserPassword 修改已有用户的密码
+func SetUserPassword(name, password string) error {
+	u, ok := SCache.GetUser(name)
+	if !ok {
+		return errors.New("用户不存在")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hash
+	u.Updated = time.Now()
+	return SCache.SaveUser(&u)
+}
+
+// initialPasswordFile 保存随机生成的初始管理员密码，只有运行网关的用户可读
+var initialPasswordFile = "console_admin_password.txt"
+
+// writeInitialPassword 将初始密码写入 initialPasswordFile，已有的旧文件会被替换
+func writeInitialPassword(password string) error {
+	if err := os.Remove(initialPasswordFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(initialPasswordFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(password + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// EnsureConsoleAdmin 在尚无任何用户时创建初始管理员
+//
+// 密码取自 console_admin_password，未配置时随机生成并写入权限为 0600 的 initialPasswordFile，
+// 不会出现在日志中，登录后应立即修改
+func EnsureConsoleAdmin(cfg *Config) error {
+	if len(SCache.ListUsers()) > 0 {
+		return nil
+	}
+	password := cfg.ConsoleAdminPassword
+	generated := password == ""
+	if generated {
+		raw := make([]byte, 9)
+		if _, err := rand.Read(raw); err != nil {
+			return err
+		}
+		password = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if generated {
+		if err := writeInitialPassword(password); err != nil {
+			return fmt.Errorf("write initial password: %w", err)
+		}
+	}
+	now := time.Now()
+	if err := SCache.SaveUser(&ConsoleUser{Name: defaultAdminUser, PasswordHash: hash, Role: RoleAdmin, Created: now, Updated: now}); err != nil {
+		if generated {
+			os.Remove(initialPasswordFile)
+		}
+		return err
+	}
+	if generated {
+		Warnf("[AUTH] Created console user %q, its password is in %s, please change it after logging in and delete the file", defaultAdminUser, initialPasswordFile)
+	} else {
+		Infof("[AUTH] Created console user %q with the configured console_admin_password", defaultAdminUser)
+	}
+	return nil
+}
+
+// consoleSession 是一个登录会话
+type consoleSession struct {
+	User     string
+	Created  time.Time
+	LastSeen time.Time
+}
+
+// sessionStore 在内存中保存登录会话，进程重启后需重新登录
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*consoleSession
+	swept    time.Time
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]*consoleSession)}
+}
+
+// sessions 是全局会话存储
+var sessions = newSessionStore()
+
+// sessionTimeout 返回会话空闲超时
+func sessionTimeout() time.Duration {
+	if config != nil && config.ConsoleSessionTimeout > 0 {
+		return time.Duration(config.ConsoleSessionTimeout) * time.Minute
+	}
+	return defaultSessionTimeout
+}
+
+// Create 为用户创建会话，返回会话标识
+func (s *sessionStore) Create(user string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(raw)
+	now := time.Now()
+	s.mu.Lock()
+	s.sessions[id] = &consoleSession{User: user, Created: now, LastSeen: now}
+	s.mu.Unlock()
+	return id, nil
+}
+
+// Touch 校验会话，refresh 为 true 时刷新最后访问时间；返回会话所属用户，超时的会话被删除
+func (s *sessionStore) Touch(id string, timeout time.Duration, refresh bool) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.swept) >= sessionSweepInterval {
+		for k, sess := range s.sessions {
+			if now.Sub(sess.LastSeen) > timeout {
+				delete(s.sessions, k)
+			}
+		}
+		s.swept = now
+	}
+	sess, ok := s.sessions[id]
+	if !ok {
+		return "", false
+	}
+	if now.Sub(sess.LastSeen) > timeout {
+		delete(s.sessions, id)
+		return "", false
+	}
+	if refresh {
+		sess.LastSeen = now
+	}
+	return sess.User, true
+}
+
+// Delete 删除会话（退出登录）
+func (s *sessionStore) Delete(id string) {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+}
+
+// DeleteUser 删除用户的所有会话，except 非空时保留该会话
+func (s *sessionStore) DeleteUser(user, except string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sess := range s.sessions {
+		if sess.User == user && id != except {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+type consoleUserKey struct{}
+
+// consoleUserFromRequest 返回 requireConsoleUser 识别出的登录用户
+func consoleUserFromRequest(r *http.Request) *ConsoleUser {
+	u, _ := r.Context().Value(consoleUserKey{}).(*ConsoleUser)
+	return u
+}
+
+// backgroundPaths 是页面自动发起的请求（统计轮询、事件流），不算作用户活动，不延长会话
+var backgroundPaths = map[string]bool{
+	"/console/stats":  true,
+	"/console/events": true,
+}
+
+// sessionUser 按会话 Cookie 查找登录用户，用户已被删除时视为未登录
+func sessionUser(r *http.Request) (*ConsoleUser, string) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, ""
+	}
+	name, ok := sessions.Touch(cookie.Value, sessionTimeout(), !backgroundPaths[r.URL.Path])
+	if !ok {
+		return nil, ""
+	}
+	u, ok := SCache.GetUser(name)
+	if !ok {
+		sessions.Delete(cookie.Value)
+		return nil, ""
+	}
+	return &u, cookie.Value
+}
+
+// setSessionCookie 写入会话 Cookie；HTTPS 访问时加 Secure
+//
+// SameSite=Lax 只阻止跨站的 POST 等请求携带 Cookie，跨站的 GET 导航仍会携带，
+// 因此修改状态的管理界面接口只接受 POST，并由 sameOrigin 校验请求来源
+func setSessionCookie(w http.ResponseWriter, r *http.Request, id string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sameOrigin 检查请求是否由本站页面发起，防止跨站请求伪造
+//
+// 优先使用浏览器的 Sec-Fetch-Site，其次比较 Origin 或 Referer 与 Host；
+// 都没有时（非浏览器客户端）放行
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// safeMethod 判断请求方法是否不修改状态
+func safeMethod(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+}
+
+// requireConsoleUser 要求管理界面请求已登录
+//
+// 未登录时页面请求跳转到登录页，其余请求（表单提交、/console 接口）返回 401；
+// 非 GET 请求还需来自本站页面
+func requireConsoleUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !safeMethod(r) && !sameOrigin(r) {
+			Warnf("[AUTH] Rejected cross-site %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			writeAPIError(w, http.StatusForbidden, "cross_site_request", "", "拒绝跨站请求")
+			return
+		}
+		user, _ := sessionUser(r)
+		if user == nil {
+			if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/console/") {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			writeAPIError(w, http.StatusUnauthorized, "login_required", "", "请先登录")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), consoleUserKey{}, user)))
+	}
+}
+
+// safeRedirect 只允许跳转到本站路径，防止开放重定向
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// authenticate 校验用户名与密码
+func authenticate(name, password string) (*ConsoleUser, error) {
+	u, ok := SCache.GetUser(name)
+	if !ok {
+		checkPassword(dummyPasswordHash(), password)
+		return nil, errors.New("用户名或密码错误")
+	}
+	if !checkPassword(u.PasswordHash, password) {
+		return nil, errors.New("用户名或密码错误")
+	}
+	return &u, nil
+}
+
+// renderLogin 渲染登录页
+func renderLogin(w http.ResponseWriter, status int, name, next, message string) {
+	if templates == nil {
+		http.Error(w, "模板未加载", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Name  string
+		Next  string
+		Error string
+	}{name, next, message}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, "login", data); err != nil {
+		Errorf("[TPL] 渲染 login 失败: %v", err)
+	}
+}
+
+// loginPage 显示登录页并处理登录
+func loginPage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "请求格式错误", http.StatusBadRequest)
+		return
+	}
+	next := safeRedirect(r.Form.Get("next"))
+	switch r.Method {
+	case http.MethodGet:
+		if user, _ := sessionUser(r); user != nil {
+			http.Redirect(w, r, next, http.StatusFound)
+			return
+		}
+		renderLogin(w, http.StatusOK, "", next, "")
+	case http.MethodPost:
+		name := strings.TrimSpace(r.Form.Get("username"))
+		user, err := authenticate(name, r.Form.Get("password"))
+		if err != nil {
+			Warnf("[AUTH] Console login failed for %q from %s", name, r.RemoteAddr)
+			renderLogin(w, http.StatusUnauthorized, name, next, err.Error())
+			return
+		}
+		// 登录时总是签发新的会话标识，旧 Cookie 作废
+		if cookie, err := r.Cookie(sessionCookieName); err == nil {
+			sessions.Delete(cookie.Value)
+		}
+		id, err := sessions.Create(user.Name)
+		if err != nil {
+			Errorf("[AUTH] Create session failed: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		setSessionCookie(w, r, id, 0)
+		Infof("[AUTH] Console user %s logged in from %s", user.Name, r.RemoteAddr)
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "仅支持 GET 和 POST", http.StatusMethodNotAllowed)
+	}
+}
+
+// logout 退出登录
+func logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "仅支持 POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "拒绝跨站请求", http.StatusForbidden)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		sessions.Delete(cookie.Value)
+	}
+	setSessionCookie(w, r, "", -1)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// accountPassword 修改当前用户的密码，成功后该用户的其他会话失效
+func accountPassword(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "请求格式错误", http.StatusBadRequest)
+		return
+	}
+	user := consoleUserFromRequest(r)
+	status := http.StatusOK
+	notice, message := "", ""
+	if r.Method == http.MethodPost {
+		current, password := r.Form.Get("current"), r.Form.Get("password")
+		if !checkPassword(user.PasswordHash, current) {
+			status, message = http.StatusBadRequest, "当前密码错误"
+		} else if err := ValidatePassword(password, r.Form.Get("confirm")); err != nil {
+			status, message = http.StatusBadRequest, err.(*ValidationError).Message
+		} else if err := SetUserPassword(user.Name, password); err != nil {
+			Errorf("[AUTH] Update password of %s failed: %v", user.Name, err)
+			status, message = http.StatusInternalServerError, "保存失败，请稍后重试"
+		} else {
+			_, id := sessionUser(r)
+			sessions.DeleteUser(user.Name, id)
+			Infof("[AUTH] Console user %s changed password", user.Name)
+			notice = "密码已修改，其他已登录的会话已失效"
+		}
+	}
+
+	data := struct {
+		ActivePage   string
+		ServiceReady bool
+		User         *ConsoleUser
+		Notice       string
+		Error        string
+	}{
+		ActivePage:   "account",
+		ServiceReady: IsCmppReady(),
+		User:         user,
+		Notice:       notice,
+		Error:        message,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := renderTemplate(w, "account", data); err != nil {
+		Errorf("[TPL] 渲染 account 失败: %v", err)
+	}
+}
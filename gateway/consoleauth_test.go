@@ -0,0 +1,267 @@
+package gateway
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withFastPasswordHash 调低密码哈希迭代次数以加快测试
+func withFastPasswordHash(t *testing.T) {
+	old := passwordHashIterations
+	passwordHashIterations = 1000
+	t.Cleanup(func() { passwordHashIterations = old })
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// RFC 7914 第 11 节的测试向量
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tc := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(tc.password), []byte(tc.salt), tc.iterations, 64))
+		if got != tc.want {
+			t.Errorf("pbkdf2(%q, %q, %d) = %s, want %s", tc.password, tc.salt, tc.iterations, got, tc.want)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	withFastPasswordHash(t)
+	hash, err := hashPassword("s3cret-pass")
+	if err != nil {
+		t.Fatalf("hashPassword failed: %v", err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2_sha256$1000$") {
+		t.Errorf("Unexpected hash format %q", hash)
+	}
+	if other, _ := hashPassword("s3cret-pass"); other == hash {
+		t.Error("Hashes of the same password should use different salts")
+	}
+	if !checkPassword(hash, "s3cret-pass") {
+		t.Error("Correct password rejected")
+	}
+	for _, bad := range []string{"wrong", ""} {
+		if checkPassword(hash, bad) {
+			t.Errorf("Password %q accepted", bad)
+		}
+	}
+	for _, malformed := range []string{"", "plain", "md5$1$a$b", "pbkdf2_sha256$x$salt$aGFzaA==", "pbkdf2_sha256$1000$salt$!!!"} {
+		if checkPassword(malformed, "s3cret-pass") {
+			t.Errorf("Malformed hash %q accepted", malformed)
+		}
+	}
+
+	// 与 Python hashlib.pbkdf2_hmac（Django pbkdf2_sha256）生成的哈希兼容
+	if !checkPassword("pbkdf2_sha256$1000$c2FsdHNhbHQ$eAysd/MssJVY6ty2+kamRT68SJ/vZKvDhUpzcVn49Qs=", "s3cret-pass") {
+		t.Error("Hash generated by hashlib.pbkdf2_hmac rejected")
+	}
+}
+
+func TestSessionStoreTimeout(t *testing.T) {
+	s := newSessionStore()
+	id, err := s.Create("alice")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if user, ok := s.Touch(id, time.Minute, true); !ok || user != "alice" {
+		t.Fatalf("Touch = %q, %v", user, ok)
+	}
+	// 不刷新时最后访问时间不变
+	last := s.sessions[id].LastSeen
+	time.Sleep(time.Millisecond)
+	if _, ok := s.Touch(id, time.Minute, false); !ok || !s.sessions[id].LastSeen.Equal(last) {
+		t.Error("Touch without refresh should not extend the session")
+	}
+	s.sessions[id].LastSeen = time.Now().Add(-2 * time.Minute)
+	if _, ok := s.Touch(id, time.Minute, true); ok {
+		t.Error("Expired session should be rejected")
+	}
+	if _, ok := s.sessions[id]; ok {
+		t.Error("Expired session should be removed")
+	}
+
+	a, _ := s.Create("alice")
+	b, _ := s.Create("alice")
+	c, _ := s.Create("bob")
+	s.DeleteUser("alice", b)
+	if _, ok := s.Touch(a, time.Minute, true); ok {
+		t.Error("Other sessions of alice should be revoked")
+	}
+	if _, ok := s.Touch(b, time.Minute, true); !ok {
+		t.Error("Excepted session should be kept")
+	}
+	if _, ok := s.Touch(c, time.Minute, true); !ok {
+		t.Error("Sessions of other users should be kept")
+	}
+}
+
+func TestEnsureConsoleAdminGeneratedPassword(t *testing.T) {
+	withFastPasswordHash(t)
+	withAPIClients(t)
+	newTestBoltCache(t)
+	oldFile := initialPasswordFile
+	initialPasswordFile = filepath.Join(t.TempDir(), "password.txt")
+	t.Cleanup(func() { initialPasswordFile = oldFile })
+
+	if err := EnsureConsoleAdmin(config); err != nil {
+		t.Fatalf("EnsureConsoleAdmin failed: %v", err)
+	}
+	info, err := os.Stat(initialPasswordFile)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected password file with mode 0600, got %v %v", info, err)
+	}
+	data, _ := os.ReadFile(initialPasswordFile)
+	if u, ok := SCache.GetUser(defaultAdminUser); !ok || !checkPassword(u.PasswordHash, strings.TrimSpace(string(data))) {
+		t.Error("Expected the generated password in the file to log in")
+	}
+}
+
+func TestConsoleLogin(t *testing.T) {
+	withFastPasswordHash(t)
+	withAPIClients(t)
+	config.ConsoleAdminPassword = "initial-pass"
+	newTestBoltCache(t)
+	oldSessions := sessions
+	sessions = newSessionStore()
+	t.Cleanup(func() { sessions = oldSessions })
+
+	if err := EnsureConsoleAdmin(config); err != nil {
+		t.Fatalf("EnsureConsoleAdmin failed: %v", err)
+	}
+	// 已有用户时不再创建
+	config.ConsoleAdminPassword = "other-pass"
+	EnsureConsoleAdmin(config)
+	if u, ok := SCache.GetUser(defaultAdminUser); !ok || !checkPassword(u.PasswordHash, "initial-pass") {
+		t.Fatal("Initial admin should be created once with the configured password")
+	}
+
+	var seen *ConsoleUser
+	protected := requireConsoleUser(func(w http.ResponseWriter, r *http.Request) {
+		seen = consoleUserFromRequest(r)
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(h http.HandlerFunc, method, target, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	rec := serve(protected, "GET", "/list_message?page=2", "", nil)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/login?next="+url.QueryEscape("/list_message?page=2") {
+		t.Errorf("Expected redirect to login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := serve(protected, "GET", "/console/stats", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Console API without session: expected 401, got %d", rec.Code)
+	}
+	if rec := serve(protected, "POST", "/console/send", "dest=13800000000", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Form post without session: expected 401, got %d", rec.Code)
+	}
+
+	for _, body := range []string{"username=admin&password=wrong", "username=nobody&password=initial-pass"} {
+		if rec := serve(loginPage, "POST", "/login", body, nil); rec.Code == http.StatusSeeOther || len(rec.Result().Cookies()) != 0 {
+			t.Errorf("%s: login should fail, got %d", body, rec.Code)
+		}
+	}
+
+	rec = serve(loginPage, "POST", "/login", "username=admin&password=initial-pass&next=//evil.example.com", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("Expected redirect to /, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookieName || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("Unexpected session cookie %+v", cookies)
+	}
+	session := cookies[0]
+
+	if rec := serve(protected, "GET", "/", "", session); rec.Code != http.StatusOK || seen == nil || seen.Name != defaultAdminUser {
+		t.Errorf("Expected access with session, got %d (user %+v)", rec.Code, seen)
+	}
+	if rec := serve(loginPage, "GET", "/login?next=/list_mo", "", session); rec.Code != http.StatusFound || rec.Header().Get("Location") != "/list_mo" {
+		t.Errorf("Logged-in user should be redirected from login page, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// 修改状态的请求需来自本站页面，/console/send 只接受 POST
+	cross := httptest.NewRequest("POST", "/console/send", strings.NewReader("dest=13800000000"))
+	cross.Header.Set("Origin", "https://evil.example.com")
+	cross.AddCookie(session)
+	rec = httptest.NewRecorder()
+	protected(rec, cross)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Cross-site post: expected 403, got %d", rec.Code)
+	}
+	if rec := serve(requireConsoleUser(consoleSend), "GET", "/console/send?src=01&dest=13800000000&cont=hi", "", session); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Send via GET: expected 405, got %d", rec.Code)
+	}
+
+	if rec := serve(logout, "GET", "/logout", "", session); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Logout via GET: expected 405, got %d", rec.Code)
+	}
+	if rec := serve(logout, "POST", "/logout", "", session); rec.Code != http.StatusSeeOther {
+		t.Errorf("Logout: expected 303, got %d", rec.Code)
+	}
+	if rec := serve(protected, "GET", "/", "", session); rec.Code != http.StatusFound {
+		t.Errorf("Session should be invalid after logout, got %d", rec.Code)
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		header map[string]string
+		want   bool
+	}{
+		{nil, true},
+		{map[string]string{"Sec-Fetch-Site": "same-origin"}, true},
+		{map[string]string{"Sec-Fetch-Site": "none"}, true},
+		{map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://gateway.local:8000"}, false},
+		{map[string]string{"Sec-Fetch-Site": "same-site"}, false},
+		{map[string]string{"Origin": "http://gateway.local:8000"}, true},
+		{map[string]string{"Origin": "https://evil.example.com"}, false},
+		{map[string]string{"Origin": "null"}, false},
+		{map[string]string{"Referer": "http://gateway.local:8000/list_message"}, true},
+		{map[string]string{"Referer": "https://evil.example.com/page"}, false},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("POST", "http://gateway.local:8000/console/send", nil)
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		if got := sameOrigin(req); got != tc.want {
+			t.Errorf("sameOrigin(%v) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestSafeRedirect(t *testing.T) {
+	tests := map[string]string{
+		"":                    "/",
+		"/list_mo?page=2":     "/list_mo?page=2",
+		"//evil.example.com":  "/",
+		"/\\evil.example.com": "/",
+		"https://evil.com/":   "/",
+		"list_mo":             "/",
+	}
+	for in, want := range tests {
+		if got := safeRedirect(in); got != want {
+			t.Errorf("safeRedirect(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// 连接失败的地址在该时间内不会被优先选择，主地址恢复探测也以此为间隔
+const defaultEndpointCooldown = 30 * time.Second
+
+// EndpointStatus 是一个 ISMG 地址的健康状态快照，供首页展示
+type EndpointStatus struct {
+	Addr        string
+	Primary     bool // 列表中的第一个地址
+	Active      bool // 当前正在使用
+	Healthy     bool
+	Failures    int // 连续失败次数
+	LastError   string
+	LastFailure time.Time
+	LastSuccess time.Time
+}
+
+// endpointPool 维护有序的 ISMG 地址列表及其健康状态
+//
+// 选择顺序：主地址健康时总是优先；否则从当前地址的下一个开始轮转，
+// 仍处于冷却期的地址排在最后，作为其余地址都失败时的兜底
+type endpointPool struct {
+	mu        sync.Mutex
+	endpoints []EndpointStatus
+	current   int // 最近一次连接成功的地址下标，也是轮转的起点；-1 表示从未连接成功
+	cooldown  time.Duration
+}
+
+// newEndpointPool 根据配置创建地址列表
+// 配置了 cmpp_endpoints 时使用该列表，否则使用 cmpp_host:cmpp_port
+func newEndpointPool(cfg *Config) *endpointPool {
+	addrs := cfg.CMPPEndpoints
+	if len(addrs) == 0 {
+		addrs = []string{net.JoinHostPort(cfg.CMPPHost, cfg.CMPPPort)}
+	}
+
+	p := &endpointPool{current: -1, cooldown: defaultEndpointCooldown}
+	for i, addr := range addrs {
+		p.endpoints = append(p.endpoints, EndpointStatus{Addr: addr, Primary: i == 0, Healthy: true})
+	}
+	return p
+}
+
+// coolingDown 判断地址是否仍处于失败后的冷却期，调用者需持有锁
+func (p *endpointPool) coolingDown(i int, now time.Time) bool {
+	ep := &p.endpoints[i]
+	return !ep.Healthy && now.Sub(ep.LastFailure) < p.cooldown
+}
+
+// candidates 返回本次连接依次尝试的地址下标
+func (p *endpointPool) candidates(now time.Time) []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.endpoints)
+	order := make([]int, 0, n)
+	var deferred []int
+	add := func(i int) {
+		if p.coolingDown(i, now) {
+			deferred = append(deferred, i)
+		} else {
+			order = append(order, i)
+		}
+	}
+
+	// 主地址健康时总是排在最前，实现故障恢复后的回切
+	add(0)
+	for k := 1; k <= n; k++ {
+		if i := (p.current + k) % n; i != 0 {
+			add(i)
+		}
+	}
+	return append(order, deferred...)
+}
+
+// markSuccess 记录地址连接成功并设为当前地址
+func (p *endpointPool) markSuccess(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep := &p.endpoints[i]
+	ep.Healthy = true
+	ep.Failures = 0
+	ep.LastError = ""
+	ep.LastSuccess = time.Now()
+	p.current = i
+}
+
+// markFailure 记录地址连接失败
+func (p *endpointPool) markFailure(i int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep := &p.endpoints[i]
+	ep.Healthy = false
+	ep.Failures++
+	ep.LastFailure = time.Now()
+	if err != nil {
+		ep.LastError = err.Error()
+	}
+}
+
+// markLost 记录当前连接中断，下一次重连会先尝试其他地址
+// current 保持不变，作为轮转的起点
+func (p *endpointPool) markLost(err error) {
+	if i := p.activeIndex(); i >= 0 {
+		p.markFailure(i, err)
+	}
+}
+
+// addr 返回下标对应的地址
+func (p *endpointPool) addr(i int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.endpoints[i].Addr
+}
+
+// label 返回便于日志阅读的地址描述，如 "10.0.0.2:7890 (backup #1)"
+func (p *endpointPool) label(i int) string {
+	addr := p.addr(i)
+	if i == 0 {
+		return addr + " (primary)"
+	}
+	return fmt.Sprintf("%s (backup #%d)", addr, i)
+}
+
+// activeIndex 返回最近一次连接成功的地址下标，从未连接成功时返回 -1
+func (p *endpointPool) activeIndex() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current
+}
+
+// shouldProbePrimary 当前连接在备用地址上且主地址已过冷却期时返回 true
+func (p *endpointPool) shouldProbePrimary(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current > 0 && !p.coolingDown(0, now)
+}
+
+// snapshot 返回所有地址的状态副本
+func (p *endpointPool) snapshot(connected bool) []EndpointStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := make([]EndpointStatus, len(p.endpoints))
+	copy(list, p.endpoints)
+	if connected && p.current >= 0 {
+		list[p.current].Active = true
+	}
+	return list
+}
+
+// probeEndpoint 探测地址是否可达：完成 TCP 建连（配置 TLS 时包括握手）即认为健康
+// 不发送 CMPP_CONNECT，避免在 ISMG 上产生多余的登录记录
+func probeEndpoint(cfg *Config, addr string, timeout time.Duration) error {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !cfg.CMPPTLS {
+		conn, err := dialer.Dial("tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	tlsConfig, err := newCMPPTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFailoverManager 创建使用 mock 客户端的 ClientManager，down 中的地址连接失败
+func newFailoverManager(endpoints []string, down map[string]bool, mu *sync.Mutex) (*ClientManager, *[]string) {
+	cm := NewClientManager(&Config{CMPPEndpoints: endpoints, User: "u", Password: "p"})
+	var dialed []string
+	cm.newClient = func() cmppClient {
+		return &mockClient{
+			connectFunc: func(addr, user, password string, timeout time.Duration) error {
+				mu.Lock()
+				defer mu.Unlock()
+				dialed = append(dialed, addr)
+				if down[addr] {
+					return errors.New("connection refused")
+				}
+				return nil
+			},
+		}
+	}
+	cm.probe = func(addr string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if down[addr] {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	return cm, &dialed
+}
+
+func TestEndpointPoolDefaultsToHostPort(t *testing.T) {
+	p := newEndpointPool(&Config{CMPPHost: "127.0.0.1", CMPPPort: "7891"})
+	if len(p.endpoints) != 1 || p.endpoints[0].Addr != "127.0.0.1:7891" {
+		t.Fatalf("Unexpected endpoints: %+v", p.endpoints)
+	}
+	if got := p.candidates(time.Now()); len(got) != 1 || got[0] != 0 {
+		t.Errorf("Expected [0], got %v", got)
+	}
+}
+
+func TestEndpointPoolCandidates(t *testing.T) {
+	p := newEndpointPool(&Config{CMPPEndpoints: []string{"a:1", "b:1", "c:1"}})
+	now := time.Now()
+
+	if got := p.candidates(now); !equalInts(got, []int{0, 1, 2}) {
+		t.Errorf("Initial order: got %v", got)
+	}
+
+	// 在备用地址 b 上断开：主地址 a 冷却中，从 c 开始轮转，a、b 作为兜底
+	p.markFailure(0, errors.New("down"))
+	p.markSuccess(1)
+	p.markLost(errors.New("lost"))
+	if got := p.candidates(now); !equalInts(got, []int{2, 0, 1}) {
+		t.Errorf("Order after losing backup: got %v", got)
+	}
+
+	// 冷却期过后主地址重新排在最前
+	if got := p.candidates(now.Add(defaultEndpointCooldown + time.Second)); got[0] != 0 {
+		t.Errorf("Expected primary first after cooldown, got %v", got)
+	}
+}
+
+func TestClientManagerFailsOverToBackup(t *testing.T) {
+	var mu sync.Mutex
+	down := map[string]bool{"primary:7890": true}
+	cm, dialed := newFailoverManager([]string{"primary:7890", "backup1:7890", "backup2:7890"}, down, &mu)
+	defer cm.Shutdown()
+
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if got := cm.ActiveEndpoint(); got != "backup1:7890" {
+		t.Errorf("Expected backup1 to be active, got %q", got)
+	}
+	if len(*dialed) != 2 {
+		t.Errorf("Expected 2 dial attempts, got %v", *dialed)
+	}
+
+	status := cm.Endpoints()
+	if status[0].Healthy || status[0].Failures != 1 || status[0].LastError == "" {
+		t.Errorf("Primary should be marked unhealthy: %+v", status[0])
+	}
+	if !status[1].Active || !status[1].Healthy {
+		t.Errorf("Backup1 should be active and healthy: %+v", status[1])
+	}
+}
+
+func TestClientManagerRotatesOnConnectionLoss(t *testing.T) {
+	var mu sync.Mutex
+	down := map[string]bool{"primary:7890": true}
+	cm, _ := newFailoverManager([]string{"primary:7890", "backup1:7890", "backup2:7890"}, down, &mu)
+	defer cm.Shutdown()
+
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// backup1 的连接中断，重连应切换到 backup2
+	cm.ready.Store(false)
+	cm.performHeartbeat()
+
+	if got := cm.ActiveEndpoint(); got != "backup2:7890" {
+		t.Errorf("Expected backup2 after connection loss, got %q", got)
+	}
+}
+
+func TestClientManagerAllEndpointsDown(t *testing.T) {
+	var mu sync.Mutex
+	down := map[string]bool{"a:1": true, "b:1": true}
+	cm, _ := newFailoverManager([]string{"a:1", "b:1"}, down, &mu)
+	defer cm.Shutdown()
+
+	if err := cm.Connect(); err == nil {
+		t.Fatal("Expected connect to fail when all endpoints are down")
+	}
+	if cm.IsReady() || cm.ActiveEndpoint() != "" {
+		t.Error("Manager should not be ready")
+	}
+}
+
+func TestClientManagerFailsBackToPrimary(t *testing.T) {
+	newTestBoltCache(t)
+
+	var mu sync.Mutex
+	down := map[string]bool{"primary:7890": true}
+	cm, _ := newFailoverManager([]string{"primary:7890", "backup1:7890"}, down, &mu)
+	defer cm.Shutdown()
+
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// 主地址仍在冷却期，不探测
+	cm.tryFailback()
+	if got := cm.ActiveEndpoint(); got != "backup1:7890" {
+		t.Fatalf("Should stay on backup during cooldown, got %q", got)
+	}
+
+	// 冷却期结束且主地址恢复
+	mu.Lock()
+	down["primary:7890"] = false
+	mu.Unlock()
+	cm.endpoints.cooldown = 0
+
+	// 当前连接上的消息在等待时间内未收到响应，推迟切换
+	gen := cm.Generation()
+	mes := SmsMes{Dest: "13800138000"}
+	cm.pipeline.addPending(gen, 1, &mes)
+	cm.drainTimeout = 50 * time.Millisecond
+	cm.tryFailback()
+	if got := cm.ActiveEndpoint(); got != "backup1:7890" {
+		t.Fatalf("Should not switch while submits are pending, got %q", got)
+	}
+
+	// 旧连接遗留的等待记录不影响切换；等待期间新的提交立即返回暂停，收到响应后立即切换
+	SCache.SetWaitCache(gen-1, 1, SmsMes{Dest: "13900139000"})
+	cm.drainTimeout = 5 * time.Second
+	paused := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		start := time.Now()
+		err := cm.Submit(&SmsMes{Dest: "13800138001", Content: "hi"})
+		if d := time.Since(start); d > time.Second {
+			err = fmt.Errorf("Submit blocked for %v", d)
+		}
+		paused <- err
+		cm.pipeline.submitResponded(gen, 1, "1", 0)
+	}()
+	cm.tryFailback()
+	if got := cm.ActiveEndpoint(); got != "primary:7890" {
+		t.Errorf("Expected failback to primary, got %q", got)
+	}
+	if err := <-paused; !errors.Is(err, errSubmitPaused) {
+		t.Errorf("Expected submit to be paused while draining, got %v", err)
+	}
+	if cm.draining.Load() {
+		t.Error("Submits should resume after failback")
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 每个订阅者的事件缓冲，消费过慢时丢弃新事件
+	eventBufferSize = 256
+	// SSE 保活注释的发送间隔，防止代理断开空闲连接
+	eventKeepAliveInterval = 15 * time.Second
+)
+
+// 事件类型
+const (
+	eventSent       = "sent"       // 消息已发往上游，等待提交响应
+	eventSubmit     = "submit"     // 提交结果已入库（含本地失败）
+	eventMO         = "mo"         // 收到上行短信
+	eventReceipt    = "receipt"    // 状态报告已匹配到下发记录
+	eventConnection = "connection" // 上游连接状态变化
+)
+
+// Event 是事件总线上的一条事件
+type Event struct {
+	Seq    uint64      `json:"seq"`
+	Type   string      `json:"type"`
+	Time   time.Time   `json:"time"`
+	Client string      `json:"client,omitempty"` // 消息所属客户端，连接事件为空
+	Data   interface{} `json:"data"`
+}
+
+// connectionState 是连接事件的数据
+type connectionState struct {
+	Channel string `json:"channel"`
+	Ready   bool   `json:"ready"`
+}
+
+// eventBus 将网关内部的消息与连接事件分发给订阅者
+//
+// 发布不阻塞：订阅者的缓冲满时丢弃事件，避免慢速的 SSE 连接拖慢发送与接收
+type eventBus struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs map[chan Event]struct{}
+}
+
+// events 是全局事件总线
+var events = &eventBus{subs: make(map[chan Event]struct{})}
+
+// Subscribe 订阅事件，使用完毕后需调用 Unsubscribe
+func (b *eventBus) Subscribe() chan Event {
+	ch := make(chan Event, eventBufferSize)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+// Unsubscribe 取消订阅
+func (b *eventBus) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	b.mu.Unlock()
+}
+
+// hasSubscribers 检查是否有订阅者，没有时可跳过构造事件
+func (b *eventBus) hasSubscribers() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs) > 0
+}
+
+// Publish 发布事件
+func (b *eventBus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	e.Seq = b.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			Debugf("[EVENT] Subscriber buffer full, dropping %s event %d", e.Type, e.Seq)
+		}
+	}
+}
+
+// publishMessage 发布消息事件
+func (b *eventBus) publishMessage(typ string, mes *SmsMes, listName string) {
+	if !b.hasSubscribers() {
+		return
+	}
+	b.Publish(Event{Type: typ, Client: mes.Client, Data: newAPIMessage(mes, listName)})
+}
+
+// 事件总线作为消息观察者接收提交结果、上行短信与状态报告
+func (b *eventBus) submitDone(mes SmsMes) {
+	b.publishMessage(eventSubmit, &mes, "list_message")
+}
+
+func (b *eventBus) moDone(mes SmsMes) {
+	b.publishMessage(eventMO, &mes, "list_mo")
+}
+
+func (b *eventBus) receiptDone(receipt, mes SmsMes) {
+	b.publishMessage(eventReceipt, &mes, "list_message")
+}
+
+// streamEvents 以 Server-Sent Events 推送事件
+//
+// 参数: types（逗号分隔的事件类型，为空表示全部）、client（管理客户端或未启用认证时按客户端筛选）。
+// 普通客户端只收到自己的消息事件与连接事件；连接建立后先推送一次当前连接状态
+func streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	r.ParseForm()
+	client := scopeClient(r)
+	user := consoleUserFromRequest(r)
+	var types map[string]bool
+	if t := r.Form.Get("types"); t != "" {
+		types = make(map[string]bool)
+		for _, typ := range strings.Split(t, ",") {
+			types[strings.TrimSpace(typ)] = true
+		}
+	}
+
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+	w.WriteHeader(http.StatusOK)
+
+	send := func(e Event) bool {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return true
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	if types == nil || types[eventConnection] {
+		send(Event{Type: eventConnection, Time: time.Now(), Data: connectionState{Channel: channelName(), Ready: IsCmppReady()}})
+	} else {
+		flusher.Flush()
+	}
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e := <-ch:
+			if types != nil && !types[e.Type] {
+				continue
+			}
+			if client != "" && e.Type != eventConnection && e.Client != client {
+				continue
+			}
+			if !send(redactEvent(user, e)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readSSE 读取下一条 SSE 事件，跳过保活注释
+func readSSE(t *testing.T, r *bufio.Reader) (string, Event) {
+	t.Helper()
+	var typ string
+	var e Event
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Read event failed: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e)
+		case line == "" && typ != "":
+			return typ, e
+		}
+	}
+}
+
+func openEventStream(t *testing.T, srv *httptest.Server, query string, header map[string]string) *bufio.Reader {
+	t.Helper()
+	req, _ := http.NewRequest("GET", srv.URL+"/api/events"+query, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Open event stream failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("Unexpected response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestEventStream(t *testing.T) {
+	newTestBoltCache(t)
+	withAPIClients(t,
+		APIClient{Name: "acme", Key: "acme-key"},
+		APIClient{Name: "ops", Key: "ops-key", Admin: true},
+	)
+	addObserver(events)
+	t.Cleanup(func() { removeObserver(events) })
+	srv := httptest.NewServer(requireAPIClient(streamEvents))
+	t.Cleanup(srv.Close) // 在关闭事件流之后执行，否则 Close 会等待仍在推送的请求
+
+	all := openEventStream(t, srv, "", map[string]string{"X-API-Key": "ops-key"})
+	acme := openEventStream(t, srv, "?types=mo,receipt", map[string]string{"X-API-Key": "acme-key"})
+	if typ, e := readSSE(t, all); typ != eventConnection || e.Data.(map[string]interface{})["channel"] != ChannelCMPP {
+		t.Fatalf("Expected initial connection event, got %s %+v", typ, e)
+	}
+
+	p := newMessagePipeline(ChannelCMPP)
+	mes := SmsMes{Id: "e1", Client: "beta", Dest: "13800000000", Content: "hi", SubmitResult: 65535, DelivleryResult: 65535}
+	events.publishMessage(eventSent, &mes, "list_message")
+	p.addPending(1, 1, &mes)
+	p.submitResponded(1, 1, "900", 0)
+	p.receiptReceived(SmsMes{MsgId: "900", DelivleryResult: 0, DeliveryStat: "DELIVRD"})
+	p.moReceived(SmsMes{Client: "acme", Src: "13900000000", Dest: "10659", Content: "TD"})
+
+	for _, want := range []string{"sent:pending", "submit:submitted", "receipt:delivered", "mo:received"} {
+		typ, e := readSSE(t, all)
+		if got := typ + ":" + e.Data.(map[string]interface{})["status"].(string); got != want {
+			t.Errorf("Expected %s, got %s (%+v)", want, got, e)
+		}
+	}
+	// 普通客户端只收到自己的、且为所选类型的事件
+	if typ, e := readSSE(t, acme); typ != eventMO || e.Client != "acme" {
+		t.Errorf("Unexpected event for client: %s %+v", typ, e)
+	}
+}
+
+// recordingHandler 记录通道回调，供测试检查
+type recordingHandler struct {
+	mu       sync.Mutex
+	submits  []SmsMes
+	mos      []SmsMes
+	receipts []SmsMes
+	states   []bool
+}
+
+func (h *recordingHandler) SubmitDone(mes SmsMes) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.submits = append(h.submits, mes)
+}
+
+func (h *recordingHandler) MOReceived(mes SmsMes) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mos = append(h.mos, mes)
+}
+
+func (h *recordingHandler) ReceiptReceived(receipt, mes SmsMes) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.receipts = append(h.receipts, mes)
+}
+
+func (h *recordingHandler) ConnectionChanged(channel string, ready bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.states = append(h.states, ready)
+}
+
+func TestChannelHandlerCallbacks(t *testing.T) {
+	newTestBoltCache(t)
+	h := &recordingHandler{}
+	ch := &stubChannel{pipeline: newMessagePipeline(ChannelSMPP)}
+	ch.SetHandler(h)
+
+	var ready atomic.Bool
+	for _, state := range []bool{true, true, false} {
+		ch.pipeline.setReady(&ready, state)
+	}
+	mes := SmsMes{Id: "h1", Dest: "13800000000", SubmitResult: 65535, DelivleryResult: 65535}
+	ch.pipeline.addPending(1, 1, &mes)
+	ch.pipeline.submitResponded(1, 1, "m1", 0)
+	ch.pipeline.receiptReceived(SmsMes{MsgId: "m1", DelivleryResult: 0, DeliveryStat: "DELIVRD"})
+	ch.pipeline.moReceived(SmsMes{Src: "13800000000", Dest: "10659", Content: "hi"})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.states) != 2 || !h.states[0] || h.states[1] {
+		t.Errorf("Expected one callback per state change, got %v", h.states)
+	}
+	if len(h.submits) != 1 || h.submits[0].MsgId != "m1" || h.submits[0].Channel != ChannelSMPP {
+		t.Errorf("Unexpected submit callbacks: %+v", h.submits)
+	}
+	if len(h.receipts) != 1 || h.receipts[0].Id != "h1" || h.receipts[0].DeliveryStat != "DELIVRD" {
+		t.Errorf("Unexpected receipt callbacks: %+v", h.receipts)
+	}
+	if len(h.mos) != 1 || h.mos[0].Content != "hi" {
+		t.Errorf("Unexpected MO callbacks: %+v", h.mos)
+	}
+}
+
+// TestSendFailureUsesChannelHandler 本地发送失败也通过通道设置的回调通知
+func TestSendFailureUsesChannelHandler(t *testing.T) {
+	newTestBoltCache(t)
+	h := &recordingHandler{}
+	ch := &stubChannel{pipeline: newMessagePipeline(ChannelSMGP), submitErr: errors.New("not connected")}
+	ch.SetHandler(h)
+
+	sendMessage(ch, SmsMes{Id: "f1", Dest: "13800000000", Content: "hi"})
+	ch.submitErr = fmt.Errorf("src: %w", errSrcIdTooLong)
+	sendMessage(ch, SmsMes{Id: "f2", Dest: "13800000000", Content: "hi"})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.submits) != 2 || h.submits[0].MsgId != "SEND_ERROR" || h.submits[1].MsgId != "ERROR" || h.submits[0].Channel != ChannelSMGP {
+		t.Errorf("Unexpected submit callbacks: %+v", h.submits)
+	}
+	if mes, ok := SCache.LookupMessage(indexById + "f1"); !ok || mes.SubmitResult != 254 {
+		t.Errorf("Expected failed submit to be stored, got %+v %v", mes, ok)
+	}
+}
+
+func TestChannelConnectionEvents(t *testing.T) {
+	p := newMessagePipeline(ChannelSMGP)
+	sub := events.Subscribe()
+	defer events.Unsubscribe(sub)
+
+	var ready atomic.Bool
+	for _, state := range []bool{true, false} {
+		p.setReady(&ready, state)
+		select {
+		case e := <-sub:
+			if s := e.Data.(connectionState); e.Type != eventConnection || s.Channel != ChannelSMGP || s.Ready != state {
+				t.Errorf("Unexpected event: %+v", e)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Timed out waiting for connection event ready=%v", state)
+		}
+	}
+}
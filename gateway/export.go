@@ -0,0 +1,179 @@
+package gateway
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// 导出时每批从存储读取的记录数
+	exportBatchSize = 500
+	// 每输出多少条刷新一次响应，使下载尽快开始
+	exportFlushRows = 200
+	// CSV 中的时间格式（本地时间），Excel 可直接识别
+	exportTimeLayout = "2006-01-02 15:04:05"
+)
+
+// utf8BOM 写在 CSV 开头，Excel 据此按 UTF-8 打开，避免中文乱码
+const utf8BOM = "\xEF\xBB\xBF"
+
+// exportTime 格式化 CSV 中的时间，零值输出为空
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(exportTimeLayout)
+}
+
+// exportText 防止以 = + - @ 开头的文本在 Excel 中被当作公式执行
+func exportText(s string) string {
+	if s != "" && (s[0] == '=' || s[0] == '+' || s[0] == '-' || s[0] == '@') {
+		return "'" + s
+	}
+	return s
+}
+
+// exportHeader 返回 CSV 表头
+func exportHeader(listName string) []string {
+	if listName == "list_mo" {
+		return []string{"id", "client", "src", "dest", "content", "msg_id", "channel", "created"}
+	}
+	return []string{"id", "client", "client_ref", "src", "dest", "content", "msg_id", "channel", "status",
+		"submit_result", "delivery_result", "delivery_stat", "segments", "created", "submitted_at", "delivered_at"}
+}
+
+// exportRecord 返回与 exportHeader 对应的一行
+func exportRecord(mes *SmsMes, listName string) []string {
+	if listName == "list_mo" {
+		return []string{mes.Id, mes.Client, mes.Src, mes.Dest, exportText(mes.Content), mes.MsgId, channelOf(mes), exportTime(mes.Created)}
+	}
+	return []string{
+		mes.Id,
+		mes.Client,
+		exportText(mes.ClientRef),
+		mes.Src,
+		mes.Dest,
+		exportText(mes.Content),
+		mes.MsgId,
+		channelOf(mes),
+		messageStatus(mes),
+		strconv.FormatUint(uint64(mes.SubmitResult), 10),
+		strconv.FormatUint(uint64(mes.DelivleryResult), 10),
+		mes.DeliveryStat,
+		strconv.Itoa(messageSegments(mes.Content).Count),
+		exportTime(mes.Created),
+		exportTime(mes.SubmitTime),
+		exportTime(mes.ReceiptTime),
+	}
+}
+
+// exportMessages 导出下发或上行记录，边读取边输出，不在内存中保存全部结果
+//
+// 参数: type（mt 或 mo，默认 mt）、format（csv 或 jsonl，默认 csv）、from/to（按创建时间筛选）
+// 以及与列表页相同的搜索条件。普通客户端只能导出自己的消息
+func exportMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "", "仅支持 GET")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_param", "", "请求格式错误")
+		return
+	}
+
+	listName := "list_message"
+	switch r.Form.Get("type") {
+	case "", "mt":
+	case "mo":
+		listName = "list_mo"
+	default:
+		writeAPIError(w, http.StatusBadRequest, "invalid_param", "type", "type 仅支持 mt 或 mo")
+		return
+	}
+	format := r.Form.Get("format")
+	switch format {
+	case "":
+		format = "csv"
+	case "csv", "jsonl":
+	default:
+		writeAPIError(w, http.StatusBadRequest, "invalid_param", "format", "format 仅支持 csv 或 jsonl")
+		return
+	}
+
+	filters, err := listFilters(r, listName)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", listName, time.Now().Format("20060102-150405"), format)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	var write func(mes *SmsMes) error
+	var flush func() error
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		if _, err := w.Write([]byte(utf8BOM)); err != nil {
+			return
+		}
+		cw.Write(exportHeader(listName))
+		write = func(mes *SmsMes) error {
+			return cw.Write(exportRecord(mes, listName))
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	} else {
+		enc := json.NewEncoder(w)
+		write = func(mes *SmsMes) error {
+			return enc.Encode(newAPIMessage(mes, listName))
+		}
+		flush = func() error { return nil }
+	}
+
+	masked := masksNumbers(r)
+	rows := 0
+	err = SCache.ForEachMessage(listName, filters, func(mes *SmsMes) error {
+		if masked {
+			maskMessage(mes, listName)
+		}
+		if err := write(mes); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			// 客户端断开后停止读取存储
+			return r.Context().Err()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// 响应已经开始，只能记录日志，客户端会收到不完整的文件
+		Warnf("[EXPORT] Export of %s stopped after %d rows: %v", listName, rows, err)
+		return
+	}
+	Infof("[EXPORT] Exported %d rows from %s as %s", rows, listName, format)
+}
@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestExportMessages(t *testing.T) {
+	withAPIClients(t)
+	cache := newTestBoltCache(t)
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	fixtures := []SmsMes{
+		{Id: "m1", Src: "10659", Dest: "13800000001", Content: "第一条", MsgId: "1", Created: day.AddDate(0, 0, -1)},
+		{Id: "m2", Src: "10659", Dest: "13800000002", Content: "=1+1", MsgId: "2", Created: day, SubmitTime: day.Add(time.Second)},
+		{Id: "m3", Src: "10659", Dest: "13800000003", Content: "失败", SubmitResult: 8, Created: day.AddDate(0, 0, 1)},
+	}
+	for i := range fixtures {
+		fixtures[i].DelivleryResult = 65535
+		if err := cache.AddSubmits(&fixtures[i]); err != nil {
+			t.Fatalf("AddSubmits failed: %v", err)
+		}
+	}
+	if err := cache.AddMoList(&SmsMes{Src: "13900000000", Dest: "10659", Content: "上行", Created: day}); err != nil {
+		t.Fatalf("AddMoList failed: %v", err)
+	}
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		exportMessages(rec, httptest.NewRequest("GET", "/export?"+query, nil))
+		return rec
+	}
+
+	rec := export("from=2026-03-01&to=2026-03-01")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Unexpected Content-Type %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "attachment") || !strings.Contains(cd, ".csv") {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, utf8BOM) {
+		t.Fatal("CSV export should start with a UTF-8 BOM")
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(body, utf8BOM))).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if len(records) != 2 || records[0][0] != "id" || records[1][0] != "m2" {
+		t.Fatalf("Expected header and m2 only, got %v", records)
+	}
+	if records[1][5] != "'=1+1" {
+		t.Errorf("Formula-like content should be escaped, got %q", records[1][5])
+	}
+	if records[1][13] != "2026-03-01 10:00:00" || records[1][15] != "" {
+		t.Errorf("Unexpected time columns: %v", records[1][13:])
+	}
+
+	// 搜索条件与列表页一致
+	rec = export("format=jsonl&status=1")
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 failed message, got %q", rec.Body.String())
+	}
+	var m apiMessage
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil || m.Id != "m3" || m.Status != "failed" {
+		t.Errorf("Unexpected JSONL line %q: %v", lines[0], err)
+	}
+
+	rec = export("type=mo&format=jsonl")
+	if n := strings.Count(rec.Body.String(), "\n"); n != 1 || !strings.Contains(rec.Body.String(), `"status":"received"`) {
+		t.Errorf("Expected 1 MO line, got %q", rec.Body.String())
+	}
+
+	for _, query := range []string{"format=xml", "type=orphan", "from=yesterday", "from=2026-03-02&to=2026-03-01", "dest=abc"} {
+		if rec := export(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestBoltCacheForEachMessage(t *testing.T) {
+	cache := newTestBoltCache(t)
+	total := exportBatchSize*2 + 7
+	err := cache.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(messageBucket)
+		for i := 0; i < total; i++ {
+			v, _ := json.Marshal(SmsMes{Id: newMessageId(), Dest: "13800000000", Content: "x"})
+			if err := b.Put(timeKey(tx, b), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	err = cache.ForEachMessage("list_message", nil, func(mes *SmsMes) error {
+		if seen[mes.Id] {
+			t.Fatalf("Message %s visited twice", mes.Id)
+		}
+		seen[mes.Id] = true
+		return nil
+	})
+	if err != nil || len(seen) != total {
+		t.Errorf("Expected %d messages, got %d (err %v)", total, len(seen), err)
+	}
+
+	// 回调返回错误时停止遍历
+	stop := errors.New("stop")
+	count := 0
+	err = cache.ForEachMessage("list_message", nil, func(mes *SmsMes) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Errorf("Expected to stop after first message, got %d (err %v)", count, err)
+	}
+}
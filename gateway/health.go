@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+)
+
+// 发送队列占用达到该比例时视为饱和，readyz 返回 503 让负载均衡暂停转发
+const readyQueueSaturation = 0.9
+
+// healthCheck 是单个组件的检查结果
+type healthCheck struct {
+	Status string                 `json:"status"` // ok 或 fail
+	Error  string                 `json:"error,omitempty"`
+	Detail map[string]interface{} `json:"detail,omitempty"`
+}
+
+func checkResult(err error, detail map[string]interface{}) healthCheck {
+	if err != nil {
+		return healthCheck{Status: "fail", Error: err.Error(), Detail: detail}
+	}
+	return healthCheck{Status: "ok", Detail: detail}
+}
+
+// healthz 存活探针：进程能处理请求即返回 200，不检查任何依赖
+func healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz 就绪探针：检查上游通道、存储、发送队列与页面模板，任一失败返回 503
+func readyz(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]healthCheck, 4)
+
+	var upstreamErr error
+	if !IsCmppReady() {
+		upstreamErr = errors.New("上游通道未连接")
+	}
+	checks["upstream"] = checkResult(upstreamErr, map[string]interface{}{"channel": channelName()})
+
+	backend := "boltdb"
+	if _, ok := SCache.(*Cache); ok {
+		backend = "redis"
+	}
+	var storageErr error
+	if SCache == nil {
+		storageErr = errors.New("存储未初始化")
+	} else {
+		storageErr = SCache.Ping()
+	}
+	checks["storage"] = checkResult(storageErr, map[string]interface{}{"backend": backend})
+
+	depth, capacity := len(Messages), cap(Messages)
+	var queueErr error
+	if capacity > 0 && float64(depth) >= float64(capacity)*readyQueueSaturation {
+		queueErr = errors.New("发送队列已饱和")
+	}
+	checks["queue"] = checkResult(queueErr, map[string]interface{}{"depth": depth, "capacity": capacity})
+
+	var templateErr error
+	if templates == nil {
+		templateErr = errors.New("页面模板未加载")
+	}
+	checks["templates"] = checkResult(templateErr, nil)
+
+	status, code := "ok", http.StatusOK
+	for _, c := range checks {
+		if c.Status != "ok" {
+			status, code = "fail", http.StatusServiceUnavailable
+			break
+		}
+	}
+	writeJSON(w, code, map[string]interface{}{"status": status, "checks": checks})
+}
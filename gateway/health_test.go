@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	healthz(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("healthz status = %d", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	boltCache := newTestBoltCache(t)
+	oldUpstream, oldTemplates := upstream, templates
+	t.Cleanup(func() { upstream, templates = oldUpstream, oldTemplates })
+
+	probe := func() (int, map[string]string) {
+		rec := httptest.NewRecorder()
+		readyz(rec, httptest.NewRequest("GET", "/readyz", nil))
+		var out struct {
+			Status string
+			Checks map[string]healthCheck
+		}
+		json.Unmarshal(rec.Body.Bytes(), &out)
+		status := map[string]string{"": out.Status}
+		for name, c := range out.Checks {
+			status[name] = c.Status
+		}
+		return rec.Code, status
+	}
+
+	// 上游未连接、模板未加载
+	upstream, templates = nil, nil
+	code, status := probe()
+	if code != http.StatusServiceUnavailable || status["upstream"] != "fail" || status["templates"] != "fail" || status["storage"] != "ok" || status["queue"] != "ok" {
+		t.Errorf("Unexpected readiness: %d %v", code, status)
+	}
+
+	upstream, templates = &stubChannel{}, template.New("")
+	if code, status := probe(); code != http.StatusOK || status[""] != "ok" {
+		t.Errorf("Expected ready, got %d %v", code, status)
+	}
+
+	// 发送队列饱和
+	drainMessages(t)
+	for i := 0; i < cap(Messages); i++ {
+		Messages <- SmsMes{}
+	}
+	code, status = probe()
+	if code != http.StatusServiceUnavailable || status["queue"] != "fail" {
+		t.Errorf("Expected saturated queue to fail readiness, got %d %v", code, status)
+	}
+
+	// 存储关闭
+	boltCache.StopBoltCache()
+	if code, status := probe(); code != http.StatusServiceUnavailable || status["storage"] != "fail" {
+		t.Errorf("Expected closed storage to fail readiness, got %d %v", code, status)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -14,6 +15,10 @@ import (
 )
 
 var pageSize = 5
+
+// 列表页可选的每页条数
+var pageSizeOptions = []int{5, 10, 20, 50, 100}
+
 var templates *template.Template
 
 // handler echoes the HTTP request.
@@ -51,7 +56,28 @@ func handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mes := SmsMes{Src: src, Content: validatedContent, Dest: dest}
+	client := clientFromRequest(r)
+	src, err = ValidateClientExtCode(client, src)
+	if err != nil {
+		Warnf("[HTTP] 扩展码验证失败: %v", err)
+		result, _ := json.Marshal(
+			map[string]interface{}{"result": -1, "error": err.Error()})
+		fmt.Fprintf(w, string(result))
+		return
+	}
+
+	clientRef := r.Form.Get("client_ref")
+	if len(clientRef) > apiMaxClientRefLen {
+		result, _ := json.Marshal(
+			map[string]interface{}{"result": -1, "error": fmt.Sprintf("client_ref 最长 %d 个字符", apiMaxClientRefLen)})
+		fmt.Fprintf(w, string(result))
+		return
+	}
+
+	mes := SmsMes{Src: src, Content: validatedContent, Dest: dest, ClientRef: clientRef}
+	if client != nil {
+		mes.Client = client.Name
+	}
 	Messages <- mes
 	result, _ := json.Marshal(
 		map[string]interface{}{"error": "", "result": 0})
@@ -76,6 +102,12 @@ func index(w http.ResponseWriter, r *http.Request) {
 		isRedisEnabled = true
 	}
 
+	// ISMG 地址及健康状态，未启动 CMPP 客户端时为空
+	var endpoints []EndpointStatus
+	if cm := GetClientManager(); cm != nil {
+		endpoints = cm.Endpoints()
+	}
+
 	data := struct {
 		ActivePage     string
 		Stats          map[string]int
@@ -83,6 +115,10 @@ func index(w http.ResponseWriter, r *http.Request) {
 		DefaultSrc     string
 		IsRedisEnabled bool
 		ServiceReady   bool
+		Endpoints      []EndpointStatus
+		Channel        string
+		Clients        []string
+		User           *ConsoleUser
 	}{
 		ActivePage: "home",
 		Stats: map[string]int{
@@ -95,6 +131,10 @@ func index(w http.ResponseWriter, r *http.Request) {
 		DefaultSrc:     config.SmsAccessNo,
 		IsRedisEnabled: isRedisEnabled,
 		ServiceReady:   IsCmppReady(),
+		Endpoints:      endpoints,
+		Channel:        channelName(),
+		Clients:        clientNames(),
+		User:           consoleUserFromRequest(r),
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -141,39 +181,77 @@ func listMessage(w http.ResponseWriter, r *http.Request, listName string, active
 		return
 	}
 
-	// 提取并验证搜索参数
-	filters := make(map[string]string)
-	dest := r.Form.Get("dest")
-	src := r.Form.Get("src")
-	content := r.Form.Get("content")
-
-	// 根据列表类型设置过滤器
-	if listName == "list_message" {
-		if dest != "" {
-			filters["dest"] = dest
-		}
-		if status := r.Form.Get("status"); status != "" {
-			filters["status"] = status
-		}
-	} else if listName == "list_mo" {
-		if src != "" {
-			filters["src"] = src
-		}
-		if dest != "" {
-			filters["dest"] = dest
-		}
-	}
-	if content != "" {
-		filters["content"] = content
+	size, err := ValidatePageSize(r.Form.Get("page_size"), pageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// 验证搜索参数
-	if err := ValidateSearchParams(dest, src, content); err != nil {
+	filters, err := listFilters(r, listName)
+	if err != nil {
 		Warnf("[HTTP] 搜索参数验证失败: %v", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	count, v := queryList(listName, filters, c_page, size)
+	if masksNumbers(r) {
+		for i := range *v {
+			maskMessage(&(*v)[i], listName)
+		}
+	}
+
+	data := struct {
+		ActivePage   string
+		Data         *[]SmsMes
+		Page         pages.Page
+		ServiceReady bool
+		Filters      map[string]string
+		Clients      []string
+		User         *ConsoleUser
+	}{
+		ActivePage: activePage,
+		Data:       v,
+		Page: pages.Page{
+			CurrentPage: c_page,
+			PageSize:    size,
+			TotalRecord: count,
+			TotalPage:   (count + size - 1) / size,
+			StartRow:    (c_page - 1) * size,
+			EndRow:      c_page*size - 1,
+			IsFirst:     c_page == 1,
+			IsEnd:       c_page >= (count+size-1)/size,
+			LastPage:    c_page - 1,
+			NextPage:    c_page + 1,
+		},
+		ServiceReady: IsCmppReady(),
+		Filters:      withPageSize(filters, size),
+		Clients:      clientNames(),
+		User:         consoleUserFromRequest(r),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := renderTemplate(w, listName, data); err != nil {
+		Errorf("[TPL] 渲染 %s 失败: %v", listName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// withPageSize 返回翻页链接使用的参数：搜索条件加上非默认的每页条数
+func withPageSize(filters map[string]string, size int) map[string]string {
+	if size == pageSize {
+		return filters
+	}
+	params := make(map[string]string, len(filters)+1)
+	for k, v := range filters {
+		params[k] = v
+	}
+	params["page_size"] = strconv.Itoa(size)
+	return params
+}
+
+// queryList 查询一页消息，发送列表在无搜索条件时合并等待响应的消息（显示在最前面）
+func queryList(listName string, filters map[string]string, c_page, size int) (int, *[]SmsMes) {
 	var count int
 	var v *[]SmsMes
 
@@ -186,7 +264,7 @@ func listMessage(w http.ResponseWriter, r *http.Request, listName string, active
 	// 如果有搜索条件，使用搜索功能
 	if len(filters) > 0 {
 		count = SCache.GetSearchCount(listName, filters)
-		page := pages.NewPage(c_page, pageSize, count)
+		page := pages.NewPage(c_page, size, count)
 		v = SCache.SearchList(listName, filters, page.StartRow, page.EndRow)
 	} else {
 		// 普通分页查询
@@ -197,7 +275,7 @@ func listMessage(w http.ResponseWriter, r *http.Request, listName string, active
 			count += len(waitList)
 		}
 
-		page := pages.NewPage(c_page, pageSize, count)
+		page := pages.NewPage(c_page, size, count)
 		v = SCache.GetList(listName, page.StartRow, page.EndRow)
 
 		// 合并等待列表（等待的消息显示在最前面）
@@ -217,57 +295,191 @@ func listMessage(w http.ResponseWriter, r *http.Request, listName string, active
 			}
 		}
 	}
+	return count, v
+}
+
+// listFilters 从请求中提取并验证列表的搜索条件
+func listFilters(r *http.Request, listName string) (map[string]string, error) {
+	filters := make(map[string]string)
+	dest := r.Form.Get("dest")
+	src := r.Form.Get("src")
+	content := r.Form.Get("content")
+	msgId := r.Form.Get("msgid")
+
+	// 根据列表类型设置过滤器
+	if listName == "list_message" {
+		if dest != "" {
+			filters["dest"] = dest
+		}
+		if status := r.Form.Get("status"); status != "" {
+			filters["status"] = status
+		}
+		if result := r.Form.Get("submit_result"); result != "" {
+			filters["submit_result"] = result
+		}
+		if stat := r.Form.Get("delivery_stat"); stat != "" {
+			filters["delivery_stat"] = strings.ToUpper(stat)
+		}
+	} else if listName == "list_mo" {
+		if src != "" {
+			filters["src"] = src
+		}
+		if dest != "" {
+			filters["dest"] = dest
+		}
+	} else if listName == "list_orphan" {
+		if dest != "" {
+			filters["dest"] = dest
+		}
+		if stat := r.Form.Get("delivery_stat"); stat != "" {
+			filters["delivery_stat"] = strings.ToUpper(stat)
+		}
+	}
+	if content != "" {
+		filters["content"] = content
+	}
+	if msgId != "" {
+		filters["msgid"] = msgId
+	}
+	// 时间范围按消息创建时间过滤，起始时间含、结束时间不含
+	from, to := r.Form.Get("from"), r.Form.Get("to")
+	if from != "" {
+		filters["from"] = from
+	}
+	if to != "" {
+		filters["to"] = to
+	}
+	if client := scopeClient(r); client != "" {
+		filters["client"] = client
+	}
+
+	// 验证搜索参数
+	if err := ValidateSearchParams(dest, src, content); err != nil {
+		return nil, err
+	}
+	if err := ValidateMsgIdFilter(msgId); err != nil {
+		return nil, err
+	}
+	if err := ValidateSubmitResult(filters["submit_result"]); err != nil {
+		return nil, err
+	}
+	if err := ValidateDeliveryStat(filters["delivery_stat"]); err != nil {
+		return nil, err
+	}
+	if _, _, err := ValidateTimeRange(from, to); err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
+
+func listSubmits(w http.ResponseWriter, r *http.Request) {
+	listMessage(w, r, "list_message", "list_message")
+}
+
+func listMo(w http.ResponseWriter, r *http.Request) {
+	listMessage(w, r, "list_mo", "list_mo")
+}
+
+func listOrphanReceipts(w http.ResponseWriter, r *http.Request) {
+	listMessage(w, r, "list_orphan", "list_orphan")
+}
+
+// listWebhooks 显示投递失败的 Webhook 记录
+func listWebhooks(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "请求格式错误", http.StatusBadRequest)
+		return
+	}
+	c_page, err := ValidatePageParam(r.Form.Get("page"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	size, err := ValidatePageSize(r.Form.Get("page_size"), pageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var failed []WebhookDelivery
+	pending := 0
+	for _, d := range SCache.ListWebhooks() {
+		if d.Status == webhookFailed {
+			failed = append(failed, d)
+		} else {
+			pending++
+		}
+	}
+	// 最近失败的显示在最前面
+	for i, j := 0, len(failed)-1; i < j; i, j = i+1, j-1 {
+		failed[i], failed[j] = failed[j], failed[i]
+	}
+	page := pages.NewPage(c_page, size, len(failed))
+	start, end := page.StartRow, page.EndRow+1
+	if start > len(failed) {
+		start = len(failed)
+	}
+	if end > len(failed) {
+		end = len(failed)
+	}
 
 	data := struct {
 		ActivePage   string
-		Data         *[]SmsMes
+		Data         []WebhookDelivery
 		Page         pages.Page
+		Pending      int
 		ServiceReady bool
 		Filters      map[string]string
+		Notice       string
+		User         *ConsoleUser
 	}{
-		ActivePage: activePage,
-		Data:       v,
-		Page: pages.Page{
-			CurrentPage: c_page,
-			PageSize:    pageSize,
-			TotalRecord: count,
-			TotalPage:   (count + pageSize - 1) / pageSize,
-			StartRow:    (c_page - 1) * pageSize,
-			EndRow:      c_page*pageSize - 1,
-			IsFirst:     c_page == 1,
-			IsEnd:       c_page >= (count+pageSize-1)/pageSize,
-			LastPage:    c_page - 1,
-			NextPage:    c_page + 1,
-		},
+		ActivePage:   "list_webhook",
+		Data:         failed[start:end],
+		Page:         page,
+		Pending:      pending,
 		ServiceReady: IsCmppReady(),
-		Filters:      filters,
+		Filters:      withPageSize(map[string]string{}, size),
+		Notice:       r.Form.Get("notice"),
+		User:         consoleUserFromRequest(r),
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := renderTemplate(w, listName, data); err != nil {
-		Errorf("[TPL] 渲染 %s 失败: %v", listName, err)
+	if err := renderTemplate(w, "list_webhook", data); err != nil {
+		Errorf("[TPL] 渲染 list_webhook 失败: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
-func listSubmits(w http.ResponseWriter, r *http.Request) {
-	listMessage(w, r, "list_message", "list_message")
-}
-
-func listMo(w http.ResponseWriter, r *http.Request) {
-	listMessage(w, r, "list_mo", "list_mo")
+// redeliverWebhook 将投递失败的记录重新放入发件箱，完成后返回失败列表页
+func redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "仅支持 POST", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	notice := "redelivered"
+	if err := RedeliverWebhook(r.Form.Get("id")); err != nil {
+		Warnf("[WEBHOOK] Redeliver failed: %v", err)
+		notice = "not_found"
+	}
+	http.Redirect(w, r, "/list_webhook?notice="+notice, http.StatusSeeOther)
 }
 
-// getStats 返回实时统计数据的API接口
+// getStats 返回实时统计数据的API接口，client 参数指定客户端时只统计该客户端的消息
 func getStats(w http.ResponseWriter, r *http.Request) {
-	stats := SCache.GetStats()
-	totalReceived := SCache.Length("list_mo")
-
-	response := map[string]int{
-		"total":    stats["total"],
-		"success":  stats["success"],
-		"failed":   stats["failed"],
-		"received": totalReceived,
+	r.ParseForm()
+	var response map[string]int
+	if client := scopeClient(r); client != "" {
+		response = clientStats(client)
+	} else {
+		stats := SCache.GetStats()
+		response = map[string]int{
+			"total":    stats["total"],
+			"success":  stats["success"],
+			"failed":   stats["failed"],
+			"received": SCache.Length("list_mo"),
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -287,6 +499,22 @@ func initTemplates() error {
 		"isWaiting": func(result uint32) bool {
 			return result == 65535
 		},
+		"decodeMsgId": func(msgId string) *MsgIdParts {
+			// 仅解析网关返回的十进制 MsgId，本地错误标记返回 nil
+			id, err := strconv.ParseUint(msgId, 10, 64)
+			if err != nil {
+				return nil
+			}
+			parts := DecodeMsgId(id)
+			return &parts
+		},
+		"msgIdHex": func(msgId string) string {
+			id, err := strconv.ParseUint(msgId, 10, 64)
+			if err != nil {
+				return ""
+			}
+			return fmt.Sprintf("%016x", id)
+		},
 		"pageRange": func(current, total int) []int {
 			// Generate page range for pagination (max 5 pages)
 			start := current - 2
@@ -307,13 +535,14 @@ func initTemplates() error {
 			}
 			return result
 		},
+		"pageSizeOptions": func() []int { return pageSizeOptions },
 		"buildPageURL": func(page int, filters map[string]string) string {
 			params := make([]string, 0, len(filters)+1)
 			params = append(params, fmt.Sprintf("page=%d", page))
 
 			for key, value := range filters {
 				if value != "" {
-					params = append(params, fmt.Sprintf("%s=%s", key, value))
+					params = append(params, key+"="+url.QueryEscape(value))
 				}
 			}
 
@@ -360,6 +589,16 @@ func initTemplates() error {
 	return nil
 }
 
+// consoleSend 管理界面发送短信，只接受 POST
+func consoleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{"result": -1, "error": "仅支持 POST"})
+		return
+	}
+	handler(w, r)
+}
+
 func Serve(cfg *Config) {
 	config = cfg
 
@@ -370,13 +609,66 @@ func Serve(cfg *Config) {
 		templates = nil
 	}
 
-	http.HandleFunc("/submit", handler)
-	http.HandleFunc("/send", handler) // 保持向后兼容
-	http.HandleFunc("/", index)
-	http.HandleFunc("/list_message", listSubmits)
-	http.HandleFunc("/list_mo", listMo)
-	http.HandleFunc("/api/stats", getStats)
+	// 对外接口，配置 api_clients 后需携带 API Key；未配置时与旧版本一样匿名访问（/api/admin/* 除外）
+	if len(cfg.APIClients) == 0 {
+		Warnf("[AUTH] 未配置 api_clients，/submit、/send、/api/* 与 /metrics 不做认证，/api/admin/* 不对外开放")
+	}
+	http.HandleFunc("/submit", requireAPIClient(requireSignature(handler)))
+	http.HandleFunc("/send", requireAPIClient(requireSignature(handler))) // 保持向后兼容
+	http.HandleFunc("/api/stats", requireAPIClient(getStats))
+	http.HandleFunc("/api/v1/messages", requireAPIClient(requireSignature(apiMessages)))
+	http.HandleFunc("/api/v1/messages/", requireAPIClient(requireSignature(apiGetMessage)))
+	http.HandleFunc("/api/v1/messages/export", requireAPIClient(requireSignature(exportMessages)))
+	http.HandleFunc("/api/events", requireAPIClient(streamEvents))
+	http.HandleFunc("/metrics", requireAdminClient(serveMetrics))
+	http.HandleFunc("/api/v1/stats/timeseries", requireAdminClient(getTimeSeries))
+	http.HandleFunc("/api/admin/query", requireAdminKey(adminQuery))
+	http.HandleFunc("/api/admin/cancel", requireAdminKey(adminCancel))
+
+	// 健康检查，供负载均衡与编排系统探测，不需要认证
+	http.HandleFunc("/healthz", healthz)
+	http.HandleFunc("/readyz", readyz)
+
+	// 管理界面及其使用的接口，需登录并按角色授权（见 rbac.go）
+	if err := EnsureConsoleAdmin(cfg); err != nil {
+		Errorf("[AUTH] 创建初始管理员失败: %v", err)
+	}
+	http.HandleFunc("/login", loginPage)
+	http.HandleFunc("/logout", logout)
+	http.HandleFunc("/account/password", requireConsoleUser(accountPassword))
+	http.HandleFunc("/", requireRole(RoleViewer, index))
+	http.HandleFunc("/console/stats", requireRole(RoleViewer, getStats))
+	http.HandleFunc("/console/timeseries", requireRole(RoleViewer, getTimeSeries))
+	http.HandleFunc("/console/events", requireRole(RoleViewer, streamEvents))
+	http.HandleFunc("/list_message", requireRole(RoleAuditor, listSubmits))
+	http.HandleFunc("/list_mo", requireRole(RoleAuditor, listMo))
+	http.HandleFunc("/list_orphan", requireRole(RoleAuditor, listOrphanReceipts))
+	http.HandleFunc("/export", requireRole(RoleAuditor, exportMessages))
+	http.HandleFunc("/list_webhook", requireRole(RoleOperator, listWebhooks))
+	http.HandleFunc("/webhook/redeliver", requireRole(RoleOperator, redeliverWebhook))
+	http.HandleFunc("/console/send", requireRole(RoleOperator, consoleSend))
+	http.HandleFunc("/console/cancel", requireRole(RoleOperator, adminCancel))
+	http.HandleFunc("/users", requireRole(RoleAdmin, listUsers))
+	http.HandleFunc("/users/manage", requireRole(RoleAdmin, manageUser))
+	http.HandleFunc("/console/connection", requireRole(RoleAdmin, reconnectUpstream))
+
+	addr := config.HttpHost + ":" + config.HttpPort
+	if config.HTTPSCertFile == "" && config.HTTPSKeyFile == "" {
+		Infof("[HTTP] 服务启动: %s", addr)
+		log.Fatal(http.ListenAndServe(addr, nil))
+	}
 
-	Infof("[HTTP] 服务启动: %s:%s", config.HttpHost, config.HttpPort)
-	log.Fatal(http.ListenAndServe(config.HttpHost+":"+config.HttpPort, nil))
+	tlsConfig, err := newHTTPSTLSConfig(config)
+	if err != nil {
+		log.Fatalf("HTTPS 配置错误: %v", err)
+	}
+	if config.HTTPRedirectAddr != "" {
+		go func() {
+			Infof("[HTTP] HTTP 重定向服务启动: %s", config.HTTPRedirectAddr)
+			log.Fatal(http.ListenAndServe(config.HTTPRedirectAddr, httpsRedirect(config.HttpPort)))
+		}()
+	}
+	srv := &http.Server{Addr: addr, TLSConfig: tlsConfig}
+	Infof("[HTTP] HTTPS 服务启动: %s", addr)
+	log.Fatal(srv.ListenAndServeTLS("", ""))
 }
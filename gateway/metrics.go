@@ -0,0 +1,193 @@
+package gateway
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// counterVec 是带一个标签的计数器
+type counterVec struct {
+	mu     sync.Mutex
+	label  string
+	values map[string]uint64
+}
+
+func newCounterVec(label string) *counterVec {
+	return &counterVec{label: label, values: make(map[string]uint64)}
+}
+
+// Inc 将标签值对应的计数加一
+func (c *counterVec) Inc(value string) {
+	c.mu.Lock()
+	c.values[value]++
+	c.mu.Unlock()
+}
+
+// write 按标签值排序输出，保证每次抓取的顺序稳定
+func (c *counterVec) write(w io.Writer, name string) {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, c.label, escapeLabel(k), c.values[k])
+	}
+	c.mu.Unlock()
+}
+
+// histogram 是累积分桶的直方图，单位为秒
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64 // 与 buckets 对应，不含 +Inf
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets ...float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe 记录一次耗时
+func (h *histogram) Observe(d time.Duration) {
+	v := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(upper, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// escapeLabel 按 Prometheus 文本格式转义标签值
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// gatewayMetrics 汇总网关运行指标，进程重启后计数器从零开始
+type gatewayMetrics struct {
+	submits           *counterVec // 按提交结果码
+	receipts          *counterVec // 按状态报告状态
+	reconnects        *counterVec // 按通道
+	heartbeatFailures *counterVec // 按通道
+	mo                atomic.Uint64
+	inflight          atomic.Int64 // 已发往上游、等待提交响应的消息数，由各通道登记与撤销时更新
+
+	submitLatency  *histogram // 发往上游到收到提交响应
+	receiptLatency *histogram // 发往上游到收到状态报告
+}
+
+func newGatewayMetrics() *gatewayMetrics {
+	return &gatewayMetrics{
+		submits:           newCounterVec("result"),
+		receipts:          newCounterVec("stat"),
+		reconnects:        newCounterVec("channel"),
+		heartbeatFailures: newCounterVec("channel"),
+		submitLatency:     newHistogram(0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30),
+		receiptLatency:    newHistogram(1, 2, 5, 10, 30, 60, 120, 300, 600, 1800, 3600),
+	}
+}
+
+// metrics 是全局运行指标
+var metrics = newGatewayMetrics()
+
+// 运行指标作为消息观察者统计提交结果、上行短信与状态报告
+func (m *gatewayMetrics) submitDone(mes SmsMes) {
+	m.submits.Inc(strconv.FormatUint(uint64(mes.SubmitResult), 10))
+	// 从发往上游开始计时，不含发送队列与暂停提交期间的等待；本地失败的消息没有发送时间
+	if !mes.SentTime.IsZero() && !mes.SubmitTime.IsZero() {
+		m.submitLatency.Observe(mes.SubmitTime.Sub(mes.SentTime))
+	}
+}
+
+func (m *gatewayMetrics) moDone(mes SmsMes) {
+	m.mo.Add(1)
+}
+
+func (m *gatewayMetrics) receiptDone(receipt, mes SmsMes) {
+	m.receipts.Inc(receiptStatLabel(receipt.DeliveryStat))
+	if !mes.SentTime.IsZero() && !mes.ReceiptTime.IsZero() {
+		m.receiptLatency.Observe(mes.ReceiptTime.Sub(mes.SentTime))
+	}
+}
+
+// metricReceiptStats 是按原值统计的状态报告状态
+var metricReceiptStats = map[string]bool{
+	"DELIVRD": true, "EXPIRED": true, "DELETED": true, "UNDELIV": true,
+	"ACCEPTD": true, "UNKNOWN": true, "REJECTD": true, "ENROUTE": true,
+}
+
+// receiptStatLabel 返回状态报告状态的标签值
+// 运营商自定义的错误码（如 MK:0001）归为 OTHER，避免标签取值无限增长
+func receiptStatLabel(stat string) string {
+	if stat == "" {
+		return "UNKNOWN"
+	}
+	if metricReceiptStats[stat] {
+		return stat
+	}
+	return "OTHER"
+}
+
+// writeMetric 输出 HELP 与 TYPE 注释
+func writeMetric(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// serveMetrics 以 Prometheus 文本格式输出运行指标
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := metrics
+
+	writeMetric(w, "cmpp_gateway_submits_total", "counter", "Submit results recorded, by result code (254/255 are local send errors).")
+	m.submits.write(w, "cmpp_gateway_submits_total")
+	writeMetric(w, "cmpp_gateway_mo_total", "counter", "MO messages received.")
+	fmt.Fprintf(w, "cmpp_gateway_mo_total %d\n", m.mo.Load())
+	writeMetric(w, "cmpp_gateway_receipts_total", "counter", "Status reports matched to submitted messages, by stat.")
+	m.receipts.write(w, "cmpp_gateway_receipts_total")
+	writeMetric(w, "cmpp_gateway_reconnects_total", "counter", "Successful upstream reconnections, by channel.")
+	m.reconnects.write(w, "cmpp_gateway_reconnects_total")
+	writeMetric(w, "cmpp_gateway_heartbeat_failures_total", "counter", "Failed upstream heartbeats, by channel.")
+	m.heartbeatFailures.write(w, "cmpp_gateway_heartbeat_failures_total")
+
+	writeMetric(w, "cmpp_gateway_queue_depth", "gauge", "Messages waiting in the send queue.")
+	fmt.Fprintf(w, "cmpp_gateway_queue_depth %d\n", len(Messages))
+	writeMetric(w, "cmpp_gateway_queue_capacity", "gauge", "Capacity of the send queue.")
+	fmt.Fprintf(w, "cmpp_gateway_queue_capacity %d\n", cap(Messages))
+	writeMetric(w, "cmpp_gateway_inflight", "gauge", "Messages sent upstream and waiting for a submit response.")
+	fmt.Fprintf(w, "cmpp_gateway_inflight %d\n", m.inflight.Load())
+	writeMetric(w, "cmpp_gateway_up", "gauge", "Whether the upstream channel is connected (1) or not (0).")
+	up := 0
+	if IsCmppReady() {
+		up = 1
+	}
+	fmt.Fprintf(w, "cmpp_gateway_up{channel=\"%s\"} %d\n", escapeLabel(channelName()), up)
+
+	writeMetric(w, "cmpp_gateway_submit_response_seconds", "histogram", "Time from sending a message upstream to its submit response.")
+	m.submitLatency.write(w, "cmpp_gateway_submit_response_seconds")
+	writeMetric(w, "cmpp_gateway_submit_receipt_seconds", "histogram", "Time from sending a message upstream to its status report.")
+	m.receiptLatency.write(w, "cmpp_gateway_submit_receipt_seconds")
+}
@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	newTestBoltCache(t)
+	oldMetrics := metrics
+	metrics = newGatewayMetrics()
+	addObserver(metrics)
+	t.Cleanup(func() {
+		removeObserver(metrics)
+		metrics = oldMetrics
+	})
+
+	p := newMessagePipeline(ChannelCMPP)
+	// 创建后在队列中等待了一分钟，耗时从发往上游开始计算
+	created := time.Now().Add(-time.Minute)
+	for i, result := range []uint32{0, 0, 8, 0} {
+		mes := SmsMes{Id: newMessageId(), Dest: "13800000000", Created: created, SubmitResult: 65535, DelivleryResult: 65535}
+		p.addPending(1, uint32(i), &mes)
+		p.submitResponded(1, uint32(i), []string{"1", "2", "3", "4"}[i], result)
+	}
+	p.receiptReceived(SmsMes{MsgId: "1", DeliveryStat: "DELIVRD"})
+	p.receiptReceived(SmsMes{MsgId: "2", DelivleryResult: 1, DeliveryStat: "UNDELIV"})
+	p.receiptReceived(SmsMes{MsgId: "4", DelivleryResult: 1, DeliveryStat: "MK:0001"})
+	// 仍在等待提交响应的消息
+	pending := SmsMes{Id: newMessageId(), Dest: "13800000000", Created: created}
+	p.addPending(1, 9, &pending)
+	p.moReceived(SmsMes{Src: "13800000000", Dest: "10659", Content: "hi"})
+	metrics.heartbeatFailures.Inc(ChannelCMPP)
+	metrics.reconnects.Inc(ChannelCMPP)
+
+	rec := httptest.NewRecorder()
+	serveMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`cmpp_gateway_submits_total{result="0"} 3`,
+		`cmpp_gateway_submits_total{result="8"} 1`,
+		`cmpp_gateway_mo_total 1`,
+		`cmpp_gateway_receipts_total{stat="DELIVRD"} 1`,
+		`cmpp_gateway_receipts_total{stat="UNDELIV"} 1`,
+		`cmpp_gateway_receipts_total{stat="OTHER"} 1`,
+		`cmpp_gateway_reconnects_total{channel="cmpp"} 1`,
+		`cmpp_gateway_heartbeat_failures_total{channel="cmpp"} 1`,
+		`cmpp_gateway_queue_capacity 10`,
+		`cmpp_gateway_inflight 1`,
+		`cmpp_gateway_up{channel="cmpp"} 0`,
+		`cmpp_gateway_submit_response_seconds_bucket{le="1"} 4`,
+		`cmpp_gateway_submit_response_seconds_count 4`,
+		`cmpp_gateway_submit_receipt_seconds_bucket{le="1"} 3`,
+		`cmpp_gateway_submit_receipt_seconds_count 3`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("Missing %q in metrics output", want)
+		}
+	}
+
+	// 每行都应是注释或 名称{标签} 数值
+	line := regexp.MustCompile(`^[a-z_]+(\{[a-z]+="[^"]*"\})? [0-9.e+-]+$`)
+	for _, l := range strings.Split(strings.TrimSpace(body), "\n") {
+		if !strings.HasPrefix(l, "# ") && !line.MatchString(l) {
+			t.Errorf("Malformed metrics line: %q", l)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("escapeLabel = %q", got)
+	}
+}
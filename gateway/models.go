@@ -1,8 +1,13 @@
 package gateway
 
-import "time"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
 
 type SmsMes struct {
+	Id              string // 网关分配的消息标识，接受提交时生成
 	Src             string
 	Dest            string
 	Content         string
@@ -10,6 +15,15 @@ type SmsMes struct {
 	Created         time.Time
 	SubmitResult    uint32
 	DelivleryResult uint32
+	DeliveryStat    string    // 状态报告中的原始状态，如 DELIVRD、UNDELIV
+	Channel         string    // 发送或接收该消息的通道，如 cmpp、smpp；为空表示 cmpp
+	Account         string    // 经 CMPP 代理提交的下游账号，为空表示 HTTP 提交
+	ProxyMsgId      string    // 返回给下游账号的 MsgId
+	Client          string    // 所属的 API 客户端名称，未配置客户端时为空
+	ClientRef       string    // 调用方提交时传入的业务标识，同一客户端内用于查询
+	SentTime        time.Time // 发往上游的时间，登记等待提交响应时记录，不含在发送队列中等待的时间
+	SubmitTime      time.Time // 收到网关提交响应（或确定提交失败）的时间
+	ReceiptTime     time.Time // 收到状态报告的时间
 }
 
 type MesSlice []SmsMes
@@ -25,3 +39,38 @@ func (c MesSlice) Swap(i, j int) {
 func (c MesSlice) Less(i, j int) bool {
 	return c[i].Created.Before(c[j].Created)
 }
+
+// 消息索引键的前缀，按网关标识、ISMG MsgId 或客户端业务标识定位下发记录
+const (
+	indexById        = "id:"
+	indexByMsgId     = "msgid:"
+	indexByClientRef = "ref:"
+)
+
+// clientRefKey 返回客户端业务标识的索引键，业务标识只在同一客户端内唯一
+func clientRefKey(client, ref string) string {
+	return indexByClientRef + client + ":" + ref
+}
+
+// messageIndexKeys 返回下发记录的所有索引键
+func messageIndexKeys(mes *SmsMes) []string {
+	var keys []string
+	if mes.Id != "" {
+		keys = append(keys, indexById+mes.Id)
+	}
+	// 提交失败时网关返回的 MsgId 可能为 0 或重复，不建立索引
+	if mes.MsgId != "" && mes.SubmitResult == 0 {
+		keys = append(keys, indexByMsgId+mes.MsgId)
+	}
+	if mes.ClientRef != "" {
+		keys = append(keys, clientRefKey(mes.Client, mes.ClientRef))
+	}
+	return keys
+}
+
+// newMessageId 生成网关消息标识（24 位十六进制随机数）
+func newMessageId() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CMPP MsgId 的位布局（共 64 位，从高到低）：
+//
+//	月(4) 日(5) 时(5) 分(6) 秒(6) 网关代码(22) 序列号(16)
+const (
+	msgIdTimeShift = 38 // 时间部分（月日时分秒）占据高 26 位
+	msgIdIsmgShift = 16
+	msgIdIsmgMask  = 1<<22 - 1
+	msgIdSeqMask   = 1<<16 - 1
+)
+
+// MsgIdParts 表示按协议规定拆分后的 MsgId
+type MsgIdParts struct {
+	Month    int
+	Day      int
+	Hour     int
+	Minute   int
+	Second   int
+	IsmgCode uint32 // 短信网关代码
+	Sequence uint16 // 网关内的序列号
+}
+
+// DecodeMsgId 按 CMPP 协议拆分 MsgId
+func DecodeMsgId(id uint64) MsgIdParts {
+	return MsgIdParts{
+		Month:    int(id >> 60 & 0x0f),
+		Day:      int(id >> 55 & 0x1f),
+		Hour:     int(id >> 50 & 0x1f),
+		Minute:   int(id >> 44 & 0x3f),
+		Second:   int(id >> 38 & 0x3f),
+		IsmgCode: uint32(id >> msgIdIsmgShift & msgIdIsmgMask),
+		Sequence: uint16(id & msgIdSeqMask),
+	}
+}
+
+// EncodeMsgId 按 CMPP 协议组装 MsgId，与 DecodeMsgId 互逆
+func EncodeMsgId(p MsgIdParts) uint64 {
+	return msgIdTimeKey(p.Month, p.Day, p.Hour, p.Minute, p.Second)<<msgIdTimeShift |
+		uint64(p.IsmgCode&msgIdIsmgMask)<<msgIdIsmgShift | uint64(p.Sequence)
+}
+
+// Timestamp 返回 MsgId 中的时间（格式 MM-DD HH:MM:SS），MsgId 本身不含年份
+func (p MsgIdParts) Timestamp() string {
+	return fmt.Sprintf("%02d-%02d %02d:%02d:%02d", p.Month, p.Day, p.Hour, p.Minute, p.Second)
+}
+
+// Valid 检查时间部分是否在合法范围内，非标准网关生成的 MsgId 可能无法按协议解释
+func (p MsgIdParts) Valid() bool {
+	return p.Month >= 1 && p.Month <= 12 && p.Day >= 1 && p.Day <= 31 &&
+		p.Hour <= 23 && p.Minute <= 59 && p.Second <= 59
+}
+
+// ParseMsgId 解析十进制或十六进制（0x 前缀或 16 位十六进制）形式的 MsgId
+func ParseMsgId(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return strconv.ParseUint(s[2:], 16, 64)
+	}
+	if id, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return id, nil
+	}
+	if len(s) == 16 {
+		return strconv.ParseUint(s, 16, 64)
+	}
+	return 0, fmt.Errorf("invalid msgid: %s", s)
+}
+
+// msgIdTimeKey 将月日时分秒打包为可比较的整数，与 MsgId 的高 26 位一致
+func msgIdTimeKey(month, day, hour, minute, second int) uint64 {
+	return uint64(month)<<22 | uint64(day)<<17 | uint64(hour)<<12 | uint64(minute)<<6 | uint64(second)
+}
+
+// parseMsgIdTime 解析 MMDDhhmm 或 MMDDhhmmss 形式的时间
+func parseMsgIdTime(s string, end bool) (uint64, error) {
+	layout := "0102150405"
+	if len(s) == 8 {
+		layout = "01021504"
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return 0, err
+	}
+	second := t.Second()
+	if len(s) == 8 && end {
+		// 只精确到分钟的结束时间包含该分钟内的所有秒
+		second = 59
+	}
+	return msgIdTimeKey(int(t.Month()), t.Day(), t.Hour(), t.Minute(), second), nil
+}
+
+// msgIdFilter 表示 MsgId 搜索条件：精确值或时间范围
+type msgIdFilter struct {
+	exact    bool
+	id       uint64
+	from, to uint64 // 时间范围（msgIdTimeKey）
+}
+
+// parseMsgIdFilter 解析 MsgId 搜索条件
+//
+// 支持以下形式:
+//   - 十进制: 9223372036854775807
+//   - 十六进制: 0x7fffffffffffffff 或 7fffffffffffffff
+//   - 时间范围: MMDDhhmm[ss]~MMDDhhmm[ss]，如 01021500~01021600
+func parseMsgIdFilter(s string) (msgIdFilter, error) {
+	s = strings.TrimSpace(s)
+	if from, to, ok := strings.Cut(s, "~"); ok {
+		fromKey, err := parseMsgIdTime(strings.TrimSpace(from), false)
+		if err != nil {
+			return msgIdFilter{}, fmt.Errorf("invalid msgid time range start: %s", from)
+		}
+		toKey, err := parseMsgIdTime(strings.TrimSpace(to), true)
+		if err != nil {
+			return msgIdFilter{}, fmt.Errorf("invalid msgid time range end: %s", to)
+		}
+		return msgIdFilter{from: fromKey, to: toKey}, nil
+	}
+
+	id, err := ParseMsgId(s)
+	if err != nil {
+		return msgIdFilter{}, err
+	}
+	return msgIdFilter{exact: true, id: id}, nil
+}
+
+// match 检查存储的 MsgId（十进制字符串）是否满足条件
+func (f msgIdFilter) match(msgId string) bool {
+	id, err := strconv.ParseUint(msgId, 10, 64)
+	if err != nil {
+		// ERROR、SEND_ERROR 等本地标记不匹配任何 MsgId 条件
+		return false
+	}
+	if f.exact {
+		return id == f.id
+	}
+
+	key := id >> msgIdTimeShift
+	if f.from <= f.to {
+		return key >= f.from && key <= f.to
+	}
+	// 跨年范围，如 12311200~01010800
+	return key >= f.from || key <= f.to
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+// buildMsgId 按协议位布局构造 MsgId
+func buildMsgId(month, day, hour, minute, second int, ismg uint32, seq uint16) uint64 {
+	return msgIdTimeKey(month, day, hour, minute, second)<<msgIdTimeShift |
+		uint64(ismg)<<msgIdIsmgShift | uint64(seq)
+}
+
+func TestDecodeMsgId(t *testing.T) {
+	id := buildMsgId(12, 31, 23, 59, 58, 0x3fffff, 65535)
+	p := DecodeMsgId(id)
+
+	want := MsgIdParts{Month: 12, Day: 31, Hour: 23, Minute: 59, Second: 58, IsmgCode: 0x3fffff, Sequence: 65535}
+	if p != want {
+		t.Fatalf("DecodeMsgId() = %+v, want %+v", p, want)
+	}
+	if !p.Valid() {
+		t.Error("Expected decoded parts to be valid")
+	}
+	if got := p.Timestamp(); got != "12-31 23:59:58" {
+		t.Errorf("Timestamp() = %s", got)
+	}
+}
+
+func TestEncodeMsgIdRoundTrip(t *testing.T) {
+	want := MsgIdParts{Month: 3, Day: 9, Hour: 8, Minute: 7, Second: 6, IsmgCode: 123456, Sequence: 42}
+	id := EncodeMsgId(want)
+	if id != buildMsgId(3, 9, 8, 7, 6, 123456, 42) {
+		t.Fatalf("EncodeMsgId() = %d", id)
+	}
+	if got := DecodeMsgId(id); got != want {
+		t.Errorf("DecodeMsgId(EncodeMsgId()) = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseMsgId(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		{"12345", 12345, false},
+		{"0x3039", 12345, false},
+		{"0000000000003039", 3039, false}, // 16 位纯数字按十进制解析
+		{"000000000000303a", 12346, false},
+		{"xyz", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMsgId(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMsgId(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestMsgIdFilterMatch(t *testing.T) {
+	id := buildMsgId(1, 2, 15, 30, 10, 1234, 7)
+	dec := strconv.FormatUint(id, 10)
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{dec, true},
+		{fmt.Sprintf("0x%x", id), true},
+		{"01021500~01021600", true},
+		{"0102153010~0102153010", true},
+		{"01021531~01021600", false},
+		{"12311200~01030000", true}, // 跨年范围
+		{"01030000~12310000", false},
+	}
+	for _, tt := range tests {
+		f, err := parseMsgIdFilter(tt.filter)
+		if err != nil {
+			t.Errorf("parseMsgIdFilter(%q): %v", tt.filter, err)
+			continue
+		}
+		if got := f.match(dec); got != tt.want {
+			t.Errorf("match(%q) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+
+	f, _ := parseMsgIdFilter("01021500~01021600")
+	if f.match("SEND_ERROR") {
+		t.Error("Local error markers must not match")
+	}
+}
+
+func TestValidateMsgIdFilter(t *testing.T) {
+	if err := ValidateMsgIdFilter(""); err != nil {
+		t.Errorf("empty filter: %v", err)
+	}
+	if err := ValidateMsgIdFilter("01021500~01021600"); err != nil {
+		t.Errorf("range filter: %v", err)
+	}
+	for _, filter := range []string{"02301500~02301600", "01301500~"} {
+		err := ValidateMsgIdFilter(filter)
+		if ve, ok := err.(*ValidationError); !ok || ve.Field != "msgid" {
+			t.Errorf("%s: expected msgid ValidationError, got %v", filter, err)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package gateway
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 管理界面角色，权限逐级包含
+const (
+	RoleViewer   = "viewer"   // 只能查看统计
+	RoleAuditor  = "auditor"  // 查看与导出记录，号码脱敏
+	RoleOperator = "operator" // 发送短信、重新投递、撤回消息，查看完整号码
+	RoleAdmin    = "admin"    // 配置与连接控制、用户管理
+)
+
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleAuditor:  2,
+	RoleOperator: 3,
+	RoleAdmin:    4,
+}
+
+// roleNames 是角色的中文名称，供页面显示
+var roleNames = map[string]string{
+	RoleViewer:   "只读",
+	RoleAuditor:  "审计",
+	RoleOperator: "操作员",
+	RoleAdmin:    "管理员",
+}
+
+// consoleRoles 按权限从低到高排列，供页面的角色下拉框使用
+var consoleRoles = []string{RoleViewer, RoleAuditor, RoleOperator, RoleAdmin}
+
+// 用户名: 1-32 位字母、数字、_ . -
+var userNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`)
+
+// EffectiveRole 返回用户角色；引入角色前创建的用户只有初始管理员，视为 admin
+func (u *ConsoleUser) EffectiveRole() string {
+	if u.Role == "" {
+		return RoleAdmin
+	}
+	return u.Role
+}
+
+// RoleName 返回角色的中文名称
+func (u *ConsoleUser) RoleName() string {
+	return roleNames[u.EffectiveRole()]
+}
+
+// Can 检查用户是否具有 role 或更高的角色，供处理器与模板使用
+func (u *ConsoleUser) Can(role string) bool {
+	if u == nil {
+		return false
+	}
+	return roleLevels[u.EffectiveRole()] >= roleLevels[role]
+}
+
+// requireRole 要求已登录且具有 role 或更高的角色
+func requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return requireConsoleUser(func(w http.ResponseWriter, r *http.Request) {
+		user := consoleUserFromRequest(r)
+		if !user.Can(role) {
+			Warnf("[AUTH] Console user %s (%s) denied %s %s", user.Name, user.EffectiveRole(), r.Method, r.URL.Path)
+			if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/console/") {
+				http.Error(w, "权限不足", http.StatusForbidden)
+				return
+			}
+			writeAPIError(w, http.StatusForbidden, "forbidden", "", "权限不足")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// maskNumber 隐藏号码中间部分，如 13800138000 -> 138****8000
+func maskNumber(s string) string {
+	n := len(s)
+	switch {
+	case n >= 7:
+		return s[:3] + strings.Repeat("*", n-7) + s[n-4:]
+	case n >= 3:
+		return s[:1] + strings.Repeat("*", n-2) + s[n-1:]
+	default:
+		return strings.Repeat("*", n)
+	}
+}
+
+// maskMessage 隐藏消息中的用户号码：上行记录为发送方，其余为接收方
+func maskMessage(mes *SmsMes, listName string) {
+	if listName == "list_mo" {
+		mes.Src = maskNumber(mes.Src)
+	} else {
+		mes.Dest = maskNumber(mes.Dest)
+	}
+}
+
+// masksNumbers 检查是否需要对该请求的登录用户隐藏号码（API 请求没有登录用户，不脱敏）
+func masksNumbers(r *http.Request) bool {
+	user := consoleUserFromRequest(r)
+	return user != nil && !user.Can(RoleOperator)
+}
+
+// redactEvent 按登录用户的角色处理推送的事件：只读用户只收到事件类型，审计用户的号码脱敏
+func redactEvent(user *ConsoleUser, e Event) Event {
+	if user == nil || e.Type == eventConnection || user.Can(RoleOperator) {
+		return e
+	}
+	if !user.Can(RoleAuditor) {
+		e.Data = nil
+		return e
+	}
+	if m, ok := e.Data.(apiMessage); ok {
+		if e.Type == eventMO {
+			m.Src = maskNumber(m.Src)
+		} else {
+			m.Dest = maskNumber(m.Dest)
+		}
+		e.Data = m
+	}
+	return e
+}
+
+// 用户管理操作结果，显示在用户列表页
+var userNotices = map[string]struct {
+	ok   bool
+	text string
+}{
+	"created":      {true, "用户已创建"},
+	"role_updated": {true, "角色已修改"},
+	"password_set": {true, "密码已重置，该用户需重新登录"},
+	"deleted":      {true, "用户已删除"},
+	"invalid_name": {false, "用户名应为 1-32 位字母、数字、_ . -"},
+	"invalid_role": {false, "无效的角色"},
+	"exists":       {false, "用户已存在"},
+	"not_found":    {false, "用户不存在"},
+	"weak":         {false, "密码至少 8 个字符且两次输入一致"},
+	"self":         {false, "不能删除自己或修改自己的角色"},
+	"last_admin":   {false, "至少需要保留一个管理员"},
+	"failed":       {false, "保存失败，请稍后重试"},
+}
+
+// userView 是用户列表页的一行
+type userView struct {
+	Name     string
+	Role     string
+	RoleName string
+	Created  time.Time
+	Updated  time.Time
+}
+
+// listUsers 显示用户列表
+func listUsers(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	users := SCache.ListUsers()
+	views := make([]userView, 0, len(users))
+	for i := range users {
+		u := &users[i]
+		views = append(views, userView{u.Name, u.EffectiveRole(), u.RoleName(), u.Created, u.Updated})
+	}
+	notice := userNotices[r.Form.Get("notice")]
+
+	data := struct {
+		ActivePage   string
+		ServiceReady bool
+		User         *ConsoleUser
+		Users        []userView
+		Roles        []string
+		RoleNames    map[string]string
+		Notice       string
+		NoticeOK     bool
+	}{
+		ActivePage:   "users",
+		ServiceReady: IsCmppReady(),
+		User:         consoleUserFromRequest(r),
+		Users:        views,
+		Roles:        consoleRoles,
+		RoleNames:    roleNames,
+		Notice:       notice.text,
+		NoticeOK:     notice.ok,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := renderTemplate(w, "users", data); err != nil {
+		Errorf("[TPL] 渲染 users 失败: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// countAdmins 统计管理员数量
+func countAdmins() int {
+	n := 0
+	for _, u := range SCache.ListUsers() {
+		if u.EffectiveRole() == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// manageUser 处理用户管理操作，完成后返回用户列表页
+//
+// 参数: action（create、role、password、delete）、name、role、password、confirm
+func manageUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "仅支持 POST", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	current := consoleUserFromRequest(r)
+	notice := updateUser(current, r.Form.Get("action"), strings.TrimSpace(r.Form.Get("name")), r.Form)
+	http.Redirect(w, r, "/users?notice="+notice, http.StatusSeeOther)
+}
+
+// updateUser 执行用户管理操作，返回 userNotices 中的结果代码
+func updateUser(current *ConsoleUser, action, name string, form url.Values) string {
+	get := form.Get
+	role := get("role")
+
+	if action == "create" {
+		if !userNameRegex.MatchString(name) {
+			return "invalid_name"
+		}
+		if _, ok := roleLevels[role]; !ok {
+			return "invalid_role"
+		}
+		if _, ok := SCache.GetUser(name); ok {
+			return "exists"
+		}
+		if ValidatePassword(get("password"), get("confirm")) != nil {
+			return "weak"
+		}
+		hash, err := hashPassword(get("password"))
+		if err != nil {
+			return "failed"
+		}
+		now := time.Now()
+		if err := SCache.SaveUser(&ConsoleUser{Name: name, PasswordHash: hash, Role: role, Created: now, Updated: now}); err != nil {
+			Errorf("[AUTH] Create console user %s failed: %v", name, err)
+			return "failed"
+		}
+		Infof("[AUTH] Console user %s created %s with role %s", current.Name, name, role)
+		return "created"
+	}
+
+	u, ok := SCache.GetUser(name)
+	if !ok {
+		return "not_found"
+	}
+	switch action {
+	case "role":
+		if _, ok := roleLevels[role]; !ok {
+			return "invalid_role"
+		}
+		if name == current.Name {
+			return "self"
+		}
+		if u.EffectiveRole() == RoleAdmin && role != RoleAdmin && countAdmins() <= 1 {
+			return "last_admin"
+		}
+		u.Role = role
+		u.Updated = time.Now()
+		if err := SCache.SaveUser(&u); err != nil {
+			Errorf("[AUTH] Update role of %s failed: %v", name, err)
+			return "failed"
+		}
+		// 角色在每次请求时从存储读取，已登录的会话立即生效
+		Infof("[AUTH] Console user %s changed role of %s to %s", current.Name, name, role)
+		return "role_updated"
+	case "password":
+		if ValidatePassword(get("password"), get("confirm")) != nil {
+			return "weak"
+		}
+		if err := SetUserPassword(name, get("password")); err != nil {
+			Errorf("[AUTH] Reset password of %s failed: %v", name, err)
+			return "failed"
+		}
+		sessions.DeleteUser(name, "")
+		Infof("[AUTH] Console user %s reset password of %s", current.Name, name)
+		return "password_set"
+	case "delete":
+		if name == current.Name {
+			return "self"
+		}
+		if u.EffectiveRole() == RoleAdmin && countAdmins() <= 1 {
+			return "last_admin"
+		}
+		if err := SCache.DeleteUser(name); err != nil {
+			Errorf("[AUTH] Delete console user %s failed: %v", name, err)
+			return "failed"
+		}
+		sessions.DeleteUser(name, "")
+		Infof("[AUTH] Console user %s deleted %s", current.Name, name)
+		return "deleted"
+	}
+	return "failed"
+}
+
+// reconnectUpstream 断开上游 CMPP 连接，由心跳协程在下一周期重新连接
+func reconnectUpstream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{"result": -1, "error": "仅支持 POST"})
+		return
+	}
+	cm := GetClientManager()
+	if cm == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]interface{}{"result": -4, "error": "当前上游通道不支持该操作"})
+		return
+	}
+	Infof("[AUTH] Console user %s requested upstream reconnection", consoleUserFromRequest(r).Name)
+	cm.Disconnect()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"result": 0, "error": ""})
+}
@@ -0,0 +1,220 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaskNumber(t *testing.T) {
+	tests := map[string]string{
+		"13800138000":   "138****8000",
+		"8613800138000": "861******8000",
+		"1065901":       "1065901",
+		"10086":         "1***6",
+		"12":            "**",
+		"":              "",
+	}
+	for in, want := range tests {
+		if got := maskNumber(in); got != want {
+			t.Errorf("maskNumber(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestConsoleUserCan(t *testing.T) {
+	var nobody *ConsoleUser
+	if nobody.Can(RoleViewer) {
+		t.Error("nil user should have no role")
+	}
+	legacy := &ConsoleUser{Name: "admin"}
+	if !legacy.Can(RoleAdmin) {
+		t.Error("User without role should be treated as admin")
+	}
+	auditor := &ConsoleUser{Name: "a", Role: RoleAuditor}
+	for role, want := range map[string]bool{RoleViewer: true, RoleAuditor: true, RoleOperator: false, RoleAdmin: false} {
+		if got := auditor.Can(role); got != want {
+			t.Errorf("auditor.Can(%s) = %v, want %v", role, got, want)
+		}
+	}
+	if (&ConsoleUser{Role: "unknown"}).Can(RoleViewer) {
+		t.Error("Unknown role should have no permission")
+	}
+}
+
+// withConsoleUser 返回带有登录用户的请求
+func withConsoleUser(req *http.Request, u *ConsoleUser) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), consoleUserKey{}, u))
+}
+
+func TestRequireRole(t *testing.T) {
+	withFastPasswordHash(t)
+	withAPIClients(t)
+	newTestBoltCache(t)
+	oldSessions := sessions
+	sessions = newSessionStore()
+	t.Cleanup(func() { sessions = oldSessions })
+
+	hash, _ := hashPassword("password-1")
+	for name, role := range map[string]string{"viewer": RoleViewer, "operator": RoleOperator} {
+		SCache.SaveUser(&ConsoleUser{Name: name, PasswordHash: hash, Role: role})
+	}
+	cookie := func(name string) *http.Cookie {
+		id, _ := sessions.Create(name)
+		return &http.Cookie{Name: sessionCookieName, Value: id}
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	tests := []struct {
+		user, method, target string
+		want                 int
+	}{
+		{"viewer", "GET", "/console/stats", http.StatusOK},
+		{"viewer", "GET", "/list_message", http.StatusForbidden},
+		{"viewer", "POST", "/console/send", http.StatusForbidden},
+		{"operator", "POST", "/console/send", http.StatusOK},
+		{"operator", "GET", "/users", http.StatusForbidden},
+	}
+	roles := map[string]string{"/console/stats": RoleViewer, "/list_message": RoleAuditor, "/console/send": RoleOperator, "/users": RoleAdmin}
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		req.AddCookie(cookie(tc.user))
+		rec := httptest.NewRecorder()
+		requireRole(roles[tc.target], ok)(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s %s: expected %d, got %d", tc.user, tc.method, tc.target, tc.want, rec.Code)
+		}
+		if rec.Code == http.StatusForbidden && tc.method == "POST" && !strings.Contains(rec.Body.String(), "forbidden") {
+			t.Errorf("%s %s: expected JSON error, got %q", tc.method, tc.target, rec.Body.String())
+		}
+	}
+
+	// 角色修改立即生效
+	SCache.SaveUser(&ConsoleUser{Name: "viewer", PasswordHash: hash, Role: RoleAuditor})
+	req := httptest.NewRequest("GET", "/list_message", nil)
+	req.AddCookie(cookie("viewer"))
+	rec := httptest.NewRecorder()
+	requireRole(RoleAuditor, ok)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Updated role should apply to existing sessions, got %d", rec.Code)
+	}
+}
+
+func TestExportMasksNumbers(t *testing.T) {
+	withAPIClients(t)
+	cache := newTestBoltCache(t)
+	cache.AddSubmits(&SmsMes{Id: "m1", Src: "10659", Dest: "13800138000", Content: "hi", Created: time.Now()})
+
+	for role, masked := range map[string]bool{RoleAuditor: true, RoleOperator: false} {
+		req := withConsoleUser(httptest.NewRequest("GET", "/export?format=jsonl", nil), &ConsoleUser{Name: "u", Role: role})
+		rec := httptest.NewRecorder()
+		exportMessages(rec, req)
+		if got := strings.Contains(rec.Body.String(), "138****8000"); got != masked {
+			t.Errorf("%s: masked = %v, body %q", role, got, rec.Body.String())
+		}
+	}
+	// 开放 API 不脱敏
+	rec := httptest.NewRecorder()
+	exportMessages(rec, httptest.NewRequest("GET", "/export?format=jsonl", nil))
+	if !strings.Contains(rec.Body.String(), "13800138000") {
+		t.Errorf("API export should not be masked, got %q", rec.Body.String())
+	}
+}
+
+func TestRedactEvent(t *testing.T) {
+	e := Event{Type: eventSubmit, Data: apiMessage{Id: "m1", Src: "10659", Dest: "13800138000"}}
+	if got := redactEvent(&ConsoleUser{Role: RoleViewer}, e); got.Data != nil || got.Type != eventSubmit {
+		t.Errorf("Viewer should only receive event type, got %+v", got)
+	}
+	if got := redactEvent(&ConsoleUser{Role: RoleAuditor}, e).Data.(apiMessage); got.Dest != "138****8000" || got.Src != "10659" {
+		t.Errorf("Auditor event should mask dest, got %+v", got)
+	}
+	mo := Event{Type: eventMO, Data: apiMessage{Src: "13900139000", Dest: "10659"}}
+	if got := redactEvent(&ConsoleUser{Role: RoleAuditor}, mo).Data.(apiMessage); got.Src != "139****9000" {
+		t.Errorf("Auditor MO event should mask src, got %+v", got)
+	}
+	if got := redactEvent(&ConsoleUser{Role: RoleOperator}, e).Data.(apiMessage); got.Dest != "13800138000" {
+		t.Errorf("Operator event should not be masked, got %+v", got)
+	}
+	// 原事件由所有订阅者共享，不能被修改
+	if e.Data.(apiMessage).Dest != "13800138000" {
+		t.Error("redactEvent modified the original event")
+	}
+	conn := Event{Type: eventConnection, Data: connectionState{Ready: true}}
+	if got := redactEvent(&ConsoleUser{Role: RoleViewer}, conn); got.Data == nil {
+		t.Error("Connection events should not be redacted")
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	withFastPasswordHash(t)
+	withAPIClients(t)
+	newTestBoltCache(t)
+	oldSessions := sessions
+	sessions = newSessionStore()
+	t.Cleanup(func() { sessions = oldSessions })
+
+	hash, _ := hashPassword("password-1")
+	admin := &ConsoleUser{Name: "admin", PasswordHash: hash, Role: RoleAdmin}
+	SCache.SaveUser(admin)
+	form := func(kv ...string) url.Values {
+		v := url.Values{}
+		for i := 0; i+1 < len(kv); i += 2 {
+			v.Set(kv[i], kv[i+1])
+		}
+		return v
+	}
+
+	tests := []struct {
+		action, name string
+		form         url.Values
+		want         string
+	}{
+		{"create", "bad name", form("role", RoleViewer, "password", "password-2", "confirm", "password-2"), "invalid_name"},
+		{"create", "bob", form("role", "root", "password", "password-2", "confirm", "password-2"), "invalid_role"},
+		{"create", "bob", form("role", RoleViewer, "password", "short", "confirm", "short"), "weak"},
+		{"create", "bob", form("role", RoleViewer, "password", "password-2", "confirm", "password-2"), "created"},
+		{"create", "bob", form("role", RoleViewer, "password", "password-2", "confirm", "password-2"), "exists"},
+		{"role", "admin", form("role", RoleViewer), "self"},
+		{"delete", "admin", nil, "self"},
+		{"role", "nobody", form("role", RoleViewer), "not_found"},
+		{"role", "bob", form("role", RoleOperator), "role_updated"},
+		{"password", "bob", form("password", "password-3", "confirm", "password-3"), "password_set"},
+	}
+	for _, tc := range tests {
+		if got := updateUser(admin, tc.action, tc.name, tc.form); got != tc.want {
+			t.Errorf("%s %s: got %q, want %q", tc.action, tc.name, got, tc.want)
+		}
+	}
+	if u, _ := SCache.GetUser("bob"); u.Role != RoleOperator || !checkPassword(u.PasswordHash, "password-3") {
+		t.Errorf("Unexpected user %+v", u)
+	}
+
+	// 另一个管理员不能移除最后一个管理员
+	other := &ConsoleUser{Name: "carol", Role: RoleAdmin}
+	SCache.SaveUser(other)
+	if got := updateUser(other, "role", "carol", form("role", RoleViewer)); got != "self" {
+		t.Errorf("Expected self, got %q", got)
+	}
+	if got := updateUser(admin, "role", "carol", form("role", RoleViewer)); got != "role_updated" {
+		t.Errorf("Expected role_updated, got %q", got)
+	}
+	if got := updateUser(other, "delete", "admin", nil); got != "last_admin" {
+		t.Errorf("Deleting the last admin: expected last_admin, got %q", got)
+	}
+
+	id, _ := sessions.Create("bob")
+	if got := updateUser(admin, "delete", "bob", nil); got != "deleted" {
+		t.Errorf("Expected deleted, got %q", got)
+	}
+	if _, ok := SCache.GetUser("bob"); ok {
+		t.Error("User should be deleted")
+	}
+	if _, ok := sessions.Touch(id, time.Minute, false); ok {
+		t.Error("Sessions of deleted user should be revoked")
+	}
+}
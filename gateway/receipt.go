@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// 未匹配状态报告在关联缓冲区中的保留时间
+	defaultReceiptHoldTime = 60 * time.Second
+	// 关联缓冲区的过期检查间隔
+	defaultReceiptSweepInterval = 5 * time.Second
+)
+
+// 状态报告的投递结果
+const (
+	deliveryResultDelivered uint32 = 0 // DELIVRD，投递成功
+	deliveryResultFailed    uint32 = 1 // 其他状态，投递失败
+)
+
+// deliveryStatCanceled 通过 CMPP_CANCEL 删除成功的消息记录的状态，
+// 与标准状态一样为 7 个字符，可按 delivery_stat=CANCELD 搜索
+const deliveryStatCanceled = "CANCELD"
+
+// deliveryResultFromStat 将状态报告的 Stat 字段转换为投递结果
+func deliveryResultFromStat(stat string) uint32 {
+	if stat == "DELIVRD" {
+		return deliveryResultDelivered
+	}
+	return deliveryResultFailed
+}
+
+// pendingReceipt 暂存的状态报告
+type pendingReceipt struct {
+	mes      SmsMes
+	received time.Time
+}
+
+// receiptBuffer 暂存早于 Submit 响应到达的状态报告
+// 部分网关会在 Cmpp3SubmitRspPkt 之前（或几乎同时）发送状态报告，
+// 此时消息尚未获得 MsgId，无法与已存储的记录匹配
+type receiptBuffer struct {
+	mu       sync.Mutex
+	receipts map[string]pendingReceipt
+	holdTime time.Duration
+}
+
+func newReceiptBuffer(holdTime time.Duration) *receiptBuffer {
+	return &receiptBuffer{
+		receipts: make(map[string]pendingReceipt),
+		holdTime: holdTime,
+	}
+}
+
+// Put 暂存一个未匹配的状态报告，同一 MsgId 以最新的为准
+func (b *receiptBuffer) Put(mes SmsMes) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.receipts[mes.MsgId] = pendingReceipt{mes: mes, received: time.Now()}
+}
+
+// Take 取出并删除指定 MsgId 的状态报告
+func (b *receiptBuffer) Take(msgId string) (SmsMes, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r, ok := b.receipts[msgId]
+	if ok {
+		delete(b.receipts, msgId)
+	}
+	return r.mes, ok
+}
+
+// Restore 放回取出后未能写入存储的状态报告并重新计时，已有同一 MsgId 的新报告时保留新的
+func (b *receiptBuffer) Restore(mes SmsMes) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.receipts[mes.MsgId]; !ok {
+		b.receipts[mes.MsgId] = pendingReceipt{mes: mes, received: time.Now()}
+	}
+}
+
+// Expire 取出并删除所有超过保留时间的状态报告
+func (b *receiptBuffer) Expire(now time.Time) []SmsMes {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var expired []SmsMes
+	for msgId, r := range b.receipts {
+		if now.Sub(r.received) >= b.holdTime {
+			expired = append(expired, r.mes)
+			delete(b.receipts, msgId)
+		}
+	}
+	return expired
+}
+
+// Len 返回当前暂存的状态报告数量
+func (b *receiptBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.receipts)
+}
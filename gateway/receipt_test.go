@@ -0,0 +1,197 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	cmpp "github.com/bigwhite/gocmpp"
+	bolt "go.etcd.io/bbolt"
+)
+
+// newTestBoltCache 使用临时目录创建 BoltDB 并替换全局 SCache
+func newTestBoltCache(t *testing.T) *BoltCache {
+	t.Helper()
+	boltCache, err := StartBoltCache(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("StartBoltCache failed: %v", err)
+	}
+	oldCache := SCache
+	SCache = boltCache
+	t.Cleanup(func() {
+		SCache = oldCache
+		boltCache.StopBoltCache()
+	})
+	return boltCache
+}
+
+// newReceiptDeliver 构造携带状态报告的 Deliver 包
+func newReceiptDeliver(t *testing.T, msgId uint64, stat string) *cmpp.Cmpp3DeliverReqPkt {
+	t.Helper()
+	receipt := &cmpp.CmppReceiptPkt{
+		MsgId:          msgId,
+		Stat:           stat,
+		SubmitTime:     "2401011200",
+		DoneTime:       "2401011201",
+		DestTerminalId: "13800138000",
+	}
+	data, err := receipt.Pack()
+	if err != nil {
+		t.Fatalf("Pack receipt failed: %v", err)
+	}
+	return &cmpp.Cmpp3DeliverReqPkt{
+		MsgId:            99,
+		RegisterDelivery: 1,
+		MsgLength:        uint8(len(data)),
+		MsgContent:       string(data),
+	}
+}
+
+func TestReceiptBufferTakeAndExpire(t *testing.T) {
+	b := newReceiptBuffer(time.Minute)
+	b.Put(SmsMes{MsgId: "1", DeliveryStat: "DELIVRD"})
+	b.Put(SmsMes{MsgId: "2", DeliveryStat: "UNDELIV"})
+
+	if r, ok := b.Take("1"); !ok || r.DeliveryStat != "DELIVRD" {
+		t.Fatalf("Take(1) = %+v, %v", r, ok)
+	}
+	if _, ok := b.Take("1"); ok {
+		t.Fatal("Take should remove the receipt")
+	}
+
+	if expired := b.Expire(time.Now()); len(expired) != 0 {
+		t.Fatalf("Expected nothing expired yet, got %d", len(expired))
+	}
+	expired := b.Expire(time.Now().Add(time.Minute))
+	if len(expired) != 1 || expired[0].MsgId != "2" {
+		t.Fatalf("Expected receipt 2 expired, got %+v", expired)
+	}
+	if b.Len() != 0 {
+		t.Fatalf("Expected empty buffer, got %d", b.Len())
+	}
+}
+
+// failingCompleteCache 在合并提交响应后让事务失败
+type failingCompleteCache struct {
+	CacheInterface
+}
+
+func (c failingCompleteCache) CompleteWaitCache(gen uint64, seq uint32, fill func(mes *SmsMes)) (SmsMes, error) {
+	mes := SmsMes{}
+	fill(&mes)
+	return mes, errors.New("commit failed")
+}
+
+// TestSubmitRspKeepsReceiptOnFailedCommit 写入失败时先到的状态报告仍留在缓冲区
+func TestSubmitRspKeepsReceiptOnFailedCommit(t *testing.T) {
+	newTestBoltCache(t)
+	p := newMessagePipeline(ChannelCMPP)
+	p.cache = failingCompleteCache{SCache}
+	p.receipts.Put(SmsMes{MsgId: "77", DeliveryStat: "DELIVRD"})
+
+	p.submitResponded(1, 1, "77", 0)
+	if r, ok := p.receipts.Take("77"); !ok || r.DeliveryStat != "DELIVRD" {
+		t.Fatalf("Expected buffered receipt to survive the failed commit, got %+v %v", r, ok)
+	}
+
+	// 放回时不覆盖期间到达的新报告
+	p.receipts.Put(SmsMes{MsgId: "78", DeliveryStat: "UNDELIV"})
+	p.receipts.Restore(SmsMes{MsgId: "78", DeliveryStat: "DELIVRD"})
+	if r, _ := p.receipts.Take("78"); r.DeliveryStat != "UNDELIV" {
+		t.Errorf("Restore should keep the newer receipt, got %+v", r)
+	}
+}
+
+// TestReceiptBeforeSubmitRsp 测试状态报告先于提交响应到达
+func TestReceiptBeforeSubmitRsp(t *testing.T) {
+	newTestBoltCache(t)
+	cm := NewClientManager(&Config{})
+
+	gen := cm.Generation()
+	if err := SCache.SetWaitCache(gen, 7, SmsMes{Dest: "13800138000", Content: "hi"}); err != nil {
+		t.Fatalf("SetWaitCache failed: %v", err)
+	}
+
+	cm.handleDeliverReq(newReceiptDeliver(t, 4242, "DELIVRD"))
+	if cm.pipeline.receipts.Len() != 1 {
+		t.Fatalf("Expected receipt to be buffered, got %d", cm.pipeline.receipts.Len())
+	}
+
+	cm.handleSubmitRsp(&cmpp.Cmpp3SubmitRspPkt{MsgId: 4242, SeqId: 7}, gen)
+	if cm.pipeline.receipts.Len() != 0 {
+		t.Fatal("Expected buffered receipt to be consumed by submit response")
+	}
+
+	list := *SCache.GetList("list_message", 0, 10)
+	if len(list) != 1 || list[0].DeliveryStat != "DELIVRD" || list[0].DelivleryResult != deliveryResultDelivered {
+		t.Fatalf("Expected receipt applied to stored message, got %+v", list)
+	}
+}
+
+// TestReceiptAfterSubmitRsp 测试正常顺序下状态报告直接写入记录
+func TestReceiptAfterSubmitRsp(t *testing.T) {
+	newTestBoltCache(t)
+	cm := NewClientManager(&Config{})
+
+	SCache.AddSubmits(&SmsMes{MsgId: "5151", Dest: "13800138000", DelivleryResult: 65535})
+	cm.handleDeliverReq(newReceiptDeliver(t, 5151, "UNDELIV"))
+
+	if cm.pipeline.receipts.Len() != 0 {
+		t.Fatal("Receipt for stored message must not be buffered")
+	}
+	list := *SCache.GetList("list_message", 0, 10)
+	if len(list) != 1 || list[0].DeliveryStat != "UNDELIV" || list[0].DelivleryResult != deliveryResultFailed {
+		t.Fatalf("Expected failed receipt applied, got %+v", list)
+	}
+	if SCache.Length("list_mo") != 0 {
+		t.Fatal("Receipt must not be stored as MO message")
+	}
+}
+
+// TestReceiptExpiresToOrphanList 测试超时未匹配的状态报告进入孤立列表
+func TestReceiptExpiresToOrphanList(t *testing.T) {
+	newTestBoltCache(t)
+	cm := NewClientManager(&Config{})
+
+	cm.handleDeliverReq(newReceiptDeliver(t, 6060, "EXPIRED"))
+	cm.pipeline.expireReceipts(time.Now().Add(defaultReceiptHoldTime))
+
+	if cm.pipeline.receipts.Len() != 0 {
+		t.Fatal("Expected buffer to be empty after expiry")
+	}
+	orphans := *SCache.GetList("list_orphan", 0, 10)
+	if len(orphans) != 1 || orphans[0].MsgId != "6060" || orphans[0].DeliveryStat != "EXPIRED" {
+		t.Fatalf("Expected orphan receipt, got %+v", orphans)
+	}
+}
+
+func TestBoltCacheBackfillsMessageIndex(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	cache, err := StartBoltCache(path)
+	if err != nil {
+		t.Fatalf("StartBoltCache failed: %v", err)
+	}
+	// 建立索引之前写入的记录：清掉补建标记，直接写入 messages
+	cache.db.Update(func(tx *bolt.Tx) error {
+		tx.Bucket(indexBucket).Delete(indexBackfilled)
+		v, _ := json.Marshal(SmsMes{Id: "legacy", MsgId: "42"})
+		return tx.Bucket(messageBucket).Put(timeKey(tx, tx.Bucket(messageBucket)), v)
+	})
+	if _, ok, err := cache.ApplyReceipt("42", deliveryResultDelivered, "DELIVRD"); ok || err != nil {
+		t.Fatalf("Unindexed record should not match: %v %v", ok, err)
+	}
+	cache.StopBoltCache()
+
+	cache, err = StartBoltCache(path)
+	if err != nil {
+		t.Fatalf("StartBoltCache failed: %v", err)
+	}
+	defer cache.StopBoltCache()
+	if mes, ok, err := cache.ApplyReceipt("42", deliveryResultDelivered, "DELIVRD"); !ok || err != nil || mes.MsgId != "42" || mes.DeliveryStat != "DELIVRD" {
+		t.Fatalf("Backfilled record should match: %v %v", ok, err)
+	}
+	if mes, ok := cache.LookupMessage(indexById + "legacy"); !ok || mes.DeliveryStat != "DELIVRD" {
+		t.Errorf("Unexpected record %+v", mes)
+	}
+}
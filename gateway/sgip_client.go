@@ -0,0 +1,455 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SGIP 的 SPNumber 最长 21 字节
+const sgipMaxSPNumber = 21
+
+// errSgipReadTimeout 表示在超时时间内没有收到任何数据，可以安全地重试
+var errSgipReadTimeout = errors.New("sgip read timeout")
+
+// sgipConn 是 SGIP 连接的帧层实现
+type sgipConn struct {
+	conn   net.Conn
+	node   uint32 // 本端节点编号，用于生成序列号
+	seq    atomic.Uint32
+	closed atomic.Bool
+	wmu    sync.Mutex // 保证一个包的字节连续写出
+}
+
+func newSGIPConn(conn net.Conn, node uint32) *sgipConn {
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetKeepAlive(true)
+	}
+	return &sgipConn{conn: conn, node: node}
+}
+
+// nextSeq 分配序列号
+func (c *sgipConn) nextSeq() SgipSeq {
+	return SgipSeq{Node: c.node, Time: sgipTimestamp(time.Now()), Seq: c.seq.Add(1)}
+}
+
+// Close 关闭连接（可重复调用）
+func (c *sgipConn) Close() {
+	if c.closed.CompareAndSwap(false, true) {
+		c.conn.Close()
+	}
+}
+
+// SendReq 分配序列号并发送请求
+func (c *sgipConn) SendReq(commandId uint32, body []byte) (SgipSeq, error) {
+	seq := c.nextSeq()
+	return seq, c.Send(&SgipPDU{CommandId: commandId, Seq: seq, Body: body})
+}
+
+// Send 发送一个包
+func (c *sgipConn) Send(p *SgipPDU) error {
+	if c.closed.Load() {
+		return io.ErrClosedPipe
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(p.Bytes())
+	return err
+}
+
+// Recv 读取一个完整的包，超时且未读到数据时返回 errSgipReadTimeout
+func (c *sgipConn) Recv(timeout time.Duration) (*SgipPDU, error) {
+	if c.closed.Load() {
+		return nil, io.ErrClosedPipe
+	}
+
+	var header [sgipHeaderLen]byte
+	if timeout != 0 {
+		c.conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	// 先读第一个字节：此时超时说明没有数据，可以安全地重试
+	if _, err := io.ReadFull(c.conn, header[:1]); err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, errSgipReadTimeout
+		}
+		return nil, err
+	}
+
+	// 包已开始到达，剩余部分使用较长的超时，避免读取半个包后流错位
+	c.conn.SetReadDeadline(time.Now().Add(defaultPacketBodyTimeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	if _, err := io.ReadFull(c.conn, header[1:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < sgipHeaderLen || length > sgipMaxPacketLen {
+		return nil, fmt.Errorf("%w: message length %d", errSgipMalformed, length)
+	}
+	p := &SgipPDU{
+		CommandId: binary.BigEndian.Uint32(header[4:8]),
+		Seq:       readSgipSeq(header[8:20]),
+		Body:      make([]byte, length-sgipHeaderLen),
+	}
+	if _, err := io.ReadFull(c.conn, p.Body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// respond 发送响应，序列号与请求相同
+func (c *sgipConn) respond(req *SgipPDU, result uint8) error {
+	return c.Send(&SgipPDU{CommandId: req.CommandId | 0x80000000, Seq: req.Seq, Body: (&SgipRespPkt{Result: result}).Pack()})
+}
+
+// bind 发送 Bind 并校验响应
+func (c *sgipConn) bind(req *SgipBindPkt, timeout time.Duration) error {
+	seq, err := c.SendReq(SgipBind, req.Pack())
+	if err != nil {
+		return err
+	}
+	rsp, err := c.Recv(timeout)
+	if err != nil {
+		return err
+	}
+	if rsp.CommandId != SgipBindResp {
+		return fmt.Errorf("unexpected response 0x%08x to bind", rsp.CommandId)
+	}
+	if rsp.Seq != seq {
+		return fmt.Errorf("bind response sequence mismatch: %s != %s", rsp.Seq, seq)
+	}
+	var r SgipRespPkt
+	if err := r.Unpack(rsp.Body); err != nil {
+		return err
+	}
+	if r.Result != 0 {
+		return fmt.Errorf("bind rejected, result=%d", r.Result)
+	}
+	return nil
+}
+
+// sgipUserNumber 将手机号转换为 SGIP 要求的带 86 前缀的格式
+func sgipUserNumber(dest string) string {
+	dest = strings.TrimPrefix(dest, "+")
+	if len(dest) == 11 {
+		return "86" + dest
+	}
+	return dest
+}
+
+// trimSgipUserNumber 去掉 86 前缀，与其他通道保存的号码格式保持一致
+func trimSgipUserNumber(n string) string {
+	if len(n) == 13 && strings.HasPrefix(n, "86") {
+		return n[2:]
+	}
+	return n
+}
+
+// SGIPClient 是 SGIP 1.2 上游通道（中国联通）
+//
+// SGIP 的 MO 与状态报告不在 SP 发起的连接上返回，而是由 SMG 另行连接到 SP，
+// 因此除了发送用的客户端连接，还需要在 sgip_listen_addr 上监听 SMG 的连接
+type SGIPClient struct {
+	config *Config
+
+	conn *sgipConn // 需要加锁保护
+	mu   sync.RWMutex
+
+	ready atomic.Bool
+
+	// 连接代次，与序列号共同作为提交响应的关联键
+	generation atomic.Uint64
+
+	pipeline *messagePipeline
+	listener *sgipListener
+
+	// 退出信号
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	wg           sync.WaitGroup
+}
+
+// NewSGIPClient 创建 SGIP 通道
+func NewSGIPClient(cfg *Config) *SGIPClient {
+	c := &SGIPClient{
+		config:   cfg,
+		pipeline: newMessagePipeline(ChannelSGIP),
+		shutdown: make(chan struct{}),
+	}
+	if cfg.SGIPListenAddr != "" {
+		c.listener = newSGIPListener(cfg, c.pipeline)
+	}
+	c.generation.Store(uint64(time.Now().UnixNano()))
+	return c
+}
+
+// Name 返回通道类型
+func (c *SGIPClient) Name() string {
+	return ChannelSGIP
+}
+
+// SetHandler 设置接收处理结果与连接状态的回调，需在 Start 之前调用
+func (c *SGIPClient) SetHandler(h ChannelHandler) {
+	c.pipeline.setHandler(h)
+}
+
+// SubmitFailed 记录未能提交的消息
+func (c *SGIPClient) SubmitFailed(mes *SmsMes) {
+	c.pipeline.submitFailed(mes)
+}
+
+// IsReady 检查连接是否就绪
+func (c *SGIPClient) IsReady() bool {
+	return c.ready.Load()
+}
+
+// Generation 返回当前连接代次
+func (c *SGIPClient) Generation() uint64 {
+	return c.generation.Load()
+}
+
+// ListenAddr 返回接收 SMG 连接的实际监听地址，未监听时为空
+func (c *SGIPClient) ListenAddr() string {
+	if c.listener == nil {
+		return ""
+	}
+	return c.listener.Addr()
+}
+
+// Start 启动 SMG 连接监听，建立发送连接并启动重连与状态报告清理协程
+func (c *SGIPClient) Start() {
+	if c.listener != nil {
+		if err := c.listener.Start(); err != nil {
+			Errorf("[SGIP] Failed to listen on %s for SMG connections: %v", c.config.SGIPListenAddr, err)
+		}
+	} else {
+		Warnf("[SGIP] sgip_listen_addr not configured, MO and status reports will not be received")
+	}
+
+	if err := c.Connect(); err != nil {
+		Errorf("[SGIP] Initial connection failed: %v", err)
+		// 由心跳协程尝试重连
+	}
+
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		c.heartbeatLoop()
+	}()
+	go func() {
+		defer c.wg.Done()
+		c.pipeline.runReceiptSweeper(c.shutdown)
+	}()
+}
+
+// Connect 建立连接并完成 Bind，成功后启动该连接的接收协程
+func (c *SGIPClient) Connect() error {
+	addr := net.JoinHostPort(c.config.SGIPHost, c.config.SGIPPort)
+	netConn, err := net.DialTimeout("tcp", addr, defaultConnectTimeout)
+	if err != nil {
+		c.pipeline.setReady(&c.ready, false)
+		return fmt.Errorf("failed to connect to SMG: %w", err)
+	}
+	conn := newSGIPConn(netConn, c.config.SGIPNodeId)
+	err = conn.bind(&SgipBindPkt{
+		LoginType:     SgipLoginSPToSMG,
+		LoginName:     c.config.SGIPUser,
+		LoginPassword: c.config.SGIPPassword,
+	}, defaultConnectTimeout)
+	if err != nil {
+		conn.Close()
+		c.pipeline.setReady(&c.ready, false)
+		return fmt.Errorf("failed to bind to SMG: %w", err)
+	}
+
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = conn
+	gen := c.generation.Add(1)
+	c.pipeline.setReady(&c.ready, true)
+	c.mu.Unlock()
+	Infof("[SGIP] Bind successful, addr=%s user=%s generation=%d", addr, c.config.SGIPUser, gen)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.receiveLoop(conn, gen)
+	}()
+
+	c.pipeline.resolveStalePending(gen)
+	return nil
+}
+
+// current 返回当前连接及其代次
+func (c *SGIPClient) current() (*sgipConn, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn, c.generation.Load()
+}
+
+// Submit 构建 Submit 并发送
+// SMG 通常会关闭空闲连接，连接不可用时先尝试重新 Bind
+func (c *SGIPClient) Submit(mes *SmsMes) error {
+	spNumber := c.config.SGIPSPNumber
+	if spNumber == "" {
+		spNumber = c.config.SmsAccessNo
+	}
+	srcId := buildSrcId(spNumber, mes.Src)
+	if len(srcId) > sgipMaxSPNumber {
+		return fmt.Errorf("%w: %s (len=%d, max %d)", errSrcIdTooLong, srcId, len(srcId), sgipMaxSPNumber)
+	}
+	serviceType := c.config.SGIPServiceType
+	if serviceType == "" {
+		serviceType = c.config.ServiceId
+	}
+
+	coding, content := encodeMsgContent(mes.Content)
+	body, err := (&SgipSubmitPkt{
+		SPNumber:         srcId,
+		ChargeNumber:     "000000000000000000000", // 21 个 0 表示由 SP 支付
+		UserNumber:       []string{sgipUserNumber(mes.Dest)},
+		CorpId:           c.config.SGIPCorpId,
+		ServiceType:      serviceType,
+		FeeType:          1, // 免费
+		FeeValue:         "0",
+		GivenValue:       "0",
+		AgentFlag:        0,
+		MorelatetoMTFlag: 2, // 非 MO 引起的 MT
+		Priority:         0,
+		ReportFlag:       1, // 需要状态报告
+		MessageCoding:    coding,
+		MessageContent:   content,
+	}).Pack()
+	if err != nil {
+		return err
+	}
+
+	if !c.IsReady() {
+		if err := c.Connect(); err != nil {
+			return err
+		}
+	}
+	conn, gen := c.current()
+	if conn == nil {
+		return fmt.Errorf("SGIP client not ready")
+	}
+
+	seq := conn.nextSeq()
+	if err := c.pipeline.addPending(gen, seq.Seq, mes); err != nil {
+		return err
+	}
+	if err := conn.Send(&SgipPDU{CommandId: SgipSubmit, Seq: seq, Body: body}); err != nil {
+		// 未发出的消息撤销登记，由调用者记录为发送失败
+		c.pipeline.removePending(gen, seq.Seq)
+		c.pipeline.setReady(&c.ready, false)
+		return err
+	}
+	Infof("[SEND] Sent successfully, waiting for response Gen=%d Seq=%s", gen, seq)
+	return nil
+}
+
+// receiveLoop 接收一条连接上的包，连接关闭或出错时退出
+func (c *SGIPClient) receiveLoop(conn *sgipConn, gen uint64) {
+	Infof("[SGIP][RECV] Receiver goroutine started, generation=%d", gen)
+	defer Infof("[SGIP][RECV] Receiver goroutine stopped, generation=%d", gen)
+
+	for {
+		select {
+		case <-c.shutdown:
+			return
+		default:
+		}
+
+		pdu, err := conn.Recv(defaultReceiveTimeout)
+		if err != nil {
+			if errors.Is(err, errSgipReadTimeout) {
+				continue
+			}
+			// 只有当前连接出错才影响就绪状态，旧连接被替换时也会走到这里
+			if cur, _ := c.current(); cur == conn {
+				Warnf("[SGIP][RECV] Connection closed: %v", err)
+				c.pipeline.setReady(&c.ready, false)
+			}
+			conn.Close()
+			return
+		}
+
+		switch pdu.CommandId {
+		case SgipSubmitResp:
+			var r SgipRespPkt
+			r.Unpack(pdu.Body)
+			// Submit 的序列号即消息标识，状态报告以它引用原消息
+			msgId := ""
+			if r.Result == 0 {
+				msgId = pdu.Seq.String()
+			}
+			Infof("[SGIP][SUBMIT-RSP] Received submit response: MsgId=%s Gen=%d Result=%d", msgId, gen, r.Result)
+			c.pipeline.submitResponded(gen, pdu.Seq.Seq, msgId, uint32(r.Result))
+		case SgipUnbind:
+			Infof("[SGIP] SMG requested unbind")
+			conn.Send(&SgipPDU{CommandId: SgipUnbindResp, Seq: pdu.Seq})
+			c.pipeline.setReady(&c.ready, false)
+			conn.Close()
+		case SgipUnbindResp:
+			Infof("[SGIP] Received unbind response")
+		default:
+			if pdu.CommandId&0x80000000 == 0 {
+				conn.respond(pdu, 0)
+			}
+			Debugf("[SGIP][RECV] Ignoring command 0x%08x", pdu.CommandId)
+		}
+	}
+}
+
+// heartbeatLoop 定期检查连接，不可用时重连
+// SGIP 没有链路检测命令，空闲连接由 SMG 关闭后在此或下次发送时重新建立
+func (c *SGIPClient) heartbeatLoop() {
+	ticker := time.NewTicker(defaultHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !c.IsReady() {
+				Debugf("[SGIP][HEARTBEAT] Client not ready, attempting reconnection")
+				if err := c.Connect(); err != nil {
+					Errorf("[SGIP][HEARTBEAT] Reconnection failed: %v", err)
+				} else {
+					metrics.reconnects.Inc(ChannelSGIP)
+				}
+			}
+		case <-c.shutdown:
+			return
+		}
+	}
+}
+
+// Stop 发送 Unbind，断开连接并关闭监听（可重复调用）
+func (c *SGIPClient) Stop() {
+	c.shutdownOnce.Do(func() {
+		Infof("[SGIP] Shutting down SGIP client...")
+		close(c.shutdown)
+
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.SendReq(SgipUnbind, nil)
+			c.conn.Close()
+		}
+		c.pipeline.setReady(&c.ready, false)
+		c.mu.Unlock()
+
+		if c.listener != nil {
+			c.listener.Stop()
+		}
+		c.wg.Wait()
+		Infof("[SGIP] SGIP client shutdown complete")
+	})
+}
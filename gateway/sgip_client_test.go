@@ -0,0 +1,251 @@
+package gateway
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMG 是测试用的最小 SGIP 1.2 模拟器
+// 接受 SP 的 Bind 与 Submit；上行短信与状态报告通过另行连接网关监听地址发送
+type fakeSMG struct {
+	t        *testing.T
+	password string
+
+	mu      sync.Mutex
+	submits []SgipSubmitPkt
+	seqs    []SgipSeq
+}
+
+func startFakeSMG(t *testing.T, password string) (*fakeSMG, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := &fakeSMG{t: t, password: password}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			netConn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(newSGIPConn(netConn, 2000000001))
+		}
+	}()
+	return s, ln.Addr().String()
+}
+
+func (s *fakeSMG) serve(conn *sgipConn) {
+	defer conn.Close()
+	for {
+		pdu, err := conn.Recv(0)
+		if err != nil {
+			return
+		}
+		switch pdu.CommandId {
+		case SgipBind:
+			var req SgipBindPkt
+			req.Unpack(pdu.Body)
+			var result uint8
+			if req.LoginType != SgipLoginSPToSMG || req.LoginPassword != s.password {
+				result = 1
+			}
+			conn.respond(pdu, result)
+			if result != 0 {
+				return
+			}
+		case SgipSubmit:
+			var req SgipSubmitPkt
+			req.Unpack(pdu.Body)
+			s.mu.Lock()
+			s.submits = append(s.submits, req)
+			s.seqs = append(s.seqs, pdu.Seq)
+			s.mu.Unlock()
+			conn.respond(pdu, 0)
+		case SgipUnbind:
+			conn.Send(&SgipPDU{CommandId: SgipUnbindResp, Seq: pdu.Seq})
+			return
+		}
+	}
+}
+
+// dialGateway 以 SMG 身份连接网关的监听地址并完成 Bind
+func dialGateway(t *testing.T, addr, user, password string) (*sgipConn, error) {
+	t.Helper()
+	netConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial gateway listener failed: %v", err)
+	}
+	conn := newSGIPConn(netConn, 2000000001)
+	t.Cleanup(conn.Close)
+	return conn, conn.bind(&SgipBindPkt{LoginType: SgipLoginSMGToSP, LoginName: user, LoginPassword: password}, time.Second)
+}
+
+// request 发送请求并等待响应，返回响应的 Result
+func request(t *testing.T, conn *sgipConn, commandId uint32, body []byte) uint8 {
+	t.Helper()
+	seq, err := conn.SendReq(commandId, body)
+	if err != nil {
+		t.Fatalf("Send 0x%08x failed: %v", commandId, err)
+	}
+	rsp, err := conn.Recv(time.Second)
+	if err != nil {
+		t.Fatalf("Receive response to 0x%08x failed: %v", commandId, err)
+	}
+	if rsp.CommandId != commandId|0x80000000 || rsp.Seq != seq {
+		t.Fatalf("Unexpected response: 0x%08x %s", rsp.CommandId, rsp.Seq)
+	}
+	var r SgipRespPkt
+	r.Unpack(rsp.Body)
+	return r.Result
+}
+
+func newTestSGIPClient(t *testing.T, addr, password string) *SGIPClient {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(addr)
+	c := NewSGIPClient(&Config{
+		SGIPHost:           host,
+		SGIPPort:           port,
+		SGIPUser:           "gateway",
+		SGIPPassword:       password,
+		SGIPNodeId:         3010099999,
+		SGIPCorpId:         "99999",
+		SGIPListenAddr:     "127.0.0.1:0",
+		SGIPListenUser:     "smg",
+		SGIPListenPassword: "smgsecret",
+		SmsAccessNo:        "10655",
+		ServiceId:          "TEST",
+	})
+	t.Cleanup(c.Stop)
+	return c
+}
+
+func TestSgipSubmitPktRoundTrip(t *testing.T) {
+	coding, content := encodeMsgContent("验证码 123456")
+	p := &SgipSubmitPkt{
+		SPNumber: "1065501", UserNumber: []string{"8613000000000", "8615600000000"},
+		CorpId: "99999", ServiceType: "TEST", ReportFlag: 1, MessageCoding: coding, MessageContent: content,
+	}
+	body, err := p.Pack()
+	if err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+	var got SgipSubmitPkt
+	if err := got.Unpack(body); err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	if got.SPNumber != "1065501" || len(got.UserNumber) != 2 || got.UserNumber[1] != "8615600000000" ||
+		got.CorpId != "99999" || got.ReportFlag != 1 || decodeMsgContent(got.MessageCoding, got.MessageContent) != "验证码 123456" {
+		t.Errorf("Submit fields mismatch: %+v", got)
+	}
+
+	if _, err := (&SgipSubmitPkt{UserNumber: []string{"1"}, MessageContent: make([]byte, 161)}).Pack(); err == nil {
+		t.Error("Expected error for content over 160 bytes")
+	}
+	if s := (SgipSeq{Node: 3010099999, Time: 102150405, Seq: 7}).String(); s != "301009999901021504050000000007" {
+		t.Errorf("Unexpected sequence string: %s", s)
+	}
+}
+
+func TestSGIPClientSubmitAndReport(t *testing.T) {
+	newTestBoltCache(t)
+	smg, addr := startFakeSMG(t, "secret")
+	c := newTestSGIPClient(t, addr, "secret")
+	c.Start()
+	if !c.IsReady() {
+		t.Fatal("Client should be ready after bind")
+	}
+
+	mes := SmsMes{Src: "01", Dest: "13000000000", Content: "你好", SubmitResult: 65535, DelivleryResult: 65535}
+	if err := c.Submit(&mes); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	waitFor(t, "submit response", func() bool { return SCache.Length("list_message") == 1 })
+
+	smg.mu.Lock()
+	sub, seq := smg.submits[0], smg.seqs[0]
+	smg.mu.Unlock()
+	if sub.SPNumber != "1065501" || sub.UserNumber[0] != "8613000000000" || sub.ReportFlag != 1 || seq.Node != 3010099999 {
+		t.Errorf("Unexpected submit: %+v seq=%s", sub, seq)
+	}
+	stored := (*SCache.GetList("list_message", 0, 1))[0]
+	if stored.MsgId != seq.String() || stored.SubmitResult != 0 || stored.Channel != ChannelSGIP {
+		t.Errorf("Unexpected stored message: %+v", stored)
+	}
+
+	// SMG 另行连接网关推送状态报告
+	conn, err := dialGateway(t, c.ListenAddr(), "smg", "smgsecret")
+	if err != nil {
+		t.Fatalf("SMG bind to gateway failed: %v", err)
+	}
+	waiting := &SgipReportPkt{SubmitSeq: seq, UserNumber: "8613000000000", State: SgipStateWaiting}
+	if r := request(t, conn, SgipReport, waiting.Pack()); r != 0 {
+		t.Fatalf("Report rejected: %d", r)
+	}
+	report := &SgipReportPkt{SubmitSeq: seq, UserNumber: "8613000000000", State: SgipStateFailed, ErrorCode: 6}
+	if r := request(t, conn, SgipReport, report.Pack()); r != 0 {
+		t.Fatalf("Report rejected: %d", r)
+	}
+	waitFor(t, "report applied", func() bool {
+		return (*SCache.GetList("list_message", 0, 1))[0].DeliveryStat == "UNDELIV"
+	})
+}
+
+func TestSGIPListenerReceivesMO(t *testing.T) {
+	newTestBoltCache(t)
+	_, addr := startFakeSMG(t, "secret")
+	c := newTestSGIPClient(t, addr, "secret")
+	c.Start()
+
+	conn, err := dialGateway(t, c.ListenAddr(), "smg", "smgsecret")
+	if err != nil {
+		t.Fatalf("SMG bind to gateway failed: %v", err)
+	}
+	deliver := &SgipDeliverPkt{
+		UserNumber:     "8613000000000",
+		SPNumber:       "10655",
+		MessageCoding:  SgipCodingGBK,
+		MessageContent: []byte{0xBB, 0xD8, 0xB8, 0xB4}, // "回复"
+	}
+	if r := request(t, conn, SgipDeliver, deliver.Pack()); r != 0 {
+		t.Fatalf("Deliver rejected: %d", r)
+	}
+	waitFor(t, "MO stored", func() bool { return SCache.Length("list_mo") == 1 })
+
+	mo := (*SCache.GetList("list_mo", 0, 1))[0]
+	if mo.Src != "13000000000" || mo.Dest != "10655" || mo.Content != "回复" || mo.Channel != ChannelSGIP {
+		t.Errorf("Unexpected MO: %+v", mo)
+	}
+
+	if _, err := conn.SendReq(SgipUnbind, nil); err != nil {
+		t.Fatalf("Unbind failed: %v", err)
+	}
+	if rsp, err := conn.Recv(time.Second); err != nil || rsp.CommandId != SgipUnbindResp {
+		t.Errorf("Expected unbind response, got %+v %v", rsp, err)
+	}
+}
+
+func TestSGIPListenerRejectsBadLogin(t *testing.T) {
+	_, addr := startFakeSMG(t, "secret")
+	c := newTestSGIPClient(t, addr, "secret")
+	c.Start()
+
+	if _, err := dialGateway(t, c.ListenAddr(), "smg", "wrong"); err == nil {
+		t.Error("Expected bind with wrong password to be rejected")
+	}
+}
+
+func TestSGIPClientBindRejected(t *testing.T) {
+	_, addr := startFakeSMG(t, "secret")
+	c := newTestSGIPClient(t, addr, "wrong")
+	if err := c.Connect(); err == nil {
+		t.Fatal("Expected bind to fail with wrong password")
+	}
+	if c.IsReady() {
+		t.Error("Client must not be ready after failed bind")
+	}
+}
@@ -0,0 +1,210 @@
+package gateway
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// sgipListener 接受 SMG 主动建立的连接（LoginType=2），接收上行短信与状态报告
+type sgipListener struct {
+	addr     string
+	user     string
+	password string
+	node     uint32
+	pipeline *messagePipeline
+
+	ln    net.Listener
+	mu    sync.Mutex
+	conns map[*sgipConn]struct{}
+
+	shutdown chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+func newSGIPListener(cfg *Config, pipeline *messagePipeline) *sgipListener {
+	return &sgipListener{
+		addr:     cfg.SGIPListenAddr,
+		user:     cfg.SGIPListenUser,
+		password: cfg.SGIPListenPassword,
+		node:     cfg.SGIPNodeId,
+		pipeline: pipeline,
+		conns:    make(map[*sgipConn]struct{}),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Start 开始监听并在后台接受连接
+func (l *sgipListener) Start() error {
+	ln, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.ln = ln
+	l.mu.Unlock()
+	Infof("[SGIP][LISTEN] Accepting SMG connections on %s", ln.Addr())
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		for {
+			netConn, err := ln.Accept()
+			if err != nil {
+				select {
+				case <-l.shutdown:
+				default:
+					Errorf("[SGIP][LISTEN] Accept failed: %v", err)
+				}
+				return
+			}
+			conn := newSGIPConn(netConn, l.node)
+			l.mu.Lock()
+			l.conns[conn] = struct{}{}
+			l.mu.Unlock()
+
+			l.wg.Add(1)
+			go func() {
+				defer l.wg.Done()
+				l.serve(conn)
+				l.mu.Lock()
+				delete(l.conns, conn)
+				l.mu.Unlock()
+			}()
+		}
+	}()
+	return nil
+}
+
+// Addr 返回实际监听地址
+func (l *sgipListener) Addr() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ln == nil {
+		return ""
+	}
+	return l.ln.Addr().String()
+}
+
+// serve 处理一条 SMG 连接：先完成 Bind，再接收 Deliver/Report 直到 Unbind
+func (l *sgipListener) serve(conn *sgipConn) {
+	defer conn.Close()
+	remote := conn.conn.RemoteAddr()
+
+	pdu, err := conn.Recv(defaultConnectTimeout)
+	if err != nil || pdu.CommandId != SgipBind {
+		Warnf("[SGIP][LISTEN] Expected bind from %s, closing: %v", remote, err)
+		return
+	}
+	var bind SgipBindPkt
+	var result uint8
+	if err := bind.Unpack(pdu.Body); err != nil {
+		result = 4 // 消息结构错
+	} else if bind.LoginType != SgipLoginSMGToSP {
+		result = 2 // 重复登录或登录类型错
+	} else if l.user != "" && (bind.LoginName != l.user || bind.LoginPassword != l.password) {
+		result = 1 // 非法登录
+	}
+	conn.respond(pdu, result)
+	if result != 0 {
+		Warnf("[SGIP][LISTEN] Rejected bind from %s: login_type=%d name=%s result=%d", remote, bind.LoginType, bind.LoginName, result)
+		return
+	}
+	Infof("[SGIP][LISTEN] SMG bound from %s, name=%s", remote, bind.LoginName)
+
+	for {
+		select {
+		case <-l.shutdown:
+			return
+		default:
+		}
+
+		pdu, err := conn.Recv(defaultReceiveTimeout)
+		if err != nil {
+			if errors.Is(err, errSgipReadTimeout) {
+				continue
+			}
+			Infof("[SGIP][LISTEN] Connection from %s closed: %v", remote, err)
+			return
+		}
+
+		switch pdu.CommandId {
+		case SgipDeliver:
+			l.handleDeliver(conn, pdu)
+		case SgipReport:
+			l.handleReport(conn, pdu)
+		case SgipUnbind:
+			conn.Send(&SgipPDU{CommandId: SgipUnbindResp, Seq: pdu.Seq})
+			Infof("[SGIP][LISTEN] SMG %s unbound", remote)
+			return
+		default:
+			if pdu.CommandId&0x80000000 == 0 {
+				conn.respond(pdu, 0)
+			}
+			Debugf("[SGIP][LISTEN] Ignoring command 0x%08x", pdu.CommandId)
+		}
+	}
+}
+
+// handleDeliver 保存上行短信
+func (l *sgipListener) handleDeliver(conn *sgipConn, pdu *SgipPDU) {
+	var p SgipDeliverPkt
+	if err := p.Unpack(pdu.Body); err != nil {
+		conn.respond(pdu, 4)
+		Warnf("[SGIP][DELIVER] Failed to unpack deliver: %v", err)
+		return
+	}
+	conn.respond(pdu, 0)
+
+	Infof("[SGIP][DELIVER] Received MO: Src=%s Dest=%s", p.UserNumber, p.SPNumber)
+	l.pipeline.moReceived(SmsMes{
+		MsgId:   pdu.Seq.String(),
+		Src:     trimSgipUserNumber(p.UserNumber),
+		Dest:    p.SPNumber,
+		Content: p.Text(),
+	})
+}
+
+// handleReport 处理状态报告，等待发送的中间状态只记录日志
+func (l *sgipListener) handleReport(conn *sgipConn, pdu *SgipPDU) {
+	var p SgipReportPkt
+	if err := p.Unpack(pdu.Body); err != nil {
+		conn.respond(pdu, 4)
+		Warnf("[SGIP][RECEIPT] Failed to unpack report: %v", err)
+		return
+	}
+	conn.respond(pdu, 0)
+
+	msgId := p.SubmitSeq.String()
+	if p.State == SgipStateWaiting {
+		Debugf("[SGIP][RECEIPT] Message %s still waiting for delivery", msgId)
+		return
+	}
+	Infof("[SGIP][RECEIPT] Received report: MsgId=%s State=%d ErrorCode=%d Dest=%s", msgId, p.State, p.ErrorCode, p.UserNumber)
+	l.pipeline.receiptReceived(SmsMes{
+		MsgId:           msgId,
+		Dest:            trimSgipUserNumber(p.UserNumber),
+		Created:         time.Now(),
+		SubmitResult:    65535,
+		DelivleryResult: deliveryResultFromStat(p.Stat()),
+		DeliveryStat:    p.Stat(),
+	})
+}
+
+// Stop 关闭监听与所有 SMG 连接，并等待处理协程退出
+func (l *sgipListener) Stop() {
+	l.once.Do(func() {
+		close(l.shutdown)
+		l.mu.Lock()
+		if l.ln != nil {
+			l.ln.Close()
+		}
+		for conn := range l.conns {
+			conn.Close()
+		}
+		l.mu.Unlock()
+		l.wg.Wait()
+	})
+}
@@ -0,0 +1,340 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SGIP 1.2 的 Command ID
+const (
+	SgipBind        uint32 = 0x00000001
+	SgipBindResp    uint32 = 0x80000001
+	SgipUnbind      uint32 = 0x00000002
+	SgipUnbindResp  uint32 = 0x80000002
+	SgipSubmit      uint32 = 0x00000003
+	SgipSubmitResp  uint32 = 0x80000003
+	SgipDeliver     uint32 = 0x00000004
+	SgipDeliverResp uint32 = 0x80000004
+	SgipReport      uint32 = 0x00000005
+	SgipReportResp  uint32 = 0x80000005
+	SgipTrace       uint32 = 0x00001000
+	SgipTraceResp   uint32 = 0x80001000
+)
+
+// Bind 的登录类型
+const (
+	SgipLoginSPToSMG uint8 = 1 // SP 向 SMG 建立的连接，用于发送 Submit
+	SgipLoginSMGToSP uint8 = 2 // SMG 向 SP 建立的连接，用于发送 Deliver 和 Report
+)
+
+// 短消息编码
+const (
+	SgipCodingASCII uint8 = 0
+	SgipCodingUCS2  uint8 = 8
+	SgipCodingGBK   uint8 = 15
+)
+
+// Report 的 State
+const (
+	SgipStateDelivered uint8 = 0 // 发送成功
+	SgipStateWaiting   uint8 = 1 // 等待发送
+	SgipStateFailed    uint8 = 2 // 发送失败
+)
+
+const (
+	// 消息头：长度(4) + 命令(4) + 序列号(12)
+	sgipHeaderLen = 20
+	// 超过该长度的包视为非法
+	sgipMaxPacketLen = 4096
+	// MessageContent 的最大长度
+	sgipMaxContent = 160
+)
+
+var errSgipMalformed = errors.New("malformed sgip packet")
+
+// SgipSeq 是 SGIP 的 12 字节序列号：源节点编号 + 时间(MMDDhhmmss) + 序列号
+//
+// Submit 的序列号同时作为消息标识，状态报告以 SubmitSequenceNumber 引用原消息
+type SgipSeq struct {
+	Node uint32
+	Time uint32
+	Seq  uint32
+}
+
+// String 格式化为 30 位数字，作为 MsgId 保存
+func (s SgipSeq) String() string {
+	return fmt.Sprintf("%010d%010d%010d", s.Node, s.Time, s.Seq)
+}
+
+func (s SgipSeq) write(buf *bytes.Buffer) {
+	binary.Write(buf, binary.BigEndian, s.Node)
+	binary.Write(buf, binary.BigEndian, s.Time)
+	binary.Write(buf, binary.BigEndian, s.Seq)
+}
+
+func readSgipSeq(b []byte) SgipSeq {
+	return SgipSeq{
+		Node: binary.BigEndian.Uint32(b[0:4]),
+		Time: binary.BigEndian.Uint32(b[4:8]),
+		Seq:  binary.BigEndian.Uint32(b[8:12]),
+	}
+}
+
+// sgipTimestamp 返回序列号中使用的 MMDDhhmmss 时间
+func sgipTimestamp(t time.Time) uint32 {
+	v, _ := strconv.ParseUint(t.Format("0102150405"), 10, 32)
+	return uint32(v)
+}
+
+// SgipPDU 是一个完整的 SGIP 包，Body 为消息头之后的内容
+type SgipPDU struct {
+	CommandId uint32
+	Seq       SgipSeq
+	Body      []byte
+}
+
+// Bytes 编码为可直接写出的字节序列
+func (p *SgipPDU) Bytes() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, sgipHeaderLen+len(p.Body)))
+	binary.Write(buf, binary.BigEndian, uint32(sgipHeaderLen+len(p.Body)))
+	binary.Write(buf, binary.BigEndian, p.CommandId)
+	p.Seq.write(buf)
+	buf.Write(p.Body)
+	return buf.Bytes()
+}
+
+// SgipBindPkt 是 Bind 请求
+type SgipBindPkt struct {
+	LoginType     uint8
+	LoginName     string
+	LoginPassword string
+}
+
+func (p *SgipBindPkt) Pack() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 41))
+	buf.WriteByte(p.LoginType)
+	writeFixedString(buf, p.LoginName, 16)
+	writeFixedString(buf, p.LoginPassword, 16)
+	writeFixedString(buf, "", 8)
+	return buf.Bytes()
+}
+
+func (p *SgipBindPkt) Unpack(b []byte) error {
+	if len(b) < 33 {
+		return errSgipMalformed
+	}
+	p.LoginType = b[0]
+	p.LoginName = readFixedString(b[1:17])
+	p.LoginPassword = readFixedString(b[17:33])
+	return nil
+}
+
+// SgipRespPkt 是各类响应（Bind_Resp、Submit_Resp、Deliver_Resp、Report_Resp）的包体
+type SgipRespPkt struct {
+	Result uint8
+}
+
+func (p *SgipRespPkt) Pack() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 9))
+	buf.WriteByte(p.Result)
+	writeFixedString(buf, "", 8)
+	return buf.Bytes()
+}
+
+func (p *SgipRespPkt) Unpack(b []byte) error {
+	if len(b) < 1 {
+		return errSgipMalformed
+	}
+	p.Result = b[0]
+	return nil
+}
+
+// SgipSubmitPkt 是 Submit 请求
+type SgipSubmitPkt struct {
+	SPNumber         string
+	ChargeNumber     string
+	UserNumber       []string
+	CorpId           string
+	ServiceType      string
+	FeeType          uint8
+	FeeValue         string
+	GivenValue       string
+	AgentFlag        uint8
+	MorelatetoMTFlag uint8
+	Priority         uint8
+	ExpireTime       string
+	ScheduleTime     string
+	ReportFlag       uint8
+	TpPid            uint8
+	TpUdhi           uint8
+	MessageCoding    uint8
+	MessageType      uint8
+	MessageContent   []byte
+}
+
+func (p *SgipSubmitPkt) Pack() ([]byte, error) {
+	if len(p.UserNumber) == 0 || len(p.UserNumber) > 100 {
+		return nil, fmt.Errorf("sgip invalid user number count: %d", len(p.UserNumber))
+	}
+	if len(p.MessageContent) > sgipMaxContent {
+		return nil, fmt.Errorf("sgip message content too long: %d bytes", len(p.MessageContent))
+	}
+	buf := new(bytes.Buffer)
+	writeFixedString(buf, p.SPNumber, 21)
+	writeFixedString(buf, p.ChargeNumber, 21)
+	buf.WriteByte(uint8(len(p.UserNumber)))
+	for _, n := range p.UserNumber {
+		writeFixedString(buf, n, 21)
+	}
+	writeFixedString(buf, p.CorpId, 5)
+	writeFixedString(buf, p.ServiceType, 10)
+	buf.WriteByte(p.FeeType)
+	writeFixedString(buf, p.FeeValue, 6)
+	writeFixedString(buf, p.GivenValue, 6)
+	buf.WriteByte(p.AgentFlag)
+	buf.WriteByte(p.MorelatetoMTFlag)
+	buf.WriteByte(p.Priority)
+	writeFixedString(buf, p.ExpireTime, 16)
+	writeFixedString(buf, p.ScheduleTime, 16)
+	buf.WriteByte(p.ReportFlag)
+	buf.WriteByte(p.TpPid)
+	buf.WriteByte(p.TpUdhi)
+	buf.WriteByte(p.MessageCoding)
+	buf.WriteByte(p.MessageType)
+	binary.Write(buf, binary.BigEndian, uint32(len(p.MessageContent)))
+	buf.Write(p.MessageContent)
+	writeFixedString(buf, "", 8)
+	return buf.Bytes(), nil
+}
+
+func (p *SgipSubmitPkt) Unpack(b []byte) error {
+	if len(b) < 43 {
+		return errSgipMalformed
+	}
+	p.SPNumber = readFixedString(b[0:21])
+	p.ChargeNumber = readFixedString(b[21:42])
+	count := int(b[42])
+	b = b[43:]
+	if len(b) < 21*count+72 {
+		return errSgipMalformed
+	}
+	p.UserNumber = make([]string, count)
+	for i := range p.UserNumber {
+		p.UserNumber[i] = readFixedString(b[i*21 : (i+1)*21])
+	}
+	b = b[21*count:]
+	p.CorpId = readFixedString(b[0:5])
+	p.ServiceType = readFixedString(b[5:15])
+	p.FeeType = b[15]
+	p.FeeValue = readFixedString(b[16:22])
+	p.GivenValue = readFixedString(b[22:28])
+	p.AgentFlag = b[28]
+	p.MorelatetoMTFlag = b[29]
+	p.Priority = b[30]
+	p.ExpireTime = readFixedString(b[31:47])
+	p.ScheduleTime = readFixedString(b[47:63])
+	p.ReportFlag = b[63]
+	p.TpPid = b[64]
+	p.TpUdhi = b[65]
+	p.MessageCoding = b[66]
+	p.MessageType = b[67]
+	n := int(binary.BigEndian.Uint32(b[68:72]))
+	if n < 0 || len(b) < 72+n {
+		return errSgipMalformed
+	}
+	p.MessageContent = append([]byte(nil), b[72:72+n]...)
+	return nil
+}
+
+// SgipDeliverPkt 是 SMG 发给 SP 的上行短信
+type SgipDeliverPkt struct {
+	UserNumber     string
+	SPNumber       string
+	TpPid          uint8
+	TpUdhi         uint8
+	MessageCoding  uint8
+	MessageContent []byte
+}
+
+func (p *SgipDeliverPkt) Pack() []byte {
+	buf := new(bytes.Buffer)
+	writeFixedString(buf, p.UserNumber, 21)
+	writeFixedString(buf, p.SPNumber, 21)
+	buf.WriteByte(p.TpPid)
+	buf.WriteByte(p.TpUdhi)
+	buf.WriteByte(p.MessageCoding)
+	binary.Write(buf, binary.BigEndian, uint32(len(p.MessageContent)))
+	buf.Write(p.MessageContent)
+	writeFixedString(buf, "", 8)
+	return buf.Bytes()
+}
+
+func (p *SgipDeliverPkt) Unpack(b []byte) error {
+	if len(b) < 49 {
+		return errSgipMalformed
+	}
+	p.UserNumber = readFixedString(b[0:21])
+	p.SPNumber = readFixedString(b[21:42])
+	p.TpPid = b[42]
+	p.TpUdhi = b[43]
+	p.MessageCoding = b[44]
+	n := int(binary.BigEndian.Uint32(b[45:49]))
+	if n < 0 || len(b) < 49+n {
+		return errSgipMalformed
+	}
+	p.MessageContent = append([]byte(nil), b[49:49+n]...)
+	return nil
+}
+
+// Text 按编码解码为 UTF-8
+func (p *SgipDeliverPkt) Text() string {
+	return decodeMsgContent(p.MessageCoding, p.MessageContent)
+}
+
+// SgipReportPkt 是 SMG 发给 SP 的状态报告
+type SgipReportPkt struct {
+	SubmitSeq  SgipSeq
+	ReportType uint8 // 0 表示对先前 Submit 的报告
+	UserNumber string
+	State      uint8
+	ErrorCode  uint8
+}
+
+func (p *SgipReportPkt) Pack() []byte {
+	buf := new(bytes.Buffer)
+	p.SubmitSeq.write(buf)
+	buf.WriteByte(p.ReportType)
+	writeFixedString(buf, p.UserNumber, 21)
+	buf.WriteByte(p.State)
+	buf.WriteByte(p.ErrorCode)
+	writeFixedString(buf, "", 8)
+	return buf.Bytes()
+}
+
+func (p *SgipReportPkt) Unpack(b []byte) error {
+	if len(b) < 36 {
+		return errSgipMalformed
+	}
+	p.SubmitSeq = readSgipSeq(b[0:12])
+	p.ReportType = b[12]
+	p.UserNumber = readFixedString(b[13:34])
+	p.State = b[34]
+	p.ErrorCode = b[35]
+	return nil
+}
+
+// Stat 将 State 转换为与 CMPP 状态报告一致的状态字符串
+func (p *SgipReportPkt) Stat() string {
+	switch p.State {
+	case SgipStateDelivered:
+		return "DELIVRD"
+	case SgipStateWaiting:
+		return "ENROUTE"
+	default:
+		return "UNDELIV"
+	}
+}
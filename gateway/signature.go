@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 默认允许的签名时间偏差
+const defaultSignatureMaxSkew = 300 * time.Second
+
+// signatureMaxSkew 返回签名时间戳允许的偏差
+func signatureMaxSkew() time.Duration {
+	if config != nil && config.SignatureMaxSkew > 0 {
+		return time.Duration(config.SignatureMaxSkew) * time.Second
+	}
+	return defaultSignatureMaxSkew
+}
+
+// signingString 拼接待签名的字符串：方法、路径（含查询参数）、时间戳、随机数、请求体，以换行分隔
+func signingString(method, uri, timestamp, nonce string, body []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(method)
+	buf.WriteByte('\n')
+	buf.WriteString(uri)
+	buf.WriteByte('\n')
+	buf.WriteString(timestamp)
+	buf.WriteByte('\n')
+	buf.WriteString(nonce)
+	buf.WriteByte('\n')
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// SignRequest 计算请求签名（小写十六进制的 HMAC-SHA256），供调用方与测试使用
+func SignRequest(secret, method, uri, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(signingString(method, uri, timestamp, nonce, body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validNonce 限制随机数为 8-64 位字母、数字、- 或 _，避免占用过多存储
+func validNonce(nonce string) bool {
+	if len(nonce) < 8 || len(nonce) > 64 {
+		return false
+	}
+	for _, ch := range nonce {
+		if !(ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '-' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// requireSignature 校验配置了 secret 的客户端的请求签名，需放在 requireAPIClient 之后
+//
+// 请求头: X-Timestamp（Unix 秒）、X-Nonce、X-Signature；
+// 时间戳超出允许偏差或随机数在有效期内重复使用时拒绝请求
+func requireSignature(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := clientFromRequest(r)
+		if client == nil || client.Secret == "" {
+			next(w, r)
+			return
+		}
+
+		timestamp := r.Header.Get("X-Timestamp")
+		nonce := r.Header.Get("X-Nonce")
+		signature := r.Header.Get("X-Signature")
+		if timestamp == "" || nonce == "" || signature == "" {
+			writeAPIError(w, http.StatusUnauthorized, "signature_required", "", "缺少 X-Timestamp、X-Nonce 或 X-Signature 请求头")
+			return
+		}
+		if !validNonce(nonce) {
+			writeAPIError(w, http.StatusUnauthorized, "invalid_signature", "", "X-Nonce 应为 8-64 位字母、数字、- 或 _")
+			return
+		}
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusUnauthorized, "invalid_signature", "", "X-Timestamp 应为 Unix 秒")
+			return
+		}
+		skew := signatureMaxSkew()
+		if d := time.Since(time.Unix(ts, 0)); d > skew || d < -skew {
+			Warnf("[HTTP] Client %s request expired: timestamp %s", client.Name, timestamp)
+			writeAPIError(w, http.StatusUnauthorized, "request_expired", "", "请求时间戳超出允许范围")
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, apiMaxBodySize+1))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid_body", "", "读取请求体失败")
+			return
+		}
+		if len(body) > apiMaxBodySize {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, "body_too_large", "", "请求体过大")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		expected := SignRequest(client.Secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+		if !hmac.Equal([]byte(expected), []byte(signature)) {
+			Warnf("[HTTP] Client %s invalid signature from %s", client.Name, r.RemoteAddr)
+			writeAPIError(w, http.StatusUnauthorized, "invalid_signature", "", "签名校验失败")
+			return
+		}
+
+		// 签名通过后再登记随机数，伪造的请求无法占用合法随机数
+		// 时间戳在 ±skew 内有效，随机数至少保留 2*skew
+		ok, err := SCache.ReserveNonce(client.Name+":"+nonce, 2*skew)
+		if err != nil {
+			Errorf("[HTTP] Reserve nonce failed: %v", err)
+			writeAPIError(w, http.StatusServiceUnavailable, "service_unavailable", "", "存储不可用，请稍后重试")
+			return
+		}
+		if !ok {
+			Warnf("[HTTP] Client %s replayed nonce %s from %s", client.Name, nonce, r.RemoteAddr)
+			writeAPIError(w, http.StatusUnauthorized, "replayed_request", "", "请求已被处理过（X-Nonce 重复）")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequireSignature(t *testing.T) {
+	newTestBoltCache(t)
+	withAPIClients(t,
+		APIClient{Name: "partner", Key: "partner-key", Secret: "s3cret"},
+		APIClient{Name: "internal", Key: "internal-key"},
+	)
+	var gotBody string
+	h := requireAPIClient(requireSignature(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(key, body string, header func(ts, nonce string) map[string]string, ts time.Time, nonce string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/submit?src=01", strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		for k, v := range header(strconv.FormatInt(ts.Unix(), 10), nonce) {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+	signed := func(body string) func(ts, nonce string) map[string]string {
+		return func(ts, nonce string) map[string]string {
+			return map[string]string{
+				"X-Timestamp": ts,
+				"X-Nonce":     nonce,
+				"X-Signature": SignRequest("s3cret", "POST", "/submit?src=01", ts, nonce, []byte(body)),
+			}
+		}
+	}
+	none := func(ts, nonce string) map[string]string { return nil }
+
+	body := "dest=13800000000&cont=hello"
+	now := time.Now()
+	if rec := send("partner-key", body, signed(body), now, "nonce-0001"); rec.Code != http.StatusOK || gotBody != body {
+		t.Fatalf("Expected signed request to pass with body intact, got %d %q", rec.Code, gotBody)
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		header func(ts, nonce string) map[string]string
+		ts     time.Time
+		nonce  string
+		want   int
+		code   string
+	}{
+		{"replayed nonce", "partner-key", signed(body), now, "nonce-0001", http.StatusUnauthorized, "replayed_request"},
+		{"missing headers", "partner-key", none, now, "nonce-0002", http.StatusUnauthorized, "signature_required"},
+		{"tampered body", "partner-key", signed("dest=13900000000&cont=hello"), now, "nonce-0003", http.StatusUnauthorized, "invalid_signature"},
+		{"expired", "partner-key", signed(body), now.Add(-10 * time.Minute), "nonce-0004", http.StatusUnauthorized, "request_expired"},
+		{"future", "partner-key", signed(body), now.Add(10 * time.Minute), "nonce-0005", http.StatusUnauthorized, "request_expired"},
+		{"short nonce", "partner-key", signed(body), now, "abc", http.StatusUnauthorized, "invalid_signature"},
+		{"client without secret", "internal-key", none, now, "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		rec := send(tt.key, body, tt.header, tt.ts, tt.nonce)
+		if rec.Code != tt.want || !strings.Contains(rec.Body.String(), tt.code) {
+			t.Errorf("%s: got %d %s, want %d %s", tt.name, rec.Code, rec.Body.String(), tt.want, tt.code)
+		}
+	}
+
+	// 伪造请求不会占用随机数
+	if rec := send("partner-key", body, signed(body), now, "nonce-0003"); rec.Code != http.StatusOK {
+		t.Errorf("Expected nonce of rejected request to stay usable, got %d", rec.Code)
+	}
+}
+
+func TestBoltCacheReserveNonce(t *testing.T) {
+	c := newTestBoltCache(t)
+	if ok, err := c.ReserveNonce("a:1", time.Hour); !ok || err != nil {
+		t.Fatalf("First reserve = %v %v", ok, err)
+	}
+	if ok, _ := c.ReserveNonce("a:1", time.Hour); ok {
+		t.Error("Expected duplicate nonce to be rejected")
+	}
+	if ok, _ := c.ReserveNonce("b:1", -time.Second); !ok {
+		t.Error("Expected different nonce to be accepted")
+	}
+	if ok, _ := c.ReserveNonce("b:1", time.Hour); !ok {
+		t.Error("Expected expired nonce to be reusable")
+	}
+}
@@ -0,0 +1,368 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cmpp "github.com/bigwhite/gocmpp"
+)
+
+// SMGP 的 SrcTermID 最长 21 字节
+const smgpMaxSrcTermId = 21
+
+// newSMGPConn 创建 SMGP 3.0 连接，消息头布局与 CMPP 相同，只替换包类型
+func newSMGPConn(conn net.Conn) *cmppConn {
+	c := newCMPPConn(conn)
+	c.newPacket = NewSMGPPacket
+	c.maxLen = SmgpPacketMax
+	return c
+}
+
+// smgpLogin 发送 Login 并校验响应
+func smgpLogin(c *cmppConn, clientId, password string, timeout time.Duration) error {
+	seq, err := c.SendReqPkt(&SmgpLoginReqPkt{
+		ClientID:  clientId,
+		Secret:    password,
+		LoginMode: SmgpLoginModeTransmit,
+	})
+	if err != nil {
+		return err
+	}
+	pkt, err := c.RecvAndUnpackPkt(timeout)
+	if err != nil {
+		return err
+	}
+	rsp, ok := pkt.(*SmgpLoginRspPkt)
+	if !ok || rsp.SeqId != seq {
+		return cmpp.ErrRespNotMatch
+	}
+	if rsp.Status != 0 {
+		return fmt.Errorf("login rejected, status=%d", rsp.Status)
+	}
+	return nil
+}
+
+// SMGPClient 是 SMGP 3.0 上游通道（中国电信），以收发模式登录
+type SMGPClient struct {
+	config *Config
+
+	conn *cmppConn // 需要加锁保护
+	mu   sync.RWMutex
+
+	ready atomic.Bool
+
+	// 连接代次，与 SequenceID 共同作为提交响应的关联键
+	generation atomic.Uint64
+
+	pipeline *messagePipeline
+
+	// 退出信号
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	wg           sync.WaitGroup
+}
+
+// NewSMGPClient 创建 SMGP 通道
+func NewSMGPClient(cfg *Config) *SMGPClient {
+	c := &SMGPClient{
+		config:   cfg,
+		pipeline: newMessagePipeline(ChannelSMGP),
+		shutdown: make(chan struct{}),
+	}
+	c.generation.Store(uint64(time.Now().UnixNano()))
+	return c
+}
+
+// Name 返回通道类型
+func (c *SMGPClient) Name() string {
+	return ChannelSMGP
+}
+
+// SetHandler 设置接收处理结果与连接状态的回调，需在 Start 之前调用
+func (c *SMGPClient) SetHandler(h ChannelHandler) {
+	c.pipeline.setHandler(h)
+}
+
+// SubmitFailed 记录未能提交的消息
+func (c *SMGPClient) SubmitFailed(mes *SmsMes) {
+	c.pipeline.submitFailed(mes)
+}
+
+// IsReady 检查连接是否就绪
+func (c *SMGPClient) IsReady() bool {
+	return c.ready.Load()
+}
+
+// Generation 返回当前连接代次
+func (c *SMGPClient) Generation() uint64 {
+	return c.generation.Load()
+}
+
+// Start 建立初始连接并启动心跳（Active_Test）与状态报告清理协程
+func (c *SMGPClient) Start() {
+	if err := c.Connect(); err != nil {
+		Errorf("[SMGP] Initial connection failed: %v", err)
+		// 由心跳协程尝试重连
+	}
+
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		c.heartbeatLoop()
+	}()
+	go func() {
+		defer c.wg.Done()
+		c.pipeline.runReceiptSweeper(c.shutdown)
+	}()
+}
+
+// Connect 建立连接并完成 Login，成功后启动该连接的接收协程
+func (c *SMGPClient) Connect() error {
+	addr := net.JoinHostPort(c.config.SMGPHost, c.config.SMGPPort)
+	netConn, err := net.DialTimeout("tcp", addr, defaultConnectTimeout)
+	if err != nil {
+		c.pipeline.setReady(&c.ready, false)
+		return fmt.Errorf("failed to connect to SMGW: %w", err)
+	}
+	conn := newSMGPConn(netConn)
+	if err := smgpLogin(conn, c.config.SMGPClientId, c.config.SMGPPassword, defaultConnectTimeout); err != nil {
+		conn.Close()
+		c.pipeline.setReady(&c.ready, false)
+		return fmt.Errorf("failed to login to SMGW: %w", err)
+	}
+
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = conn
+	gen := c.generation.Add(1)
+	c.pipeline.setReady(&c.ready, true)
+	c.mu.Unlock()
+	Infof("[SMGP] Login successful, addr=%s client_id=%s generation=%d", addr, c.config.SMGPClientId, gen)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.receiveLoop(conn, gen)
+	}()
+
+	c.pipeline.resolveStalePending(gen)
+	return nil
+}
+
+// current 返回当前连接及其代次
+func (c *SMGPClient) current() (*cmppConn, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn, c.generation.Load()
+}
+
+// Submit 构建 Submit 并发送
+// 网关的响应可能非常快，因此先登记等待响应再写出请求
+func (c *SMGPClient) Submit(mes *SmsMes) error {
+	source := c.config.SMGPSrcTermId
+	if source == "" {
+		source = c.config.SmsAccessNo
+	}
+	srcId := buildSrcId(source, mes.Src)
+	if len(srcId) > smgpMaxSrcTermId {
+		return fmt.Errorf("%w: %s (len=%d, max %d)", errSrcIdTooLong, srcId, len(srcId), smgpMaxSrcTermId)
+	}
+	serviceId := c.config.SMGPServiceId
+	if serviceId == "" {
+		serviceId = c.config.ServiceId
+	}
+
+	conn, gen := c.current()
+	if !c.IsReady() || conn == nil {
+		return fmt.Errorf("SMGP client not ready")
+	}
+
+	format, content := encodeMsgContent(mes.Content)
+	if len(content) > 255 {
+		return fmt.Errorf("message content too long for SMGP: %d bytes", len(content))
+	}
+	p := &SmgpSubmitReqPkt{
+		MsgType:    6, // MT 消息
+		NeedReport: 1, // 需要状态报告
+		Priority:   1,
+		ServiceID:  serviceId,
+		FeeType:    "00", // 免费
+		FeeCode:    "000000",
+		FixedFee:   "000000",
+		MsgFormat:  format,
+		SrcTermID:  srcId,
+		DestTermID: []string{mes.Dest},
+		MsgContent: content,
+	}
+
+	seq := conn.seq.Add(1)
+	if err := c.pipeline.addPending(gen, seq, mes); err != nil {
+		return err
+	}
+	if err := conn.SendRspPkt(p, seq); err != nil {
+		// 未发出的消息撤销登记，由调用者记录为发送失败
+		c.pipeline.removePending(gen, seq)
+		c.pipeline.setReady(&c.ready, false)
+		return err
+	}
+	Infof("[SEND] Sent successfully, waiting for response Gen=%d Seq=%d", gen, seq)
+	return nil
+}
+
+// receiveLoop 接收一条连接上的包，连接关闭或出错时退出
+func (c *SMGPClient) receiveLoop(conn *cmppConn, gen uint64) {
+	Infof("[SMGP][RECV] Receiver goroutine started, generation=%d", gen)
+	defer Infof("[SMGP][RECV] Receiver goroutine stopped, generation=%d", gen)
+
+	for {
+		select {
+		case <-c.shutdown:
+			return
+		default:
+		}
+
+		pkt, err := conn.RecvAndUnpackPkt(defaultReceiveTimeout)
+		if err != nil {
+			if errors.Is(err, cmpp.ErrReadCmdIDTimeout) {
+				continue
+			}
+			if errors.Is(err, errUnknownCommand) {
+				Debugf("[SMGP][RECV] Ignoring packet: %v", err)
+				continue
+			}
+			// 只有当前连接出错才影响就绪状态，旧连接被替换时也会走到这里
+			if cur, _ := c.current(); cur == conn {
+				Warnf("[SMGP][RECV] Connection lost: %v", err)
+				c.pipeline.setReady(&c.ready, false)
+			}
+			conn.Close()
+			return
+		}
+		c.handlePacket(conn, gen, pkt)
+	}
+}
+
+// handlePacket 处理接收到的包
+func (c *SMGPClient) handlePacket(conn *cmppConn, gen uint64, pkt interface{}) {
+	switch p := pkt.(type) {
+	case *SmgpSubmitRspPkt:
+		msgId := ""
+		if p.Status == 0 {
+			msgId = p.MsgId.String()
+		}
+		Infof("[SMGP][SUBMIT-RSP] Received submit response: MsgId=%s Seq=%d Gen=%d Status=%d", msgId, p.SeqId, gen, p.Status)
+		c.pipeline.submitResponded(gen, p.SeqId, msgId, p.Status)
+	case *SmgpDeliverReqPkt:
+		c.handleDeliver(conn, p)
+	case *SmgpEmptyPkt:
+		switch p.RequestID {
+		case SMGP_ACTIVE_TEST:
+			Debugf("[SMGP][HEARTBEAT] Received active test")
+			conn.SendRspPkt(&SmgpEmptyPkt{RequestID: SMGP_ACTIVE_TEST_RESP}, p.SeqId)
+		case SMGP_ACTIVE_TEST_RESP:
+			Debugf("[SMGP][HEARTBEAT] Received active test response")
+		case SMGP_EXIT:
+			Warnf("[SMGP] SMGW requested exit")
+			conn.SendRspPkt(&SmgpEmptyPkt{RequestID: SMGP_EXIT_RESP}, p.SeqId)
+			c.pipeline.setReady(&c.ready, false)
+			conn.Close()
+		case SMGP_EXIT_RESP:
+			Infof("[SMGP] Received exit response")
+		}
+	default:
+		Debugf("[SMGP][RECV] Ignoring packet %T", pkt)
+	}
+}
+
+// handleDeliver 处理上行短信与状态报告
+func (c *SMGPClient) handleDeliver(conn *cmppConn, p *SmgpDeliverReqPkt) {
+	if err := conn.SendRspPkt(&SmgpDeliverRspPkt{MsgId: p.MsgId}, p.SeqId); err != nil {
+		Errorf("[SMGP][DELIVER] Failed to send response: %v", err)
+	}
+
+	if p.IsReport == 1 {
+		r, err := ParseSmgpReport(p.MsgContent)
+		if err != nil {
+			Warnf("[SMGP][RECEIPT] Failed to parse report: %v", err)
+			return
+		}
+		Infof("[SMGP][RECEIPT] Received report: MsgId=%s Stat=%s Dest=%s", r.MsgId, r.Stat, p.SrcTermID)
+		c.pipeline.receiptReceived(SmsMes{
+			MsgId:           r.MsgId.String(),
+			Dest:            p.SrcTermID, // 状态报告的源号码是原消息的接收方
+			Created:         time.Now(),
+			SubmitResult:    65535,
+			DelivleryResult: deliveryResultFromStat(r.Stat),
+			DeliveryStat:    r.Stat,
+		})
+		return
+	}
+
+	Infof("[SMGP][DELIVER] Received MO: MsgId=%s Src=%s Dest=%s", p.MsgId, p.SrcTermID, p.DestTermID)
+	c.pipeline.moReceived(SmsMes{
+		MsgId:   p.MsgId.String(),
+		Src:     p.SrcTermID,
+		Dest:    p.DestTermID,
+		Content: decodeMsgContent(p.MsgFormat, p.MsgContent),
+	})
+}
+
+// heartbeatLoop 定期发送 Active_Test，连接不可用时重连
+func (c *SMGPClient) heartbeatLoop() {
+	ticker := time.NewTicker(defaultHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.performHeartbeat()
+		case <-c.shutdown:
+			return
+		}
+	}
+}
+
+func (c *SMGPClient) performHeartbeat() {
+	conn, _ := c.current()
+	if !c.IsReady() || conn == nil {
+		Warnf("[SMGP][HEARTBEAT] Client not ready, attempting reconnection")
+		if err := c.Connect(); err != nil {
+			Errorf("[SMGP][HEARTBEAT] Reconnection failed: %v", err)
+			return
+		}
+		metrics.reconnects.Inc(ChannelSMGP)
+		return
+	}
+
+	if _, err := conn.SendReqPkt(&SmgpEmptyPkt{RequestID: SMGP_ACTIVE_TEST}); err != nil {
+		Errorf("[SMGP][HEARTBEAT] Active test failed: %v, will reconnect", err)
+		metrics.heartbeatFailures.Inc(ChannelSMGP)
+		c.pipeline.setReady(&c.ready, false)
+		conn.Close()
+	}
+}
+
+// Stop 发送 Exit 并断开连接（可重复调用）
+func (c *SMGPClient) Stop() {
+	c.shutdownOnce.Do(func() {
+		Infof("[SMGP] Shutting down SMGP client...")
+		close(c.shutdown)
+
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.SendReqPkt(&SmgpEmptyPkt{RequestID: SMGP_EXIT})
+			c.conn.Close()
+		}
+		c.pipeline.setReady(&c.ready, false)
+		c.mu.Unlock()
+
+		c.wg.Wait()
+		Infof("[SMGP] SMGP client shutdown complete")
+	})
+}
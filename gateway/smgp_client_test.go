@@ -0,0 +1,278 @@
+package gateway
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+// fakeSMGW 是测试用的最小 SMGP 3.0 模拟器
+// 校验登录密码，对 Submit 返回 MsgID 并随即推送状态报告
+type fakeSMGW struct {
+	t        *testing.T
+	password string
+	stat     string // 状态报告的 Stat，为空时不推送
+
+	mu       sync.Mutex
+	conns    []*cmppConn
+	submits  []SmgpSubmitReqPkt
+	nextId   byte
+	actives  int
+	delivers []SmgpDeliverRspPkt
+}
+
+func startFakeSMGW(t *testing.T, password, stat string) (*fakeSMGW, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := &fakeSMGW{t: t, password: password, stat: stat}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			netConn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(newSMGPConn(netConn))
+		}
+	}()
+	return s, ln.Addr().String()
+}
+
+func (s *fakeSMGW) serve(conn *cmppConn) {
+	defer conn.Close()
+	for {
+		pkt, err := conn.RecvAndUnpackPkt(0)
+		if err != nil {
+			return
+		}
+		switch p := pkt.(type) {
+		case *SmgpLoginReqPkt:
+			// 按规范重新计算认证码
+			expect := &SmgpLoginReqPkt{ClientID: p.ClientID, Secret: s.password, TimeStamp: p.TimeStamp}
+			var status uint32
+			if expect.Authenticator() != p.AuthenticatorClient {
+				status = 21 // 认证错
+			}
+			conn.SendRspPkt(&SmgpLoginRspPkt{Status: status, ServerVersion: SmgpVersion}, p.SeqId)
+			if status != 0 {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+		case *SmgpSubmitReqPkt:
+			s.mu.Lock()
+			s.nextId++
+			msgId := SmgpMsgId{0x00, 0x00, 0x01, 0x01, 0x02, 0x15, 0x04, 0x00, 0x00, s.nextId}
+			s.submits = append(s.submits, *p)
+			s.mu.Unlock()
+
+			conn.SendRspPkt(&SmgpSubmitRspPkt{MsgId: msgId}, p.SeqId)
+			if s.stat != "" {
+				report := &SmgpReport{MsgId: msgId, Sub: "001", Dlvrd: "001", SubmitDate: "2401021504", DoneDate: "2401021505", Stat: s.stat, Err: "000"}
+				conn.SendReqPkt(&SmgpDeliverReqPkt{
+					IsReport:   1,
+					SrcTermID:  p.DestTermID[0],
+					DestTermID: p.SrcTermID,
+					MsgContent: report.Bytes(),
+				})
+			}
+		case *SmgpDeliverRspPkt:
+			s.mu.Lock()
+			s.delivers = append(s.delivers, *p)
+			s.mu.Unlock()
+		case *SmgpEmptyPkt:
+			switch p.RequestID {
+			case SMGP_ACTIVE_TEST:
+				s.mu.Lock()
+				s.actives++
+				s.mu.Unlock()
+				conn.SendRspPkt(&SmgpEmptyPkt{RequestID: SMGP_ACTIVE_TEST_RESP}, p.SeqId)
+			case SMGP_EXIT:
+				conn.SendRspPkt(&SmgpEmptyPkt{RequestID: SMGP_EXIT_RESP}, p.SeqId)
+				return
+			}
+		}
+	}
+}
+
+// deliverMO 向最近登录的连接推送上行短信
+func (s *fakeSMGW) deliverMO(p *SmgpDeliverReqPkt) {
+	s.mu.Lock()
+	conn := s.conns[len(s.conns)-1]
+	s.mu.Unlock()
+	conn.SendReqPkt(p)
+}
+
+func newTestSMGPClient(t *testing.T, addr, password string) *SMGPClient {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(addr)
+	c := NewSMGPClient(&Config{
+		SMGPHost:     host,
+		SMGPPort:     port,
+		SMGPClientId: "gateway",
+		SMGPPassword: password,
+		SmsAccessNo:  "10659",
+		ServiceId:    "TEST",
+	})
+	t.Cleanup(c.Stop)
+	return c
+}
+
+func TestSmgpPacketRoundTrip(t *testing.T) {
+	format, content := encodeMsgContent("验证码 123456")
+	submit := &SmgpSubmitReqPkt{
+		MsgType: 6, NeedReport: 1, ServiceID: "TEST", MsgFormat: format,
+		SrcTermID: "1065901", DestTermID: []string{"13300000000", "18900000000"}, MsgContent: content,
+	}
+	data, err := submit.Pack(7)
+	if err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+	var got SmgpSubmitReqPkt
+	if err := got.Unpack(data[8:]); err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	if got.SeqId != 7 || got.SrcTermID != "1065901" || len(got.DestTermID) != 2 || got.DestTermID[1] != "18900000000" {
+		t.Errorf("Submit fields mismatch: %+v", got)
+	}
+	if text := decodeMsgContent(got.MsgFormat, got.MsgContent); text != "验证码 123456" {
+		t.Errorf("Content mismatch: %q", text)
+	}
+
+	if _, err := (&SmgpSubmitReqPkt{DestTermID: []string{"1"}, MsgContent: make([]byte, 256)}).Pack(1); err == nil {
+		t.Error("Expected error for content over 255 bytes")
+	}
+}
+
+func TestParseSmgpReport(t *testing.T) {
+	id := SmgpMsgId{0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC, 0xDE, 0xF0, 0x20, 0x20}
+	report := &SmgpReport{MsgId: id, Sub: "001", Dlvrd: "000", SubmitDate: "2401021504", DoneDate: "2401021505", Stat: "UNDELIV", Err: "006"}
+
+	r, err := ParseSmgpReport(report.Bytes())
+	if err != nil {
+		t.Fatalf("ParseSmgpReport failed: %v", err)
+	}
+	// MsgID 中含有空格(0x20)字节，不能按文本解析
+	if r.MsgId != id || r.Stat != "UNDELIV" || r.Err != "006" || r.DoneDate != "2401021505" {
+		t.Errorf("Unexpected report: %+v", r)
+	}
+	if r.MsgId.String() != "123456789abcdef02020" {
+		t.Errorf("Unexpected MsgId string: %s", r.MsgId)
+	}
+
+	if _, err := ParseSmgpReport([]byte("garbage")); err == nil {
+		t.Error("Expected error for invalid report")
+	}
+}
+
+func TestSMGPClientSubmitAndReport(t *testing.T) {
+	newTestBoltCache(t)
+	smgw, addr := startFakeSMGW(t, "secret", "DELIVRD")
+	c := newTestSMGPClient(t, addr, "secret")
+
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if !c.IsReady() {
+		t.Fatal("Client should be ready after login")
+	}
+
+	mes := SmsMes{Src: "01", Dest: "13300000000", Content: "你好", SubmitResult: 65535, DelivleryResult: 65535}
+	if err := c.Submit(&mes); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	waitFor(t, "report applied", func() bool {
+		list := *SCache.GetList("list_message", 0, 10)
+		return len(list) == 1 && list[0].DeliveryStat == "DELIVRD"
+	})
+	list := *SCache.GetList("list_message", 0, 10)
+	if list[0].MsgId != "00000101021504000001" || list[0].SubmitResult != 0 || list[0].Channel != ChannelSMGP {
+		t.Errorf("Unexpected stored message: %+v", list[0])
+	}
+
+	smgw.mu.Lock()
+	sub := smgw.submits[0]
+	smgw.mu.Unlock()
+	if sub.SrcTermID != "1065901" || sub.ServiceID != "TEST" || sub.NeedReport != 1 ||
+		decodeMsgContent(sub.MsgFormat, sub.MsgContent) != "你好" {
+		t.Errorf("Unexpected submit: %+v", sub)
+	}
+	waitFor(t, "deliver response", func() bool {
+		smgw.mu.Lock()
+		defer smgw.mu.Unlock()
+		return len(smgw.delivers) == 1
+	})
+}
+
+func TestSMGPClientReceivesMO(t *testing.T) {
+	newTestBoltCache(t)
+	smgw, addr := startFakeSMGW(t, "secret", "")
+	c := newTestSMGPClient(t, addr, "secret")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// 电信网关常以 GB 编码下发中文上行
+	smgw.deliverMO(&SmgpDeliverReqPkt{
+		MsgId:      SmgpMsgId{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		MsgFormat:  SmgpMsgFormatGB,
+		SrcTermID:  "13300000000",
+		DestTermID: "10659",
+		MsgContent: []byte{0xBB, 0xD8, 0xB8, 0xB4}, // "回复"
+	})
+	waitFor(t, "MO stored", func() bool { return SCache.Length("list_mo") == 1 })
+
+	mo := (*SCache.GetList("list_mo", 0, 1))[0]
+	if mo.Src != "13300000000" || mo.Dest != "10659" || mo.Content != "回复" || mo.Channel != ChannelSMGP || mo.MsgId != "0102030405060708090a" {
+		t.Errorf("Unexpected MO: %+v", mo)
+	}
+}
+
+func TestSMGPClientLoginRejected(t *testing.T) {
+	_, addr := startFakeSMGW(t, "secret", "")
+	c := newTestSMGPClient(t, addr, "wrong")
+	if err := c.Connect(); err == nil {
+		t.Fatal("Expected login to fail with wrong password")
+	}
+	if c.IsReady() {
+		t.Error("Client must not be ready after failed login")
+	}
+}
+
+func TestSMGPClientHeartbeatReconnects(t *testing.T) {
+	newTestBoltCache(t)
+	smgw, addr := startFakeSMGW(t, "secret", "")
+	c := newTestSMGPClient(t, addr, "secret")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	firstGen := c.Generation()
+
+	c.performHeartbeat()
+	waitFor(t, "active test", func() bool {
+		smgw.mu.Lock()
+		defer smgw.mu.Unlock()
+		return smgw.actives == 1
+	})
+
+	SCache.SetWaitCache(firstGen, 99, SmsMes{Dest: "13300000000", Channel: ChannelSMGP})
+	smgw.mu.Lock()
+	smgw.conns[0].Close()
+	smgw.mu.Unlock()
+	waitFor(t, "connection loss detected", func() bool { return !c.IsReady() })
+
+	c.performHeartbeat()
+	if !c.IsReady() || c.Generation() == firstGen {
+		t.Fatal("Expected reconnect with new generation")
+	}
+	list := *SCache.GetList("list_message", 0, 10)
+	if len(list) != 1 || list[0].SubmitResult != 253 {
+		t.Errorf("Expected pending submit resolved as lost, got %+v", list)
+	}
+}
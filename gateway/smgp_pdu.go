@@ -0,0 +1,467 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	cmpp "github.com/bigwhite/gocmpp"
+)
+
+// SMGP 3.0 的 RequestID
+const (
+	SMGP_LOGIN            uint32 = 0x00000001
+	SMGP_LOGIN_RESP       uint32 = 0x80000001
+	SMGP_SUBMIT           uint32 = 0x00000002
+	SMGP_SUBMIT_RESP      uint32 = 0x80000002
+	SMGP_DELIVER          uint32 = 0x00000003
+	SMGP_DELIVER_RESP     uint32 = 0x80000003
+	SMGP_ACTIVE_TEST      uint32 = 0x00000004
+	SMGP_ACTIVE_TEST_RESP uint32 = 0x80000004
+	SMGP_EXIT             uint32 = 0x00000006
+	SMGP_EXIT_RESP        uint32 = 0x80000006
+)
+
+// SMGP 包长度（包含 12 字节消息头）
+const (
+	SmgpHeaderLen        uint32 = 12
+	SmgpLoginReqPktLen   uint32 = 12 + 8 + 16 + 1 + 4 + 1 // 42
+	SmgpLoginRspPktLen   uint32 = 12 + 4 + 16 + 1         // 33
+	SmgpSubmitRspPktLen  uint32 = 12 + 10 + 4             // 26
+	SmgpDeliverRspPktLen uint32 = 12 + 10 + 4             // 26
+	SmgpActiveTestLen    uint32 = 12
+	SmgpExitLen          uint32 = 12
+
+	// 超过该长度的包视为非法
+	SmgpPacketMax uint32 = 2048
+)
+
+// 登录模式
+const (
+	SmgpLoginModeSend     uint8 = 0 // 发送短消息
+	SmgpLoginModeReceive  uint8 = 1 // 接收短消息
+	SmgpLoginModeTransmit uint8 = 2 // 收发短消息
+)
+
+// 短消息格式
+const (
+	SmgpMsgFormatASCII uint8 = 0
+	SmgpMsgFormatUCS2  uint8 = 8
+	SmgpMsgFormatGB    uint8 = 15
+)
+
+// SmgpVersion 是协议版本 3.0
+const SmgpVersion uint8 = 0x30
+
+// SmgpMsgIdLen 是 MsgID 的长度：SMGW 代码(3) + 时间(4) + 序列号(3)，均为 BCD 码
+const SmgpMsgIdLen = 10
+
+// SmgpMsgId 是 SMGP 的 10 字节消息标识，以十六进制字符串形式展示和存储
+type SmgpMsgId [SmgpMsgIdLen]byte
+
+func (id SmgpMsgId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// smgpTimestamp 返回登录使用的 MMDDHHMMSS 时间戳
+func smgpTimestamp(t time.Time) uint32 {
+	v, _ := strconv.ParseUint(t.Format("0102150405"), 10, 32)
+	return uint32(v)
+}
+
+// SmgpLoginReqPkt 是登录请求，Secret 仅用于计算 AuthenticatorClient，不在网络上传输
+type SmgpLoginReqPkt struct {
+	ClientID            string
+	Secret              string
+	AuthenticatorClient string
+	LoginMode           uint8
+	TimeStamp           uint32
+	ClientVersion       uint8
+
+	// session info
+	SeqId uint32
+}
+
+// Authenticator 计算 MD5(ClientID + 7 字节 0 + Secret + TimeStamp)
+func (p *SmgpLoginReqPkt) Authenticator() string {
+	ts := fmt.Sprintf("%010d", p.TimeStamp)
+	sum := md5.Sum(bytes.Join([][]byte{[]byte(p.ClientID), make([]byte, 7), []byte(p.Secret), []byte(ts)}, nil))
+	return string(sum[:])
+}
+
+// Pack 打包登录请求
+func (p *SmgpLoginReqPkt) Pack(seqId uint32) ([]byte, error) {
+	if p.TimeStamp == 0 {
+		p.TimeStamp = smgpTimestamp(time.Now())
+	}
+	if p.ClientVersion == 0 {
+		p.ClientVersion = SmgpVersion
+	}
+	p.AuthenticatorClient = p.Authenticator()
+
+	buf := bytes.NewBuffer(make([]byte, 0, SmgpLoginReqPktLen))
+	writeHeader(buf, SmgpLoginReqPktLen, cmpp.CommandId(SMGP_LOGIN), seqId)
+	writeFixedString(buf, p.ClientID, 8)
+	writeFixedString(buf, p.AuthenticatorClient, 16)
+	buf.WriteByte(p.LoginMode)
+	binary.Write(buf, binary.BigEndian, p.TimeStamp)
+	buf.WriteByte(p.ClientVersion)
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包登录请求，data 从 SequenceID 开始
+func (p *SmgpLoginReqPkt) Unpack(data []byte) error {
+	if uint32(len(data)) < SmgpLoginReqPktLen-8 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	p.ClientID = readFixedString(data[4:12])
+	p.AuthenticatorClient = string(data[12:28])
+	p.LoginMode = data[28]
+	p.TimeStamp = binary.BigEndian.Uint32(data[29:33])
+	p.ClientVersion = data[33]
+	return nil
+}
+
+// SmgpLoginRspPkt 是登录响应，Status 为 0 表示成功
+type SmgpLoginRspPkt struct {
+	Status              uint32
+	AuthenticatorServer string
+	ServerVersion       uint8
+
+	// session info
+	SeqId uint32
+}
+
+// Pack 打包登录响应
+func (p *SmgpLoginRspPkt) Pack(seqId uint32) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, SmgpLoginRspPktLen))
+	writeHeader(buf, SmgpLoginRspPktLen, cmpp.CommandId(SMGP_LOGIN_RESP), seqId)
+	binary.Write(buf, binary.BigEndian, p.Status)
+	writeFixedString(buf, p.AuthenticatorServer, 16)
+	buf.WriteByte(p.ServerVersion)
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包登录响应，data 从 SequenceID 开始
+func (p *SmgpLoginRspPkt) Unpack(data []byte) error {
+	if uint32(len(data)) < SmgpLoginRspPktLen-8 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	p.Status = binary.BigEndian.Uint32(data[4:8])
+	p.AuthenticatorServer = string(data[8:24])
+	p.ServerVersion = data[24]
+	return nil
+}
+
+// SmgpSubmitReqPkt 是下发短信请求（不含可选参数）
+type SmgpSubmitReqPkt struct {
+	MsgType      uint8 // 6 表示 MT 消息
+	NeedReport   uint8
+	Priority     uint8
+	ServiceID    string
+	FeeType      string
+	FeeCode      string
+	FixedFee     string
+	MsgFormat    uint8
+	ValidTime    string
+	AtTime       string
+	SrcTermID    string
+	ChargeTermID string
+	DestTermID   []string
+	MsgContent   []byte
+	Reserve      string
+
+	// session info
+	SeqId uint32
+}
+
+// Pack 打包下发请求
+func (p *SmgpSubmitReqPkt) Pack(seqId uint32) ([]byte, error) {
+	if len(p.MsgContent) > 255 {
+		return nil, fmt.Errorf("smgp message content too long: %d bytes", len(p.MsgContent))
+	}
+	if len(p.DestTermID) == 0 || len(p.DestTermID) > 100 {
+		return nil, fmt.Errorf("smgp invalid destination count: %d", len(p.DestTermID))
+	}
+
+	totalLen := SmgpHeaderLen + 105 + uint32(21*len(p.DestTermID)) + 1 + uint32(len(p.MsgContent)) + 8
+	buf := bytes.NewBuffer(make([]byte, 0, totalLen))
+	writeHeader(buf, totalLen, cmpp.CommandId(SMGP_SUBMIT), seqId)
+	buf.WriteByte(p.MsgType)
+	buf.WriteByte(p.NeedReport)
+	buf.WriteByte(p.Priority)
+	writeFixedString(buf, p.ServiceID, 10)
+	writeFixedString(buf, p.FeeType, 2)
+	writeFixedString(buf, p.FeeCode, 6)
+	writeFixedString(buf, p.FixedFee, 6)
+	buf.WriteByte(p.MsgFormat)
+	writeFixedString(buf, p.ValidTime, 17)
+	writeFixedString(buf, p.AtTime, 17)
+	writeFixedString(buf, p.SrcTermID, 21)
+	writeFixedString(buf, p.ChargeTermID, 21)
+	buf.WriteByte(uint8(len(p.DestTermID)))
+	for _, d := range p.DestTermID {
+		writeFixedString(buf, d, 21)
+	}
+	buf.WriteByte(uint8(len(p.MsgContent)))
+	buf.Write(p.MsgContent)
+	writeFixedString(buf, p.Reserve, 8)
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包下发请求，data 从 SequenceID 开始，忽略可选参数
+func (p *SmgpSubmitReqPkt) Unpack(data []byte) error {
+	if len(data) < 4+105 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	b := data[4:]
+	p.MsgType = b[0]
+	p.NeedReport = b[1]
+	p.Priority = b[2]
+	p.ServiceID = readFixedString(b[3:13])
+	p.FeeType = readFixedString(b[13:15])
+	p.FeeCode = readFixedString(b[15:21])
+	p.FixedFee = readFixedString(b[21:27])
+	p.MsgFormat = b[27]
+	p.ValidTime = readFixedString(b[28:45])
+	p.AtTime = readFixedString(b[45:62])
+	p.SrcTermID = readFixedString(b[62:83])
+	p.ChargeTermID = readFixedString(b[83:104])
+	count := int(b[104])
+	b = b[105:]
+	if len(b) < 21*count+1 {
+		return errPacketTooShort
+	}
+	p.DestTermID = make([]string, count)
+	for i := 0; i < count; i++ {
+		p.DestTermID[i] = readFixedString(b[i*21 : (i+1)*21])
+	}
+	b = b[21*count:]
+	n := int(b[0])
+	if len(b) < 1+n+8 {
+		return errPacketTooShort
+	}
+	p.MsgContent = append([]byte(nil), b[1:1+n]...)
+	p.Reserve = readFixedString(b[1+n : 1+n+8])
+	return nil
+}
+
+// SmgpSubmitRspPkt 是下发响应
+type SmgpSubmitRspPkt struct {
+	MsgId  SmgpMsgId
+	Status uint32
+
+	// session info
+	SeqId uint32
+}
+
+// Pack 打包下发响应
+func (p *SmgpSubmitRspPkt) Pack(seqId uint32) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, SmgpSubmitRspPktLen))
+	writeHeader(buf, SmgpSubmitRspPktLen, cmpp.CommandId(SMGP_SUBMIT_RESP), seqId)
+	buf.Write(p.MsgId[:])
+	binary.Write(buf, binary.BigEndian, p.Status)
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包下发响应，data 从 SequenceID 开始
+func (p *SmgpSubmitRspPkt) Unpack(data []byte) error {
+	if uint32(len(data)) < SmgpSubmitRspPktLen-8 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	copy(p.MsgId[:], data[4:14])
+	p.Status = binary.BigEndian.Uint32(data[14:18])
+	return nil
+}
+
+// SmgpDeliverReqPkt 是上行短信或状态报告（IsReport 为 1）
+type SmgpDeliverReqPkt struct {
+	MsgId      SmgpMsgId
+	IsReport   uint8
+	MsgFormat  uint8
+	RecvTime   string // YYYYMMDDhhmmss
+	SrcTermID  string
+	DestTermID string
+	MsgContent []byte
+	Reserve    string
+
+	// session info
+	SeqId uint32
+}
+
+// Pack 打包 Deliver 请求
+func (p *SmgpDeliverReqPkt) Pack(seqId uint32) ([]byte, error) {
+	if len(p.MsgContent) > 255 {
+		return nil, fmt.Errorf("smgp message content too long: %d bytes", len(p.MsgContent))
+	}
+	totalLen := SmgpHeaderLen + 69 + uint32(len(p.MsgContent)) + 8
+	buf := bytes.NewBuffer(make([]byte, 0, totalLen))
+	writeHeader(buf, totalLen, cmpp.CommandId(SMGP_DELIVER), seqId)
+	buf.Write(p.MsgId[:])
+	buf.WriteByte(p.IsReport)
+	buf.WriteByte(p.MsgFormat)
+	writeFixedString(buf, p.RecvTime, 14)
+	writeFixedString(buf, p.SrcTermID, 21)
+	writeFixedString(buf, p.DestTermID, 21)
+	buf.WriteByte(uint8(len(p.MsgContent)))
+	buf.Write(p.MsgContent)
+	writeFixedString(buf, p.Reserve, 8)
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包 Deliver 请求，data 从 SequenceID 开始，忽略可选参数
+func (p *SmgpDeliverReqPkt) Unpack(data []byte) error {
+	if len(data) < 4+69 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	b := data[4:]
+	copy(p.MsgId[:], b[0:10])
+	p.IsReport = b[10]
+	p.MsgFormat = b[11]
+	p.RecvTime = readFixedString(b[12:26])
+	p.SrcTermID = readFixedString(b[26:47])
+	p.DestTermID = readFixedString(b[47:68])
+	n := int(b[68])
+	if len(b) < 69+n+8 {
+		return errPacketTooShort
+	}
+	p.MsgContent = append([]byte(nil), b[69:69+n]...)
+	p.Reserve = readFixedString(b[69+n : 69+n+8])
+	return nil
+}
+
+// SmgpDeliverRspPkt 是 Deliver 响应
+type SmgpDeliverRspPkt struct {
+	MsgId  SmgpMsgId
+	Status uint32
+
+	// session info
+	SeqId uint32
+}
+
+// Pack 打包 Deliver 响应
+func (p *SmgpDeliverRspPkt) Pack(seqId uint32) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, SmgpDeliverRspPktLen))
+	writeHeader(buf, SmgpDeliverRspPktLen, cmpp.CommandId(SMGP_DELIVER_RESP), seqId)
+	buf.Write(p.MsgId[:])
+	binary.Write(buf, binary.BigEndian, p.Status)
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包 Deliver 响应，data 从 SequenceID 开始
+func (p *SmgpDeliverRspPkt) Unpack(data []byte) error {
+	if uint32(len(data)) < SmgpDeliverRspPktLen-8 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	copy(p.MsgId[:], data[4:14])
+	p.Status = binary.BigEndian.Uint32(data[14:18])
+	return nil
+}
+
+// SmgpEmptyPkt 是只有消息头的包（Active_Test、Exit 及其响应）
+type SmgpEmptyPkt struct {
+	RequestID uint32
+
+	// session info
+	SeqId uint32
+}
+
+// Pack 打包只有消息头的包
+func (p *SmgpEmptyPkt) Pack(seqId uint32) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, SmgpHeaderLen))
+	writeHeader(buf, SmgpHeaderLen, cmpp.CommandId(p.RequestID), seqId)
+	p.SeqId = seqId
+	return buf.Bytes(), nil
+}
+
+// Unpack 解包只有消息头的包，data 从 SequenceID 开始
+func (p *SmgpEmptyPkt) Unpack(data []byte) error {
+	if len(data) < 4 {
+		return errPacketTooShort
+	}
+	p.SeqId = binary.BigEndian.Uint32(data[0:4])
+	return nil
+}
+
+// SmgpReport 是状态报告的内容
+// 格式：id:(10字节MsgID) sub:001 dlvrd:001 Submit_date:YYMMDDhhmm done_date:YYMMDDhhmm Stat:DELIVRD err:000 Txt:...
+type SmgpReport struct {
+	MsgId      SmgpMsgId
+	Sub        string
+	Dlvrd      string
+	SubmitDate string
+	DoneDate   string
+	Stat       string
+	Err        string
+	Txt        string
+}
+
+// Bytes 编码为 Deliver 的 MsgContent
+func (r *SmgpReport) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("id:")
+	buf.Write(r.MsgId[:])
+	fmt.Fprintf(buf, " sub:%03s dlvrd:%03s Submit_date:%-10s done_date:%-10s Stat:%-7s err:%03s Txt:%-20s",
+		r.Sub, r.Dlvrd, r.SubmitDate, r.DoneDate, r.Stat, r.Err, r.Txt)
+	return buf.Bytes()
+}
+
+// ParseSmgpReport 解析状态报告内容，MsgID 为二进制，其余部分为文本
+func ParseSmgpReport(content []byte) (SmgpReport, error) {
+	var r SmgpReport
+	if len(content) < 3+SmgpMsgIdLen || !bytes.EqualFold(content[:3], []byte("id:")) {
+		return r, fmt.Errorf("invalid smgp report: %q", content)
+	}
+	copy(r.MsgId[:], content[3:3+SmgpMsgIdLen])
+
+	fields := parseReceiptText(string(content[3+SmgpMsgIdLen:]))
+	r.Sub = fields["sub"]
+	r.Dlvrd = fields["dlvrd"]
+	r.SubmitDate = fields["submit_date"]
+	r.DoneDate = fields["done_date"]
+	r.Stat = fields["stat"]
+	r.Err = fields["err"]
+	r.Txt = fields["txt"]
+	if r.Stat == "" {
+		return r, fmt.Errorf("smgp report without stat: %q", content)
+	}
+	return r, nil
+}
+
+// NewSMGPPacket 根据 RequestID 创建对应的 SMGP 3.0 包
+func NewSMGPPacket(id uint32) (cmpp.Packer, error) {
+	switch id {
+	case SMGP_LOGIN:
+		return &SmgpLoginReqPkt{}, nil
+	case SMGP_LOGIN_RESP:
+		return &SmgpLoginRspPkt{}, nil
+	case SMGP_SUBMIT:
+		return &SmgpSubmitReqPkt{}, nil
+	case SMGP_SUBMIT_RESP:
+		return &SmgpSubmitRspPkt{}, nil
+	case SMGP_DELIVER:
+		return &SmgpDeliverReqPkt{}, nil
+	case SMGP_DELIVER_RESP:
+		return &SmgpDeliverRspPkt{}, nil
+	case SMGP_ACTIVE_TEST, SMGP_ACTIVE_TEST_RESP, SMGP_EXIT, SMGP_EXIT_RESP:
+		return &SmgpEmptyPkt{RequestID: id}, nil
+	default:
+		return nil, fmt.Errorf("%w: 0x%08x", errUnknownCommand, id)
+	}
+}
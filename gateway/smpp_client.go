@@ -0,0 +1,466 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SMPP 的 source_addr 最长 21 字节（含结尾的 0）
+const smppMaxSourceAddr = 20
+
+// errSmppReadTimeout 表示在超时时间内没有收到任何数据，可以安全地重试
+var errSmppReadTimeout = errors.New("smpp read timeout")
+
+// smppConn 是 SMPP 连接的帧层实现
+type smppConn struct {
+	conn   net.Conn
+	seq    atomic.Uint32
+	closed atomic.Bool
+	wmu    sync.Mutex // 保证一个 PDU 的字节连续写出
+}
+
+func newSMPPConn(conn net.Conn) *smppConn {
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetKeepAlive(true)
+	}
+	return &smppConn{conn: conn}
+}
+
+// nextSeq 分配序列号，取值范围为 1 ~ 0x7FFFFFFF
+func (c *smppConn) nextSeq() uint32 {
+	return c.seq.Add(1) & 0x7FFFFFFF
+}
+
+// Close 关闭连接（可重复调用）
+func (c *smppConn) Close() {
+	if c.closed.CompareAndSwap(false, true) {
+		c.conn.Close()
+	}
+}
+
+// SendReq 分配序列号并发送请求
+func (c *smppConn) SendReq(commandId uint32, body []byte) (uint32, error) {
+	seq := c.nextSeq()
+	return seq, c.Send(&SmppPDU{CommandId: commandId, SeqNum: seq, Body: body})
+}
+
+// Send 发送一个 PDU
+func (c *smppConn) Send(p *SmppPDU) error {
+	if c.closed.Load() {
+		return io.ErrClosedPipe
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(p.Bytes())
+	return err
+}
+
+// Recv 读取一个完整的 PDU，超时且未读到数据时返回 errSmppReadTimeout
+func (c *smppConn) Recv(timeout time.Duration) (*SmppPDU, error) {
+	if c.closed.Load() {
+		return nil, io.ErrClosedPipe
+	}
+
+	var header [smppHeaderLen]byte
+	if timeout != 0 {
+		c.conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	// 先读第一个字节：此时超时说明没有数据，可以安全地重试
+	if _, err := io.ReadFull(c.conn, header[:1]); err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, errSmppReadTimeout
+		}
+		return nil, err
+	}
+
+	// PDU 已开始到达，剩余部分使用较长的超时，避免读取半个包后流错位
+	c.conn.SetReadDeadline(time.Now().Add(defaultPacketBodyTimeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	if _, err := io.ReadFull(c.conn, header[1:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < smppHeaderLen || length > smppMaxPDULen {
+		return nil, fmt.Errorf("%w: command_length %d", errSmppMalformed, length)
+	}
+	p := &SmppPDU{
+		CommandId: binary.BigEndian.Uint32(header[4:8]),
+		Status:    binary.BigEndian.Uint32(header[8:12]),
+		SeqNum:    binary.BigEndian.Uint32(header[12:16]),
+		Body:      make([]byte, length-smppHeaderLen),
+	}
+	if _, err := io.ReadFull(c.conn, p.Body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// bind 发送 bind_transceiver 并校验响应
+func (c *smppConn) bind(req *SmppBindPkt, timeout time.Duration) error {
+	seq, err := c.SendReq(SmppBindTransceiver, req.Pack())
+	if err != nil {
+		return err
+	}
+	rsp, err := c.Recv(timeout)
+	if err != nil {
+		return err
+	}
+	if rsp.CommandId != SmppBindTransceiverResp && rsp.CommandId != SmppGenericNack {
+		return fmt.Errorf("unexpected response 0x%08x to bind_transceiver", rsp.CommandId)
+	}
+	if rsp.SeqNum != seq {
+		return fmt.Errorf("bind_transceiver response sequence mismatch: %d != %d", rsp.SeqNum, seq)
+	}
+	if rsp.Status != SmppStatusOK {
+		return fmt.Errorf("bind_transceiver rejected, command_status=0x%08x", rsp.Status)
+	}
+	return nil
+}
+
+// SMPPClient 是 SMPP 3.4 上游通道（bind_transceiver）
+type SMPPClient struct {
+	config *Config
+
+	conn *smppConn // 需要加锁保护
+	mu   sync.RWMutex
+
+	ready atomic.Bool
+
+	// 连接代次，与 sequence_number 共同作为提交响应的关联键
+	generation atomic.Uint64
+
+	pipeline *messagePipeline
+
+	// 退出信号
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	wg           sync.WaitGroup
+}
+
+// NewSMPPClient 创建 SMPP 通道
+func NewSMPPClient(cfg *Config) *SMPPClient {
+	c := &SMPPClient{
+		config:   cfg,
+		pipeline: newMessagePipeline(ChannelSMPP),
+		shutdown: make(chan struct{}),
+	}
+	c.generation.Store(uint64(time.Now().UnixNano()))
+	return c
+}
+
+// Name 返回通道类型
+func (c *SMPPClient) Name() string {
+	return ChannelSMPP
+}
+
+// SetHandler 设置接收处理结果与连接状态的回调，需在 Start 之前调用
+func (c *SMPPClient) SetHandler(h ChannelHandler) {
+	c.pipeline.setHandler(h)
+}
+
+// SubmitFailed 记录未能提交的消息
+func (c *SMPPClient) SubmitFailed(mes *SmsMes) {
+	c.pipeline.submitFailed(mes)
+}
+
+// IsReady 检查连接是否就绪
+func (c *SMPPClient) IsReady() bool {
+	return c.ready.Load()
+}
+
+// Generation 返回当前连接代次
+func (c *SMPPClient) Generation() uint64 {
+	return c.generation.Load()
+}
+
+// Start 建立初始连接并启动心跳（enquire_link）与状态报告清理协程
+func (c *SMPPClient) Start() {
+	if err := c.Connect(); err != nil {
+		Errorf("[SMPP] Initial connection failed: %v", err)
+		// 由心跳协程尝试重连
+	}
+
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		c.heartbeatLoop()
+	}()
+	go func() {
+		defer c.wg.Done()
+		c.pipeline.runReceiptSweeper(c.shutdown)
+	}()
+}
+
+// Connect 建立连接并完成 bind_transceiver，成功后启动该连接的接收协程
+func (c *SMPPClient) Connect() error {
+	addr := net.JoinHostPort(c.config.SMPPHost, c.config.SMPPPort)
+	netConn, err := net.DialTimeout("tcp", addr, defaultConnectTimeout)
+	if err != nil {
+		c.pipeline.setReady(&c.ready, false)
+		return fmt.Errorf("failed to connect to SMSC: %w", err)
+	}
+	conn := newSMPPConn(netConn)
+	err = conn.bind(&SmppBindPkt{
+		SystemId:         c.config.SMPPSystemId,
+		Password:         c.config.SMPPPassword,
+		SystemType:       c.config.SMPPSystemType,
+		InterfaceVersion: 0x34,
+	}, defaultConnectTimeout)
+	if err != nil {
+		conn.Close()
+		c.pipeline.setReady(&c.ready, false)
+		return fmt.Errorf("failed to bind to SMSC: %w", err)
+	}
+
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = conn
+	gen := c.generation.Add(1)
+	c.pipeline.setReady(&c.ready, true)
+	c.mu.Unlock()
+	Infof("[SMPP] Bind successful, addr=%s system_id=%s generation=%d", addr, c.config.SMPPSystemId, gen)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.receiveLoop(conn, gen)
+	}()
+
+	c.pipeline.resolveStalePending(gen)
+	return nil
+}
+
+// current 返回当前连接及其代次
+func (c *SMPPClient) current() (*smppConn, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn, c.generation.Load()
+}
+
+// Submit 构建 submit_sm 并发送
+// SMSC 的响应可能非常快，因此先登记等待响应再写出 PDU
+func (c *SMPPClient) Submit(mes *SmsMes) error {
+	source := c.config.SMPPSourceAddr
+	if source == "" {
+		source = c.config.SmsAccessNo
+	}
+	srcId := buildSrcId(source, mes.Src)
+	if len(srcId) > smppMaxSourceAddr {
+		return fmt.Errorf("%w: %s (len=%d, max %d)", errSrcIdTooLong, srcId, len(srcId), smppMaxSourceAddr)
+	}
+
+	conn, gen := c.current()
+	if !c.IsReady() || conn == nil {
+		return fmt.Errorf("SMPP client not ready")
+	}
+
+	p := &SmppSmPkt{
+		SourceAddr:         srcId,
+		DestinationAddr:    strings.TrimPrefix(mes.Dest, "+"),
+		DestAddrNpi:        1, // ISDN (E.163/E.164)
+		RegisteredDelivery: 1, // 需要状态报告
+	}
+	if !isNumeric(srcId) {
+		p.SourceAddrTon = 5 // 字母数字
+	} else {
+		p.SourceAddrNpi = 1
+	}
+	if strings.HasPrefix(mes.Dest, "+") {
+		p.DestAddrTon = 1 // 国际号码
+	}
+	p.SetText(mes.Content)
+
+	seq := conn.nextSeq()
+	if err := c.pipeline.addPending(gen, seq, mes); err != nil {
+		return err
+	}
+	if err := conn.Send(&SmppPDU{CommandId: SmppSubmitSm, SeqNum: seq, Body: p.Pack()}); err != nil {
+		// 未发出的消息撤销登记，由调用者记录为发送失败
+		c.pipeline.removePending(gen, seq)
+		c.pipeline.setReady(&c.ready, false)
+		return err
+	}
+	Infof("[SEND] Sent successfully, waiting for response Gen=%d Seq=%d", gen, seq)
+	return nil
+}
+
+func isNumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// receiveLoop 接收一条连接上的 PDU，连接关闭或出错时退出
+func (c *SMPPClient) receiveLoop(conn *smppConn, gen uint64) {
+	Infof("[SMPP][RECV] Receiver goroutine started, generation=%d", gen)
+	defer Infof("[SMPP][RECV] Receiver goroutine stopped, generation=%d", gen)
+
+	for {
+		select {
+		case <-c.shutdown:
+			return
+		default:
+		}
+
+		pdu, err := conn.Recv(defaultReceiveTimeout)
+		if err != nil {
+			if errors.Is(err, errSmppReadTimeout) {
+				continue
+			}
+			// 只有当前连接出错才影响就绪状态，旧连接被替换时也会走到这里
+			if cur, _ := c.current(); cur == conn {
+				Warnf("[SMPP][RECV] Connection lost: %v", err)
+				c.pipeline.setReady(&c.ready, false)
+			}
+			conn.Close()
+			return
+		}
+		c.handlePDU(conn, gen, pdu)
+	}
+}
+
+// handlePDU 处理接收到的 PDU
+func (c *SMPPClient) handlePDU(conn *smppConn, gen uint64, pdu *SmppPDU) {
+	switch pdu.CommandId {
+	case SmppSubmitSmResp:
+		msgId := ""
+		if pdu.Status == SmppStatusOK {
+			r := &smppReader{data: pdu.Body}
+			msgId = r.cstring()
+		}
+		Infof("[SMPP][SUBMIT-RSP] Received submit_sm_resp: MessageId=%s Seq=%d Gen=%d Status=0x%08x", msgId, pdu.SeqNum, gen, pdu.Status)
+		c.pipeline.submitResponded(gen, pdu.SeqNum, msgId, smppSubmitResult(pdu.Status))
+	case SmppDeliverSm:
+		c.handleDeliverSm(conn, pdu)
+	case SmppEnquireLink:
+		Debugf("[SMPP][HEARTBEAT] Received enquire_link")
+		conn.Send(&SmppPDU{CommandId: SmppEnquireLinkResp, SeqNum: pdu.SeqNum})
+	case SmppEnquireLinkResp:
+		Debugf("[SMPP][HEARTBEAT] Received enquire_link_resp")
+	case SmppUnbind:
+		Warnf("[SMPP] SMSC requested unbind")
+		conn.Send(&SmppPDU{CommandId: SmppUnbindResp, SeqNum: pdu.SeqNum})
+		c.pipeline.setReady(&c.ready, false)
+		conn.Close()
+	case SmppUnbindResp:
+		Infof("[SMPP] Received unbind_resp")
+	case SmppGenericNack:
+		// 对 submit_sm 的否定应答同样需要给出最终结果
+		Warnf("[SMPP] Received generic_nack Seq=%d Status=0x%08x", pdu.SeqNum, pdu.Status)
+		c.pipeline.submitResponded(gen, pdu.SeqNum, "NACK", smppSubmitResult(pdu.Status))
+	default:
+		if pdu.CommandId&0x80000000 == 0 {
+			conn.Send(&SmppPDU{CommandId: SmppGenericNack, Status: SmppStatusInvCmdId, SeqNum: pdu.SeqNum})
+		}
+		Debugf("[SMPP][RECV] Ignoring PDU command_id=0x%08x", pdu.CommandId)
+	}
+}
+
+// handleDeliverSm 处理上行短信与状态报告
+func (c *SMPPClient) handleDeliverSm(conn *smppConn, pdu *SmppPDU) {
+	var p SmppSmPkt
+	err := p.Unpack(pdu.Body)
+
+	// deliver_sm_resp 的 message_id 固定为空
+	status := SmppStatusOK
+	if err != nil {
+		status = SmppStatusSysErr
+	}
+	conn.Send(&SmppPDU{CommandId: SmppDeliverSmResp, Status: status, SeqNum: pdu.SeqNum, Body: []byte{0}})
+	if err != nil {
+		Warnf("[SMPP][DELIVER] Failed to unpack deliver_sm: %v", err)
+		return
+	}
+
+	if p.EsmClass&SmppEsmClassReceipt != 0 {
+		r, err := p.ParseReceipt()
+		if err != nil {
+			Warnf("[SMPP][RECEIPT] Failed to parse receipt: %v", err)
+			return
+		}
+		Infof("[SMPP][RECEIPT] Received receipt: MessageId=%s Stat=%s Dest=%s", r.MessageId, r.Stat, p.SourceAddr)
+		c.pipeline.receiptReceived(SmsMes{
+			MsgId:           r.MessageId,
+			Dest:            p.SourceAddr, // 状态报告的源地址是原消息的接收方
+			Created:         time.Now(),
+			SubmitResult:    65535,
+			DelivleryResult: deliveryResultFromStat(r.Stat),
+			DeliveryStat:    r.Stat,
+		})
+		return
+	}
+
+	Infof("[SMPP][DELIVER] Received MO: Src=%s Dest=%s", p.SourceAddr, p.DestinationAddr)
+	c.pipeline.moReceived(SmsMes{
+		Src:     p.SourceAddr,
+		Dest:    p.DestinationAddr,
+		Content: p.Text(),
+	})
+}
+
+// heartbeatLoop 定期发送 enquire_link，连接不可用时重连
+func (c *SMPPClient) heartbeatLoop() {
+	ticker := time.NewTicker(defaultHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.performHeartbeat()
+		case <-c.shutdown:
+			return
+		}
+	}
+}
+
+func (c *SMPPClient) performHeartbeat() {
+	conn, _ := c.current()
+	if !c.IsReady() || conn == nil {
+		Warnf("[SMPP][HEARTBEAT] Client not ready, attempting reconnection")
+		if err := c.Connect(); err != nil {
+			Errorf("[SMPP][HEARTBEAT] Reconnection failed: %v", err)
+			return
+		}
+		metrics.reconnects.Inc(ChannelSMPP)
+		return
+	}
+
+	if _, err := conn.SendReq(SmppEnquireLink, nil); err != nil {
+		Errorf("[SMPP][HEARTBEAT] enquire_link failed: %v, will reconnect", err)
+		metrics.heartbeatFailures.Inc(ChannelSMPP)
+		c.pipeline.setReady(&c.ready, false)
+		conn.Close()
+	}
+}
+
+// Stop 发送 unbind 并断开连接（可重复调用）
+func (c *SMPPClient) Stop() {
+	c.shutdownOnce.Do(func() {
+		Infof("[SMPP] Shutting down SMPP client...")
+		close(c.shutdown)
+
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.SendReq(SmppUnbind, nil)
+			c.conn.Close()
+		}
+		c.pipeline.setReady(&c.ready, false)
+		c.mu.Unlock()
+
+		c.wg.Wait()
+		Infof("[SMPP] SMPP client shutdown complete")
+	})
+}
@@ -0,0 +1,345 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMSC 是测试用的最小 SMPP 3.4 模拟器
+// 接受 bind_transceiver，对 submit_sm 返回 message_id 并随即推送状态报告
+type fakeSMSC struct {
+	t        *testing.T
+	password string
+	stat     string // 状态报告的 stat，为空时不推送
+	status   uint32 // submit_sm_resp 的 command_status，非 0 时不返回 message_id
+
+	mu       sync.Mutex
+	conns    []*smppConn
+	submits  []SmppSmPkt
+	nextId   int
+	enquires int
+}
+
+func startFakeSMSC(t *testing.T, password, stat string) (*fakeSMSC, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := &fakeSMSC{t: t, password: password, stat: stat}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			netConn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(newSMPPConn(netConn))
+		}
+	}()
+	return s, ln.Addr().String()
+}
+
+func (s *fakeSMSC) serve(conn *smppConn) {
+	defer conn.Close()
+	for {
+		pdu, err := conn.Recv(0)
+		if err != nil {
+			return
+		}
+		switch pdu.CommandId {
+		case SmppBindTransceiver:
+			var req SmppBindPkt
+			req.Unpack(pdu.Body)
+			status := SmppStatusOK
+			if req.Password != s.password {
+				status = SmppStatusInvPassword
+			}
+			body := append([]byte("fake-smsc"), 0)
+			conn.Send(&SmppPDU{CommandId: SmppBindTransceiverResp, Status: status, SeqNum: pdu.SeqNum, Body: body})
+			if status != SmppStatusOK {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+		case SmppSubmitSm:
+			var req SmppSmPkt
+			req.Unpack(pdu.Body)
+			s.mu.Lock()
+			s.nextId++
+			msgId := fmt.Sprintf("sim-%d", s.nextId)
+			s.submits = append(s.submits, req)
+			status := s.status
+			s.mu.Unlock()
+
+			if status != SmppStatusOK {
+				conn.Send(&SmppPDU{CommandId: SmppSubmitSmResp, Status: status, SeqNum: pdu.SeqNum})
+				continue
+			}
+			conn.Send(&SmppPDU{CommandId: SmppSubmitSmResp, SeqNum: pdu.SeqNum, Body: append([]byte(msgId), 0)})
+			if s.stat != "" {
+				s.deliver(conn, &SmppSmPkt{
+					SourceAddr:      req.DestinationAddr,
+					DestinationAddr: req.SourceAddr,
+					EsmClass:        SmppEsmClassReceipt,
+					ShortMessage: []byte(fmt.Sprintf("id:%s sub:001 dlvrd:001 submit date:2401021504 done date:2401021505 stat:%s err:000 text:",
+						msgId, s.stat)),
+				})
+			}
+		case SmppEnquireLink:
+			s.mu.Lock()
+			s.enquires++
+			s.mu.Unlock()
+			conn.Send(&SmppPDU{CommandId: SmppEnquireLinkResp, SeqNum: pdu.SeqNum})
+		case SmppUnbind:
+			conn.Send(&SmppPDU{CommandId: SmppUnbindResp, SeqNum: pdu.SeqNum})
+			return
+		}
+	}
+}
+
+// deliver 向客户端推送 deliver_sm（上行短信或状态报告）
+func (s *fakeSMSC) deliver(conn *smppConn, p *SmppSmPkt) {
+	conn.SendReq(SmppDeliverSm, p.Pack())
+}
+
+// deliverMO 向最近绑定的连接推送上行短信
+func (s *fakeSMSC) deliverMO(src, dest, text string) {
+	s.mu.Lock()
+	conn := s.conns[len(s.conns)-1]
+	s.mu.Unlock()
+	p := &SmppSmPkt{SourceAddr: src, DestinationAddr: dest}
+	p.SetText(text)
+	s.deliver(conn, p)
+}
+
+func newTestSMPPClient(t *testing.T, addr, password string) *SMPPClient {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(addr)
+	c := NewSMPPClient(&Config{
+		SMPPHost:     host,
+		SMPPPort:     port,
+		SMPPSystemId: "gateway",
+		SMPPPassword: password,
+		SmsAccessNo:  "1064899",
+	})
+	t.Cleanup(c.Stop)
+	return c
+}
+
+// waitFor 轮询直到条件成立或超时
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+func TestSmppSmPktRoundTrip(t *testing.T) {
+	long := ""
+	for i := 0; i < 200; i++ {
+		long += "长"
+	}
+	cases := []string{"Hello", "验证码 123456", long}
+	for _, text := range cases {
+		p := &SmppSmPkt{SourceAddr: "1064899", DestinationAddr: "8613800138000", RegisteredDelivery: 1}
+		p.SetText(text)
+
+		var got SmppSmPkt
+		if err := got.Unpack(p.Pack()); err != nil {
+			t.Fatalf("Unpack failed: %v", err)
+		}
+		if got.SourceAddr != "1064899" || got.DestinationAddr != "8613800138000" || got.RegisteredDelivery != 1 {
+			t.Errorf("Header fields mismatch: %+v", got)
+		}
+		if got.Text() != text {
+			t.Errorf("Text mismatch: got %q want %q", got.Text(), text)
+		}
+	}
+
+	ascii := &SmppSmPkt{}
+	ascii.SetText("Hello")
+	if ascii.DataCoding != SmppCodingDefault {
+		t.Errorf("Expected default coding for ASCII, got %d", ascii.DataCoding)
+	}
+	ucs2 := &SmppSmPkt{}
+	ucs2.SetText(long)
+	if ucs2.DataCoding != SmppCodingUCS2 || ucs2.ShortMessage != nil || ucs2.TLVs[SmppTagMessagePayload] == nil {
+		t.Errorf("Expected long UCS2 text in message_payload: %+v", ucs2)
+	}
+}
+
+func TestSmppParseReceipt(t *testing.T) {
+	p := &SmppSmPkt{
+		EsmClass:     SmppEsmClassReceipt,
+		ShortMessage: []byte("id:0A1B2C sub:001 dlvrd:000 submit date:2401021504 done date:2401021505 stat:UNDELIV err:001 text:hello stat:x"),
+	}
+	r, err := p.ParseReceipt()
+	if err != nil {
+		t.Fatalf("ParseReceipt failed: %v", err)
+	}
+	if r.MessageId != "0A1B2C" || r.Stat != "UNDELIV" || r.Err != "001" {
+		t.Errorf("Unexpected receipt: %+v", r)
+	}
+
+	// 可选参数优先于正文
+	p.TLVs = map[uint16][]byte{
+		SmppTagReceiptedMessageId: append([]byte("ABC"), 0),
+		SmppTagMessageState:       {2},
+	}
+	r, _ = p.ParseReceipt()
+	if r.MessageId != "ABC" || r.Stat != "DELIVRD" {
+		t.Errorf("Expected TLV values, got %+v", r)
+	}
+
+	if _, err := (&SmppSmPkt{ShortMessage: []byte("garbage")}).ParseReceipt(); err == nil {
+		t.Error("Expected error for receipt without id")
+	}
+}
+
+func TestSMPPClientSubmitAndReceipt(t *testing.T) {
+	newTestBoltCache(t)
+	smsc, addr := startFakeSMSC(t, "secret", "DELIVRD")
+	c := newTestSMPPClient(t, addr, "secret")
+
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if !c.IsReady() {
+		t.Fatal("Client should be ready after bind")
+	}
+
+	mes := SmsMes{Src: "01", Dest: "13800138000", Content: "你好", SubmitResult: 65535, DelivleryResult: 65535}
+	if err := c.Submit(&mes); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	waitFor(t, "receipt applied", func() bool {
+		list := *SCache.GetList("list_message", 0, 10)
+		return len(list) == 1 && list[0].DeliveryStat == "DELIVRD"
+	})
+	list := *SCache.GetList("list_message", 0, 10)
+	if list[0].MsgId != "sim-1" || list[0].SubmitResult != 0 || list[0].Channel != ChannelSMPP {
+		t.Errorf("Unexpected stored message: %+v", list[0])
+	}
+
+	smsc.mu.Lock()
+	sub := smsc.submits[0]
+	smsc.mu.Unlock()
+	if sub.SourceAddr != "106489901" || sub.Text() != "你好" || sub.RegisteredDelivery != 1 {
+		t.Errorf("Unexpected submit_sm: %+v", sub)
+	}
+}
+
+func TestSMPPClientSubmitRejected(t *testing.T) {
+	newTestBoltCache(t)
+	smsc, addr := startFakeSMSC(t, "secret", "")
+	smsc.status = SmppStatusUnknownErr
+	c := newTestSMPPClient(t, addr, "secret")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	mes := SmsMes{Dest: "13800138000", Content: "hi", SubmitResult: 65535, DelivleryResult: 65535}
+	if err := c.Submit(&mes); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	waitFor(t, "submit result stored", func() bool {
+		return len(*SCache.GetList("list_message", 0, 10)) == 1
+	})
+	// ESME_RUNKNOWNERR（0xFF）不应与本地保留的 255 混淆
+	if got := (*SCache.GetList("list_message", 0, 10))[0].SubmitResult; got != smppResultBase+0xFF {
+		t.Errorf("Expected submit result 0x%x, got 0x%x", smppResultBase+0xFF, got)
+	}
+	if smppSubmitResult(SmppStatusOK) != 0 || smppSubmitResult(0xFFFFFFFF) != smppResultBase+0xFFFF {
+		t.Error("Unexpected command_status mapping")
+	}
+}
+
+func TestSMPPClientReceivesMO(t *testing.T) {
+	newTestBoltCache(t)
+	smsc, addr := startFakeSMSC(t, "secret", "")
+	c := newTestSMPPClient(t, addr, "secret")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	smsc.deliverMO("13800138000", "1064899", "回复 TD")
+	waitFor(t, "MO stored", func() bool { return SCache.Length("list_mo") == 1 })
+
+	mo := (*SCache.GetList("list_mo", 0, 1))[0]
+	if mo.Src != "13800138000" || mo.Dest != "1064899" || mo.Content != "回复 TD" || mo.Channel != ChannelSMPP {
+		t.Errorf("Unexpected MO: %+v", mo)
+	}
+}
+
+func TestSMPPClientBindRejected(t *testing.T) {
+	_, addr := startFakeSMSC(t, "secret", "")
+	c := newTestSMPPClient(t, addr, "wrong")
+	if err := c.Connect(); err == nil {
+		t.Fatal("Expected bind to fail with wrong password")
+	}
+	if c.IsReady() {
+		t.Error("Client must not be ready after failed bind")
+	}
+}
+
+func TestSMPPClientHeartbeatReconnects(t *testing.T) {
+	newTestBoltCache(t)
+	smsc, addr := startFakeSMSC(t, "secret", "")
+	c := newTestSMPPClient(t, addr, "secret")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	firstGen := c.Generation()
+
+	c.performHeartbeat()
+	waitFor(t, "enquire_link", func() bool {
+		smsc.mu.Lock()
+		defer smsc.mu.Unlock()
+		return smsc.enquires == 1
+	})
+
+	// 等待响应期间连接中断：消息应被记为连接中断，重连后代次变化
+	SCache.SetWaitCache(firstGen, 99, SmsMes{Dest: "13800138000", Channel: ChannelSMPP})
+	smsc.mu.Lock()
+	smsc.conns[0].Close()
+	smsc.mu.Unlock()
+	waitFor(t, "connection loss detected", func() bool { return !c.IsReady() })
+
+	c.performHeartbeat()
+	if !c.IsReady() || c.Generation() == firstGen {
+		t.Fatal("Expected reconnect with new generation")
+	}
+	list := *SCache.GetList("list_message", 0, 10)
+	if len(list) != 1 || list[0].SubmitResult != 253 {
+		t.Errorf("Expected pending submit resolved as lost, got %+v", list)
+	}
+}
+
+func TestDrainStaleWaitIsolatesChannels(t *testing.T) {
+	newTestBoltCache(t)
+	SCache.SetWaitCache(1, 1, SmsMes{Content: "legacy"})
+	SCache.SetWaitCache(2, 1, SmsMes{Content: "smpp", Channel: ChannelSMPP})
+
+	stale, err := SCache.DrainStaleWait(ChannelSMPP, 3)
+	if err != nil {
+		t.Fatalf("DrainStaleWait failed: %v", err)
+	}
+	if len(stale) != 1 || stale[0].Content != "smpp" {
+		t.Fatalf("Expected only the SMPP entry drained, got %+v", stale)
+	}
+	if left := SCache.GetWaitList(); len(left) != 1 || left[0].Content != "legacy" {
+		t.Errorf("CMPP entry must be kept, got %+v", left)
+	}
+}
@@ -0,0 +1,410 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// SMPP 3.4 的 command_id
+const (
+	SmppGenericNack         uint32 = 0x80000000
+	SmppSubmitSm            uint32 = 0x00000004
+	SmppSubmitSmResp        uint32 = 0x80000004
+	SmppDeliverSm           uint32 = 0x00000005
+	SmppDeliverSmResp       uint32 = 0x80000005
+	SmppUnbind              uint32 = 0x00000006
+	SmppUnbindResp          uint32 = 0x80000006
+	SmppBindTransceiver     uint32 = 0x00000009
+	SmppBindTransceiverResp uint32 = 0x80000009
+	SmppEnquireLink         uint32 = 0x00000015
+	SmppEnquireLinkResp     uint32 = 0x80000015
+)
+
+// SMPP 3.4 的 command_status（仅列出网关用到的部分）
+const (
+	SmppStatusOK          uint32 = 0x00000000 // ESME_ROK
+	SmppStatusInvCmdId    uint32 = 0x00000003 // ESME_RINVCMDID
+	SmppStatusSysErr      uint32 = 0x00000008 // ESME_RSYSERR
+	SmppStatusBindFail    uint32 = 0x0000000D // ESME_RBINDFAIL
+	SmppStatusInvPassword uint32 = 0x0000000E // ESME_RINVPASWD
+	SmppStatusInvSysId    uint32 = 0x0000000F // ESME_RINVSYSID
+	SmppStatusThrottled   uint32 = 0x00000058 // ESME_RTHROTTLED
+	SmppStatusUnknownErr  uint32 = 0x000000FF // ESME_RUNKNOWNERR
+)
+
+// smppResultBase 是 command_status 保存为提交结果时的偏移
+// command_status 可能取 0xFF 等值，原样保存会与本地保留的 253～255、65535 混淆
+const smppResultBase uint32 = 0x10000
+
+// smppSubmitResult 将 command_status 转换为提交结果：成功为 0，其余为 0x10000+command_status
+// 超出 0xFFFF 的值（协议保留）按 0xFFFF 处理
+func smppSubmitResult(status uint32) uint32 {
+	if status == SmppStatusOK {
+		return 0
+	}
+	if status > 0xFFFF {
+		status = 0xFFFF
+	}
+	return smppResultBase + status
+}
+
+// 可选参数（TLV）的 tag
+const (
+	SmppTagReceiptedMessageId uint16 = 0x001E
+	SmppTagMessagePayload     uint16 = 0x0424
+	SmppTagMessageState       uint16 = 0x0427
+)
+
+// data_coding
+const (
+	SmppCodingDefault uint8 = 0x00 // SMSC 默认字母表
+	SmppCodingUCS2    uint8 = 0x08
+)
+
+// esm_class 中表示状态报告的位
+const SmppEsmClassReceipt uint8 = 0x04
+
+const (
+	smppHeaderLen = 16
+	// 超过该长度的 PDU 视为非法，避免错误的长度字段导致大量内存分配
+	smppMaxPDULen = 64 * 1024
+	// short_message 的最大长度，更长的内容使用 message_payload 发送
+	smppMaxShortMessage = 254
+)
+
+var errSmppMalformed = errors.New("malformed smpp pdu")
+
+// SmppPDU 是一个完整的 SMPP PDU，Body 为消息头之后的内容
+type SmppPDU struct {
+	CommandId uint32
+	Status    uint32
+	SeqNum    uint32
+	Body      []byte
+}
+
+// Bytes 编码为可直接写出的字节序列
+func (p *SmppPDU) Bytes() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, smppHeaderLen+len(p.Body)))
+	binary.Write(buf, binary.BigEndian, uint32(smppHeaderLen+len(p.Body)))
+	binary.Write(buf, binary.BigEndian, p.CommandId)
+	binary.Write(buf, binary.BigEndian, p.Status)
+	binary.Write(buf, binary.BigEndian, p.SeqNum)
+	buf.Write(p.Body)
+	return buf.Bytes()
+}
+
+// smppReader 按 SMPP 的编码规则顺序读取字段
+type smppReader struct {
+	data []byte
+	err  error
+}
+
+func (r *smppReader) byte() uint8 {
+	if r.err != nil || len(r.data) < 1 {
+		r.err = errSmppMalformed
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+// cstring 读取以 0 结尾的字符串
+func (r *smppReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	i := bytes.IndexByte(r.data, 0)
+	if i < 0 {
+		r.err = errSmppMalformed
+		return ""
+	}
+	s := string(r.data[:i])
+	r.data = r.data[i+1:]
+	return s
+}
+
+func (r *smppReader) bytes(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = errSmppMalformed
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// tlvs 读取剩余的可选参数
+func (r *smppReader) tlvs() map[uint16][]byte {
+	if r.err != nil || len(r.data) == 0 {
+		return nil
+	}
+	m := make(map[uint16][]byte)
+	for len(r.data) >= 4 {
+		tag := binary.BigEndian.Uint16(r.data[0:2])
+		n := int(binary.BigEndian.Uint16(r.data[2:4]))
+		if len(r.data) < 4+n {
+			r.err = errSmppMalformed
+			return m
+		}
+		m[tag] = r.data[4 : 4+n]
+		r.data = r.data[4+n:]
+	}
+	return m
+}
+
+func writeCString(buf *bytes.Buffer, s string) {
+	buf.WriteString(s)
+	buf.WriteByte(0)
+}
+
+func writeTLV(buf *bytes.Buffer, tag uint16, value []byte) {
+	binary.Write(buf, binary.BigEndian, tag)
+	binary.Write(buf, binary.BigEndian, uint16(len(value)))
+	buf.Write(value)
+}
+
+// SmppBindPkt 是 bind_transceiver 请求
+type SmppBindPkt struct {
+	SystemId         string
+	Password         string
+	SystemType       string
+	InterfaceVersion uint8
+	AddrTon          uint8
+	AddrNpi          uint8
+	AddressRange     string
+}
+
+// Pack 编码请求体
+func (p *SmppBindPkt) Pack() []byte {
+	buf := new(bytes.Buffer)
+	writeCString(buf, p.SystemId)
+	writeCString(buf, p.Password)
+	writeCString(buf, p.SystemType)
+	buf.WriteByte(p.InterfaceVersion)
+	buf.WriteByte(p.AddrTon)
+	buf.WriteByte(p.AddrNpi)
+	writeCString(buf, p.AddressRange)
+	return buf.Bytes()
+}
+
+// Unpack 解码请求体
+func (p *SmppBindPkt) Unpack(body []byte) error {
+	r := &smppReader{data: body}
+	p.SystemId = r.cstring()
+	p.Password = r.cstring()
+	p.SystemType = r.cstring()
+	p.InterfaceVersion = r.byte()
+	p.AddrTon = r.byte()
+	p.AddrNpi = r.byte()
+	p.AddressRange = r.cstring()
+	return r.err
+}
+
+// SmppSmPkt 是 submit_sm 与 deliver_sm 共用的消息体
+type SmppSmPkt struct {
+	ServiceType          string
+	SourceAddrTon        uint8
+	SourceAddrNpi        uint8
+	SourceAddr           string
+	DestAddrTon          uint8
+	DestAddrNpi          uint8
+	DestinationAddr      string
+	EsmClass             uint8
+	ProtocolId           uint8
+	PriorityFlag         uint8
+	ScheduleDeliveryTime string
+	ValidityPeriod       string
+	RegisteredDelivery   uint8
+	ReplaceIfPresentFlag uint8
+	DataCoding           uint8
+	SmDefaultMsgId       uint8
+	ShortMessage         []byte
+	TLVs                 map[uint16][]byte
+}
+
+// Pack 编码消息体，TLV 按 tag 排序输出以保证结果稳定
+func (p *SmppSmPkt) Pack() []byte {
+	buf := new(bytes.Buffer)
+	writeCString(buf, p.ServiceType)
+	buf.WriteByte(p.SourceAddrTon)
+	buf.WriteByte(p.SourceAddrNpi)
+	writeCString(buf, p.SourceAddr)
+	buf.WriteByte(p.DestAddrTon)
+	buf.WriteByte(p.DestAddrNpi)
+	writeCString(buf, p.DestinationAddr)
+	buf.WriteByte(p.EsmClass)
+	buf.WriteByte(p.ProtocolId)
+	buf.WriteByte(p.PriorityFlag)
+	writeCString(buf, p.ScheduleDeliveryTime)
+	writeCString(buf, p.ValidityPeriod)
+	buf.WriteByte(p.RegisteredDelivery)
+	buf.WriteByte(p.ReplaceIfPresentFlag)
+	buf.WriteByte(p.DataCoding)
+	buf.WriteByte(p.SmDefaultMsgId)
+	buf.WriteByte(uint8(len(p.ShortMessage)))
+	buf.Write(p.ShortMessage)
+	for _, tag := range []uint16{SmppTagReceiptedMessageId, SmppTagMessagePayload, SmppTagMessageState} {
+		if v, ok := p.TLVs[tag]; ok {
+			writeTLV(buf, tag, v)
+		}
+	}
+	return buf.Bytes()
+}
+
+// Unpack 解码消息体
+func (p *SmppSmPkt) Unpack(body []byte) error {
+	r := &smppReader{data: body}
+	p.ServiceType = r.cstring()
+	p.SourceAddrTon = r.byte()
+	p.SourceAddrNpi = r.byte()
+	p.SourceAddr = r.cstring()
+	p.DestAddrTon = r.byte()
+	p.DestAddrNpi = r.byte()
+	p.DestinationAddr = r.cstring()
+	p.EsmClass = r.byte()
+	p.ProtocolId = r.byte()
+	p.PriorityFlag = r.byte()
+	p.ScheduleDeliveryTime = r.cstring()
+	p.ValidityPeriod = r.cstring()
+	p.RegisteredDelivery = r.byte()
+	p.ReplaceIfPresentFlag = r.byte()
+	p.DataCoding = r.byte()
+	p.SmDefaultMsgId = r.byte()
+	n := r.byte()
+	p.ShortMessage = r.bytes(int(n))
+	p.TLVs = r.tlvs()
+	return r.err
+}
+
+// SetText 按内容选择编码写入正文：纯 ASCII 使用默认字母表，否则使用 UCS2
+// 超过 short_message 长度上限时改用 message_payload
+func (p *SmppSmPkt) SetText(text string) {
+	data := []byte(text)
+	p.DataCoding = SmppCodingDefault
+	if !isASCII(text) {
+		p.DataCoding = SmppCodingUCS2
+		data = encodeUCS2(text)
+	}
+
+	if len(data) > smppMaxShortMessage {
+		if p.TLVs == nil {
+			p.TLVs = make(map[uint16][]byte)
+		}
+		p.TLVs[SmppTagMessagePayload] = data
+		p.ShortMessage = nil
+		return
+	}
+	p.ShortMessage = data
+}
+
+// Text 返回解码后的正文，优先使用 message_payload
+func (p *SmppSmPkt) Text() string {
+	data := p.ShortMessage
+	if payload, ok := p.TLVs[SmppTagMessagePayload]; ok {
+		data = payload
+	}
+	if p.DataCoding == SmppCodingUCS2 {
+		return decodeUCS2(data)
+	}
+	return string(data)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeUCS2 编码为 UTF-16BE（超出 BMP 的字符使用代理对）
+func encodeUCS2(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	buf := make([]byte, len(units)*2)
+	for i, u := range units {
+		binary.BigEndian.PutUint16(buf[i*2:], u)
+	}
+	return buf
+}
+
+func decodeUCS2(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// smppMessageStates 是 message_state 取值与状态报告 stat 文本的对应关系
+var smppMessageStates = map[uint8]string{
+	1: "ENROUTE",
+	2: "DELIVRD",
+	3: "EXPIRED",
+	4: "DELETED",
+	5: "UNDELIV",
+	6: "ACCEPTD",
+	7: "UNKNOWN",
+	8: "REJECTD",
+}
+
+// SmppReceipt 是从 deliver_sm 中解析出的状态报告
+type SmppReceipt struct {
+	MessageId string
+	Stat      string
+	Err       string
+}
+
+// ParseReceipt 解析状态报告
+//
+// 优先使用 receipted_message_id / message_state 可选参数，
+// 否则解析正文中的 "id:xxx sub:001 dlvrd:001 ... stat:DELIVRD err:000" 格式
+func (p *SmppSmPkt) ParseReceipt() (SmppReceipt, error) {
+	var r SmppReceipt
+	text := string(p.ShortMessage)
+	fields := parseReceiptText(text)
+	r.MessageId = fields["id"]
+	r.Stat = strings.ToUpper(fields["stat"])
+	r.Err = fields["err"]
+
+	if v, ok := p.TLVs[SmppTagReceiptedMessageId]; ok {
+		r.MessageId = string(bytes.TrimRight(v, "\x00"))
+	}
+	if v, ok := p.TLVs[SmppTagMessageState]; ok && len(v) == 1 {
+		if stat, ok := smppMessageStates[v[0]]; ok {
+			r.Stat = stat
+		}
+	}
+
+	if r.MessageId == "" || r.Stat == "" {
+		return r, fmt.Errorf("%w: receipt without id or stat: %q", errSmppMalformed, text)
+	}
+	return r, nil
+}
+
+// parseReceiptText 将 "key:value" 形式的状态报告正文拆成字段
+// "submit date" 和 "done date" 的 key 中带空格，需要单独处理
+func parseReceiptText(text string) map[string]string {
+	fields := make(map[string]string)
+	text = strings.NewReplacer("submit date:", "submit_date:", "done date:", "done_date:").Replace(text)
+	for _, part := range strings.Fields(text) {
+		k, v, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		k = strings.ToLower(k)
+		if _, exists := fields[k]; !exists {
+			fields[k] = v
+		}
+		// text 之后是原文片段，不再解析
+		if k == "text" {
+			break
+		}
+	}
+	return fields
+}
@@ -0,0 +1,203 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 时间序列统计的粒度
+const (
+	statsMinute = "minute"
+	statsHour   = "hour"
+	statsDay    = "day"
+)
+
+// 单次查询最多返回的时间段数量
+const maxStatsPoints = 1500
+
+// StatCounts 一个时间段内的消息数量
+type StatCounts struct {
+	Submitted int64 `json:"submitted"` // 下发记录，含提交失败
+	Succeeded int64 `json:"succeeded"` // 网关接受的下发
+	Failed    int64 `json:"failed"`    // 网关拒绝或本地失败的下发
+	Delivered int64 `json:"delivered"` // 状态报告为 DELIVRD 的下发
+	MO        int64 `json:"mo"`        // 上行短信
+}
+
+// StatsPoint 时间序列中的一个时间段，Time 为时间段的起始时间
+type StatsPoint struct {
+	Time time.Time `json:"time"`
+	StatCounts
+}
+
+// fields 返回各项数量的字段名与指针，用于按字段读写存储
+func (s *StatCounts) fields() map[string]*int64 {
+	return map[string]*int64{
+		"submitted": &s.Submitted,
+		"succeeded": &s.Succeeded,
+		"failed":    &s.Failed,
+		"delivered": &s.Delivered,
+		"mo":        &s.MO,
+	}
+}
+
+// add 累加另一组数量
+func (s *StatCounts) add(d StatCounts) {
+	s.Submitted += d.Submitted
+	s.Succeeded += d.Succeeded
+	s.Failed += d.Failed
+	s.Delivered += d.Delivered
+	s.MO += d.MO
+}
+
+// totalStats 将累计统计转为 GetStats 返回的格式
+func totalStats(total StatCounts) map[string]int {
+	return map[string]int{
+		"total":   int(total.Submitted),
+		"success": int(total.Succeeded),
+		"failed":  int(total.Failed),
+	}
+}
+
+// statsResolution 统计粒度的存储方式
+type statsResolution struct {
+	name      string
+	prefix    string        // 存储 key 前缀
+	layout    string        // 时间段在 key 中的格式（本地时区）
+	retention time.Duration // 保留时长，过期的时间段会被清理
+	points    int           // 未指定时间范围时返回的时间段数量
+}
+
+var statsResolutions = []statsResolution{
+	{statsMinute, "m:", "200601021504", 48 * time.Hour, 60},
+	{statsHour, "h:", "2006010215", 90 * 24 * time.Hour, 24},
+	{statsDay, "d:", "20060102", 2 * 365 * 24 * time.Hour, 30},
+}
+
+// findStatsResolution 按名称查找统计粒度
+func findStatsResolution(name string) (statsResolution, bool) {
+	for _, res := range statsResolutions {
+		if res.name == name {
+			return res, true
+		}
+	}
+	return statsResolution{}, false
+}
+
+// key 返回时间所在时间段的存储 key
+func (r statsResolution) key(t time.Time) string {
+	return r.prefix + t.In(time.Local).Format(r.layout)
+}
+
+// truncate 返回时间所在时间段的起始时间
+func (r statsResolution) truncate(t time.Time) time.Time {
+	start, _ := time.ParseInLocation(r.layout, t.In(time.Local).Format(r.layout), time.Local)
+	return start
+}
+
+// add 返回 n 个时间段之后的起始时间，按天统计时以自然日计算
+func (r statsResolution) add(t time.Time, n int) time.Time {
+	switch r.name {
+	case statsMinute:
+		return t.Add(time.Duration(n) * time.Minute)
+	case statsHour:
+		return t.Add(time.Duration(n) * time.Hour)
+	default:
+		return t.AddDate(0, 0, n)
+	}
+}
+
+// periods 返回 [from, to) 范围内各时间段的起始时间
+func (r statsResolution) periods(from, to time.Time) []time.Time {
+	var result []time.Time
+	for t := r.truncate(from); t.Before(to) && len(result) <= maxStatsPoints; t = r.add(t, 1) {
+		result = append(result, t)
+	}
+	return result
+}
+
+// statsTime 返回计入统计的时间，未记录时使用当前时间
+func statsTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+// submitCounts 返回一条下发记录计入的数量
+func submitCounts(mes *SmsMes) StatCounts {
+	d := StatCounts{Submitted: 1}
+	if mes.SubmitResult == 0 {
+		d.Succeeded = 1
+	} else {
+		d.Failed = 1
+	}
+	// 状态报告先于提交响应到达时随下发记录一起入库
+	if mes.DeliveryStat == "DELIVRD" {
+		d.Delivered = 1
+	}
+	return d
+}
+
+// getTimeSeries 返回按分钟、小时或天汇总的下发与上行数量
+//
+// 参数: resolution（minute、hour 或 day，默认 hour）、from/to（格式同列表搜索）。
+// 未指定时间范围时返回截至当前的最近 60 分钟、24 小时或 30 天
+func getTimeSeries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "", "仅支持 GET")
+		return
+	}
+	r.ParseForm()
+
+	name := r.Form.Get("resolution")
+	if name == "" {
+		name = statsHour
+	}
+	res, ok := findStatsResolution(name)
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, "invalid_param", "resolution", "resolution 仅支持 minute、hour 或 day")
+		return
+	}
+	from, to, err := ValidateTimeRange(r.Form.Get("from"), r.Form.Get("to"))
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if to.IsZero() {
+		to = res.add(res.truncate(time.Now()), 1)
+	}
+	if from.IsZero() {
+		from = res.add(res.truncate(to.Add(-time.Nanosecond)), 1-res.points)
+	}
+	if len(res.periods(from, to)) > maxStatsPoints {
+		writeValidationError(w, &ValidationError{
+			Field:   "from",
+			Message: fmt.Sprintf("时间范围过大，最多返回 %d 个时间段", maxStatsPoints),
+		})
+		return
+	}
+
+	points, err := SCache.GetTimeSeries(res.name, from, to)
+	if err != nil {
+		Errorf("[HTTP] Failed to load %s statistics: %v", res.name, err)
+		writeAPIError(w, http.StatusServiceUnavailable, "storage_unavailable", "", "读取统计失败")
+		return
+	}
+	total := StatCounts{}
+	for _, p := range points {
+		total.add(p.StatCounts)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"resolution": res.name,
+		"from":       from,
+		"to":         to,
+		"total":      total,
+		"data":       points,
+	})
+}
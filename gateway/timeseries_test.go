@@ -0,0 +1,190 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestStatsResolution(t *testing.T) {
+	at := time.Date(2026, 3, 1, 23, 59, 30, 0, time.Local)
+	tests := []struct {
+		name  string
+		key   string
+		start time.Time
+		next  time.Time
+	}{
+		{statsMinute, "m:202603012359", time.Date(2026, 3, 1, 23, 59, 0, 0, time.Local), time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local)},
+		{statsHour, "h:2026030123", time.Date(2026, 3, 1, 23, 0, 0, 0, time.Local), time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local)},
+		{statsDay, "d:20260301", time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local), time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tc := range tests {
+		res, ok := findStatsResolution(tc.name)
+		if !ok {
+			t.Fatalf("Resolution %s not found", tc.name)
+		}
+		if got := res.key(at); got != tc.key {
+			t.Errorf("%s key = %s, want %s", tc.name, got, tc.key)
+		}
+		if got := res.truncate(at); !got.Equal(tc.start) {
+			t.Errorf("%s truncate = %v, want %v", tc.name, got, tc.start)
+		}
+		if got := res.add(tc.start, 1); !got.Equal(tc.next) {
+			t.Errorf("%s add = %v, want %v", tc.name, got, tc.next)
+		}
+	}
+
+	day, _ := findStatsResolution(statsDay)
+	periods := day.periods(time.Date(2026, 2, 27, 12, 0, 0, 0, time.Local), time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local))
+	if len(periods) != 3 || !periods[2].Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Unexpected day periods %v", periods)
+	}
+	if _, ok := findStatsResolution("week"); ok {
+		t.Error("Unknown resolution should not be found")
+	}
+}
+
+func TestBoltCacheTimeSeries(t *testing.T) {
+	cache := newTestBoltCache(t)
+	at := time.Date(2026, 3, 1, 10, 15, 0, 0, time.Local)
+	cache.AddSubmits(&SmsMes{Id: "m1", MsgId: "1", SubmitTime: at})
+	cache.AddSubmits(&SmsMes{Id: "m2", MsgId: "2", SubmitTime: at.Add(time.Minute), SubmitResult: 8})
+	cache.AddSubmits(&SmsMes{Id: "m3", MsgId: "3", SubmitTime: at.Add(time.Hour), DeliveryStat: "DELIVRD"})
+	cache.AddMoList(&SmsMes{Src: "13900000000", Created: at.Add(2 * time.Minute)})
+
+	hours, err := cache.GetTimeSeries(statsHour, at.Add(-time.Hour), at.Add(105*time.Minute))
+	if err != nil || len(hours) != 3 {
+		t.Fatalf("Expected 3 hourly points, got %v (err %v)", hours, err)
+	}
+	want := []StatCounts{{}, {Submitted: 2, Succeeded: 1, Failed: 1, MO: 1}, {Submitted: 1, Succeeded: 1, Delivered: 1}}
+	for i, p := range hours {
+		if p.StatCounts != want[i] {
+			t.Errorf("Hour %v: got %+v, want %+v", p.Time, p.StatCounts, want[i])
+		}
+	}
+	minutes, _ := cache.GetTimeSeries(statsMinute, at, at.Add(3*time.Minute))
+	if len(minutes) != 3 || minutes[1].Failed != 1 || minutes[2].MO != 1 {
+		t.Errorf("Unexpected minute points %+v", minutes)
+	}
+
+	// 投递成功按状态报告到达的时间计入，重复的状态报告只计一次
+	for i := 0; i < 2; i++ {
+		if _, ok, err := cache.ApplyReceipt("1", deliveryResultDelivered, "DELIVRD"); !ok || err != nil {
+			t.Fatalf("ApplyReceipt failed: %v %v", ok, err)
+		}
+	}
+	cache.ApplyReceipt("2", deliveryResultFailed, "UNDELIV")
+	now := time.Now()
+	days, _ := cache.GetTimeSeries(statsDay, now.Add(-time.Hour), now.Add(time.Hour))
+	delivered := int64(0)
+	for _, p := range days {
+		delivered += p.Delivered
+	}
+	if delivered != 1 {
+		t.Errorf("Expected 1 delivered receipt today, got %d", delivered)
+	}
+
+	// 超过保留时长的时间段在写入时清理
+	old := at.AddDate(-3, 0, 0)
+	cache.db.Update(func(tx *bolt.Tx) error {
+		return cache.addStats(tx, old, StatCounts{MO: 1})
+	})
+	cache.statsSwept = time.Time{}
+	now = time.Now()
+	cache.AddMoList(&SmsMes{Src: "13900000000", Created: now})
+	cache.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(statsBucket)
+		for _, res := range statsResolutions {
+			if b.Get([]byte(res.key(old))) != nil {
+				t.Errorf("Expired %s statistics should be removed", res.name)
+			}
+			if b.Get([]byte(res.key(now))) == nil {
+				t.Errorf("Current %s statistics should be kept", res.name)
+			}
+		}
+		return nil
+	})
+}
+
+func TestGetTimeSeries(t *testing.T) {
+	withAPIClients(t)
+	cache := newTestBoltCache(t)
+	cache.AddSubmits(&SmsMes{Id: "m1", SubmitTime: time.Now()})
+
+	rec, out := apiRequest(t, getTimeSeries, "GET", "/api/v1/stats/timeseries", "", nil)
+	if rec.Code != http.StatusOK || out["resolution"] != statsHour {
+		t.Fatalf("Unexpected response %d %v", rec.Code, out)
+	}
+	data := out["data"].([]interface{})
+	if len(data) != 24 {
+		t.Fatalf("Expected 24 hourly points, got %d", len(data))
+	}
+	if last := data[23].(map[string]interface{}); last["submitted"] != float64(1) || last["succeeded"] != float64(1) {
+		t.Errorf("Current hour should include the new message: %v", last)
+	}
+	if total := out["total"].(map[string]interface{}); total["submitted"] != float64(1) {
+		t.Errorf("Unexpected total %v", total)
+	}
+
+	_, out = apiRequest(t, getTimeSeries, "GET", "/api/v1/stats/timeseries?resolution=day", "", nil)
+	if n := len(out["data"].([]interface{})); n != 30 {
+		t.Errorf("Expected 30 daily points, got %d", n)
+	}
+	_, out = apiRequest(t, getTimeSeries, "GET", "/api/v1/stats/timeseries?resolution=minute&from=2026-03-01T10:00&to=2026-03-01T10:05", "", nil)
+	if n := len(out["data"].([]interface{})); n != 5 {
+		t.Errorf("Expected 5 minute points, got %d", n)
+	}
+
+	for _, query := range []string{"resolution=week", "from=yesterday", "resolution=minute&from=2026-01-01&to=2026-03-01"} {
+		if rec, _ := apiRequest(t, getTimeSeries, "GET", "/api/v1/stats/timeseries?"+query, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestBoltCacheTotalStats(t *testing.T) {
+	cache := newTestBoltCache(t)
+	// 升级前写入的记录没有累计统计，启动时按记录初始化
+	cache.db.Update(func(tx *bolt.Tx) error {
+		tx.Bucket(statsBucket).Delete(statsTotalKey)
+		b := tx.Bucket(messageBucket)
+		for _, mes := range []SmsMes{{Id: "old1", SubmitResult: 0}, {Id: "old2", SubmitResult: 8}} {
+			v, _ := json.Marshal(mes)
+			b.Put(timeKey(tx, b), v)
+		}
+		return initStatsTotal(tx)
+	})
+	for i := 0; i < 1500; i++ {
+		cache.AddSubmits(&SmsMes{Id: fmt.Sprintf("n%d", i), SubmitResult: uint32(i % 3)})
+	}
+
+	want := map[string]int{"total": 1502, "success": 501, "failed": 1001}
+	if got := cache.GetStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetStats = %v, want %v", got, want)
+	}
+}
+
+func TestBoltCacheClientStats(t *testing.T) {
+	cache := newTestBoltCache(t)
+	cache.AddSubmits(&SmsMes{Id: "c1", Client: "acme", MsgId: "1", SubmitResult: 0, DeliveryStat: "DELIVRD"})
+	cache.AddSubmits(&SmsMes{Id: "c2", Client: "acme", MsgId: "SEND_ERROR", SubmitResult: 254})
+	cache.AddSubmits(&SmsMes{Id: "c3", Client: "beta", MsgId: "3", SubmitResult: 0})
+	cache.AddSubmits(&SmsMes{Id: "c4", MsgId: "4", SubmitResult: 0})
+	cache.AddMoList(&SmsMes{Client: "acme", Content: "hi"})
+
+	want := StatCounts{Submitted: 2, Succeeded: 1, Failed: 1, MO: 1}
+	if got, err := cache.GetClientStats("acme"); err != nil || got != want {
+		t.Errorf("Unexpected stats for acme: %+v %v", got, err)
+	}
+	if got, _ := cache.GetClientStats("nobody"); got != (StatCounts{}) {
+		t.Errorf("Expected zero stats for unknown client, got %+v", got)
+	}
+	if got, _ := cache.GetClientStats("beta"); got.Submitted != 1 || got.Succeeded != 1 {
+		t.Errorf("Unexpected stats for beta: %+v", got)
+	}
+}
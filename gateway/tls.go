@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// newCMPPTLSConfig 根据配置构建连接 ISMG 使用的 TLS 配置
+// 每次连接时重新加载，证书轮换后无需重启网关
+func newCMPPTLSConfig(cfg *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.CMPPTLSServerName,
+		InsecureSkipVerify: cfg.CMPPTLSInsecureSkipVerify,
+	}
+
+	if cfg.CMPPTLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.CMPPTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CMPPTLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CMPPTLSCertFile != "" || cfg.CMPPTLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CMPPTLSCertFile, cfg.CMPPTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// httpsCertReloader 为 HTTPS 服务提供证书与客户端 CA，文件修改后在下一次握手时重新加载
+// 新文件加载失败时继续使用旧证书，避免证书轮换过程中（如只写入了一个文件）服务中断
+type httpsCertReloader struct {
+	certFile, keyFile, caFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamp     string // 上次尝试加载时各文件的修改时间与大小
+}
+
+// fileStamp 返回文件的修改时间与大小，用于判断文件是否变化
+func fileStamp(paths ...string) string {
+	var b strings.Builder
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if fi, err := os.Stat(p); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", p, fi.ModTime().UnixNano(), fi.Size())
+		} else {
+			fmt.Fprintf(&b, "%s:missing;", p)
+		}
+	}
+	return b.String()
+}
+
+// load 读取证书、私钥与客户端 CA
+func (l *httpsCertReloader) load() (*tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load certificate: %w", err)
+	}
+	if l.caFile == "" {
+		return &cert, nil, nil
+	}
+	pem, err := os.ReadFile(l.caFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, nil, fmt.Errorf("no certificates found in client CA file %s", l.caFile)
+	}
+	return &cert, pool, nil
+}
+
+// reload 在文件变化时重新加载，返回当前使用的证书与客户端 CA
+func (l *httpsCertReloader) reload() (*tls.Certificate, *x509.CertPool, error) {
+	stamp := fileStamp(l.certFile, l.keyFile, l.caFile)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if stamp == l.stamp {
+		return l.cert, l.clientCAs, nil
+	}
+	// 同一组文件只尝试一次，失败时不在每次握手时重复记录日志
+	l.stamp = stamp
+	cert, pool, err := l.load()
+	if err != nil {
+		if l.cert == nil {
+			return nil, nil, err
+		}
+		Warnf("[HTTP] 重新加载 HTTPS 证书失败，继续使用旧证书: %v", err)
+		return l.cert, l.clientCAs, nil
+	}
+	if l.cert != nil {
+		Infof("[HTTP] HTTPS 证书已重新加载")
+	}
+	l.cert, l.clientCAs = cert, pool
+	return cert, pool, nil
+}
+
+// newHTTPSTLSConfig 根据配置构建 HTTPS 服务的 TLS 配置，启动时证书无法加载则返回错误
+func newHTTPSTLSConfig(cfg *Config) (*tls.Config, error) {
+	if cfg.HTTPSCertFile == "" || cfg.HTTPSKeyFile == "" {
+		return nil, fmt.Errorf("https_cert_file and https_key_file must both be set")
+	}
+	if cfg.HTTPSRequireClientCert && cfg.HTTPSClientCAFile == "" {
+		return nil, fmt.Errorf("https_require_client_cert requires https_client_ca_file")
+	}
+	l := &httpsCertReloader{certFile: cfg.HTTPSCertFile, keyFile: cfg.HTTPSKeyFile, caFile: cfg.HTTPSClientCAFile}
+	if _, _, err := l.reload(); err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _, err := l.reload()
+			return cert, err
+		},
+	}
+	if cfg.HTTPSClientCAFile == "" {
+		return base, nil
+	}
+
+	// 只在客户端提供证书时校验，浏览器访问管理界面不受影响；客户端是否必须提供证书见 APIClient.CertCN
+	base.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.HTTPSRequireClientCert {
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	// 每次握手使用最新的客户端 CA
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		_, pool, err := l.reload()
+		if err != nil {
+			return nil, err
+		}
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = pool
+		return c, nil
+	}
+	return base, nil
+}
+
+// peerCertNames 返回已验证的客户端证书的 CN 与 DNS 名称，未提供或未通过验证时为空
+func peerCertNames(state *tls.ConnectionState) []string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	leaf := state.VerifiedChains[0][0]
+	return append([]string{leaf.Subject.CommonName}, leaf.DNSNames...)
+}
+
+// httpsRedirect 将明文 HTTP 请求重定向到 HTTPS 端口
+func httpsRedirect(httpsPort string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		// 非 GET 请求使用 308，客户端重定向后保持方法与请求体
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	}
+}
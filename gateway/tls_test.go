@@ -0,0 +1,327 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert 生成的证书及其 PEM 文件路径
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	tls      tls.Certificate
+	certFile string
+	keyFile  string
+}
+
+// newTestCert 生成测试证书，parent 为 nil 时生成自签名 CA
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	dir := t.TempDir()
+	tc := &testCert{cert: cert, key: key,
+		certFile: filepath.Join(dir, name+".crt"), keyFile: filepath.Join(dir, name+".key")}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	os.WriteFile(tc.certFile, certPEM, 0600)
+	os.WriteFile(tc.keyFile, keyPEM, 0600)
+	tc.tls, _ = tls.X509KeyPair(certPEM, keyPEM)
+	return tc
+}
+
+// startFakeTLSISMG 启动要求客户端证书的 TLS ISMG
+func startFakeTLSISMG(t *testing.T, ca, server *testCert) string {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server.tls},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			netConn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeISMG(newCMPPConn(netConn))
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClientManagerConnectTLS(t *testing.T) {
+	ca := newTestCert(t, "test-ca", nil)
+	server := newTestCert(t, "ismg.example.com", ca)
+	client := newTestCert(t, "gateway", ca)
+
+	addr := startFakeTLSISMG(t, ca, server)
+	host, port, _ := net.SplitHostPort(addr)
+
+	cfg := &Config{
+		CMPPHost:          host,
+		CMPPPort:          port,
+		User:              "104221",
+		Password:          "secret",
+		CMPPTLS:           true,
+		CMPPTLSCAFile:     ca.certFile,
+		CMPPTLSCertFile:   client.certFile,
+		CMPPTLSKeyFile:    client.keyFile,
+		CMPPTLSServerName: "ismg.example.com",
+	}
+	cm := NewClientManager(cfg)
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("TLS connect failed: %v", err)
+	}
+	cm.StartReceiver()
+	defer cm.Shutdown()
+
+	if _, err := cm.Query("20240102", QueryTypeTotal, ""); err != nil {
+		t.Fatalf("Query over TLS failed: %v", err)
+	}
+}
+
+func TestClientManagerConnectTLSRejectsWrongServerName(t *testing.T) {
+	ca := newTestCert(t, "test-ca", nil)
+	server := newTestCert(t, "ismg.example.com", ca)
+	client := newTestCert(t, "gateway", ca)
+
+	addr := startFakeTLSISMG(t, ca, server)
+	host, port, _ := net.SplitHostPort(addr)
+
+	cm := NewClientManager(&Config{
+		CMPPHost:          host,
+		CMPPPort:          port,
+		CMPPTLS:           true,
+		CMPPTLSCAFile:     ca.certFile,
+		CMPPTLSCertFile:   client.certFile,
+		CMPPTLSKeyFile:    client.keyFile,
+		CMPPTLSServerName: "other.example.com",
+	})
+	if err := cm.Connect(); err == nil {
+		t.Fatal("Expected certificate verification to fail")
+	}
+	cm.Shutdown()
+}
+
+func TestNewCMPPTLSConfigErrors(t *testing.T) {
+	if _, err := newCMPPTLSConfig(&Config{CMPPTLSCAFile: "/nonexistent/ca.pem"}); err == nil {
+		t.Error("Expected error for missing CA file")
+	}
+	if _, err := newCMPPTLSConfig(&Config{CMPPTLSCertFile: "/nonexistent/client.crt"}); err == nil {
+		t.Error("Expected error for missing client certificate")
+	}
+}
+
+// startTestHTTPS 使用 HTTPS 配置启动测试服务器，返回地址
+func startTestHTTPS(t *testing.T, cfg *Config, h http.Handler) string {
+	t.Helper()
+	tlsConfig, err := newHTTPSTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("newHTTPSTLSConfig failed: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	srv := &http.Server{Handler: h, TLSConfig: tlsConfig}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+// httpsGet 发起 HTTPS 请求（不复用连接），返回响应与服务端证书
+func httpsGet(ca *testCert, client *testCert, url, key string) (*http.Response, error) {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	tlsConfig := &tls.Config{RootCAs: pool, ServerName: "gw.example.com"}
+	if client != nil {
+		tlsConfig.Certificates = []tls.Certificate{client.tls}
+	}
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true}}
+	req, _ := http.NewRequest("GET", url, nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	resp, err := c.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestHTTPSCertificateReload(t *testing.T) {
+	ca := newTestCert(t, "test-ca", nil)
+	first := newTestCert(t, "gw.example.com", ca)
+	cfg := &Config{HTTPSCertFile: first.certFile, HTTPSKeyFile: first.keyFile}
+	addr := startTestHTTPS(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serial := func() *big.Int {
+		t.Helper()
+		resp, err := httpsGet(ca, nil, "https://"+addr+"/", "")
+		if err != nil {
+			t.Fatalf("HTTPS request failed: %v", err)
+		}
+		return resp.TLS.PeerCertificates[0].SerialNumber
+	}
+	if got := serial(); got.Cmp(first.cert.SerialNumber) != 0 {
+		t.Fatalf("Expected first certificate, got serial %v", got)
+	}
+
+	// 覆盖证书文件后新连接使用新证书
+	second := newTestCert(t, "gw.example.com", ca)
+	// 显式修改时间，避免文件系统时间精度不足导致检测不到变化
+	mtime := time.Now()
+	writeFile := func(dst string, data []byte) {
+		mtime = mtime.Add(time.Second)
+		os.WriteFile(dst, data, 0600)
+		os.Chtimes(dst, mtime, mtime)
+	}
+	copyFile := func(src, dst string) {
+		data, _ := os.ReadFile(src)
+		writeFile(dst, data)
+	}
+	copyFile(second.certFile, first.certFile)
+	copyFile(second.keyFile, first.keyFile)
+	if got := serial(); got.Cmp(second.cert.SerialNumber) != 0 {
+		t.Fatalf("Expected reloaded certificate, got serial %v", got)
+	}
+
+	// 新文件无效时继续使用旧证书
+	writeFile(first.certFile, []byte("broken"))
+	if got := serial(); got.Cmp(second.cert.SerialNumber) != 0 {
+		t.Errorf("Expected previous certificate to stay in use, got serial %v", got)
+	}
+}
+
+func TestHTTPSClientCertificate(t *testing.T) {
+	ca := newTestCert(t, "test-ca", nil)
+	server := newTestCert(t, "gw.example.com", ca)
+	partner := newTestCert(t, "partner.example.com", ca)
+	other := newTestCert(t, "other.example.com", ca)
+	withAPIClients(t,
+		APIClient{Name: "partner", Key: "partner-key", CertCN: "partner.example.com"},
+		APIClient{Name: "plain", Key: "plain-key"},
+	)
+
+	cfg := &Config{HTTPSCertFile: server.certFile, HTTPSKeyFile: server.keyFile, HTTPSClientCAFile: ca.certFile}
+	h := requireAPIClient(func(w http.ResponseWriter, r *http.Request) {})
+	url := "https://" + startTestHTTPS(t, cfg, h) + "/api/stats"
+
+	tests := []struct {
+		name   string
+		client *testCert
+		key    string
+		want   int
+	}{
+		{"bound key without certificate", nil, "partner-key", http.StatusForbidden},
+		{"bound key with wrong certificate", other, "partner-key", http.StatusForbidden},
+		{"bound key with matching certificate", partner, "partner-key", http.StatusOK},
+		{"unbound key without certificate", nil, "plain-key", http.StatusOK},
+	}
+	for _, tc := range tests {
+		resp, err := httpsGet(ca, tc.client, url, tc.key)
+		if err != nil {
+			t.Errorf("%s: request failed: %v", tc.name, err)
+			continue
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, resp.StatusCode)
+		}
+	}
+
+	// 要求客户端证书时没有证书的连接在握手阶段被拒绝
+	cfg.HTTPSRequireClientCert = true
+	url = "https://" + startTestHTTPS(t, cfg, h) + "/api/stats"
+	if _, err := httpsGet(ca, nil, url, "plain-key"); err == nil {
+		t.Error("Expected handshake to fail without client certificate")
+	}
+	if resp, err := httpsGet(ca, partner, url, "partner-key"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 with client certificate, got %v %v", resp, err)
+	}
+}
+
+func TestNewHTTPSTLSConfigErrors(t *testing.T) {
+	ca := newTestCert(t, "test-ca", nil)
+	server := newTestCert(t, "gw.example.com", ca)
+	for name, cfg := range map[string]*Config{
+		"missing key":        {HTTPSCertFile: server.certFile},
+		"missing file":       {HTTPSCertFile: "/nonexistent/server.crt", HTTPSKeyFile: server.keyFile},
+		"mismatched key":     {HTTPSCertFile: server.certFile, HTTPSKeyFile: ca.keyFile},
+		"require without CA": {HTTPSCertFile: server.certFile, HTTPSKeyFile: server.keyFile, HTTPSRequireClientCert: true},
+		"invalid client CA":  {HTTPSCertFile: server.certFile, HTTPSKeyFile: server.keyFile, HTTPSClientCAFile: server.keyFile},
+		"missing client CA":  {HTTPSCertFile: server.certFile, HTTPSKeyFile: server.keyFile, HTTPSClientCAFile: "/nonexistent/ca.pem"},
+	} {
+		if _, err := newHTTPSTLSConfig(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		method, target, host, port string
+		status                     int
+		location                   string
+	}{
+		{"GET", "/list_message?page=2", "gw.example.com", "8443", http.StatusMovedPermanently, "https://gw.example.com:8443/list_message?page=2"},
+		{"GET", "/", "gw.example.com:80", "443", http.StatusMovedPermanently, "https://gw.example.com/"},
+		{"POST", "/submit", "10.0.0.1:8080", "8443", http.StatusPermanentRedirect, "https://10.0.0.1:8443/submit"},
+		{"GET", "/", "[::1]:80", "443", http.StatusMovedPermanently, "https://[::1]/"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		req.Host = tc.host
+		rec := httptest.NewRecorder()
+		httpsRedirect(tc.port)(rec, req)
+		if rec.Code != tc.status || rec.Header().Get("Location") != tc.location {
+			t.Errorf("%s %s%s: got %d %q, want %d %q", tc.method, tc.host, tc.target, rec.Code, rec.Header().Get("Location"), tc.status, tc.location)
+		}
+	}
+}
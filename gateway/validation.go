@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"time"
 	"unicode/utf8"
 )
 
@@ -27,6 +28,9 @@ var (
 
 	// 扩展码正则: 纯数字，1-6位
 	extCodeRegex = regexp.MustCompile(`^\d{1,6}$`)
+
+	// 状态报告状态正则: CMPP 的 Stat 字段为 7 个字符，如 DELIVRD、MA:0001
+	deliveryStatRegex = regexp.MustCompile(`^[A-Za-z0-9:_]{1,7}$`)
 )
 
 // ValidationError 表示参数验证错误
@@ -137,6 +141,72 @@ func ValidateSearchParams(dest, src, content string) error {
 	return nil
 }
 
+// ValidateMsgIdFilter 验证 MsgId 搜索条件
+//
+// 参数:
+//   - msgId: 十进制、十六进制 MsgId 或 MMDDhhmm[ss]~MMDDhhmm[ss] 时间范围（可选）
+//
+// 返回:
+//   - error: 验证失败时返回 ValidationError
+func ValidateMsgIdFilter(msgId string) error {
+	if msgId == "" {
+		return nil
+	}
+
+	if _, err := parseMsgIdFilter(msgId); err != nil {
+		return &ValidationError{
+			Field:   "msgid",
+			Message: fmt.Sprintf("无效的消息ID条件: %s（支持十进制、十六进制或 MMDDhhmm~MMDDhhmm 时间范围）", msgId),
+		}
+	}
+
+	return nil
+}
+
+// ValidateSubmitResult 验证提交结果码搜索条件
+//
+// 参数:
+//   - result: 网关返回的提交结果码，十进制（可选）
+//
+// 返回:
+//   - error: 验证失败时返回 ValidationError
+func ValidateSubmitResult(result string) error {
+	if result == "" {
+		return nil
+	}
+
+	if _, err := strconv.ParseUint(result, 10, 32); err != nil {
+		return &ValidationError{
+			Field:   "submit_result",
+			Message: fmt.Sprintf("无效的提交结果码: %s", result),
+		}
+	}
+
+	return nil
+}
+
+// ValidateDeliveryStat 验证状态报告状态搜索条件，如 DELIVRD、UNDELIV、MA:0001
+//
+// 参数:
+//   - stat: 状态报告中的 Stat 字段（可选，不区分大小写）
+//
+// 返回:
+//   - error: 验证失败时返回 ValidationError
+func ValidateDeliveryStat(stat string) error {
+	if stat == "" {
+		return nil
+	}
+
+	if !deliveryStatRegex.MatchString(stat) {
+		return &ValidationError{
+			Field:   "delivery_stat",
+			Message: fmt.Sprintf("无效的状态报告状态: %s（最多 7 个字母、数字或冒号）", stat),
+		}
+	}
+
+	return nil
+}
+
 // ValidatePageParam 验证分页参数
 //
 // 参数:
@@ -177,3 +247,74 @@ func ValidatePageParam(page string) (pageNum int, err error) {
 
 	return num, nil
 }
+
+// ValidatePageSize 验证每页条数，为空时返回 def，最大为 apiMaxPageSize
+func ValidatePageSize(size string, def int) (int, error) {
+	if size == "" {
+		return def, nil
+	}
+	num, err := strconv.Atoi(size)
+	if err != nil || num < 1 || num > apiMaxPageSize {
+		return 0, &ValidationError{
+			Field:   "page_size",
+			Message: fmt.Sprintf("无效的每页条数: %s（应为 1-%d）", size, apiMaxPageSize),
+		}
+	}
+	return num, nil
+}
+
+// 时间范围参数支持的格式，按本地时区解析
+var timeParamLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04", // <input type="datetime-local">
+}
+
+// parseTimeParam 解析时间参数，只有日期时 end 为 true 表示取当天结束（次日零点）
+func parseTimeParam(field, value string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeParamLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, &ValidationError{
+		Field:   field,
+		Message: fmt.Sprintf("无效的时间: %s（应为 2006-01-02、2006-01-02 15:04:05 或 RFC3339 格式）", value),
+	}
+}
+
+// ValidateTimeRange 验证时间范围参数
+//
+// 参数:
+//   - from: 起始时间（含），为空表示不限
+//   - to: 结束时间（不含），为空表示不限；只有日期时包含当天
+//
+// 返回:
+//   - start, end: 解析后的时间，未指定时为零值
+//   - error: 验证失败时返回 ValidationError
+func ValidateTimeRange(from, to string) (start, end time.Time, err error) {
+	if from != "" {
+		if start, err = parseTimeParam("from", from, false); err != nil {
+			return
+		}
+	}
+	if to != "" {
+		if end, err = parseTimeParam("to", to, true); err != nil {
+			return
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		err = &ValidationError{Field: "to", Message: "结束时间必须晚于起始时间"}
+	}
+	return
+}
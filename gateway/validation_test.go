@@ -3,6 +3,7 @@ package gateway
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 // ========== ValidateSubmitParams 测试 ==========
@@ -499,6 +500,59 @@ func TestValidatePageParam_InvalidParams(t *testing.T) {
 	}
 }
 
+func TestValidateTimeRange(t *testing.T) {
+	start, end, err := ValidateTimeRange("2026-03-01", "2026-03-02")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local); !start.Equal(want) {
+		t.Errorf("start = %v, want %v", start, want)
+	}
+	// 只有日期的结束时间包含当天
+	if want := time.Date(2026, 3, 3, 0, 0, 0, 0, time.Local); !end.Equal(want) {
+		t.Errorf("end = %v, want %v", end, want)
+	}
+
+	_, end, err = ValidateTimeRange("", "2026-03-01T08:30")
+	if err != nil || !end.Equal(time.Date(2026, 3, 1, 8, 30, 0, 0, time.Local)) {
+		t.Errorf("datetime-local end = %v, err %v", end, err)
+	}
+	if start, end, err := ValidateTimeRange("", ""); err != nil || !start.IsZero() || !end.IsZero() {
+		t.Errorf("Empty range should be unbounded, got %v %v %v", start, end, err)
+	}
+
+	for _, tc := range [][2]string{{"2026-13-01", ""}, {"", "tomorrow"}, {"2026-03-02 10:00:00", "2026-03-02 10:00:00"}} {
+		if _, _, err := ValidateTimeRange(tc[0], tc[1]); err == nil {
+			t.Errorf("%v: expected error", tc)
+		} else if _, ok := err.(*ValidationError); !ok {
+			t.Errorf("%v: expected ValidationError, got %T", tc, err)
+		}
+	}
+}
+
+func TestValidateStatusFilters(t *testing.T) {
+	for _, v := range []string{"", "0", "8", "4294967295"} {
+		if err := ValidateSubmitResult(v); err != nil {
+			t.Errorf("ValidateSubmitResult(%q): unexpected error %v", v, err)
+		}
+	}
+	for _, v := range []string{"-1", "abc", "4294967296"} {
+		if err := ValidateSubmitResult(v); err == nil {
+			t.Errorf("ValidateSubmitResult(%q): expected error", v)
+		}
+	}
+	for _, v := range []string{"", "DELIVRD", "undeliv", "MA:0001"} {
+		if err := ValidateDeliveryStat(v); err != nil {
+			t.Errorf("ValidateDeliveryStat(%q): unexpected error %v", v, err)
+		}
+	}
+	for _, v := range []string{"DELIVERED", "A B", "<x>"} {
+		if err := ValidateDeliveryStat(v); err == nil {
+			t.Errorf("ValidateDeliveryStat(%q): expected error", v)
+		}
+	}
+}
+
 // ========== 性能基准测试 ==========
 
 func BenchmarkValidateSubmitParams_Success(b *testing.B) {
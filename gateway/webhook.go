@@ -0,0 +1,346 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// 检查待投递记录的间隔
+	webhookPollInterval = time.Second
+	// 每次最多取出的到期记录数量
+	webhookBatchSize = 100
+	// 单次请求超时
+	webhookTimeout = 10 * time.Second
+	// 同时进行的投递数量
+	webhookWorkers = 4
+	// 默认最多投递次数
+	defaultWebhookMaxAttempts = 10
+	// 重试间隔从 webhookBackoffBase 开始逐次翻倍，最长 webhookBackoffMax
+	webhookBackoffBase = 10 * time.Second
+	webhookBackoffMax  = time.Hour
+)
+
+// Webhook 事件类型
+const (
+	webhookEventMO      = "mo"
+	webhookEventReceipt = "receipt"
+)
+
+// Webhook 投递状态
+const (
+	webhookPending = "pending" // 等待投递或重试
+	webhookFailed  = "failed"  // 超过最多投递次数，等待人工重新投递
+)
+
+// WebhookDelivery 是持久化在存储中的 Webhook 投递记录，投递成功后删除
+type WebhookDelivery struct {
+	Id          string
+	Event       string
+	Client      string // 消息所属客户端，用于选择签名密钥
+	URL         string
+	Payload     json.RawMessage
+	Status      string
+	Attempts    int
+	LastError   string
+	Created     time.Time
+	NextAttempt time.Time
+	Revision    int64 // 每次保存递增，用于检测并发修改
+}
+
+// webhookPayload 是 POST 到 Webhook 地址的请求体
+type webhookPayload struct {
+	Id      string     `json:"id"` // 投递标识，重试时不变，可用于去重
+	Event   string     `json:"event"`
+	Created time.Time  `json:"created"`
+	Message apiMessage `json:"message"`
+}
+
+// sortWebhooks 按创建时间排序
+func sortWebhooks(list []WebhookDelivery) {
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+}
+
+// webhookBackoff 返回第 attempts 次失败后的重试间隔
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookBackoffBase
+	for i := 1; i < attempts && d < webhookBackoffMax; i++ {
+		d *= 2
+	}
+	if d > webhookBackoffMax {
+		d = webhookBackoffMax
+	}
+	return d
+}
+
+// webhookTarget 返回客户端的推送地址，未单独配置时使用全局地址
+func webhookTarget(cfg *Config, client string) string {
+	for _, c := range cfg.APIClients {
+		if c.Name == client && c.WebhookURL != "" {
+			return c.WebhookURL
+		}
+	}
+	return cfg.WebhookURL
+}
+
+// webhookSecret 返回签名密钥，客户端配置了 secret 时优先使用
+func webhookSecret(cfg *Config, client string) string {
+	for _, c := range cfg.APIClients {
+		if c.Name == client && c.Secret != "" {
+			return c.Secret
+		}
+	}
+	return cfg.WebhookSecret
+}
+
+// hasWebhooks 检查是否配置了任何推送地址
+func hasWebhooks(cfg *Config) bool {
+	if cfg.WebhookURL != "" {
+		return true
+	}
+	for _, c := range cfg.APIClients {
+		if c.WebhookURL != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDispatcher 将上行短信与状态报告推送到 Webhook 地址
+//
+// 事件先写入存储中的发件箱，再由后台协程投递；失败按指数退避重试，
+// 超过最多次数后标记为失败，可在管理界面重新投递
+type WebhookDispatcher struct {
+	cfg    *Config
+	client *http.Client
+
+	mu       sync.Mutex
+	inflight map[string]bool // 正在投递的记录，避免重复投递
+
+	wake     chan struct{}
+	shutdown chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewWebhookDispatcher 创建 Webhook 投递器
+func NewWebhookDispatcher(cfg *Config) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: webhookTimeout},
+		inflight: make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Start 注册为消息观察者并启动投递协程，重启前未完成的记录会继续投递
+func (d *WebhookDispatcher) Start() {
+	addObserver(d)
+	Infof("[WEBHOOK] Dispatcher started")
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.run()
+	}()
+}
+
+// Stop 停止投递（可重复调用），未完成的记录保留在发件箱中
+func (d *WebhookDispatcher) Stop() {
+	d.once.Do(func() {
+		removeObserver(d)
+		close(d.shutdown)
+		d.wg.Wait()
+	})
+}
+
+func (d *WebhookDispatcher) submitDone(mes SmsMes) {}
+
+func (d *WebhookDispatcher) moDone(mes SmsMes) {
+	d.enqueue(webhookEventMO, &mes, "list_mo")
+}
+
+// receiptDone 推送状态报告对应的完整下发记录
+func (d *WebhookDispatcher) receiptDone(receipt, mes SmsMes) {
+	d.enqueue(webhookEventReceipt, &mes, "list_message")
+}
+
+// enqueue 将事件写入发件箱并唤醒投递协程
+func (d *WebhookDispatcher) enqueue(event string, mes *SmsMes, listName string) {
+	target := webhookTarget(d.cfg, mes.Client)
+	if target == "" {
+		return
+	}
+	now := time.Now()
+	id := newMessageId()
+	payload, err := json.Marshal(webhookPayload{Id: id, Event: event, Created: now, Message: newAPIMessage(mes, listName)})
+	if err != nil {
+		Errorf("[WEBHOOK] Failed to encode %s event: %v", event, err)
+		return
+	}
+	delivery := &WebhookDelivery{
+		Id:          id,
+		Event:       event,
+		Client:      mes.Client,
+		URL:         target,
+		Payload:     payload,
+		Status:      webhookPending,
+		Created:     now,
+		NextAttempt: now,
+	}
+	if err := SCache.SaveWebhook(delivery); err != nil {
+		Errorf("[WEBHOOK] Failed to save %s event for %s: %v", event, mes.Dest, err)
+		return
+	}
+	d.notify()
+}
+
+func (d *WebhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *WebhookDispatcher) run() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	sem := make(chan struct{}, webhookWorkers)
+	for {
+		select {
+		case <-d.shutdown:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+
+		for _, delivery := range SCache.DueWebhooks(time.Now(), webhookBatchSize) {
+			if !d.claim(delivery.Id) {
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-d.shutdown:
+				d.release(delivery.Id)
+				return
+			}
+			d.wg.Add(1)
+			go func(delivery WebhookDelivery) {
+				defer d.wg.Done()
+				defer func() { <-sem }()
+				defer d.release(delivery.Id)
+				d.deliver(&delivery)
+			}(delivery)
+		}
+	}
+}
+
+func (d *WebhookDispatcher) claim(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.inflight[id] {
+		return false
+	}
+	d.inflight[id] = true
+	return true
+}
+
+func (d *WebhookDispatcher) release(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inflight, id)
+}
+
+// deliver 投递一次，成功时删除记录，失败时安排重试或标记为失败
+//
+// 投递期间记录可能被重新投递（RedeliverWebhook）修改，失败时按 Revision 更新，
+// 记录已被修改则保留修改后的版本
+func (d *WebhookDispatcher) deliver(delivery *WebhookDelivery) {
+	err := d.post(delivery)
+	if err == nil {
+		Debugf("[WEBHOOK] Delivered %s event %s to %s", delivery.Event, delivery.Id, delivery.URL)
+		if err := SCache.DeleteWebhook(delivery.Id); err != nil {
+			Warnf("[WEBHOOK] Failed to remove delivered event %s: %v", delivery.Id, err)
+		}
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	maxAttempts := d.cfg.WebhookMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultWebhookMaxAttempts
+	}
+	if delivery.Attempts >= maxAttempts {
+		delivery.Status = webhookFailed
+		Warnf("[WEBHOOK] Giving up %s event %s to %s after %d attempts: %v", delivery.Event, delivery.Id, delivery.URL, delivery.Attempts, err)
+	} else {
+		delivery.NextAttempt = time.Now().Add(webhookBackoff(delivery.Attempts))
+		Infof("[WEBHOOK] Delivery of %s event %s failed (attempt %d), retry at %s: %v",
+			delivery.Event, delivery.Id, delivery.Attempts, delivery.NextAttempt.Format(time.RFC3339), err)
+	}
+	ok, err := SCache.UpdateWebhook(delivery)
+	if err != nil {
+		Errorf("[WEBHOOK] Failed to update event %s: %v", delivery.Id, err)
+	} else if !ok {
+		Infof("[WEBHOOK] Event %s was changed during delivery, keeping the newer record", delivery.Id)
+	}
+}
+
+// post 发送请求，签名方式与 requireSignature 校验的请求签名相同，X-Nonce 为投递标识
+func (d *WebhookDispatcher) post(delivery *WebhookDelivery) error {
+	u, err := url.Parse(delivery.URL)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	if secret := webhookSecret(d.cfg, delivery.Client); secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Timestamp", ts)
+		req.Header.Set("X-Nonce", delivery.Id)
+		req.Header.Set("X-Signature", SignRequest(secret, http.MethodPost, u.RequestURI(), ts, delivery.Id, delivery.Payload))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// RedeliverWebhook 将投递记录重置为待投递，立即重新投递
+func RedeliverWebhook(id string) error {
+	delivery, ok := SCache.GetWebhook(id)
+	if !ok {
+		return fmt.Errorf("投递记录 %s 不存在", id)
+	}
+	delivery.Status = webhookPending
+	delivery.Attempts = 0
+	delivery.NextAttempt = time.Now()
+	ok, err := SCache.UpdateWebhook(&delivery)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("投递记录 %s 已被修改或删除，请刷新后重试", id)
+	}
+	return nil
+}
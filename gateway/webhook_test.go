@@ -0,0 +1,229 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookReceiver 记录收到的推送，fail 为 true 时返回 500
+type webhookReceiver struct {
+	mu       sync.Mutex
+	payloads []webhookPayload
+	headers  []http.Header
+	bodies   [][]byte
+	fail     atomic.Bool
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if wr.fail.Load() {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var p webhookPayload
+	json.Unmarshal(body, &p)
+	wr.mu.Lock()
+	wr.payloads = append(wr.payloads, p)
+	wr.headers = append(wr.headers, r.Header.Clone())
+	wr.bodies = append(wr.bodies, body)
+	wr.mu.Unlock()
+}
+
+func (wr *webhookReceiver) count() int {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	return len(wr.payloads)
+}
+
+func startTestWebhooks(t *testing.T, cfg *Config) *WebhookDispatcher {
+	t.Helper()
+	oldConfig := config
+	config = cfg
+	d := NewWebhookDispatcher(cfg)
+	d.Start()
+	t.Cleanup(func() {
+		d.Stop()
+		config = oldConfig
+	})
+	return d
+}
+
+func TestWebhookDeliversMOAndReceipt(t *testing.T) {
+	newTestBoltCache(t)
+	global, acme := &webhookReceiver{}, &webhookReceiver{}
+	globalSrv, acmeSrv := httptest.NewServer(global), httptest.NewServer(acme)
+	defer globalSrv.Close()
+	defer acmeSrv.Close()
+
+	startTestWebhooks(t, &Config{
+		SmsAccessNo:   "10659",
+		WebhookURL:    globalSrv.URL + "/hook",
+		WebhookSecret: "global-secret",
+		APIClients: []APIClient{
+			{Name: "acme", Key: "k", ExtCodeMin: "100", ExtCodeMax: "199", Secret: "acme-secret", WebhookURL: acmeSrv.URL + "/acme?x=1"},
+		},
+	})
+
+	p := newMessagePipeline(ChannelCMPP)
+	p.moReceived(SmsMes{Src: "13800000000", Dest: "10659123", Content: "TD"})
+	p.moReceived(SmsMes{Src: "13900000000", Dest: "10659", Content: "hi"})
+	mes := SmsMes{Id: "m1", Client: "acme", Dest: "13700000000", Content: "code", SubmitResult: 65535, DelivleryResult: 65535}
+	p.addPending(1, 1, &mes)
+	p.submitResponded(1, 1, "777", 0)
+	p.receiptReceived(SmsMes{MsgId: "777", DelivleryResult: 0, DeliveryStat: "DELIVRD"})
+
+	waitFor(t, "webhook deliveries", func() bool { return global.count() == 1 && acme.count() == 2 })
+	if p := global.payloads[0]; p.Event != webhookEventMO || p.Message.Content != "hi" {
+		t.Errorf("Unexpected global payload: %+v", p)
+	}
+	var gotMO, gotReceipt bool
+	for i, p := range acme.payloads {
+		h := acme.headers[i]
+		want := SignRequest("acme-secret", "POST", "/acme?x=1", h.Get("X-Timestamp"), h.Get("X-Nonce"), acme.bodies[i])
+		if h.Get("X-Signature") != want || h.Get("X-Nonce") != p.Id || h.Get("X-Webhook-Event") != p.Event {
+			t.Errorf("Unexpected headers for %s: %v", p.Event, h)
+		}
+		switch p.Event {
+		case webhookEventMO:
+			gotMO = p.Message.Content == "TD" && p.Message.Status == "received"
+		case webhookEventReceipt:
+			gotReceipt = p.Message.Id == "m1" && p.Message.Status == "delivered" && p.Message.DeliveryStat == "DELIVRD"
+		}
+	}
+	if !gotMO || !gotReceipt {
+		t.Errorf("Unexpected acme payloads: %+v", acme.payloads)
+	}
+	waitFor(t, "outbox to drain", func() bool { return len(SCache.ListWebhooks()) == 0 })
+}
+
+func TestWebhookFailureAndRedeliver(t *testing.T) {
+	newTestBoltCache(t)
+	recv := &webhookReceiver{}
+	recv.fail.Store(true)
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	d := startTestWebhooks(t, &Config{WebhookURL: srv.URL, WebhookMaxAttempts: 1})
+	newMessagePipeline(ChannelCMPP).moReceived(SmsMes{Src: "13800000000", Dest: "10659", Content: "hi"})
+
+	var failed WebhookDelivery
+	waitFor(t, "delivery to fail", func() bool {
+		list := SCache.ListWebhooks()
+		if len(list) == 1 && list[0].Status == webhookFailed {
+			failed = list[0]
+			return true
+		}
+		return false
+	})
+	if failed.Attempts != 1 || failed.LastError != "HTTP 500" {
+		t.Errorf("Unexpected failed delivery: %+v", failed)
+	}
+
+	// 管理界面重新投递
+	recv.fail.Store(false)
+	req := httptest.NewRequest("POST", "/webhook/redeliver?id="+failed.Id, nil)
+	rec := httptest.NewRecorder()
+	redeliverWebhook(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect, got %d", rec.Code)
+	}
+	d.notify()
+	waitFor(t, "redelivery", func() bool { return recv.count() == 1 && len(SCache.ListWebhooks()) == 0 })
+	if recv.payloads[0].Id != failed.Id || recv.headers[0].Get("X-Signature") != "" {
+		t.Errorf("Unexpected redelivered payload: %+v %v", recv.payloads[0], recv.headers[0])
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		5:  160 * time.Second,
+		9:  2560 * time.Second,
+		10: time.Hour,
+		20: time.Hour,
+	} {
+		if got := webhookBackoff(attempts); got != want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestBoltCacheWebhookOutbox(t *testing.T) {
+	cache := newTestBoltCache(t)
+	now := time.Now()
+	due := &WebhookDelivery{Id: "due", Status: webhookPending, Created: now, NextAttempt: now.Add(-time.Minute)}
+	later := &WebhookDelivery{Id: "later", Status: webhookPending, Created: now, NextAttempt: now.Add(time.Minute)}
+	failed := &WebhookDelivery{Id: "failed", Status: webhookFailed, Created: now, NextAttempt: now.Add(-time.Hour)}
+	for _, d := range []*WebhookDelivery{due, later, failed} {
+		if err := cache.SaveWebhook(d); err != nil || d.Revision != 1 {
+			t.Fatalf("SaveWebhook(%s) = %v, revision %d", d.Id, err, d.Revision)
+		}
+	}
+
+	// 只取到期的待投递记录，失败的记录不参与轮询
+	if list := cache.DueWebhooks(now, 10); len(list) != 1 || list[0].Id != "due" {
+		t.Errorf("Unexpected due webhooks %+v", list)
+	}
+	if n := len(cache.ListWebhooks()); n != 3 {
+		t.Errorf("Expected 3 webhooks, got %d", n)
+	}
+
+	// 按 Revision 更新，过期的快照不能覆盖新的记录
+	stale := *later
+	later.NextAttempt = now.Add(-time.Second)
+	if ok, err := cache.UpdateWebhook(later); !ok || err != nil || later.Revision != 2 {
+		t.Fatalf("UpdateWebhook failed: %v %v", ok, err)
+	}
+	stale.Status = webhookFailed
+	if ok, _ := cache.UpdateWebhook(&stale); ok {
+		t.Error("Stale update should be rejected")
+	}
+	if list := cache.DueWebhooks(now, 10); len(list) != 2 || list[0].Id != "due" || list[1].Id != "later" {
+		t.Errorf("Rescheduled webhook should be due, got %+v", list)
+	}
+	if list := cache.DueWebhooks(now, 1); len(list) != 1 {
+		t.Errorf("Expected limit to apply, got %+v", list)
+	}
+
+	cache.DeleteWebhook("due")
+	if _, ok := cache.GetWebhook("due"); ok {
+		t.Error("Deleted webhook should be gone")
+	}
+	if list := cache.DueWebhooks(now, 10); len(list) != 1 || list[0].Id != "later" {
+		t.Errorf("Deleted webhook should leave the due index, got %+v", list)
+	}
+	if d, ok := cache.GetWebhook("failed"); !ok || d.Status != webhookFailed {
+		t.Errorf("Failed webhook should be kept, got %+v", d)
+	}
+}
+
+func TestWebhookDeliverKeepsConcurrentRedeliver(t *testing.T) {
+	newTestBoltCache(t)
+	recv := &webhookReceiver{}
+	recv.fail.Store(true)
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	d := NewWebhookDispatcher(&Config{WebhookMaxAttempts: 1})
+	delivery := &WebhookDelivery{Id: "w1", URL: srv.URL, Status: webhookFailed, Attempts: 1, Created: time.Now(), NextAttempt: time.Now()}
+	SCache.SaveWebhook(delivery)
+
+	// 投递开始后管理界面重新投递了同一条记录
+	snapshot := *delivery
+	if err := RedeliverWebhook("w1"); err != nil {
+		t.Fatalf("RedeliverWebhook failed: %v", err)
+	}
+	d.deliver(&snapshot)
+
+	got, ok := SCache.GetWebhook("w1")
+	if !ok || got.Status != webhookPending || got.Attempts != 0 {
+		t.Errorf("Redelivery should not be overwritten by the failed attempt, got %+v", got)
+	}
+}
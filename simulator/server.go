@@ -116,6 +116,13 @@ func (h *TerminateHandler) ServeCmpp(r *cmpp.Response, p *cmpp.Packet, l *log.Lo
 func main() {
 	// Parse command line flags
 	flag.IntVar(&maxDelay, "delay", 3, "Maximum delay in seconds for submit response (1-30, default: 3)")
+	flag.StringVar(&tlsAddr, "tls-addr", "", "Also accept TLS connections on this address, e.g. 127.0.0.1:7892")
+	flag.StringVar(&tlsCertFile, "tls-cert", "", "Server certificate for TLS mode (PEM, self-signed if empty)")
+	flag.StringVar(&tlsKeyFile, "tls-key", "", "Server private key for TLS mode (PEM)")
+	flag.StringVar(&tlsClientCA, "tls-client-ca", "", "CA file used to verify client certificates (enables mutual TLS)")
+	flag.StringVar(&tlsCAOut, "tls-ca-out", "simulator-ca.pem", "Where to write the self-signed certificate")
+	flag.StringVar(&smgpAddr, "smgp-addr", "", "Also accept SMGP 3.0 connections on this address, e.g. 127.0.0.1:8890")
+	flag.BoolVar(&smgpReport, "smgp-report", true, "Push a DELIVRD status report after each SMGP submit")
 	flag.Parse()
 
 	// Validate delay parameter
@@ -147,6 +154,18 @@ func main() {
 	log.Printf("Protocol: CMPP 3.0")
 	log.Printf("Heartbeat interval: %v", t)
 	log.Printf("Submit delay: 1s - %ds (random)", maxDelay)
+	if tlsAddr != "" {
+		if err := startTLSProxy(addr); err != nil {
+			log.Fatalf("TLS listener error: %v", err)
+		}
+		log.Printf("TLS listening on: %s (mutual TLS: %v)", tlsAddr, tlsClientCA != "")
+	}
+	if smgpAddr != "" {
+		if err := startSMGPServer(); err != nil {
+			log.Fatalf("SMGP listener error: %v", err)
+		}
+		log.Printf("SMGP 3.0 listening on: %s (status reports: %v)", smgpAddr, smgpReport)
+	}
 	log.Printf("==========================================")
 	log.Printf("Ready to accept connections...")
 	log.Printf("")
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JoeCao/cmpp-gateway/gateway"
+	cmpp "github.com/bigwhite/gocmpp"
+)
+
+// SMGP listener options (configurable via command line)
+var (
+	smgpAddr   string // SMGP listen address, empty disables SMGP mode
+	smgpReport bool   // Push a status report after each submit
+)
+
+// smgpSession is one SMGP client connection
+type smgpSession struct {
+	conn net.Conn
+	seq  atomic.Uint32
+	wmu  sync.Mutex
+}
+
+func (s *smgpSession) send(p cmpp.Packer, seq uint32) error {
+	data, err := p.Pack(seq)
+	if err != nil {
+		return err
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	_, err = s.conn.Write(data)
+	return err
+}
+
+// recv reads one packet and decodes it with the gateway's SMGP codec
+func (s *smgpSession) recv() (cmpp.Packer, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(s.conn, header[:]); err != nil {
+		return nil, err
+	}
+	totalLen := binary.BigEndian.Uint32(header[:4])
+	if totalLen < gateway.SmgpHeaderLen || totalLen > gateway.SmgpPacketMax {
+		return nil, fmt.Errorf("invalid packet length %d", totalLen)
+	}
+	body := make([]byte, totalLen-8)
+	if _, err := io.ReadFull(s.conn, body); err != nil {
+		return nil, err
+	}
+	p, err := gateway.NewSMGPPacket(binary.BigEndian.Uint32(header[4:]))
+	if err != nil {
+		return nil, err
+	}
+	return p, p.Unpack(body)
+}
+
+// startSMGPServer accepts SMGP 3.0 clients on smgpAddr
+func startSMGPServer() error {
+	ln, err := net.Listen("tcp", smgpAddr)
+	if err != nil {
+		return err
+	}
+	var msgIdCounter atomic.Uint32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Printf("[SMGP] Accept error: %v", err)
+				return
+			}
+			go serveSMGP(&smgpSession{conn: conn}, &msgIdCounter)
+		}
+	}()
+	return nil
+}
+
+func serveSMGP(s *smgpSession, counter *atomic.Uint32) {
+	defer s.conn.Close()
+	log.Printf("[SMGP] Client connected from %s", s.conn.RemoteAddr())
+
+	for {
+		pkt, err := s.recv()
+		if err != nil {
+			log.Printf("[SMGP] Connection closed: %v", err)
+			return
+		}
+
+		switch req := pkt.(type) {
+		case *gateway.SmgpLoginReqPkt:
+			// Accept all logins, like the CMPP simulator
+			log.Printf("[SMGP][Login] ClientID=%s LoginMode=%d accepted", req.ClientID, req.LoginMode)
+			s.send(&gateway.SmgpLoginRspPkt{AuthenticatorServer: "simulator", ServerVersion: gateway.SmgpVersion}, req.SeqId)
+
+		case *gateway.SmgpSubmitReqPkt:
+			log.Printf("[SMGP][Submit] SrcTermID=%s DestTermID=%v MsgFormat=%d Content=%q",
+				req.SrcTermID, req.DestTermID, req.MsgFormat, req.MsgContent)
+			go func(req *gateway.SmgpSubmitReqPkt) {
+				delay := time.Duration(1000+rand.Intn(maxDelay*1000)) * time.Millisecond
+				time.Sleep(delay)
+
+				msgId := newSMGPMsgId(counter.Add(1))
+				s.send(&gateway.SmgpSubmitRspPkt{MsgId: msgId}, req.SeqId)
+				log.Printf("[SMGP][Submit] Response: MsgID=%s, Status=0 (success)", msgId)
+
+				if smgpReport && req.NeedReport == 1 && len(req.DestTermID) > 0 {
+					sendSMGPReport(s, msgId, req)
+				}
+			}(req)
+
+		case *gateway.SmgpDeliverRspPkt:
+			log.Printf("[SMGP][Deliver] Response: MsgID=%s Status=%d", req.MsgId, req.Status)
+
+		case *gateway.SmgpEmptyPkt:
+			switch req.RequestID {
+			case gateway.SMGP_ACTIVE_TEST:
+				log.Println("[SMGP][Heartbeat] Active test request received, responding...")
+				s.send(&gateway.SmgpEmptyPkt{RequestID: gateway.SMGP_ACTIVE_TEST_RESP}, req.SeqId)
+			case gateway.SMGP_EXIT:
+				log.Println("[SMGP][Exit] Client requested to close connection")
+				s.send(&gateway.SmgpEmptyPkt{RequestID: gateway.SMGP_EXIT_RESP}, req.SeqId)
+				return
+			}
+		}
+	}
+}
+
+// newSMGPMsgId builds a 10-byte MsgID: SMGW code(3) + MMDDHHMM(4) + sequence(3), all BCD
+func newSMGPMsgId(n uint32) gateway.SmgpMsgId {
+	var id gateway.SmgpMsgId
+	digits := fmt.Sprintf("000001%s%06d", time.Now().Format("01021504"), n%1000000)
+	for i := range id {
+		id[i] = (digits[2*i]-'0')<<4 | (digits[2*i+1] - '0')
+	}
+	return id
+}
+
+// sendSMGPReport pushes a DELIVRD status report for a submitted message
+func sendSMGPReport(s *smgpSession, msgId gateway.SmgpMsgId, req *gateway.SmgpSubmitReqPkt) {
+	now := time.Now().Format("0601021504")
+	report := &gateway.SmgpReport{
+		MsgId: msgId, Sub: "001", Dlvrd: "001",
+		SubmitDate: now, DoneDate: now, Stat: "DELIVRD", Err: "000",
+	}
+	deliver := &gateway.SmgpDeliverReqPkt{
+		MsgId:      newSMGPMsgId(uint32(rand.Intn(1000000))),
+		IsReport:   1,
+		RecvTime:   time.Now().Format("20060102150405"),
+		SrcTermID:  req.DestTermID[0],
+		DestTermID: req.SrcTermID,
+		MsgContent: report.Bytes(),
+	}
+	if err := s.send(deliver, s.seq.Add(1)); err != nil {
+		log.Printf("[SMGP][Report] Failed to send report: %v", err)
+		return
+	}
+	log.Printf("[SMGP][Report] Sent report for MsgID=%s: %s", msgId, bytes.TrimRight(report.Bytes()[13:], " "))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// TLS listener options (configurable via command line)
+var (
+	tlsAddr     string // TLS listen address, empty disables TLS mode
+	tlsCertFile string // Server certificate (PEM)
+	tlsKeyFile  string // Server private key (PEM)
+	tlsClientCA string // CA used to verify client certificates (enables mTLS)
+	tlsCAOut    string // Where to write the self-signed certificate when no cert is given
+)
+
+// startTLSProxy terminates TLS on tlsAddr and forwards the plain CMPP stream to
+// the local simulator listener, the same way stunnel would sit in front of an ISMG.
+// gocmpp's server only accepts *net.TCPConn, so TLS cannot be served directly.
+func startTLSProxy(backend string) error {
+	cfg, err := serverTLSConfig()
+	if err != nil {
+		return err
+	}
+	ln, err := tls.Listen("tcp", tlsAddr, cfg)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Printf("[TLS] Accept error: %v", err)
+				return
+			}
+			go proxyConn(conn, backend)
+		}
+	}()
+	return nil
+}
+
+func proxyConn(client net.Conn, backend string) {
+	defer client.Close()
+
+	// Complete the handshake up front so certificate errors are logged here
+	if tc, ok := client.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			log.Printf("[TLS] Handshake with %s failed: %v", client.RemoteAddr(), err)
+			return
+		}
+		state := tc.ConnectionState()
+		if len(state.PeerCertificates) > 0 {
+			log.Printf("[TLS] Client %s authenticated as %q", client.RemoteAddr(), state.PeerCertificates[0].Subject.CommonName)
+		} else {
+			log.Printf("[TLS] Client %s connected", client.RemoteAddr())
+		}
+	}
+
+	server, err := net.Dial("tcp", backend)
+	if err != nil {
+		log.Printf("[TLS] Dial backend %s failed: %v", backend, err)
+		return
+	}
+	defer server.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(server, client)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, server)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func serverTLSConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	if tlsCertFile != "" {
+		cert, err = tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load server certificate: %w", err)
+		}
+	} else {
+		cert, err = selfSignedCert(tlsCAOut)
+		if err != nil {
+			return nil, fmt.Errorf("generate self-signed certificate: %w", err)
+		}
+		log.Printf("[TLS] Using self-signed certificate, written to %s (use it as cmpp_tls_ca_file)", tlsCAOut)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if tlsClientCA != "" {
+		pem, err := os.ReadFile(tlsClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", tlsClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// selfSignedCert creates a certificate valid for localhost/127.0.0.1 and writes it to caOut
+func selfSignedCert(caOut string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "cmpp-simulator"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := os.WriteFile(caOut, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}